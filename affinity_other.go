@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// pinThread pins the calling OS thread to a CPU, only supported on Linux.
+func pinThread(cpu int) error {
+	return fmt.Errorf("thread pinning is not supported on this platform")
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerFeature("control-api")
+}
+
+// serveAPI starts the control API on addr.
+// routes maps the path prefix of the control namespace to its run,
+// "" for the root namespace.
+func serveAPI(addr string, routes map[string]*run) {
+	mux := http.NewServeMux()
+	for prefix, r := range routes {
+		r.registerAPI(mux, prefix)
+	}
+	mux.HandleFunc("/watchdog", handleWatchdog)
+	mux.HandleFunc("/version", handleVersion)
+	mux.HandleFunc("/capabilities", handleCapabilities)
+
+	go func() {
+		log.Printf("control api listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("failed to serve control api, %v", err)
+		}
+	}()
+}
+
+func (r *run) registerAPI(mux *http.ServeMux, prefix string) {
+	mux.HandleFunc(prefix+"/thresholds", r.handleThresholds)
+	mux.HandleFunc(prefix+"/sessions", r.handleSessions)
+	mux.HandleFunc(prefix+"/sessions/concurrency", r.handleConcurrency)
+	mux.HandleFunc(prefix+"/sessions/snapshot", r.handleSnapshot)
+	mux.HandleFunc(prefix+"/sessions/diff", r.handleSnapshotDiff)
+	mux.HandleFunc(prefix+"/latency", r.handleLatency)
+	mux.HandleFunc(prefix+"/errors", r.handleErrors)
+	mux.HandleFunc(prefix+"/dashboard", handleDashboard)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// handleThresholds returns the current thresholds on GET,
+// and updates them on PUT/POST. Omitted fields are left unchanged.
+func (r *run) handleThresholds(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, r.getThresholds())
+
+	case http.MethodPut, http.MethodPost:
+		t := r.getThresholds()
+		if err := json.NewDecoder(req.Body).Decode(&t); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := t.validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		r.setThresholds(t)
+		r.logger.Printf("thresholds changed, delayTimeout: %v, lossThreshold: %d, maxGOP: %v, "+
+			"minBitrate: %v, maxBitrate: %v",
+			t.DelayTimeout, t.LossThreshold, t.MaxGOP, t.MinBitrate, t.MaxBitrate)
+		writeJSON(w, http.StatusOK, t)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// sessionInfo is a running session with its live stats.
+type sessionInfo struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Class      string    `json:"class"`
+	State      string    `json:"state"`
+	StateSince time.Time `json:"stateSince"`
+	Packets    uint64    `json:"packets"`
+	Bytes      uint64    `json:"bytes"`
+	Lost       int64     `json:"lost"`
+	Bitrate    bitrate   `json:"bitrate"`
+}
+
+// sessionInfos returns the running sessions with their live stats.
+func (r *run) sessionInfos() []sessionInfo {
+	l := []sessionInfo{}
+	for _, s := range r.sessions.list() {
+		ss := s.snapshot()
+		info := sessionInfo{
+			ID:         ss.ID,
+			URL:        ss.URL,
+			Class:      ss.Class,
+			State:      ss.State,
+			StateSince: ss.StateSince,
+			Packets:    ss.Packets,
+			Bytes:      ss.Bytes,
+			Bitrate:    ss.Bitrate.Current,
+		}
+		for _, t := range ss.Tracks {
+			info.Lost += t.Lost
+		}
+		l = append(l, info)
+	}
+	return l
+}
+
+// handleSessions lists the running sessions on GET,
+// adds sessions on POST {"url": "...", "count": n}, the url of the run if url is omitted,
+// and tears down the session given by the id parameter on DELETE.
+func (r *run) handleSessions(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, r.sessionInfos())
+
+	case http.MethodPost:
+		body := struct {
+			URL   string `json:"url"`
+			Count int    `json:"count"`
+		}{Count: 1}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.Count < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("count should be at least 1"))
+			return
+		}
+		if strings.Contains(body.URL, "{NUM}") {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("url should not contain {NUM}"))
+			return
+		}
+		ids := r.addSessions(body.URL, body.Count)
+		r.logger.Printf("%d sessions added by the control api", len(ids))
+		writeJSON(w, http.StatusCreated, map[string][]string{"added": ids})
+
+	case http.MethodDelete:
+		s := r.lookupSession(w, req)
+		if s == nil {
+			return
+		}
+		s.teardown()
+		writeJSON(w, http.StatusOK, map[string][]string{"tornDown": {s.id}})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleConcurrency returns the number of running sessions on GET,
+// and adds or tears down sessions to reach the target on PUT/POST {"target": n, "url": "..."},
+// the added sessions use the url of the run if url is omitted.
+func (r *run) handleConcurrency(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]int{"running": r.totals().Sessions})
+
+	case http.MethodPut, http.MethodPost:
+		var body struct {
+			Target *int   `json:"target"`
+			URL    string `json:"url"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.Target == nil || *body.Target < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("target should be given and not negative"))
+			return
+		}
+		if strings.Contains(body.URL, "{NUM}") {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("url should not contain {NUM}"))
+			return
+		}
+		added, tornDown := r.setConcurrency(*body.Target, body.URL)
+		r.logger.Printf("concurrency changed to %d by the control api, %d added, %d torn down",
+			*body.Target, len(added), len(tornDown))
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"target":   *body.Target,
+			"added":    append([]string{}, added...),
+			"tornDown": append([]string{}, tornDown...),
+		})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *run) lookupSession(w http.ResponseWriter, req *http.Request) *session {
+	id := req.URL.Query().Get("id")
+	s := r.sessions.get(id)
+	if s == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("session not found, %s", id))
+	}
+	return s
+}
+
+// handleSnapshot dumps the internal state of the session given by the id parameter.
+func (r *run) handleSnapshot(w http.ResponseWriter, req *http.Request) {
+	s := r.lookupSession(w, req)
+	if s == nil {
+		return
+	}
+	cur, _ := r.sessions.takeSnapshot(s)
+	writeJSON(w, http.StatusOK, cur)
+}
+
+// handleSnapshotDiff takes a new snapshot of the session given by the id parameter,
+// and returns the fields changed since the previous snapshot.
+func (r *run) handleSnapshotDiff(w http.ResponseWriter, req *http.Request) {
+	s := r.lookupSession(w, req)
+	if s == nil {
+		return
+	}
+	cur, prev := r.sessions.takeSnapshot(s)
+	if prev == nil {
+		writeError(w, http.StatusConflict, fmt.Errorf("no previous snapshot, %s", s.id))
+		return
+	}
+	changes, err := diffSnapshots(prev, cur)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"from":    prev.Time,
+		"to":      cur.Time,
+		"changes": changes,
+	})
+}
+
+func handleWatchdog(w http.ResponseWriter, req *http.Request) {
+	if wd == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("watchdog is disabled"))
+		return
+	}
+	writeJSON(w, http.StatusOK, wd.stats())
+}
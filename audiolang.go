@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/sdp"
+)
+
+func init() {
+	registerFeature("audio-lang")
+}
+
+// sdpLanguages returns the language (a=lang, RFC 4566) of each of the n medias of an SDP,
+// that of the session if the media has none, empty if neither has.
+func sdpLanguages(body []byte, n int) []string {
+	langs := make([]string, n)
+	var sd sdp.SessionDescription
+	if err := sd.Unmarshal(body); err != nil {
+		return langs
+	}
+	session, _ := sd.Attribute("lang")
+	for i := range langs {
+		langs[i] = session
+	}
+	for i, md := range sd.MediaDescriptions {
+		if i >= n {
+			break
+		}
+		if lang, ok := md.Attribute("lang"); ok {
+			langs[i] = lang
+		}
+	}
+	return langs
+}
+
+// selectAudio lists the audio medias of the description with their language and, with -audio-lang,
+// keeps only the audio media of the first language of the list that has one.
+// The medias and their rtcp features are filtered in place, the selected audio media is returned, nil without -audio-lang.
+func (s *session) selectAudio(desc *description.Session, body []byte, feats []rtcpFeatures) ([]rtcpFeatures, *description.Media, error) {
+	langs := sdpLanguages(body, len(desc.Medias))
+	var audios []int
+	var tracks []string
+	for i, medi := range desc.Medias {
+		if medi.Type != description.MediaTypeAudio {
+			continue
+		}
+		audios = append(audios, i)
+		lang := langs[i]
+		if lang == "" {
+			lang = "no lang"
+		}
+		tracks = append(tracks, fmt.Sprintf("#%d %s (%s)", i, lang, medi.Formats[0].Codec()))
+	}
+	if len(audios) > 1 || s.cfg.audioLang != "" {
+		s.logf("audio tracks: %s", strings.Join(tracks, ", "))
+	}
+	if s.cfg.audioLang == "" {
+		return feats, nil, nil
+	}
+
+	selected := -1
+	for _, want := range strings.Split(s.cfg.audioLang, ",") {
+		for _, i := range audios {
+			if sameLanguage(langs[i], strings.TrimSpace(want)) {
+				selected = i
+				break
+			}
+		}
+		if selected >= 0 {
+			break
+		}
+	}
+	if selected < 0 {
+		return nil, nil, fmt.Errorf("no audio track of language %s, the audio tracks are %s", s.cfg.audioLang, strings.Join(tracks, ", "))
+	}
+	s.logf("audio track #%d of language %s selected", selected, langs[selected])
+	sel := desc.Medias[selected]
+
+	var medias []*description.Media
+	var kept []rtcpFeatures
+	for i, medi := range desc.Medias {
+		if medi.Type != description.MediaTypeAudio || i == selected {
+			medias = append(medias, medi)
+			kept = append(kept, feats[i])
+		}
+	}
+	desc.Medias = medias
+	return kept, sel, nil
+}
+
+// sameLanguage tells if the language tag of the SDP matches the one of -audio-lang,
+// case-insensitively and by the primary subtag if only that is given (ex) en matches en-US.
+func sameLanguage(tag, want string) bool {
+	if want == "" || tag == "" {
+		return false
+	}
+	if strings.EqualFold(tag, want) {
+		return true
+	}
+	primary := strings.SplitN(tag, "-", 2)[0]
+	return !strings.Contains(want, "-") && strings.EqualFold(primary, want)
+}
+
+// checkAudioData fails a session whose audio track selected by -audio-lang carried no RTP packet.
+func (s *session) checkAudioData() error {
+	if s.audio == nil {
+		return nil
+	}
+	for _, forma := range s.audio.Formats {
+		if t := s.tracks[forma]; t != nil && t.stats().Packets != 0 {
+			return nil
+		}
+	}
+	return s.errorf("no rtp packet on the selected audio track, %s", s.cfg.audioLang)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("av-sync")
+}
+
+// avSyncStats is the audio/video skew of a session, positive when the video lags the audio.
+type avSyncStats struct {
+	Samples uint64   `json:"samples"`
+	Min     duration `json:"min"`
+	Avg     duration `json:"avg"`
+	Max     duration `json:"max"`
+	Alarms  uint64   `json:"alarms"`
+}
+
+// avSync measures the skew between the audio and the video of a session (lip-sync).
+// The capture times of the packets are their RTP timestamps mapped to NTP by the last sender report of their media,
+// the skew is the difference between the delays from the capture to the arrival of the video and the audio.
+type avSync struct {
+	s            *session
+	audio, video *description.Media
+
+	mu sync.Mutex
+	// delay from the capture to the arrival of the last audio packet, in seconds
+	audioDelay float64
+	hasAudio   bool
+	// timestamp of the last video frame, only its first packet is measured
+	videoTS  uint32
+	hasVideo bool
+	sum      time.Duration
+	alarm    bool
+	stats    avSyncStats
+}
+
+// newAVSync returns nil if the medias have no audio or no video, the first of each is measured.
+func newAVSync(s *session, medias []*description.Media) *avSync {
+	as := &avSync{s: s}
+	for _, medi := range medias {
+		switch {
+		case medi.Type == description.MediaTypeAudio && as.audio == nil:
+			as.audio = medi
+		case medi.Type == description.MediaTypeVideo && as.video == nil:
+			as.video = medi
+		}
+	}
+	if as.audio == nil || as.video == nil {
+		return nil
+	}
+	return as
+}
+
+func (as *avSync) onPacketRTP(now time.Time, medi *description.Media, pkt *rtp.Packet) {
+	if medi != as.audio && medi != as.video {
+		return
+	}
+	capture, ok := as.s.rtcp[medi].captureTime(pkt.Timestamp)
+	if !ok {
+		return
+	}
+	delay := float64(now.UnixNano())/float64(time.Second) - capture
+
+	as.mu.Lock()
+	if medi == as.audio {
+		as.audioDelay, as.hasAudio = delay, true
+		as.mu.Unlock()
+		return
+	}
+	if as.hasVideo && pkt.Timestamp == as.videoTS {
+		as.mu.Unlock()
+		return
+	}
+	as.videoTS, as.hasVideo = pkt.Timestamp, true
+	if !as.hasAudio {
+		as.mu.Unlock()
+		return
+	}
+	skew := time.Duration((delay - as.audioDelay) * float64(time.Second))
+	as.stats.Samples++
+	as.sum += skew
+	if as.stats.Samples == 1 || duration(skew) < as.stats.Min {
+		as.stats.Min = duration(skew)
+	}
+	if as.stats.Samples == 1 || duration(skew) > as.stats.Max {
+		as.stats.Max = duration(skew)
+	}
+	as.stats.Avg = duration(as.sum / time.Duration(as.stats.Samples))
+
+	max := as.s.cfg.maxAVSkew
+	alarm := max > 0 && (skew > max || skew < -max)
+	changed := alarm != as.alarm
+	as.alarm = alarm
+	if changed && alarm {
+		as.stats.Alarms++
+	}
+	as.mu.Unlock()
+
+	switch {
+	case changed && alarm:
+		as.s.logf("audio/video skew %v exceeds max-av-skew %v", skew, max)
+	case changed:
+		as.s.logf("audio/video skew %v back within max-av-skew %v", skew, max)
+	}
+}
+
+func (as *avSync) snapshot() avSyncStats {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.stats
+}
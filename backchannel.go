@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("backchannel")
+	registerCodec("backchannel", "G711", "LPCM")
+}
+
+// the test tone of -backchannel
+const (
+	backchannelToneHz     = 1000
+	backchannelToneLevel  = 0.25
+	backchannelPCMPacket  = 20 * time.Millisecond
+	backchannelMaxPayload = 1200
+)
+
+// backchannelStats are the packets sent on the back channels of a session.
+type backchannelStats struct {
+	Codec   string `json:"codec"`
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
+	Errors  uint64 `json:"errors"`
+}
+
+// backchannelSender sends the test tone of -backchannel on a back channel media of the ONVIF
+// audio backchannel (www.onvif.org/ver20/backchannel): a 1 kHz tone in G711 or LPCM.
+// An AAC tone needs an AAC encoder, it is left out of -backchannel to a follow-up request and
+// the back channels offering AAC only fail the session.
+type backchannelSender struct {
+	s     *session
+	name  string
+	medi  *description.Media
+	forma format.Format
+
+	// time and clock ticks of a packet
+	interval time.Duration
+	samples  int
+	// PCM payload of the samples from the nth
+	pcm func(n int) []byte
+
+	ssrc uint32
+	seq  uint16
+	ts   uint32
+	// samples sent, the tone goes on after a resetup
+	n int
+
+	mu    sync.Mutex
+	stats backchannelStats
+}
+
+// newBackchannelSender returns the sender of the first G711 or LPCM format of a back channel media.
+func newBackchannelSender(s *session, name string, medi *description.Media) (*backchannelSender, error) {
+	forma := backchannelFormat(medi)
+	if forma == nil {
+		var codecs []string
+		for _, f := range medi.Formats {
+			codecs = append(codecs, f.Codec())
+		}
+		return nil, fmt.Errorf("unsupported codecs %s, only G711 and LPCM, the AAC tone is not supported yet",
+			strings.Join(codecs, ", "))
+	}
+	bs := &backchannelSender{
+		s:     s,
+		name:  name,
+		medi:  medi,
+		forma: forma,
+		ssrc:  rand.Uint32(),
+		seq:   uint16(rand.Uint32()),
+		ts:    rand.Uint32(),
+		stats: backchannelStats{Codec: forma.Codec()},
+	}
+	rate := forma.ClockRate()
+	switch f := forma.(type) {
+	case *format.G711:
+		encode := alawEncode
+		if f.MULaw {
+			encode = ulawEncode
+		}
+		bs.pcm = func(n int) []byte {
+			b := make([]byte, bs.samples)
+			for i := range b {
+				b[i] = encode(toneSample(n+i, rate))
+			}
+			return b
+		}
+		bs.samples = int(durationToTicks(backchannelPCMPacket, rate))
+
+	case *format.LPCM:
+		size := f.BitDepth / 8
+		if size < 1 || size > 3 || f.ChannelCount < 1 {
+			return nil, fmt.Errorf("unsupported LPCM of %d bits", f.BitDepth)
+		}
+		frame := size * f.ChannelCount
+		bs.samples = int(durationToTicks(backchannelPCMPacket, rate))
+		if bs.samples*frame > backchannelMaxPayload {
+			bs.samples = backchannelMaxPayload / frame
+		}
+		bs.pcm = func(n int) []byte {
+			b := make([]byte, 0, bs.samples*frame)
+			for i := 0; i < bs.samples; i++ {
+				v := toneSample(n+i, rate)
+				for c := 0; c < f.ChannelCount; c++ {
+					switch size {
+					case 1:
+						b = append(b, byte(int(v>>8)+128))
+					case 2:
+						b = append(b, byte(uint16(v)>>8), byte(v))
+					default:
+						b = append(b, byte(uint16(v)>>8), byte(v), 0)
+					}
+				}
+			}
+			return b
+		}
+	}
+	if rate <= 0 || bs.samples <= 0 {
+		return nil, fmt.Errorf("invalid clock rate %d", rate)
+	}
+	bs.interval = time.Duration(int64(bs.samples) * int64(time.Second) / int64(rate))
+	return bs, nil
+}
+
+// backchannelFormat returns the first G711 or LPCM format of a back channel media, nil if none.
+func backchannelFormat(medi *description.Media) format.Format {
+	for _, forma := range medi.Formats {
+		switch forma.(type) {
+		case *format.G711, *format.LPCM:
+			return forma
+		}
+	}
+	return nil
+}
+
+// toneSample returns the nth 16 bits sample of the test tone.
+func toneSample(n, rate int) int16 {
+	return int16(backchannelToneLevel * 32767 * math.Sin(2*math.Pi*backchannelToneHz*float64(n)/float64(rate)))
+}
+
+// ulawEncode and alawEncode return the G711 sample of a 16 bits sample, the inverse of ulaw and alaw.
+func ulawEncode(x int16) byte {
+	const bias, clip = 0x84, 32635
+	v := int(x)
+	sign := 0
+	if v < 0 {
+		v, sign = -v, 0x80
+	}
+	if v > clip {
+		v = clip
+	}
+	v += bias
+	exp := 7
+	for mask := 0x4000; v&mask == 0 && exp > 0; mask >>= 1 {
+		exp--
+	}
+	return ^byte(sign | exp<<4 | (v>>(exp+3))&0x0F)
+}
+
+func alawEncode(x int16) byte {
+	v := int(x) >> 3
+	mask := 0xD5
+	if v < 0 {
+		v, mask = -v-1, 0x55
+	}
+	seg := 0
+	for end := 0x1F; seg < 8 && v > end; end = end<<1 | 1 {
+		seg++
+	}
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+	a := seg << 4
+	if seg < 2 {
+		a |= (v >> 1) & 0x0F
+	} else {
+		a |= (v >> seg) & 0x0F
+	}
+	return byte(a ^ mask)
+}
+
+// run sends the packets in real time on the client until done is closed.
+func (bs *backchannelSender) run(c *gortsplib.Client, done chan struct{}) {
+	t := time.NewTicker(bs.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-done:
+			return
+		}
+		pkts, err := bs.packets(bs.n)
+		if err != nil {
+			bs.s.logf("backchannel %s: failed to encode, %v", bs.name, err)
+			return
+		}
+		bs.n += bs.samples
+		for _, pkt := range pkts {
+			err := c.WritePacketRTP(bs.medi, pkt)
+			bs.mu.Lock()
+			if err != nil {
+				bs.stats.Errors++
+			} else {
+				bs.stats.Packets++
+				bs.stats.Bytes += uint64(len(pkt.Payload))
+			}
+			errors := bs.stats.Errors
+			bs.mu.Unlock()
+			if errors == 1 && err != nil {
+				bs.s.logf("backchannel %s: failed to write, %v", bs.name, err)
+			}
+		}
+	}
+}
+
+// packets returns the packets of the samples from the nth.
+func (bs *backchannelSender) packets(n int) ([]*rtp.Packet, error) {
+	ts := bs.ts + uint32(n)
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    bs.forma.PayloadType(),
+			SequenceNumber: bs.seq,
+			Timestamp:      ts,
+			SSRC:           bs.ssrc,
+			Marker:         n == 0,
+		},
+		Payload: bs.pcm(n),
+	}
+	bs.seq++
+	return []*rtp.Packet{pkt}, nil
+}
+
+func (bs *backchannelSender) snapshot() backchannelStats {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return bs.stats
+}
+
+// setupBackchannels creates the senders of the back channel medias of -backchannel.
+func (s *session) setupBackchannels(desc *description.Session) error {
+	if !s.cfg.backchannel {
+		return nil
+	}
+	// again after a redirect
+	s.backchannels = nil
+	for i, medi := range desc.Medias {
+		if !medi.IsBackChannel {
+			continue
+		}
+		name := mediaName(desc.Medias, i)
+		bs, err := newBackchannelSender(s, name, medi)
+		if err != nil {
+			return fmt.Errorf("%s, %v", name, err)
+		}
+		s.backchannels = append(s.backchannels, bs)
+	}
+	if len(s.backchannels) == 0 {
+		return fmt.Errorf("no backchannel media in the sdp")
+	}
+	return nil
+}
+
+// startBackchannels sends the test tone on the back channels until the returned func is called.
+// After a resetup the senders are stopped and started again on the new client.
+func (s *session) startBackchannels(c *gortsplib.Client) func() {
+	if len(s.backchannels) == 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, bs := range s.backchannels {
+		bs := bs
+		s.logf("backchannel %s: sending %s every %s", bs.name, bs.forma.Codec(), bs.interval)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bs.run(c, done)
+		}()
+	}
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// logBackchannels logs the packets sent on the back channels.
+func (s *session) logBackchannels() {
+	for _, bs := range s.backchannels {
+		st := bs.snapshot()
+		s.summaryf("backchannel %s %s: sent %d packets, %s, errors %d",
+			bs.name, st.Codec, st.Packets, s.cfg.human().bytes(st.Bytes), st.Errors)
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+import "syscall"
+
+// bindToDevice binds a socket to a network interface, it needs CAP_NET_RAW.
+func bindToDevice(fd uintptr, name string) error {
+	return syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, name)
+}
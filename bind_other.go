@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// bindToDevice binds a socket to a network interface, only supported on Linux.
+func bindToDevice(fd uintptr, name string) error {
+	return fmt.Errorf("binding to an interface is not supported on this platform")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bitrate is a bits per second value, parsed from "8M", "500k", "64000", ...
+type bitrate float64
+
+func parseBitrate(s string) (bitrate, error) {
+	mul := 1.0
+	switch {
+	case strings.HasSuffix(s, "G"):
+		mul, s = 1e9, strings.TrimSuffix(s, "G")
+	case strings.HasSuffix(s, "M"):
+		mul, s = 1e6, strings.TrimSuffix(s, "M")
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		mul, s = 1e3, s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid bitrate %q", s)
+	}
+	return bitrate(v * mul), nil
+}
+
+func (b bitrate) String() string {
+	return humanizer{precision: 2}.bitrate(b)
+}
+
+// Set implements flag.Value.
+func (b *bitrate) Set(s string) error {
+	v, err := parseBitrate(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+func (b *bitrate) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var f float64
+		if err := json.Unmarshal(data, &f); err != nil {
+			return err
+		}
+		*b = bitrate(f)
+		return nil
+	}
+	return b.Set(s)
+}
+
+// bitrateWindow is the window of the instantaneous bitrate.
+const bitrateWindow = time.Second
+
+type bitrateStats struct {
+	Current bitrate `json:"current"`
+	Average bitrate `json:"average"`
+	Min     bitrate `json:"min"`
+	Max     bitrate `json:"max"`
+	Bytes   uint64  `json:"bytes"`
+}
+
+// bitrateMeter measures the bitrate in 1s windows and on average.
+type bitrateMeter struct {
+	start       time.Time
+	windowStart time.Time
+	windowBytes uint64
+	windows     uint64
+	stats       bitrateStats
+}
+
+// add adds received bytes, and calls onWindow for each window closed.
+func (m *bitrateMeter) add(now time.Time, n int, onWindow func(bitrate)) {
+	if m.start.IsZero() {
+		m.start = now
+		m.windowStart = now
+	}
+	for i := 0; now.Sub(m.windowStart) >= bitrateWindow; i++ {
+		br := bitrate(float64(m.windowBytes*8) / bitrateWindow.Seconds())
+		if i >= 10 {
+			// skip the rest of a long pause
+			m.windowStart = now
+			break
+		}
+		m.stats.Current = br
+		if m.windows == 0 || br < m.stats.Min {
+			m.stats.Min = br
+		}
+		if br > m.stats.Max {
+			m.stats.Max = br
+		}
+		m.windows++
+		m.windowStart = m.windowStart.Add(bitrateWindow)
+		m.windowBytes = 0
+		if onWindow != nil {
+			onWindow(br)
+		}
+	}
+
+	m.windowBytes += uint64(n)
+	m.stats.Bytes += uint64(n)
+	if elapsed := now.Sub(m.start); elapsed > 0 {
+		m.stats.Average = bitrate(float64(m.stats.Bytes*8) / elapsed.Seconds())
+	}
+}
+
+// checkBitrate returns the violated assertion of the thresholds, if any.
+func (t thresholds) checkBitrate(br bitrate) string {
+	if t.MinBitrate > 0 && br < t.MinBitrate {
+		return "below min-bitrate " + t.MinBitrate.String()
+	}
+	if t.MaxBitrate > 0 && br > t.MaxBitrate {
+		return "above max-bitrate " + t.MaxBitrate.String()
+	}
+	return ""
+}
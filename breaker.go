@@ -0,0 +1,147 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// breakerMinResults is the minimum number of results before the breaker can trip.
+const breakerMinResults = 5
+
+// circuitBreaker pauses new sessions toward a server
+// when the handshake error rate of the last results exceeds errorRate.
+// After cooldown, one trial session is let through (half-open),
+// its result closes or opens the breaker again.
+type circuitBreaker struct {
+	server    string
+	logger    *log.Logger
+	errorRate float64
+	window    int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	results  []bool
+	openedAt time.Time
+	trial    bool
+}
+
+func (b *circuitBreaker) setState(state breakerState) {
+	if b.state != state {
+		b.logger.Printf("circuit breaker %s: %v -> %v", b.server, b.state, state)
+		b.state = state
+	}
+}
+
+// wait blocks until a new session toward the server is allowed.
+func (b *circuitBreaker) wait() {
+	for {
+		b.mu.Lock()
+		switch b.state {
+		case breakerClosed:
+			b.mu.Unlock()
+			return
+
+		case breakerOpen:
+			if time.Since(b.openedAt) >= b.cooldown {
+				b.setState(breakerHalfOpen)
+				b.trial = true
+				b.mu.Unlock()
+				return
+			}
+
+		case breakerHalfOpen:
+			if !b.trial {
+				b.trial = true
+				b.mu.Unlock()
+				return
+			}
+		}
+		b.mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// record records the handshake result of a session.
+func (b *circuitBreaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.trial = false
+		b.results = b.results[:0]
+		if ok {
+			b.setState(breakerClosed)
+		} else {
+			b.openedAt = time.Now()
+			b.setState(breakerOpen)
+		}
+		return
+	}
+
+	b.results = append(b.results, ok)
+	if len(b.results) > b.window {
+		b.results = b.results[1:]
+	}
+	if b.state != breakerClosed || len(b.results) < breakerMinResults {
+		return
+	}
+
+	errs := 0
+	for _, r := range b.results {
+		if !r {
+			errs++
+		}
+	}
+	if float64(errs)/float64(len(b.results)) >= b.errorRate {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+// breaker returns the circuit breaker of the server of the url, nil if disabled.
+func (r *run) breaker(url string) *circuitBreaker {
+	if r.cfg.breakerErrorRate <= 0 {
+		return nil
+	}
+	server := url
+	if u, err := base.ParseURL(url); err == nil {
+		server = u.Host
+	}
+
+	r.breakersMu.Lock()
+	defer r.breakersMu.Unlock()
+	b, ok := r.breakers[server]
+	if !ok {
+		b = &circuitBreaker{
+			server:    server,
+			logger:    r.logger,
+			errorRate: r.cfg.breakerErrorRate,
+			window:    r.cfg.breakerWindow,
+			cooldown:  r.cfg.breakerCooldown,
+		}
+		r.breakers[server] = b
+	}
+	return b
+}
@@ -1,3 +1,7 @@
 #!/bin/bash -e
 set -x #echo on
-CGO_ENABLED=0 go build
\ No newline at end of file
+VERSION=$(git describe --tags --always 2>/dev/null || echo dev)
+COMMIT=$(git rev-parse --short HEAD 2>/dev/null || true)
+DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+# optional subsystems left out, (ex) TAGS=nogrpc,nopcap,nosrtp ./build.sh
+CGO_ENABLED=0 go build -tags "${TAGS}" -ldflags "-X main.version=${VERSION} -X main.commit=${COMMIT} -X main.date=${DATE}"
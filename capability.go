@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// requiredFeatures returns the features the config needs on the host running it.
+func (cfg *config) requiredFeatures() []string {
+	var l []string
+	add := func(cond bool, name string) {
+		if cond {
+			l = append(l, name)
+		}
+	}
+	add(cfg.analyzeAudio(), "audio-analysis")
+	add(cfg.audioLang != "", "audio-lang")
+	add(cfg.maxAVSkew > 0, "av-sync")
+	add(cfg.captions(), "captions")
+	add(cfg.compare(), "compare")
+	add(cfg.apiAddr != "", "control-api")
+	add(cfg.grpcAddr != "", "grpc-api")
+	add(len(cfg.headers) != 0, "custom-headers")
+	add(cfg.csvOut != "", "csv")
+	add(cfg.describeCache, "describe-cache")
+	add(cfg.describeRate > 0, "describe-load")
+	add(cfg.resolveMode != resolveSystem || len(cfg.resolvePins) != 0, "dns-control")
+	add(cfg.exec != "", "exec")
+	add(cfg.injectDrop > 0 || cfg.injectReorder > 0 || cfg.injectDelay > 0, "fault-injection")
+	add(cfg.freezeTimeout > 0, "freeze")
+	add(cfg.influxURL != "", "influx")
+	add(cfg.manifest != "", "integrity")
+	add(cfg.forceIPv4 || cfg.forceIPv6, "ip-family")
+	add(cfg.keepalive != keepaliveAuto || cfg.keepaliveInterval > 0 || cfg.keepaliveDivisor != 3, "keepalive")
+	add(len(cfg.runLabels()) != 0, "labels")
+	add(cfg.loopback, "loopback")
+	add(cfg.monitor, "monitor")
+	add(cfg.tsDir != "", "mpegts")
+	add(cfg.nack, "nack")
+	add(cfg.parameterRequests(), "parameters")
+	add(cfg.backchannel, "backchannel")
+	add(cfg.media != mediaAll, "media-select")
+	add(cfg.playoutBuffer > 0, "playout")
+	add(cfg.pcapDir != "", "pcap")
+	add(cfg.preflight, "preflight")
+	add(cfg.probe, "probe")
+	add(cfg.proxy != "", "proxy")
+	add(cfg.publish != "", "publish")
+	add(cfg.readRate > 0, "read-rate")
+	add(cfg.maxRedirects != defaultMaxRedirects, "redirect")
+	add(cfg.report != "", "report")
+	add(cfg.stateFile != "", "resume")
+	add(cfg.retryAttempts > 0, "retry")
+	add(cfg.scte35, "scte35")
+	add(len(cfg.serverResponses) != 0, "server-requests")
+	add(cfg.sessionSetupDeadline > 0, "setup-deadline")
+	add(cfg.shards > 0, "shards")
+	add(cfg.maxErrorRate >= 0 || cfg.maxP95SetupMs > 0 || cfg.maxDelayEvents >= 0, "sla")
+	add(cfg.localIP != "" || cfg.iface != "", "source-address")
+	add(cfg.soakInterval > 0, "soak")
+	add(cfg.srtp, "srtp")
+	add(cfg.mikeyPSK != "", "mikey")
+	add(cfg.startJitter != jitterNone || cfg.shuffle, "stagger")
+	add(cfg.statsInterval > 0, "stats-log")
+	add(cfg.statsdAddr != "", "statsd")
+	add(cfg.rrInterval > 0, "rtcp-rr")
+	add(cfg.subtitleDir != "" || cfg.maxSubtitleGap > 0 || cfg.expectSubtitles, "subtitles")
+	add(cfg.tenants != "", "tenants")
+	add(cfg.trace, "trace")
+	add(cfg.tsAnalysis, "ts-analysis")
+	add(cfg.udpPorts != "", "udp-ports")
+	add(cfg.udpRcvbuf > 0, "udp-rcvbuf")
+	add(urlPlaceholder.MatchString(cfg.url), "url-template")
+	add(cfg.analyzeVideo(), "video-analysis")
+	add(cfg.warmup > 0, "warmup")
+	add(cfg.watchdogThreshold > 0, "watchdog")
+	add(cfg.zapInterval > 0, "zap")
+	sort.Strings(l)
+	return l
+}
+
+// checkCapabilities returns an error if bi lacks the required features,
+// or its version differs from want if want is not empty.
+func (bi buildInfo) checkCapabilities(want string, required []string) error {
+	if want != "" && bi.Version != want {
+		return fmt.Errorf("version %s, expected %s", bi.Version, want)
+	}
+	has := make(map[string]bool)
+	for _, f := range bi.Features {
+		has[f] = true
+	}
+	var missing []string
+	for _, f := range required {
+		if !has[f] {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("version %s lacks %s", bi.Version, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// fetchCapabilities gets the build info advertised by the api of an agent at addr.
+func fetchCapabilities(addr string, timeout time.Duration) (buildInfo, error) {
+	var bi buildInfo
+	c := http.Client{Timeout: timeout}
+	res, err := c.Get("http://" + addr + "/version")
+	if err != nil {
+		return bi, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return bi, fmt.Errorf("bad status %s", res.Status)
+	}
+	err = json.NewDecoder(res.Body).Decode(&bi)
+	return bi, err
+}
+
+// handleVersion advertises the version and the compiled-in features.
+func handleVersion(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, getBuildInfo())
+}
+
+// the kinds of the features listed by the capabilities subcommand, the other features are options of the modes
+var (
+	modeFeatures     = []string{"agent", "describe-load", "loopback", "preflight", "probe", "publish", "tenants", "zap"}
+	exporterFeatures = []string{"control-api", "csv", "dashboard", "grpc-api", "influx", "mpegts", "partial-results", "pcap", "report", "resource-timeline", "statsd"}
+)
+
+// capabilities describe what the binary can do, for an orchestrator to check an agent
+// before dispatching a plan that needs optional features or those of a newer version.
+type capabilities struct {
+	buildInfo
+	// size of the executable in bytes, 0 if unknown
+	BinarySize int64    `json:"binarySize"`
+	Modes      []string `json:"modes"`
+	// handlers of each codec
+	Codecs     map[string][]string `json:"codecs"`
+	Exporters  []string            `json:"exporters"`
+	Transports []string            `json:"transports"`
+	Schemes    []string            `json:"schemes"`
+	Profiles   []string            `json:"profiles"`
+}
+
+func getCapabilities() capabilities {
+	c := capabilities{
+		buildInfo:  getBuildInfo(),
+		Modes:      []string{"play"},
+		Codecs:     make(map[string][]string),
+		Transports: []string{"UDP", "TCP"},
+		Schemes:    []string{"rtsp", "rtsps"},
+		Profiles:   []string{"RTP/AVP"},
+	}
+	if exe, err := os.Executable(); err == nil {
+		if fi, err := os.Stat(exe); err == nil {
+			c.BinarySize = fi.Size()
+		}
+	}
+	has := make(map[string]bool)
+	for _, f := range c.Features {
+		has[f] = true
+	}
+	for _, f := range modeFeatures {
+		if has[f] {
+			c.Modes = append(c.Modes, f)
+		}
+	}
+	if has["agent"] {
+		c.Modes = append(c.Modes, "controller")
+	}
+	for _, f := range exporterFeatures {
+		if has[f] {
+			c.Exporters = append(c.Exporters, f)
+		}
+	}
+	if has["srtp"] {
+		c.Profiles = append(c.Profiles, "RTP/SAVP")
+	}
+	for name, handlers := range codecs {
+		c.Codecs[name] = append([]string(nil), handlers...)
+		sort.Strings(c.Codecs[name])
+	}
+	return c
+}
+
+// handleCapabilities advertises the capabilities.
+func handleCapabilities(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, getCapabilities())
+}
+
+// runCapabilities is the capabilities subcommand, it prints the capabilities as json.
+func runCapabilities(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: rtspclient capabilities")
+	}
+	b, err := json.MarshalIndent(getCapabilities(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+)
+
+func init() {
+	registerFeature("captions")
+}
+
+// the SEI message of the captions, user_data_registered_itu_t_t35 of ATSC A/53
+const (
+	seiUserDataRegistered = 4
+	t35CountryUSA         = 0xB5
+	t35ProviderATSC       = 0x0031
+	a53CCData             = 0x03
+)
+
+var a53UserIdentifier = []byte("GA94")
+
+// captionStats are the CEA-608/708 captions carried by the SEI of a video track.
+type captionStats struct {
+	// access units with caption data
+	Frames uint64 `json:"frames"`
+	// valid byte pairs of CEA-608 (fields 1 and 2) and CEA-708 (DTVCC)
+	CEA608 uint64 `json:"cea608"`
+	CEA708 uint64 `json:"cea708"`
+	// byte pairs per second from the first to the last access unit
+	CEA608Rate float64  `json:"cea608Rate"`
+	CEA708Rate float64  `json:"cea708Rate"`
+	MaxGap     duration `json:"maxGap"`
+}
+
+// captionMeter measures the captions of the access units of a video track.
+type captionMeter struct {
+	first time.Time
+	last  time.Time
+	// last access unit with captions, or the first access unit
+	lastCaption time.Time
+	stats       captionStats
+	// SEI without the emulation prevention bytes, reused
+	rbsp []byte
+}
+
+// emulationPreventionRemoveTo is h264.EmulationPreventionRemove reusing dst.
+func emulationPreventionRemoveTo(dst, nalu []byte) []byte {
+	dst = dst[:0]
+	start := 0
+	for i := 2; i < len(nalu); i++ {
+		if nalu[i-2] == 0 && nalu[i-1] == 0 && nalu[i] == 3 {
+			dst = append(dst, nalu[start:i]...)
+			start = i + 1
+		}
+	}
+	return append(dst, nalu[start:]...)
+}
+
+// onAccessUnit adds the captions of an access unit, it returns the time without captions
+// and whether these are the first captions.
+func (cm *captionMeter) onAccessUnit(now time.Time, au [][]byte, h265 bool) (time.Duration, bool) {
+	if cm.first.IsZero() {
+		cm.first, cm.lastCaption = now, now
+	}
+	cm.last = now
+	var cea608, cea708 uint64
+	for _, nalu := range au {
+		switch {
+		case !h265 && len(nalu) > 1 && h264.NALUType(nalu[0]&0x1F) == h264.NALUTypeSEI:
+			cm.rbsp = emulationPreventionRemoveTo(cm.rbsp, nalu[1:])
+			c608, c708 := seiCaptions(cm.rbsp)
+			cea608, cea708 = cea608+c608, cea708+c708
+		case h265 && len(nalu) > 2 && (nalu[0]>>1)&0x3F == 39:
+			cm.rbsp = emulationPreventionRemoveTo(cm.rbsp, nalu[2:])
+			c608, c708 := seiCaptions(cm.rbsp)
+			cea608, cea708 = cea608+c608, cea708+c708
+		}
+	}
+	if elapsed := cm.last.Sub(cm.first).Seconds(); elapsed > 0 {
+		cm.stats.CEA608Rate = float64(cm.stats.CEA608+cea608) / elapsed
+		cm.stats.CEA708Rate = float64(cm.stats.CEA708+cea708) / elapsed
+	}
+	gap := now.Sub(cm.lastCaption)
+	if duration(gap) > cm.stats.MaxGap {
+		cm.stats.MaxGap = duration(gap)
+	}
+	if cea608+cea708 == 0 {
+		return gap, false
+	}
+	firstCaptions := cm.stats.Frames == 0
+	cm.stats.Frames++
+	cm.stats.CEA608 += cea608
+	cm.stats.CEA708 += cea708
+	cm.lastCaption = now
+	return 0, firstCaptions
+}
+
+// seiCaptions returns the valid CEA-608 and CEA-708 byte pairs of the SEI messages of a SEI RBSP.
+func seiCaptions(b []byte) (uint64, uint64) {
+	var cea608, cea708 uint64
+	for len(b) > 2 {
+		typ := 0
+		for len(b) != 0 && b[0] == 0xFF {
+			typ, b = typ+0xFF, b[1:]
+		}
+		if len(b) == 0 {
+			break
+		}
+		typ, b = typ+int(b[0]), b[1:]
+		size := 0
+		for len(b) != 0 && b[0] == 0xFF {
+			size, b = size+0xFF, b[1:]
+		}
+		if len(b) == 0 {
+			break
+		}
+		size, b = size+int(b[0]), b[1:]
+		if size > len(b) {
+			break
+		}
+		payload := b[:size]
+		b = b[size:]
+
+		if typ != seiUserDataRegistered || len(payload) < 10 || payload[0] != t35CountryUSA ||
+			int(payload[1])<<8|int(payload[2]) != t35ProviderATSC || !bytes.Equal(payload[3:7], a53UserIdentifier) ||
+			payload[7] != a53CCData || payload[8]&0x40 == 0 {
+			continue
+		}
+		count := int(payload[8] & 0x1F)
+		data := payload[10:]
+		for i := 0; i < count && len(data) >= 3; i, data = i+1, data[3:] {
+			if data[0]&0x04 == 0 {
+				continue
+			}
+			switch typ := data[0] & 0x03; {
+			case typ < 2 && data[1]&0x7F == 0 && data[2]&0x7F == 0:
+				// CEA-608 padding
+			case typ < 2:
+				cea608++
+			default:
+				cea708++
+			}
+		}
+	}
+	return cea608, cea708
+}
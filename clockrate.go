@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+)
+
+// clockRates are clock rates by RTP payload type, parsed from "96=90000,97=8000".
+type clockRates map[uint8]int
+
+func (cr clockRates) String() string {
+	pts := make([]int, 0, len(cr))
+	for pt := range cr {
+		pts = append(pts, int(pt))
+	}
+	sort.Ints(pts)
+	s := make([]string, len(pts))
+	for i, pt := range pts {
+		s[i] = fmt.Sprintf("%d=%d", pt, cr[uint8(pt)])
+	}
+	return strings.Join(s, ",")
+}
+
+// Set implements flag.Value, it can be repeated.
+func (cr *clockRates) Set(s string) error {
+	if *cr == nil {
+		*cr = make(clockRates)
+	}
+	for _, kv := range strings.Split(s, ",") {
+		tmp := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(tmp) != 2 {
+			return fmt.Errorf("invalid clock rate %q, should be payload type=clock rate", kv)
+		}
+		pt, err := strconv.ParseUint(tmp[0], 10, 7)
+		if err != nil {
+			return fmt.Errorf("invalid payload type %q", tmp[0])
+		}
+		rate, err := strconv.ParseUint(tmp[1], 10, 31)
+		if err != nil || rate == 0 {
+			return fmt.Errorf("invalid clock rate %q", tmp[1])
+		}
+		(*cr)[uint8(pt)] = int(rate)
+	}
+	return nil
+}
+
+// decodeFMTP decodes a fmtp attribute value the way gortsplib does.
+func decodeFMTP(enc string) map[string]string {
+	if enc == "" {
+		return nil
+	}
+	ret := make(map[string]string)
+	for _, kv := range strings.Split(enc, ";") {
+		tmp := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(tmp) == 2 {
+			ret[strings.ToLower(tmp[0])] = tmp[1]
+		}
+	}
+	return ret
+}
+
+// defaultClockRate is the clock rate assumed for formats of unknown clock rate.
+func defaultClockRate(mediaType string) int {
+	if mediaType == "audio" {
+		return 8000
+	}
+	return 90000
+}
+
+// formatAttribute returns the index and value of the rtpmap/fmtp attribute line of a payload type, -1 if not found.
+func formatAttribute(lines []string, key string, pt uint8) (int, string) {
+	prefix := "a=" + key + ":" + strconv.Itoa(int(pt)) + " "
+	for i, l := range lines {
+		if strings.HasPrefix(l, prefix) {
+			return i, strings.TrimSpace(l[len(prefix):])
+		}
+	}
+	return -1, ""
+}
+
+// fixMedia rewrites the rtpmap attributes of a media section (m= line first).
+func (cr clockRates) fixMedia(lines []string) ([]string, []string) {
+	fields := strings.Fields(strings.TrimPrefix(lines[0], "m="))
+	if len(fields) < 4 {
+		return lines, nil
+	}
+	mediaType := fields[0]
+
+	var notes []string
+	for _, f := range fields[3:] {
+		tmp, err := strconv.ParseUint(f, 10, 7)
+		if err != nil {
+			continue
+		}
+		pt := uint8(tmp)
+
+		i, rtpMap := formatAttribute(lines, "rtpmap", pt)
+		_, fmtp := formatAttribute(lines, "fmtp", pt)
+		newMap := rtpMap
+
+		if rate, ok := cr[pt]; ok {
+			parts := strings.Split(rtpMap, "/")
+			if rtpMap == "" || len(parts) < 2 {
+				parts = []string{"private", ""}
+			}
+			parts[1] = strconv.Itoa(rate)
+			newMap = strings.Join(parts, "/")
+		}
+
+		if _, err := format.Unmarshal(mediaType, pt, newMap, decodeFMTP(fmtp)); err != nil {
+			name, rate := "private", defaultClockRate(mediaType)
+			if parts := strings.Split(newMap, "/"); len(parts) >= 2 {
+				if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+					name, rate = "private-"+parts[0], v
+				}
+			}
+			fixed := name + "/" + strconv.Itoa(rate)
+			if _, err2 := format.Unmarshal(mediaType, pt, fixed, decodeFMTP(fmtp)); err2 != nil {
+				notes = append(notes, fmt.Sprintf("%s payload type %d: %v", mediaType, pt, err))
+				continue
+			}
+			notes = append(notes, fmt.Sprintf("%s payload type %d: %v, using generic %s", mediaType, pt, err, fixed))
+			newMap = fixed
+		}
+
+		if newMap == rtpMap {
+			continue
+		}
+		l := "a=rtpmap:" + strconv.Itoa(int(pt)) + " " + newMap
+		if i >= 0 {
+			lines[i] = l
+		} else {
+			lines = append(lines[:1], append([]string{l}, lines[1:]...)...)
+		}
+	}
+	return lines, notes
+}
+
+// fixSDP rewrites the rtpmap attributes of a raw SDP before gortsplib parses it:
+// the clock rates of cr are applied, and formats whose clock rate is unknown or that
+// can not be parsed are replaced with generic private formats, so that the session
+// continues with generic stats only.
+// It returns the rewritten SDP and a note for every replaced format.
+func (cr clockRates) fixSDP(body []byte) ([]byte, []string) {
+	lines := strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n")
+
+	var out, notes []string
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			out = append(out, lines[:end]...)
+			return
+		}
+		fixed, n := cr.fixMedia(append([]string(nil), lines[start:end]...))
+		out = append(out, fixed...)
+		notes = append(notes, n...)
+	}
+	for i, l := range lines {
+		if strings.HasPrefix(l, "m=") {
+			flush(i)
+			start = i
+		}
+	}
+	flush(len(lines))
+
+	if len(notes) == 0 && len(cr) == 0 {
+		return body, nil
+	}
+	return []byte(strings.Join(out, "\r\n")), notes
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+func init() {
+	registerFeature("compare")
+}
+
+// targetURLs is the -url flag, repeated to run the same load against each url and compare them.
+type targetURLs struct {
+	cfg *config
+	set bool
+}
+
+func (t *targetURLs) String() string {
+	if t == nil || t.cfg == nil {
+		return ""
+	}
+	return t.cfg.url
+}
+
+// Set implements flag.Value, the first url replaces the default.
+func (t *targetURLs) Set(s string) error {
+	if !t.set {
+		t.cfg.targets = nil
+		t.set = true
+	}
+	t.cfg.targets = append(t.cfg.targets, s)
+	t.cfg.url = t.cfg.targets[0]
+	return nil
+}
+
+// compare returns whether several -url are compared.
+func (cfg *config) compare() bool {
+	return len(cfg.targets) > 1
+}
+
+// targetName returns the name of the ith target of the comparison, A, B, ...
+func targetName(i int) string {
+	if i < 26 {
+		return string(rune('A' + i))
+	}
+	return fmt.Sprintf("T%d", i+1)
+}
+
+// targetPath returns the output file of a target, with its name before the extension.
+func targetPath(path, name string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
+
+// newCompareRuns returns the runs of the targets, the same flags with the url of each target.
+// Their reports and csv files are written next to those of the flags, with the name of the target.
+func newCompareRuns(cfg *config) ([]*run, error) {
+	var runs []*run
+	for i, u := range cfg.targets {
+		name := targetName(i)
+		c := *cfg
+		c.url, c.targets, c.compared = u, nil, true
+		c.report, c.csvOut = targetPath(cfg.report, name), targetPath(cfg.csvOut, name)
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("[%s] invalid args, %v", name, err)
+		}
+		r, err := newRun(name, &c)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %v", name, err)
+		}
+		r.logger.Printf("target %s", u)
+		runs = append(runs, r)
+	}
+	return runs, nil
+}
+
+// runCompare runs the same load against each target at the same time, then compares their results.
+// The control api of the targets is served on -api-addr under /targets/<name>/,
+// the gRPC control api of -grpc-addr takes the target as namespace.
+// It returns the worst exit code of the runs.
+func runCompare(cfg *config) int {
+	runs, err := newCompareRuns(cfg)
+	if err != nil {
+		fmt.Println(err)
+		return exitError
+	}
+	routes := make(map[string]*run)
+	for _, r := range runs {
+		routes["/targets/"+r.name] = r
+	}
+	if cfg.apiAddr != "" {
+		serveAPI(cfg.apiAddr, routes)
+	}
+	if cfg.grpcAddr != "" {
+		serveGRPC(cfg.grpcAddr, routes)
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, len(runs))
+	for i, r := range runs {
+		wg.Add(1)
+		go func(i int, r *run) {
+			defer wg.Done()
+			if err := r.start(); err != nil {
+				r.logger.Println(err)
+				codes[i] = exitError
+				return
+			}
+			codes[i] = r.exitCode()
+		}(i, r)
+	}
+	wg.Wait()
+
+	cmp := newComparison(cfg, runs)
+	// without the name of a target
+	cmp.log(log.New(runs[0].logger.Writer(), "", 0))
+	if cfg.report != "" {
+		if err := cmp.write(cfg, cfg.report); err != nil {
+			runs[0].logger.Printf("failed to write comparison, %v", err)
+		} else {
+			runs[0].logger.Printf("comparison written to %s", cfg.report)
+		}
+	}
+
+	code := exitOK
+	for _, c := range codes {
+		if c > code {
+			code = c
+		}
+	}
+	return code
+}
+
+// comparison is the side by side results of the targets,
+// each value after the first target has its difference from the first.
+type comparison struct {
+	Title   string
+	Targets []compareTarget
+	Rows    []compareRow
+}
+
+type compareTarget struct {
+	Name string
+	URL  string
+}
+
+type compareRow struct {
+	Metric string
+	Values []string
+}
+
+// compareResult are the compared results of a target.
+type compareResult struct {
+	sessions int
+	failed   int
+	packets  uint64
+	lost     int64
+	bitrate  bitrate
+	latency  map[string]latencyPercentiles
+}
+
+func resultsOf(r *run) compareResult {
+	res := compareResult{latency: r.latency.percentiles()}
+	r.report.mu.Lock()
+	defer r.report.mu.Unlock()
+	for _, s := range r.report.results {
+		res.sessions++
+		if s.Err != "" {
+			res.failed++
+		}
+		if s.Final == nil {
+			continue
+		}
+		res.bitrate += s.Final.Bitrate.Average
+		for _, t := range s.Final.Tracks {
+			res.packets += t.Packets
+			res.lost += t.Lost
+		}
+	}
+	if res.sessions > 0 {
+		res.bitrate /= bitrate(res.sessions)
+	}
+	return res
+}
+
+func (res compareResult) failedRate() float64 {
+	if res.sessions == 0 {
+		return 0
+	}
+	return float64(res.failed) * 100 / float64(res.sessions)
+}
+
+func (res compareResult) lossRate() float64 {
+	if total := float64(res.packets) + float64(res.lost); total > 0 {
+		return float64(res.lost) * 100 / total
+	}
+	return 0
+}
+
+func newComparison(cfg *config, runs []*run) *comparison {
+	h := cfg.human()
+	cmp := &comparison{Title: cfg.tr("rtspclient comparison")}
+	results := make([]compareResult, len(runs))
+	for i, r := range runs {
+		cmp.Targets = append(cmp.Targets, compareTarget{Name: r.name, URL: r.cfg.url})
+		results[i] = resultsOf(r)
+	}
+
+	// adds a row of a metric, format formats a value
+	add := func(metric string, value func(compareResult) (float64, bool), format func(float64) string) {
+		row := compareRow{Metric: metric}
+		base, baseOK := value(results[0])
+		found := baseOK
+		for i, res := range results {
+			v, ok := value(res)
+			found = found || ok
+			switch {
+			case !ok:
+				row.Values = append(row.Values, "-")
+			case i == 0 || !baseOK || base == 0:
+				row.Values = append(row.Values, format(v))
+			default:
+				row.Values = append(row.Values, fmt.Sprintf("%s (%+.1f%%)", format(v), (v-base)*100/base))
+			}
+		}
+		if found {
+			cmp.Rows = append(cmp.Rows, row)
+		}
+	}
+	count := func(v float64) string { return fmt.Sprint(int64(v)) }
+	pct := func(v float64) string { return h.float(v) + "%" }
+	dur := func(v float64) string { return h.duration(time.Duration(v)) }
+
+	add(cfg.tr("sessions"), func(r compareResult) (float64, bool) { return float64(r.sessions), true }, count)
+	add(cfg.tr("failed"), func(r compareResult) (float64, bool) { return float64(r.failed), true }, count)
+	add(cfg.tr("error rate"), func(r compareResult) (float64, bool) { return r.failedRate(), true }, pct)
+	add(cfg.tr("avg bitrate"), func(r compareResult) (float64, bool) { return float64(r.bitrate), true },
+		func(v float64) string { return h.bitrate(bitrate(v)) })
+	add(cfg.tr("packets"), func(r compareResult) (float64, bool) { return float64(r.packets), true }, count)
+	add(cfg.tr("lost"), func(r compareResult) (float64, bool) { return float64(r.lost), true }, count)
+	add(cfg.tr("loss rate"), func(r compareResult) (float64, bool) { return r.lossRate(), true }, pct)
+
+	phases := append([]string(nil), handshakePhases...)
+	var others []string
+	seen := make(map[string]bool)
+	for _, res := range results {
+		for p := range res.latency {
+			if isTimeToPhase(p) && !seen[p] {
+				seen[p] = true
+				others = append(others, p)
+			}
+		}
+	}
+	sort.Strings(others)
+	for _, p := range append(phases, others...) {
+		p := p
+		for _, q := range []struct {
+			name string
+			v    func(latencyPercentiles) duration
+		}{
+			{"p50", func(lp latencyPercentiles) duration { return lp.P50 }},
+			{"p95", func(lp latencyPercentiles) duration { return lp.P95 }},
+			{"p99", func(lp latencyPercentiles) duration { return lp.P99 }},
+		} {
+			q := q
+			add(p+" "+q.name, func(r compareResult) (float64, bool) {
+				lp, ok := r.latency[p]
+				return float64(q.v(lp)), ok
+			}, dur)
+		}
+	}
+	return cmp
+}
+
+func (cmp *comparison) log(logger *log.Logger) {
+	for _, t := range cmp.Targets {
+		logger.Printf("compare %s: %s", t.Name, t.URL)
+	}
+	for _, row := range cmp.Rows {
+		var b strings.Builder
+		for i, v := range row.Values {
+			fmt.Fprintf(&b, ", %s %s", cmp.Targets[i].Name, v)
+		}
+		logger.Printf("compare %s:%s", row.Metric, strings.TrimPrefix(b.String(), ","))
+	}
+}
+
+func (cmp *comparison) write(cfg *config, path string) error {
+	var buf bytes.Buffer
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".md" || ext == ".markdown" {
+		t, err := texttemplate.New("comparison").Funcs(texttemplate.FuncMap{
+			"tr": cfg.tr,
+			"md": func(s string) string { return strings.ReplaceAll(s, "|", `\|`) },
+		}).Parse(markdownComparisonTemplate)
+		if err != nil {
+			return err
+		}
+		if err := t.Execute(&buf, cmp); err != nil {
+			return err
+		}
+	} else {
+		t, err := htmltemplate.New("comparison").Funcs(htmltemplate.FuncMap{
+			"tr": cfg.tr,
+		}).Parse(htmlComparisonTemplate)
+		if err != nil {
+			return err
+		}
+		if err := t.Execute(&buf, cmp); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+const htmlComparisonTemplate = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; }
+</style></head><body>
+<h1>{{.Title}}</h1>
+<table>
+{{range .Targets}}<tr><th>{{.Name}}</th><td>{{.URL}}</td></tr>
+{{end}}</table>
+<table>
+<tr><th>{{tr "metric"}}</th>{{range .Targets}}<th>{{.Name}}</th>{{end}}</tr>
+{{range .Rows}}<tr><th>{{.Metric}}</th>{{range .Values}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+</body></html>
+`
+
+const markdownComparisonTemplate = `# {{.Title}}
+
+| | |
+|---|---|
+{{range .Targets}}| {{.Name}} | {{md .URL}} |
+{{end}}
+| {{tr "metric"}} |{{range .Targets}} {{.Name}} |{{end}}
+|---|{{range .Targets}}---|{{end}}
+{{range .Rows}}| {{.Metric}} |{{range .Values}} {{.}} |{{end}}
+{{end}}`
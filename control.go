@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+)
+
+// controlPolicy is how the SETUP/PLAY URLs are built from the a=control attributes,
+// for servers interpreting nonstandard control URLs differently.
+// It is parsed from "base=request,join=rfc3986,star=base,slash=strip",
+// omitted options are the defaults (the gortsplib behavior).
+//
+//	base:  aggregate (PLAY) URL, auto (session a=control, Content-Base, request URL),
+//	       request (request URL), content-base (Content-Base, request URL)
+//	join:  relative media control, append (base + "/" + control),
+//	       rfc3986 (resolved as a relative reference, replaces the last path segment of the base)
+//	star:  media control "*", append (base + "/*"), base (base URL)
+//	slash: trailing slash of the aggregate URL, keep, strip, add
+type controlPolicy struct {
+	base  string
+	join  string
+	star  string
+	slash string
+}
+
+var controlPolicyValues = map[string][]string{
+	"base":  {"auto", "request", "content-base"},
+	"join":  {"append", "rfc3986"},
+	"star":  {"append", "base"},
+	"slash": {"keep", "strip", "add"},
+}
+
+func defaultControlPolicy() controlPolicy {
+	return controlPolicy{base: "auto", join: "append", star: "append", slash: "keep"}
+}
+
+func parseControlPolicy(s string) (controlPolicy, error) {
+	p := defaultControlPolicy()
+	if s == "" {
+		return p, nil
+	}
+	for _, opt := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(opt), "=", 2)
+		if len(kv) != 2 {
+			return p, fmt.Errorf("invalid control policy option %q", opt)
+		}
+		values, ok := controlPolicyValues[kv[0]]
+		if !ok {
+			return p, fmt.Errorf("unknown control policy option %q", kv[0])
+		}
+		valid := false
+		for _, v := range values {
+			valid = valid || v == kv[1]
+		}
+		if !valid {
+			return p, fmt.Errorf("invalid control policy %s %q, should be one of %s",
+				kv[0], kv[1], strings.Join(values, ","))
+		}
+		switch kv[0] {
+		case "base":
+			p.base = kv[1]
+		case "join":
+			p.join = kv[1]
+		case "star":
+			p.star = kv[1]
+		case "slash":
+			p.slash = kv[1]
+		}
+	}
+	return p, nil
+}
+
+func (p controlPolicy) String() string {
+	return fmt.Sprintf("base=%s,join=%s,star=%s,slash=%s", p.base, p.join, p.star, p.slash)
+}
+
+// Set implements flag.Value.
+func (p *controlPolicy) Set(s string) error {
+	v, err := parseControlPolicy(s)
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// controlOverrides are the control policies of servers, by host (host:port or host).
+type controlOverrides map[string]controlPolicy
+
+func (o controlOverrides) String() string {
+	hosts := make([]string, 0, len(o))
+	for h := range o {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	for i, h := range hosts {
+		hosts[i] = h + "=" + o[h].String()
+	}
+	return strings.Join(hosts, " ")
+}
+
+// Set implements flag.Value, s is "host=policy".
+func (o *controlOverrides) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("invalid control override %q, should be host=policy", s)
+	}
+	p, err := parseControlPolicy(kv[1])
+	if err != nil {
+		return err
+	}
+	if *o == nil {
+		*o = make(controlOverrides)
+	}
+	(*o)[kv[0]] = p
+	return nil
+}
+
+// controlPolicy returns the control policy of a server.
+func (cfg *config) controlPolicy(u *base.URL) controlPolicy {
+	if p, ok := cfg.controlOverrides[u.Host]; ok {
+		return p
+	}
+	if p, ok := cfg.controlOverrides[u.Hostname()]; ok {
+		return p
+	}
+	return cfg.control
+}
+
+// apply sets the aggregate URL and the media controls of desc by the policy.
+// Media controls it changes are replaced with absolute URLs.
+func (p controlPolicy) apply(desc *description.Session, res *base.Response, u *base.URL) error {
+	switch p.base {
+	case "request":
+		desc.BaseURL = u
+	case "content-base":
+		desc.BaseURL = u
+		if cb, ok := res.Header["Content-Base"]; ok && len(cb) == 1 {
+			cbURL, err := base.ParseURL(cb[0])
+			if err != nil {
+				return fmt.Errorf("invalid Content-Base %q", cb[0])
+			}
+			cbURL.User = u.User
+			desc.BaseURL = cbURL
+		}
+	}
+
+	baseURL := *desc.BaseURL
+	switch p.slash {
+	case "strip":
+		baseURL.Path = strings.TrimRight(baseURL.Path, "/")
+	case "add":
+		if !strings.HasSuffix(baseURL.Path, "/") {
+			baseURL.Path += "/"
+		}
+	}
+
+	for _, medi := range desc.Medias {
+		switch {
+		case medi.Control == "*" && p.star == "base":
+			medi.Control = baseURL.String()
+
+		case medi.Control != "" && medi.Control != "*" && p.join == "rfc3986" &&
+			!strings.HasPrefix(medi.Control, "rtsp://") && !strings.HasPrefix(medi.Control, "rtsps://"):
+			ref, err := url.Parse(medi.Control)
+			if err != nil {
+				return fmt.Errorf("invalid control attribute %q", medi.Control)
+			}
+			medi.Control = (*url.URL)(desc.BaseURL).ResolveReference(ref).String()
+		}
+	}
+
+	desc.BaseURL = &baseURL
+	return nil
+}
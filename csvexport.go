@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerFeature("csv")
+}
+
+// sessionColumns are the columns of a row of -csv-out.
+var sessionColumns = []string{
+	"time", "run", "id", "url", "class", "result", "failure", "error", "transport",
+	"packets", "bytes", "lost", "max_jitter_ms",
+	"bitrate_avg_bps", "bitrate_min_bps", "bitrate_max_bps",
+	"connect_ms", "options_ms", "describe_ms", "setup_ms", "play_ms", "first_packet_ms",
+	"rtcp_sender_reports", "rtcp_interval_alarms",
+	"keyframes", "gop_max_interval_ms", "gop_alarms",
+	"access_units", "malformed_access_units",
+	"labels",
+}
+
+// timeseriesColumns are the columns of a row of the time-series file of -csv-out.
+var timeseriesColumns = []string{
+	"time", "run", "sessions", "playing", "packets", "bytes", "bitrate_bps", "labels",
+}
+
+// csvFile appends rows to a CSV file, or TSV if the name ends with .tsv.
+// The header is written only if the file is empty.
+type csvFile struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *csv.Writer
+}
+
+func openCSVFile(path string, header []string) (*csvFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	cf := &csvFile{f: f, w: csv.NewWriter(f)}
+	if strings.EqualFold(filepath.Ext(path), ".tsv") {
+		cf.w.Comma = '\t'
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		if err := cf.write(header); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return cf, nil
+}
+
+func (cf *csvFile) write(row []string) error {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	cf.w.Write(row)
+	cf.w.Flush()
+	return cf.w.Error()
+}
+
+func (cf *csvFile) close() error {
+	return cf.f.Close()
+}
+
+// timeseriesPath returns the path of the time-series file of -csv-out,
+// ex) results.csv -> results.timeseries.csv
+func timeseriesPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".timeseries" + ext
+}
+
+// csvExporter writes the metrics of the sessions of a run to -csv-out.
+type csvExporter struct {
+	sessions   *csvFile
+	timeseries *csvFile
+}
+
+func newCSVExporter(path string) (*csvExporter, error) {
+	sessions, err := openCSVFile(path, sessionColumns)
+	if err != nil {
+		return nil, err
+	}
+	timeseries, err := openCSVFile(timeseriesPath(path), timeseriesColumns)
+	if err != nil {
+		sessions.close()
+		return nil, err
+	}
+	return &csvExporter{sessions: sessions, timeseries: timeseries}, nil
+}
+
+func (e *csvExporter) close() {
+	e.sessions.close()
+	e.timeseries.close()
+}
+
+func formatMillis(d duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+func formatUint(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
+
+func formatBitrate(b bitrate) string {
+	return strconv.FormatFloat(float64(b), 'f', 0, 64)
+}
+
+// sessionRow returns the row of -csv-out of a finished session.
+func sessionRow(runName string, s *session, err error) []string {
+	ss := s.snapshot()
+	result, failure, errStr := "ok", "", ""
+	if err != nil {
+		result, failure, errStr = "failed", s.failure, err.Error()
+		if failure == "" {
+			failure = "other"
+		}
+	}
+
+	var lost int64
+	var maxJitter duration
+	for _, t := range ss.Tracks {
+		lost += t.Lost
+		for _, st := range t.SSRCs {
+			if st.Jitter > maxJitter {
+				maxJitter = st.Jitter
+			}
+		}
+	}
+
+	firstPacket := ""
+	var minFirst duration
+	for _, d := range ss.FirstPacket {
+		if firstPacket == "" || d < minFirst {
+			minFirst = d
+			firstPacket = formatMillis(d)
+		}
+	}
+
+	phase := func(name string) string {
+		if d, ok := ss.Handshake[name]; ok {
+			return formatMillis(d)
+		}
+		return ""
+	}
+
+	var srs, srAlarms uint64
+	for _, st := range ss.RTCP {
+		srs += st.SenderReports
+		srAlarms += st.IntervalAlarms
+	}
+
+	var keyframes, gopAlarms uint64
+	var maxGOP duration
+	for _, st := range ss.GOP {
+		keyframes += st.Keyframes
+		gopAlarms += st.Alarms
+		if st.MaxInterval > maxGOP {
+			maxGOP = st.MaxInterval
+		}
+	}
+
+	var aus, malformed uint64
+	for _, st := range ss.Bitstream {
+		aus += st.AccessUnits
+		malformed += st.Malformed
+	}
+
+	return []string{
+		timestamp(ss.Time), runName, ss.ID, ss.URL, ss.Class, result, failure, errStr, ss.Transport,
+		formatUint(ss.Packets), formatUint(ss.Bytes), strconv.FormatInt(lost, 10), formatMillis(maxJitter),
+		formatBitrate(ss.Bitrate.Average), formatBitrate(ss.Bitrate.Min), formatBitrate(ss.Bitrate.Max),
+		phase("connect"), phase("OPTIONS"), phase("DESCRIBE"), phase("SETUP"), phase("PLAY"), firstPacket,
+		formatUint(srs), formatUint(srAlarms),
+		formatUint(keyframes), formatMillis(maxGOP), formatUint(gopAlarms),
+		formatUint(aus), formatUint(malformed),
+		ss.Labels.String(),
+	}
+}
+
+func (e *csvExporter) addResult(runName string, s *session, err error) error {
+	return e.sessions.write(sessionRow(runName, s, err))
+}
+
+// sampleSessions appends a row of the running sessions of r to the time-series file
+// every interval until the returned func is called.
+func (e *csvExporter) sampleSessions(r *run, interval time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case now := <-t.C:
+				tot := r.totals()
+				row := []string{
+					timestamp(now), r.name, strconv.Itoa(tot.Sessions), strconv.Itoa(tot.Playing),
+					formatUint(tot.Packets), formatUint(tot.Bytes), formatBitrate(tot.Bitrate),
+					r.cfg.runLabels().String(),
+				}
+				if err := e.timeseries.write(row); err != nil {
+					r.logger.Printf("failed to write csv time series, %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+func init() {
+	registerFeature("dashboard")
+}
+
+// maxErrorEvents is the number of last session errors kept for the dashboard.
+const maxErrorEvents = 100
+
+// errorEvent is a failed session of the error feed.
+type errorEvent struct {
+	Time  time.Time `json:"time"`
+	ID    string    `json:"id"`
+	URL   string    `json:"url"`
+	Error string    `json:"error"`
+}
+
+func (r *run) recordError(s *session, err error) {
+	r.errorsMu.Lock()
+	defer r.errorsMu.Unlock()
+	r.errors = append(r.errors, errorEvent{Time: time.Now().In(tz), ID: s.id, URL: s.url, Error: err.Error()})
+	r.errorsTotal++
+	if len(r.errors) > maxErrorEvents {
+		r.errors = r.errors[len(r.errors)-maxErrorEvents:]
+	}
+}
+
+// handleErrors returns the last session errors, newest first.
+func (r *run) handleErrors(w http.ResponseWriter, req *http.Request) {
+	r.errorsMu.Lock()
+	l := make([]errorEvent, len(r.errors))
+	for i, e := range r.errors {
+		l[len(l)-1-i] = e
+	}
+	r.errorsMu.Unlock()
+	writeJSON(w, http.StatusOK, l)
+}
+
+// handleDashboard serves the web dashboard, it polls the sessions and errors
+// of the control api relative to its path.
+func handleDashboard(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(dashboardHTML))
+}
+
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>rtspclient</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.1em; margin-top: 1.5em; }
+table { border-collapse: collapse; font-size: 0.9em; }
+th, td { border: 1px solid #ccc; padding: 3px 8px; text-align: right; }
+th { background: #f0f0f0; }
+td.l { text-align: left; }
+.summary span { margin-right: 2em; }
+.failed { color: #c00; }
+svg.spark { vertical-align: middle; }
+</style>
+</head>
+<body>
+<h1>rtspclient</h1>
+<div class="summary">
+<span>sessions <b id="sessions">-</b></span>
+<span>playing <b id="playing">-</b></span>
+<span>bitrate <b id="bitrate">-</b></span>
+<svg id="total" class="spark" width="240" height="30"></svg>
+<span id="status"></span>
+</div>
+<h2>sessions</h2>
+<table>
+<thead><tr><th>id</th><th>state</th><th>packets</th><th>bytes</th><th>lost</th><th>bitrate</th><th>last 60s</th></tr></thead>
+<tbody id="rows"></tbody>
+</table>
+<h2>errors</h2>
+<table>
+<thead><tr><th>time</th><th>id</th><th>error</th></tr></thead>
+<tbody id="errors"></tbody>
+</table>
+<script>
+var historySize = 60;
+var history = {};
+var totalHistory = [];
+
+function humanBitrate(v) {
+  var units = ["bps", "Kbps", "Mbps", "Gbps"];
+  var i = 0;
+  while (v >= 1000 && i < units.length - 1) { v /= 1000; i++; }
+  return v.toFixed(2) + " " + units[i];
+}
+
+function push(l, v) {
+  l.push(v);
+  if (l.length > historySize) { l.shift(); }
+}
+
+function sparkline(svg, l) {
+  var w = +svg.getAttribute("width"), h = +svg.getAttribute("height");
+  var max = Math.max.apply(null, l.concat([1]));
+  var pts = l.map(function (v, i) {
+    return (i * w / (historySize - 1)).toFixed(1) + "," + (h - 1 - v * (h - 2) / max).toFixed(1);
+  });
+  svg.innerHTML = '<polyline fill="none" stroke="#36c" stroke-width="1.5" points="' + pts.join(" ") + '"/>';
+}
+
+function cell(text, cls) {
+  var td = document.createElement("td");
+  td.textContent = text;
+  if (cls) { td.className = cls; }
+  return td;
+}
+
+function updateSessions(sessions) {
+  var total = 0, playing = 0, seen = {};
+  var rows = document.getElementById("rows");
+  rows.innerHTML = "";
+  sessions.forEach(function (s) {
+    seen[s.id] = true;
+    total += s.bitrate;
+    if (s.state === "playing" || s.state === "recording") { playing++; }
+    var h = history[s.id] || (history[s.id] = []);
+    push(h, s.bitrate);
+    var tr = document.createElement("tr");
+    tr.appendChild(cell(s.id, "l"));
+    tr.appendChild(cell(s.state, "l"));
+    tr.appendChild(cell(s.packets));
+    tr.appendChild(cell(s.bytes));
+    tr.appendChild(cell(s.lost));
+    tr.appendChild(cell(humanBitrate(s.bitrate)));
+    var td = document.createElement("td");
+    var svg = document.createElementNS("http://www.w3.org/2000/svg", "svg");
+    svg.setAttribute("class", "spark");
+    svg.setAttribute("width", "120");
+    svg.setAttribute("height", "20");
+    sparkline(svg, h);
+    td.appendChild(svg);
+    tr.appendChild(td);
+    rows.appendChild(tr);
+  });
+  Object.keys(history).forEach(function (id) {
+    if (!seen[id]) { delete history[id]; }
+  });
+  push(totalHistory, total);
+  sparkline(document.getElementById("total"), totalHistory);
+  document.getElementById("sessions").textContent = sessions.length;
+  document.getElementById("playing").textContent = playing;
+  document.getElementById("bitrate").textContent = humanBitrate(total);
+}
+
+function updateErrors(errors) {
+  var rows = document.getElementById("errors");
+  rows.innerHTML = "";
+  errors.forEach(function (e) {
+    var tr = document.createElement("tr");
+    tr.appendChild(cell(e.time, "l"));
+    tr.appendChild(cell(e.id, "l"));
+    tr.appendChild(cell(e.error, "l failed"));
+    rows.appendChild(tr);
+  });
+}
+
+function poll() {
+  Promise.all([
+    fetch("sessions").then(function (r) { return r.json(); }),
+    fetch("errors").then(function (r) { return r.json(); })
+  ]).then(function (res) {
+    updateSessions(res[0]);
+    updateErrors(res[1]);
+    document.getElementById("status").textContent = "";
+  }).catch(function (err) {
+    document.getElementById("status").textContent = "disconnected, " + err;
+    document.getElementById("status").className = "failed";
+  });
+}
+
+poll();
+setInterval(poll, 1000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/pion/rtp"
+)
+
+var (
+	errMorePacketsNeeded = errors.New("need more packets")
+	errNonStartingPacket = errors.New("received a non-starting fragment without any previous starting fragment")
+	// a non-starting fragment after a lost one, the access unit can't be completed
+	errNonStartingFragment = errors.New("invalid fragmentation unit (non-starting)")
+)
+
+var annexBStartCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// fragmentPool pools the buffers joining the fragmented NALUs, shared by the sessions.
+// A buffer is taken at the first fragment of an access unit and put back after the access unit.
+var fragmentPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 64*1024)
+		return &b
+	},
+}
+
+// auDepacketizer depacketizes the access units of H264 (RFC 6184) and H265 (RFC 7798)
+// as the decoders of gortsplib, without allocating once its NALU list has grown:
+// the NALUs reference the payloads of the packets, the fragmented ones are joined in a buffer of fragmentPool.
+// An access unit returned by Decode is valid until the next call.
+type auDepacketizer struct {
+	h265 bool
+
+	// NALUs of the access unit being received and their size
+	nalus [][]byte
+	size  int
+	// fragmented NALUs of the access unit, nil if none
+	buf *[]byte
+	// start in buf of the NALU being joined, -1 if none
+	fragment int
+	// a starting packet has been received
+	started bool
+	// the wrapping of the NALUs of some servers in Annex B, H264 only
+	annexB bool
+	// the access unit has been returned by Decode
+	returned bool
+}
+
+// newDepacketizer returns the depacketizer of a H264 or H265 format, nil for the other formats.
+func newDepacketizer(forma format.Format) (*auDepacketizer, error) {
+	switch f := forma.(type) {
+	case *format.H264:
+		if f.PacketizationMode >= 2 {
+			return nil, fmt.Errorf("PacketizationMode >= 2 is not supported")
+		}
+		return &auDepacketizer{fragment: -1}, nil
+	case *format.H265:
+		return &auDepacketizer{h265: true, fragment: -1}, nil
+	}
+	return nil, nil
+}
+
+// Decode returns the access unit completed by the packet, errMorePacketsNeeded if it is not complete.
+func (d *auDepacketizer) Decode(pkt *rtp.Packet) ([][]byte, error) {
+	if d.returned {
+		d.reset()
+	}
+	if err := d.decodeNALUs(pkt); err != nil {
+		return nil, err
+	}
+
+	maxNALUs, maxSize := h264.MaxNALUsPerAccessUnit, h264.MaxAccessUnitSize
+	if d.h265 {
+		maxNALUs, maxSize = h265.MaxNALUsPerAccessUnit, h265.MaxAccessUnitSize
+	}
+	if n := len(d.nalus); n > maxNALUs {
+		d.reset()
+		return nil, fmt.Errorf("NALU count (%d) exceeds maximum allowed (%d)", n, maxNALUs)
+	}
+	if size := d.size; size > maxSize {
+		d.reset()
+		return nil, fmt.Errorf("access unit size (%d) is too big, maximum is %d", size, maxSize)
+	}
+	if !pkt.Marker {
+		return nil, errMorePacketsNeeded
+	}
+	d.returned = true
+	return d.nalus, nil
+}
+
+// reset releases the access unit and its buffer.
+func (d *auDepacketizer) reset() {
+	for i := range d.nalus {
+		d.nalus[i] = nil
+	}
+	d.nalus, d.size, d.fragment, d.returned = d.nalus[:0], 0, -1, false
+	if d.buf != nil {
+		*d.buf = (*d.buf)[:0]
+		fragmentPool.Put(d.buf)
+		d.buf = nil
+	}
+}
+
+func (d *auDepacketizer) add(nalu []byte) {
+	d.nalus = append(d.nalus, nalu)
+	d.size += len(nalu)
+}
+
+// discardFragment discards the fragmented NALU being joined if any.
+func (d *auDepacketizer) discardFragment() {
+	if d.fragment >= 0 {
+		*d.buf = (*d.buf)[:d.fragment]
+		d.fragment = -1
+	}
+}
+
+// decodeNALUs adds the NALUs of a packet to the access unit.
+func (d *auDepacketizer) decodeNALUs(pkt *rtp.Packet) error {
+	p := pkt.Payload
+	if d.h265 {
+		if len(p) < 2 {
+			d.discardFragment()
+			return fmt.Errorf("payload is too short")
+		}
+		switch typ := h265.NALUType((p[0] >> 1) & 0x3F); typ {
+		case h265.NALUType_AggregationUnit:
+			return d.aggregated(p[2:])
+		case h265.NALUType_FragmentationUnit:
+			if len(p) < 3 {
+				d.discardFragment()
+				return fmt.Errorf("payload is too short")
+			}
+			head := uint16(p[0]&0x81)<<8 | uint16(p[2]&0x3F)<<9 | uint16(p[1])
+			return d.fragmented(p[2]&0x80 != 0, p[2]&0x40 != 0, []byte{byte(head >> 8), byte(head)}, p[3:], h265.MaxAccessUnitSize)
+		case h265.NALUType_PACI:
+			d.discardFragment()
+			d.started = true
+			return fmt.Errorf("PACI packets are not supported (yet)")
+		}
+		d.discardFragment()
+		d.started = true
+		d.add(p)
+		return nil
+	}
+
+	if len(p) < 1 {
+		d.discardFragment()
+		return fmt.Errorf("payload is too short")
+	}
+	switch typ := h264.NALUType(p[0] & 0x1F); typ {
+	case h264.NALUTypeSTAPA:
+		return d.aggregated(p[1:])
+	case h264.NALUTypeFUA:
+		if len(p) < 2 {
+			return fmt.Errorf("invalid FU-A packet (invalid size)")
+		}
+		return d.fragmented(p[1]&0x80 != 0, p[1]&0x40 != 0, []byte{p[0]&0x60 | p[1]&0x1F}, p[2:], h264.MaxAccessUnitSize)
+	case h264.NALUTypeSTAPB, h264.NALUTypeMTAP16, h264.NALUTypeMTAP24, h264.NALUTypeFUB:
+		d.discardFragment()
+		d.started = true
+		return fmt.Errorf("packet type not supported (%v)", typ)
+	}
+	d.discardFragment()
+	d.started = true
+	d.addH264(p)
+	return nil
+}
+
+// aggregated adds the NALUs of a STAP-A (H264) or of an aggregation unit (H265).
+func (d *auDepacketizer) aggregated(p []byte) error {
+	d.discardFragment()
+	n := 0
+	for len(p) > 0 {
+		if len(p) < 2 {
+			return fmt.Errorf("invalid aggregation unit (invalid size)")
+		}
+		size := int(p[0])<<8 | int(p[1])
+		p = p[2:]
+		// padding
+		if size == 0 {
+			break
+		}
+		if size > len(p) {
+			return fmt.Errorf("invalid aggregation unit (invalid size)")
+		}
+		d.add(p[:size])
+		p = p[size:]
+		n++
+	}
+	if n == 0 {
+		return fmt.Errorf("aggregation unit doesn't contain any NALU")
+	}
+	d.started = true
+	return nil
+}
+
+// fragmented joins the fragments of a FU-A (H264) or of a fragmentation unit (H265) in the buffer,
+// head is the NALU header rebuilt from the FU header.
+func (d *auDepacketizer) fragmented(start, end bool, head, p []byte, maxSize int) error {
+	if start {
+		d.discardFragment()
+		if end {
+			return fmt.Errorf("invalid fragmentation unit (can't contain both a start and end bit)")
+		}
+		if d.buf == nil {
+			d.buf = fragmentPool.Get().(*[]byte)
+		}
+		d.fragment = len(*d.buf)
+		*d.buf = append(append(*d.buf, head...), p...)
+		d.started = true
+		return errMorePacketsNeeded
+	}
+	if d.fragment < 0 {
+		if !d.started {
+			return errNonStartingPacket
+		}
+		return errNonStartingFragment
+	}
+	if size := len(*d.buf) - d.fragment + len(p); size > maxSize {
+		d.discardFragment()
+		return fmt.Errorf("NALU size (%d) is too big, maximum is %d", size, maxSize)
+	}
+	*d.buf = append(*d.buf, p...)
+	if !end {
+		return errMorePacketsNeeded
+	}
+	nalu := (*d.buf)[d.fragment:]
+	d.fragment = -1
+	if d.h265 {
+		d.add(nalu)
+	} else {
+		d.addH264(nalu)
+	}
+	return nil
+}
+
+// addH264 adds a NALU, split if the server wraps the NALUs in Annex B.
+func (d *auDepacketizer) addH264(nalu []byte) {
+	if !d.annexB && bytes.Contains(nalu, annexBStartCode) {
+		d.annexB = true
+	}
+	if !d.annexB {
+		d.add(nalu)
+		return
+	}
+	// the NALUs between the start codes, without copy
+	start, zeros := 0, 0
+	for i, b := range nalu {
+		switch {
+		case b == 0:
+			zeros++
+			continue
+		case b == 1 && zeros >= 2:
+			if end := i - zeros; end > start {
+				d.add(nalu[start:end])
+			}
+			start = i + 1
+		}
+		zeros = 0
+	}
+	if start < len(nalu) {
+		d.add(nalu[start:])
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/sdp"
+)
+
+func init() {
+	registerFeature("describe-cache")
+}
+
+// describeCache is the DESCRIBE response of each url of -describe-cache,
+// the first session of a url sends the DESCRIBE and the others parse its response.
+type describeCache struct {
+	mu      sync.Mutex
+	entries map[string]*describeEntry
+	hits    int
+}
+
+type describeEntry struct {
+	// closed once the first session has described
+	done chan struct{}
+	// nil if the DESCRIBE failed or is not cached
+	res *base.Response
+}
+
+func newDescribeCache() *describeCache {
+	return &describeCache{entries: make(map[string]*describeEntry)}
+}
+
+// describe returns the description of the url, from the cache if a session has described it.
+// It returns whether it is from the cache.
+func (dc *describeCache) describe(c *gortsplib.Client, u *base.URL) (*description.Session, *base.Response, bool, error) {
+	key := u.String()
+	dc.mu.Lock()
+	e, ok := dc.entries[key]
+	if !ok {
+		e = &describeEntry{done: make(chan struct{})}
+		dc.entries[key] = e
+	}
+	dc.mu.Unlock()
+
+	if !ok {
+		desc, res, err := c.Describe(u)
+		switch {
+		case err != nil:
+			// the next session describes again
+			dc.mu.Lock()
+			delete(dc.entries, key)
+			dc.mu.Unlock()
+		case desc.BaseURL.Host == u.Host:
+			// a redirected description is not cached, the SETUP would be sent to the other server
+			dc.mu.Lock()
+			e.res = res
+			dc.mu.Unlock()
+		}
+		close(e.done)
+		return desc, res, false, err
+	}
+
+	<-e.done
+	if e.res == nil {
+		desc, res, err := c.Describe(u)
+		return desc, res, false, err
+	}
+	desc, err := parseDescribe(e.res, u)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	dc.mu.Lock()
+	dc.hits++
+	dc.mu.Unlock()
+	return desc, e.res, true, nil
+}
+
+// stats returns the cached urls and the sessions described from the cache.
+func (dc *describeCache) stats() (urls, hits int) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	for _, e := range dc.entries {
+		if e.res != nil {
+			urls++
+		}
+	}
+	return urls, dc.hits
+}
+
+func (r *run) logDescribeCache() {
+	if r.describeCache == nil {
+		return
+	}
+	urls, hits := r.describeCache.stats()
+	r.logger.Printf(r.cfg.tr("describe cache: urls %d, sessions described from the cache %d"), urls, hits)
+}
+
+// parseDescribe parses the description of a DESCRIBE response as the client, each session gets its own copy.
+func parseDescribe(res *base.Response, u *base.URL) (*description.Session, error) {
+	var ssd sdp.SessionDescription
+	if err := ssd.Unmarshal(res.Body); err != nil {
+		return nil, fmt.Errorf("invalid SDP, %v", err)
+	}
+	var desc description.Session
+	if err := desc.Unmarshal(&ssd); err != nil {
+		return nil, fmt.Errorf("invalid SDP, %v", err)
+	}
+
+	// the global control attribute, the Content-Base or the url
+	desc.BaseURL = u
+	if control, ok := ssd.Attribute("control"); ok && control != "*" {
+		cu, err := base.ParseURL(control)
+		if err != nil {
+			return nil, fmt.Errorf("invalid control attribute %q", control)
+		}
+		cu.User = u.User
+		desc.BaseURL = cu
+	} else if cb, ok := res.Header["Content-Base"]; ok {
+		if len(cb) != 1 {
+			return nil, fmt.Errorf("invalid Content-Base %q", strings.Join(cb, ", "))
+		}
+		cu, err := base.ParseURL(cb[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid Content-Base %q", cb[0])
+		}
+		cu.User = u.User
+		desc.BaseURL = cu
+	}
+	return &desc, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/liberrors"
+)
+
+func init() {
+	registerFeature("describe-load")
+}
+
+// describeLoad are the results of the DESCRIBE requests of -describe-rate.
+type describeLoad struct {
+	mu      sync.Mutex
+	sent    int
+	ok      int
+	skipped int
+	errors  map[string]int
+}
+
+func (dl *describeLoad) done(err error) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if err == nil {
+		dl.ok++
+		return
+	}
+	dl.errors[describeErrorCategory(err)]++
+}
+
+// describeErrorCategory returns the category of the error of a DESCRIBE request, the status code of the response
+// or the kind of network error.
+func describeErrorCategory(err error) string {
+	var status liberrors.ErrClientBadStatusCode
+	var netErr net.Error
+	switch {
+	case errors.As(err, &status):
+		return fmt.Sprintf("status %d", status.Code)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF):
+		return "connection closed"
+	}
+	return err.Error()
+}
+
+// describeLoad sends only DESCRIBE requests, each on a new connection, at -describe-rate across the urls
+// for -describe-duration, to load the catalog behind DESCRIBE without streaming. At most -describe-concurrency
+// requests are in progress, the requests beyond are skipped: the server does not sustain the rate.
+// The connect and DESCRIBE times go to the handshake latency percentiles.
+func (r *run) describeLoad() error {
+	cfg := r.cfg
+	urls := cfg.urls()
+	r.stagger.shuffle(len(urls), func(i, j int) { urls[i], urls[j] = urls[j], urls[i] })
+	r.logger.Printf("describe load: %s requests/s over %d urls for %s, at most %d in progress",
+		cfg.human().float(cfg.describeRate), len(urls), cfg.describeDuration, cfg.describeConcurrency)
+
+	dl := &describeLoad{errors: make(map[string]int)}
+	inFlight := make(chan struct{}, cfg.describeConcurrency)
+	var wg sync.WaitGroup
+	interval := time.Duration(float64(time.Second) / cfg.describeRate)
+	start := time.Now()
+	for i := 0; ; i++ {
+		next := start.Add(time.Duration(i) * interval)
+		if next.Sub(start) >= cfg.describeDuration {
+			break
+		}
+		time.Sleep(time.Until(next))
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			dl.mu.Lock()
+			dl.skipped++
+			dl.mu.Unlock()
+			continue
+		}
+		dl.mu.Lock()
+		dl.sent++
+		dl.mu.Unlock()
+		u := r.expandURL(urls[i%len(urls)], int64(i+1))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			dl.done(r.describe(u))
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	failed := dl.sent - dl.ok
+	rate := 0.0
+	if dl.sent != 0 {
+		rate = float64(failed) * 100 / float64(dl.sent)
+	}
+	h := cfg.human()
+	r.logger.Printf(cfg.tr("describe load: sent %d (%s/s), ok %d, failed %d (%s%%), skipped %d over -describe-concurrency"),
+		dl.sent, h.float(float64(dl.sent)/elapsed.Seconds()), dl.ok, failed, h.float(rate), dl.skipped)
+	categories := make([]string, 0, len(dl.errors))
+	for c := range dl.errors {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+	for _, c := range categories {
+		r.logger.Printf(cfg.tr("describe load errors %s: %d"), c, dl.errors[c])
+	}
+	if dl.sent != 0 && dl.ok == 0 {
+		return fmt.Errorf("all %d DESCRIBE requests failed", dl.sent)
+	}
+	return nil
+}
+
+// describe sends a DESCRIBE request to rawURL on a new connection, and records its latency.
+func (r *run) describe(rawURL string) error {
+	u, err := base.ParseURL(rawURL)
+	if err != nil {
+		return err
+	}
+	var ht handshakeTimer
+	localIP := r.sources.get()
+	c := gortsplib.Client{
+		ReadTimeout:  r.cfg.readTimeout,
+		WriteTimeout: r.cfg.writeTimeout,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			start := time.Now()
+			address, err := r.resolver.address(ctx, address, make(map[string]net.IP))
+			if err != nil {
+				return nil, err
+			}
+			conn, err := r.sources.dial(ctx, localIP, network, address)
+			if err == nil {
+				ht.connected(time.Since(start))
+			}
+			return conn, err
+		},
+		OnRequest: func(req *base.Request) {
+			r.cfg.headers.apply(req)
+			ht.onRequest(req)
+		},
+		OnResponse: func(res *base.Response) {
+			ht.onResponse(res)
+			if ct := res.Header["Content-Type"]; len(ct) == 1 && strings.HasPrefix(ct[0], "application/sdp") {
+				res.Body, _ = r.cfg.clockRates.fixSDP(fixTextMedias(res.Body))
+			}
+		},
+	}
+	if err := c.Start(u.Scheme, u.Host); err != nil {
+		return err
+	}
+	defer c.Close()
+	if _, _, err := c.Describe(u); err != nil {
+		return err
+	}
+	r.latency.record(ht.snapshot())
+	return nil
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	registerFeature("agent")
+}
+
+// controllerOnlyFlags are the flags of the controller that are not passed to the agents.
+var controllerOnlyFlags = map[string]bool{
+	"mode":         true,
+	"agents":       true,
+	"agent-token":  true,
+	"api-addr":     true,
+	"grpc-addr":    true,
+	"tenants":      true,
+	"watchdog":     true,
+	"timezone":     true,
+	"gogc":         true,
+	"ballast":      true,
+	"memory-limit": true,
+	"version":      true,
+}
+
+// agentRejectedFlags are the flags an agent does not run: the commands and the files
+// written on the host of the agent are not for the controller to choose.
+var agentRejectedFlags = map[string]bool{
+	"exec":         true,
+	"exec-session": true,
+	"report":       true,
+	"csv-out":      true,
+	"log-file":     true,
+	"pcap-dir":     true,
+	"ts-dir":       true,
+	"subtitle-dir": true,
+	"state-file":   true,
+	"manifest":     true,
+}
+
+// rejectedAgentFlags returns the flags of agentRejectedFlags set in fs.
+func rejectedAgentFlags(fs *flag.FlagSet) []string {
+	var ret []string
+	fs.Visit(func(f *flag.Flag) {
+		if agentRejectedFlags[f.Name] {
+			ret = append(ret, "-"+f.Name)
+		}
+	})
+	return ret
+}
+
+// agentStatusInterval is the interval the controller polls the status of the agents.
+const agentStatusInterval = 5 * time.Second
+
+// agentStatusFailures is the number of consecutive status failures after which an agent is failed.
+const agentStatusFailures = 6
+
+// agentPlan is the part of the load of a controller assigned to an agent.
+type agentPlan struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+}
+
+// agentStatus is the state of the run of an agent.
+type agentStatus struct {
+	Name      string    `json:"name"`
+	Running   bool      `json:"running"`
+	Finished  bool      `json:"finished"`
+	Error     string    `json:"error,omitempty"`
+	Totals    runTotals `json:"totals"`
+	Succeeded int64     `json:"succeeded"`
+	Failed    int64     `json:"failed"`
+}
+
+// agent runs the plans sent by a controller, one at a time.
+type agent struct {
+	// shared with the controller, sent as "Authorization: Bearer <token>"
+	token string
+
+	mu       sync.Mutex
+	r        *run
+	finished bool
+	err      error
+}
+
+func (a *agent) status() agentStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var st agentStatus
+	if a.r == nil {
+		return st
+	}
+	st.Name = a.r.name
+	st.Running = !a.finished
+	st.Finished = a.finished
+	if a.err != nil {
+		st.Error = a.err.Error()
+	}
+	st.Totals = a.r.totals()
+	st.Succeeded = atomic.LoadInt64(&a.r.succeeded)
+	st.Failed = atomic.LoadInt64(&a.r.failed)
+	return st
+}
+
+// authorized serves the requests of the controller with the token of the agent, the others get 401.
+func (a *agent) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		got := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(a.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid agent token"))
+			return
+		}
+		h(w, req)
+	}
+}
+
+// handleRun starts the run of the plan posted by the controller.
+func (a *agent) handleRun(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var plan agentPlan
+	if err := json.NewDecoder(req.Body).Decode(&plan); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cfg := &config{}
+	fs := newFlagSet(plan.Name, cfg, flag.ContinueOnError)
+	if err := parseConfig(fs, plan.Args); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid args, %v", err))
+		return
+	}
+	if flags := rejectedAgentFlags(fs); len(flags) != 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s not allowed on the agents", strings.Join(flags, " ")))
+		return
+	}
+	if err := cfg.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid args, %v", err))
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.r != nil && !a.finished {
+		writeError(w, http.StatusConflict, fmt.Errorf("already running %s", a.r.name))
+		return
+	}
+	r, err := newRun(plan.Name, cfg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	a.r, a.finished, a.err = r, false, nil
+	r.logger.Printf("run started by the controller %s, %s", req.RemoteAddr, strings.Join(plan.Args, " "))
+
+	go func() {
+		err := r.start()
+		a.mu.Lock()
+		a.finished, a.err = true, err
+		a.mu.Unlock()
+		if err != nil {
+			r.logger.Printf("run finished with errors, %v", err)
+		} else {
+			r.logger.Printf("run finished")
+		}
+	}()
+	writeJSON(w, http.StatusAccepted, plan)
+}
+
+func (a *agent) handleStatus(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, a.status())
+}
+
+// runAgent serves the agent api on addr, it does not return unless the server fails.
+// Only the controller with the token runs plans.
+func runAgent(addr, token string) error {
+	a := &agent{token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", handleVersion)
+	mux.HandleFunc("/capabilities", handleCapabilities)
+	mux.HandleFunc("/agent/run", a.authorized(a.handleRun))
+	mux.HandleFunc("/agent/status", a.authorized(a.handleStatus))
+	log.Printf("agent listening on %s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// agentArgs returns the args of the controller to pass to the agents,
+// without the controller only flags.
+func agentArgs(fs *flag.FlagSet, args []string) []string {
+	var ret []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" || !strings.HasPrefix(a, "-") {
+			ret = append(ret, args[i:]...)
+			break
+		}
+		name := strings.TrimLeft(a, "-")
+		hasValue := strings.Contains(name, "=")
+		if hasValue {
+			name = name[:strings.Index(name, "=")]
+		}
+		takesValue := !hasValue
+		if f := fs.Lookup(name); f != nil {
+			if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+				takesValue = false
+			}
+		}
+		if controllerOnlyFlags[name] {
+			if takesValue {
+				i++
+			}
+			continue
+		}
+		ret = append(ret, a)
+		if takesValue && i+1 < len(args) {
+			i++
+			ret = append(ret, args[i])
+		}
+	}
+	return ret
+}
+
+// splitLoad divides the sessions of cfg among n agents,
+// the {NUM} range into contiguous ranges or the count, and returns the overriding args of each agent.
+// Agents without sessions get nil.
+func splitLoad(cfg *config, n int) [][]string {
+	ret := make([][]string, n)
+	if strings.Contains(cfg.url, "{NUM}") {
+		total := cfg.nEnd - cfg.nStart + 1
+		start := cfg.nStart
+		for i := 0; i < n; i++ {
+			k := total / n
+			if i < total%n {
+				k++
+			}
+			if k == 0 {
+				continue
+			}
+			ret[i] = []string{"-start", strconv.Itoa(start), "-end", strconv.Itoa(start + k - 1)}
+			start += k
+		}
+		return ret
+	}
+	for i := 0; i < n; i++ {
+		k := cfg.count / n
+		if i < cfg.count%n {
+			k++
+		}
+		if k == 0 {
+			continue
+		}
+		ret[i] = []string{"-count", strconv.Itoa(k)}
+	}
+	return ret
+}
+
+// agentClient is the controller side of an agent.
+type agentClient struct {
+	addr   string
+	token  string
+	client http.Client
+
+	// consecutive status failures of the controller, lost past agentStatusFailures
+	failures int
+	lost     error
+}
+
+func (ac *agentClient) do(method, path string, body, resp interface{}) error {
+	var b bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&b).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, "http://"+ac.addr+path, &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+ac.token)
+	res, err := ac.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(res.Body).Decode(&e)
+		return fmt.Errorf("bad status %s, %s", res.Status, e.Error)
+	}
+	if resp != nil {
+		return json.NewDecoder(res.Body).Decode(resp)
+	}
+	return nil
+}
+
+// runController checks the agents, assigns them the load of cfg,
+// and logs their aggregated status until all of them finish.
+func runController(cfg *config, fs *flag.FlagSet, args []string, agents []string, token string) error {
+	// the features the agents need to run the plan
+	acfg := *cfg
+	acfg.apiAddr, acfg.grpcAddr, acfg.tenants, acfg.watchdogThreshold = "", "", "", 0
+	required := append(acfg.requiredFeatures(), "agent")
+	want := getBuildInfo().Version
+
+	clients := make([]*agentClient, len(agents))
+	var errs []string
+	for i, addr := range agents {
+		clients[i] = &agentClient{addr: addr, token: token, client: http.Client{Timeout: 10 * time.Second}}
+		bi, err := fetchCapabilities(addr, 10*time.Second)
+		if err == nil {
+			err = bi.checkCapabilities(want, required)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("  %s: %v", addr, err))
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("agents do not match the plan:\n%s", strings.Join(errs, "\n"))
+	}
+
+	base := agentArgs(fs, args)
+	loads := splitLoad(cfg, len(agents))
+	var started []*agentClient
+	for i, ac := range clients {
+		if loads[i] == nil {
+			log.Printf("[%s] no sessions to assign", ac.addr)
+			continue
+		}
+		plan := agentPlan{Name: ac.addr, Args: append(append([]string(nil), base...), loads[i]...)}
+		if err := ac.do(http.MethodPost, "/agent/run", plan, nil); err != nil {
+			return fmt.Errorf("[%s] failed to start, %v", ac.addr, err)
+		}
+		log.Printf("[%s] started, %s", ac.addr, strings.Join(loads[i], " "))
+		started = append(started, ac)
+	}
+
+	t := time.NewTicker(agentStatusInterval)
+	defer t.Stop()
+	h := cfg.human()
+	for range t.C {
+		var total agentStatus
+		var failedAgents []string
+		finished := 0
+		for _, ac := range started {
+			if ac.lost != nil {
+				finished++
+				failedAgents = append(failedAgents, ac.addr+": "+ac.lost.Error())
+				continue
+			}
+			var st agentStatus
+			if err := ac.do(http.MethodGet, "/agent/status", nil, &st); err != nil {
+				ac.failures++
+				log.Printf("[%s] failed to get status (%d/%d), %v", ac.addr, ac.failures, agentStatusFailures, err)
+				if ac.failures >= agentStatusFailures {
+					ac.lost = fmt.Errorf("lost, no status for %d polls, %v", ac.failures, err)
+					log.Printf("[%s] %v", ac.addr, ac.lost)
+					finished++
+					failedAgents = append(failedAgents, ac.addr+": "+ac.lost.Error())
+				}
+				continue
+			}
+			ac.failures = 0
+			log.Printf("[%s] sessions %d playing %d bitrate %s succeeded %d failed %d",
+				ac.addr, st.Totals.Sessions, st.Totals.Playing, h.bitrate(st.Totals.Bitrate),
+				st.Succeeded, st.Failed)
+			total.Totals.Sessions += st.Totals.Sessions
+			total.Totals.Playing += st.Totals.Playing
+			total.Totals.Bitrate += st.Totals.Bitrate
+			total.Succeeded += st.Succeeded
+			total.Failed += st.Failed
+			if st.Finished {
+				finished++
+				if st.Error != "" {
+					failedAgents = append(failedAgents, ac.addr+": "+st.Error)
+				}
+			}
+		}
+		log.Printf("total: agents %d/%d finished, sessions %d playing %d bitrate %s succeeded %d failed %d",
+			finished, len(started), total.Totals.Sessions, total.Totals.Playing,
+			h.bitrate(total.Totals.Bitrate), total.Succeeded, total.Failed)
+		if finished == len(started) {
+			if len(failedAgents) != 0 {
+				return fmt.Errorf("agents finished with errors, %s", strings.Join(failedAgents, ", "))
+			}
+			return nil
+		}
+	}
+	return nil
+}
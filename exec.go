@@ -0,0 +1,168 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("exec")
+	registerCodec("exec", "H264", "H265")
+}
+
+// execPipe pipes the stream of a session into the stdin of an external command (ex) ffplay -
+// MP2T over RTP is piped as MPEG-TS, H264/H265 as Annex-B elementary stream.
+type execPipe struct {
+	s     *session
+	forma format.Format
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	// MPEG-TS
+	ts *tsWriter
+
+	// H264/H265
+	dec    auDecoder
+	params [][]byte
+
+	mu      sync.Mutex
+	started bool
+	err     error
+}
+
+// firstSessionID returns the id of the first session of the run.
+func (cfg *config) firstSessionID() string {
+	if strings.Contains(cfg.url, "{NUM}") {
+		return strings.ReplaceAll(cfg.url, "{NUM}", strconv.Itoa(cfg.nStart))
+	}
+	return cfg.url + ":0"
+}
+
+// execSession returns the id of the session to pipe into -exec.
+func (cfg *config) execSession() string {
+	if cfg.execSessionID != "" {
+		return cfg.execSessionID
+	}
+	return cfg.firstSessionID()
+}
+
+// newExecPipe starts the command of -exec with the first MPEG-TS format,
+// or the first H264/H265 format. It returns nil if there is no such format.
+func newExecPipe(s *session, medias []*description.Media) (*execPipe, error) {
+	p := &execPipe{s: s}
+	for _, medi := range medias {
+		for _, forma := range medi.Formats {
+			if isMPEGTS(forma) {
+				p.forma = forma
+				break
+			}
+		}
+	}
+	if p.forma == nil {
+	find:
+		for _, medi := range medias {
+			for _, forma := range medi.Formats {
+				switch f := forma.(type) {
+				case *format.H264:
+					dec, err := f.CreateDecoder()
+					if err != nil {
+						return nil, err
+					}
+					sps, pps := f.SafeParams()
+					p.forma, p.dec, p.params = f, dec, nonNil(sps, pps)
+					break find
+
+				case *format.H265:
+					dec, err := f.CreateDecoder()
+					if err != nil {
+						return nil, err
+					}
+					vps, sps, pps := f.SafeParams()
+					p.forma, p.dec, p.params = f, dec, nonNil(vps, sps, pps)
+					break find
+				}
+			}
+		}
+	}
+	if p.forma == nil {
+		return nil, nil
+	}
+
+	p.cmd = exec.Command("sh", "-c", s.cfg.exec)
+	p.cmd.Stdout = os.Stderr
+	p.cmd.Stderr = os.Stderr
+	stdin, err := p.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.cmd.Start(); err != nil {
+		return nil, err
+	}
+	p.stdin = stdin
+	if p.dec == nil {
+		p.ts = newTSWriterTo(stdin)
+	}
+	return p, nil
+}
+
+func nonNil(v ...[]byte) [][]byte {
+	var ret [][]byte
+	for _, b := range v {
+		if b != nil {
+			ret = append(ret, b)
+		}
+	}
+	return ret
+}
+
+func (p *execPipe) onPacketRTP(forma format.Format, pkt *rtp.Packet) {
+	if forma != p.forma {
+		return
+	}
+	if p.ts != nil {
+		p.ts.write(pkt)
+		return
+	}
+
+	au, err := p.dec.Decode(pkt)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return
+	}
+	if !p.started {
+		p.started = true
+		au = append(append([][]byte(nil), p.params...), au...)
+	}
+	b, err := h264.AnnexBMarshal(au)
+	if err != nil {
+		return
+	}
+	if _, err := p.stdin.Write(b); err != nil {
+		p.err = err
+		p.s.logf("exec: stopped piping, %v", err)
+	}
+}
+
+// close closes the stdin of the command, the command is not waited.
+func (p *execPipe) close() {
+	if p.ts != nil {
+		p.ts.close()
+	} else {
+		p.stdin.Close()
+	}
+	go p.cmd.Wait()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerFeature("ip-family")
+}
+
+// addrFamily returns the address family of a host:port, ipv4 or ipv6, empty if unknown.
+func addrFamily(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// ipFamily returns the network suffix of -force-ipv4 and -force-ipv6, empty for both families.
+func (cfg *config) ipFamily() string {
+	switch {
+	case cfg.forceIPv4:
+		return "4"
+	case cfg.forceIPv6:
+		return "6"
+	}
+	return ""
+}
+
+// otherFamily returns the first address that is not of the family of ipFamily, nil if none.
+func otherFamily(ips []net.IP, family string) net.IP {
+	for _, ip := range ips {
+		if (ip.To4() != nil) != (family == "4") {
+			return ip
+		}
+	}
+	return nil
+}
+
+// familyStats are the sums of the sessions of an address family, to compare the two stacks of a dual-stack server.
+type familyStats struct {
+	Handshakes int
+	Failed     int
+	// total time of the handshakes that succeeded
+	Handshake time.Duration
+	Packets   uint64
+	Bytes     uint64
+	Lost      int64
+}
+
+type familyRecorder struct {
+	mu       sync.Mutex
+	families map[string]*familyStats
+}
+
+func newFamilyRecorder() *familyRecorder {
+	return &familyRecorder{families: make(map[string]*familyStats)}
+}
+
+func (fr *familyRecorder) get(family string) *familyStats {
+	fs := fr.families[family]
+	if fs == nil {
+		fs = &familyStats{}
+		fr.families[family] = fs
+	}
+	return fs
+}
+
+// addHandshake adds the handshake of a session, its phase times if it succeeded.
+func (fr *familyRecorder) addHandshake(family string, phases map[string]duration, err error) {
+	if family == "" {
+		return
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fs := fr.get(family)
+	fs.Handshakes++
+	if err != nil {
+		fs.Failed++
+		return
+	}
+	for _, p := range handshakePhases {
+		fs.Handshake += time.Duration(phases[p])
+	}
+}
+
+// addTraffic adds the packets received by a session at its end.
+func (fr *familyRecorder) addTraffic(family string, packets, bytes uint64, lost int64) {
+	if family == "" {
+		return
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fs := fr.get(family)
+	fs.Packets += packets
+	fs.Bytes += bytes
+	fs.Lost += lost
+}
+
+// family returns the address family of the RTSP connection of the session,
+// before it connects that of -force-ipv4 or -force-ipv6, empty without.
+func (s *session) family() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := addrFamily(s.remoteAddr); f != "" {
+		return f
+	}
+	if f := s.cfg.ipFamily(); f != "" {
+		return "ipv" + f
+	}
+	return ""
+}
+
+// logFamilies logs the sessions by address family, when they are not all over IPv4.
+func (r *run) logFamilies() {
+	r.families.mu.Lock()
+	defer r.families.mu.Unlock()
+	if _, ok := r.families.families["ipv6"]; !ok && r.cfg.ipFamily() == "" {
+		return
+	}
+	names := make([]string, 0, len(r.families.families))
+	for name := range r.families.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := r.cfg.human()
+	for _, name := range names {
+		fs := r.families.families[name]
+		var avg time.Duration
+		if ok := fs.Handshakes - fs.Failed; ok > 0 {
+			avg = fs.Handshake / time.Duration(ok)
+		}
+		lossRate := 0.0
+		if expected := int64(fs.Packets) + fs.Lost; expected > 0 {
+			lossRate = float64(fs.Lost) * 100 / float64(expected)
+		}
+		r.logger.Printf(r.cfg.tr("%s: handshakes %d, failed %d, handshake avg %s, packets %d, bytes %s, lost %d (%s%%)"),
+			name, fs.Handshakes, fs.Failed, h.duration(avg), fs.Packets, h.bytes(fs.Bytes), fs.Lost, h.float(lossRate))
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("fault-injection")
+}
+
+// faultStats are the RTP packets altered by the fault injection of a session.
+type faultStats struct {
+	Dropped   uint64 `json:"dropped"`
+	Reordered uint64 `json:"reordered"`
+	Delayed   uint64 `json:"delayed"`
+}
+
+// heldPacket is a packet reordered or delayed by the fault injection.
+type heldPacket struct {
+	forma format.Format
+	pkt   *rtp.Packet
+	// released after the next packet of the media if zero
+	due time.Time
+}
+
+// faultInjector drops, reorders and delays the received RTP packets of a session before their analysis,
+// with the percentages of -inject-drop, -inject-reorder and -inject-delay, to validate the loss metrics
+// and, with -rr-interval, the retransmissions of the server.
+// The held packets are released by the next packets of their media, in the goroutine reading them.
+type faultInjector struct {
+	drop    float64
+	reorder float64
+	delay   float64
+	delayBy time.Duration
+
+	mu    sync.Mutex
+	rnd   *rand.Rand
+	held  map[*description.Media][]heldPacket
+	stats faultStats
+}
+
+// newFaultInjector returns the fault injector of a session, its random source seeded by seed,
+// nil without fault injection.
+func newFaultInjector(cfg *config, seed func() int64) *faultInjector {
+	if cfg.injectDrop == 0 && cfg.injectReorder == 0 && cfg.injectDelay == 0 {
+		return nil
+	}
+	return &faultInjector{
+		drop:    cfg.injectDrop / 100,
+		reorder: cfg.injectReorder / 100,
+		delay:   cfg.injectDelay / 100,
+		delayBy: cfg.injectDelayBy,
+		rnd:     rand.New(rand.NewSource(seed())),
+		held:    make(map[*description.Media][]heldPacket),
+	}
+}
+
+// inject delivers the packet, unless it is dropped or held, then the held packets of the media that are due.
+func (fi *faultInjector) inject(now time.Time, medi *description.Media, forma format.Format, pkt *rtp.Packet,
+	deliver func(now time.Time, medi *description.Media, forma format.Format, pkt *rtp.Packet),
+) {
+	fi.mu.Lock()
+	r := fi.rnd.Float64()
+	switch {
+	case r < fi.drop:
+		fi.stats.Dropped++
+		fi.mu.Unlock()
+		return
+	case r < fi.drop+fi.reorder:
+		fi.stats.Reordered++
+		fi.held[medi] = append(fi.held[medi], heldPacket{forma: forma, pkt: pkt})
+		fi.mu.Unlock()
+		return
+	case r < fi.drop+fi.reorder+fi.delay:
+		fi.stats.Delayed++
+		fi.held[medi] = append(fi.held[medi], heldPacket{forma: forma, pkt: pkt, due: now.Add(fi.delayBy)})
+		fi.mu.Unlock()
+		return
+	}
+	var released []heldPacket
+	kept := fi.held[medi][:0]
+	for _, h := range fi.held[medi] {
+		if h.due.IsZero() || !now.Before(h.due) {
+			released = append(released, h)
+		} else {
+			kept = append(kept, h)
+		}
+	}
+	fi.held[medi] = kept
+	fi.mu.Unlock()
+
+	deliver(now, medi, forma, pkt)
+	for _, h := range released {
+		deliver(now, medi, h.forma, h.pkt)
+	}
+}
+
+func (fi *faultInjector) snapshot() faultStats {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.stats
+}
@@ -0,0 +1,57 @@
+package main
+
+import "time"
+
+func init() {
+	registerFeature("freeze")
+}
+
+// freezeStats are the freezes of a video track, the intervals without a complete frame longer than -freeze-timeout.
+type freezeStats struct {
+	Freezes uint64   `json:"freezes"`
+	Total   duration `json:"total"`
+	Max     duration `json:"max"`
+}
+
+// freezeMeter measures the intervals between the complete access units of a video track,
+// what the viewers see, unlike the delay of the packets.
+type freezeMeter struct {
+	last  time.Time
+	stats freezeStats
+}
+
+func (f *freezeMeter) add(d time.Duration) {
+	f.stats.Freezes++
+	f.stats.Total += duration(d)
+	if duration(d) > f.stats.Max {
+		f.stats.Max = duration(d)
+	}
+}
+
+// onFrame returns the duration of the freeze a complete frame received at now ends.
+func (f *freezeMeter) onFrame(now time.Time, timeout time.Duration) (time.Duration, bool) {
+	last := f.last
+	f.last = now
+	if last.IsZero() {
+		return 0, false
+	}
+	if d := now.Sub(last); d > timeout {
+		f.add(d)
+		return d, true
+	}
+	return 0, false
+}
+
+// end returns the duration of the freeze still going on at the end of the session.
+func (f *freezeMeter) end(now time.Time, timeout time.Duration) (time.Duration, bool) {
+	if f.last.IsZero() {
+		return 0, false
+	}
+	d := now.Sub(f.last)
+	f.last = now
+	if d > timeout {
+		f.add(d)
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math/bits"
+	"time"
+)
+
+// the log-linear buckets of gapHistogram, as those of an HDR histogram: exact below gapSubBuckets microseconds,
+// then gapSubBuckets/2 buckets per power of 2, a value is within 1/16 of its bucket, up to about a minute.
+const (
+	gapSubBuckets = 32
+	gapMaxShift   = 21
+	gapBuckets    = gapSubBuckets + gapMaxShift*gapSubBuckets/2
+)
+
+// gapHistogram is the distribution of the intervals between the arrivals of the packets of a track.
+// A max hides the intermittent stalls, the p99 and p999 show them.
+type gapHistogram struct {
+	counts [gapBuckets]uint32
+	total  uint64
+	max    time.Duration
+}
+
+func gapBucket(us uint64) int {
+	if us < gapSubBuckets {
+		return int(us)
+	}
+	shift := bits.Len64(us) - 5
+	if shift > gapMaxShift {
+		return gapBuckets - 1
+	}
+	return gapSubBuckets + (shift-1)*gapSubBuckets/2 + int(us>>uint(shift)) - gapSubBuckets/2
+}
+
+// gapBucketValue returns the middle of a bucket.
+func gapBucketValue(i int) time.Duration {
+	if i < gapSubBuckets {
+		return time.Duration(i) * time.Microsecond
+	}
+	shift := (i-gapSubBuckets)/(gapSubBuckets/2) + 1
+	low := uint64((i-gapSubBuckets)%(gapSubBuckets/2)+gapSubBuckets/2) << uint(shift)
+	return time.Duration(low+uint64(1)<<uint(shift)/2) * time.Microsecond
+}
+
+func (g *gapHistogram) add(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	g.counts[gapBucket(uint64(d/time.Microsecond))]++
+	g.total++
+	if d > g.max {
+		g.max = d
+	}
+}
+
+// percentile returns the gap below which is the fraction p of the gaps, capped by the max.
+func (g *gapHistogram) percentile(p float64) time.Duration {
+	if g.total == 0 {
+		return 0
+	}
+	rank := uint64(float64(g.total)*p + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+	var n uint64
+	for i, c := range g.counts {
+		if n += uint64(c); n >= rank {
+			if v := gapBucketValue(i); v < g.max {
+				return v
+			}
+			break
+		}
+	}
+	return g.max
+}
+
+// gapStats are the percentiles of the inter-arrival gaps of a track.
+type gapStats struct {
+	P50  duration `json:"p50"`
+	P99  duration `json:"p99"`
+	P999 duration `json:"p999"`
+	Max  duration `json:"max"`
+}
+
+func (g *gapHistogram) stats() gapStats {
+	return gapStats{
+		P50:  duration(g.percentile(0.5)),
+		P99:  duration(g.percentile(0.99)),
+		P999: duration(g.percentile(0.999)),
+		Max:  duration(g.max),
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerFeature("gc-tuning")
+}
+
+// byteSize is a flag of a size in bytes, with an optional K, M or G suffix of powers of 1024.
+type byteSize int64
+
+func parseByteSize(s string) (byteSize, error) {
+	v := strings.TrimSuffix(strings.TrimSuffix(s, "B"), "i")
+	mul := int64(1)
+	switch {
+	case strings.HasSuffix(v, "G"):
+		mul, v = 1<<30, strings.TrimSuffix(v, "G")
+	case strings.HasSuffix(v, "M"):
+		mul, v = 1<<20, strings.TrimSuffix(v, "M")
+	case strings.HasSuffix(v, "k"), strings.HasSuffix(v, "K"):
+		mul, v = 1<<10, v[:len(v)-1]
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return byteSize(n * float64(mul)), nil
+}
+
+func (b byteSize) String() string {
+	return humanizer{precision: 2}.bytes(uint64(b))
+}
+
+// Set implements flag.Value.
+func (b *byteSize) Set(s string) error {
+	v, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// gcTuning are the process-wide garbage collector settings.
+type gcTuning struct {
+	percent     int
+	memoryLimit byteSize
+	ballast     byteSize
+}
+
+// ballast is a heap allocation never touched nor freed,
+// it raises the heap size the GC paces against without using physical memory.
+var ballast []byte
+
+// apply sets the GC percent and the memory limit, and allocates the ballast.
+// The zero values leave the runtime defaults (GOGC, GOMEMLIMIT).
+func (t gcTuning) apply() {
+	if t.percent != 0 {
+		debug.SetGCPercent(t.percent)
+	}
+	if t.memoryLimit > 0 {
+		debug.SetMemoryLimit(int64(t.memoryLimit))
+	}
+	if t.ballast > 0 {
+		ballast = make([]byte, t.ballast)
+	}
+}
+
+func (t gcTuning) problems() configErrors {
+	var errs configErrors
+	if t.percent < -1 {
+		errs.add("gogc", "should be -1 (off), 0 (default) or positive", "ex) -gogc 400")
+	}
+	if t.percent == -1 && t.memoryLimit == 0 {
+		errs.add("gogc", "-1 turns off the GC, the memory grows without limit", "add -memory-limit")
+	}
+	if t.ballast > 0 && t.memoryLimit > 0 && t.ballast >= t.memoryLimit {
+		errs.add("ballast", "should be less than -memory-limit, the GC would run continuously",
+			"lower -ballast or raise -memory-limit")
+	}
+	return errs
+}
+
+// gcSnapshot is the GC counters at the start of a run.
+type gcSnapshot struct {
+	at         time.Time
+	numGC      int64
+	pauseTotal time.Duration
+}
+
+func takeGCSnapshot() gcSnapshot {
+	var st debug.GCStats
+	debug.ReadGCStats(&st)
+	return gcSnapshot{at: time.Now(), numGC: st.NumGC, pauseTotal: st.PauseTotal}
+}
+
+// gcPauses is the GC pause statistics of a run.
+// The GC is process-wide, so the runs of tenants count the pauses of each other.
+type gcPauses struct {
+	Cycles int64
+	Total  time.Duration
+	P50    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+	// percentiles of the last 256 pauses of the run at most
+	Sampled int
+	HeapSys uint64
+}
+
+// since returns the GC pauses since the snapshot.
+func (snap gcSnapshot) since() gcPauses {
+	var st debug.GCStats
+	debug.ReadGCStats(&st)
+	p := gcPauses{Cycles: st.NumGC - snap.numGC, Total: st.PauseTotal - snap.pauseTotal}
+
+	// st.Pause is the most recent first
+	var pauses []time.Duration
+	for i, end := range st.PauseEnd {
+		if end.Before(snap.at) || i >= len(st.Pause) {
+			break
+		}
+		pauses = append(pauses, st.Pause[i])
+	}
+	if n := len(pauses); n != 0 {
+		sort.Slice(pauses, func(i, j int) bool { return pauses[i] < pauses[j] })
+		p.Sampled = n
+		p.P50 = pauses[(n-1)*50/100]
+		p.P99 = pauses[(n-1)*99/100]
+		p.Max = pauses[n-1]
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	p.HeapSys = ms.HeapSys
+	return p
+}
+
+// logGC logs the GC pauses of the run, long pauses show as delays and late packets of all the sessions.
+func (r *run) logGC() {
+	p := r.gcSince()
+	h := r.cfg.human()
+	r.logger.Printf(r.cfg.tr("gc: %d cycles, pause total %s, p50 %s, p99 %s, max %s, heap %s"),
+		p.Cycles, h.duration(p.Total), h.duration(p.P50), h.duration(p.P99), h.duration(p.Max),
+		h.bytes(p.HeapSys))
+}
@@ -4,16 +4,20 @@ go 1.19
 
 require (
 	github.com/bluenviron/gortsplib/v4 v4.6.2
+	github.com/bluenviron/mediacommon v1.5.1
 	github.com/pion/rtcp v1.2.13
 	github.com/pion/rtp v1.8.3
-	golang.org/x/sync v0.5.0
+	github.com/pion/sdp/v3 v3.0.6
+	google.golang.org/grpc v1.59.0
+	google.golang.org/protobuf v1.31.0
 )
 
 require (
-	github.com/bluenviron/mediacommon v1.5.1 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/google/uuid v1.4.0 // indirect
 	github.com/pion/randutil v0.1.0 // indirect
-	github.com/pion/sdp/v3 v3.0.6 // indirect
 	golang.org/x/net v0.19.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230822172742-b8732ec3820d // indirect
 )
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// gopStats is the observed keyframe interval distribution of a video track.
+// Frames is the histogram of the interval in frames.
+type gopStats struct {
+	Keyframes   uint64         `json:"keyframes"`
+	MinInterval duration       `json:"minInterval"`
+	AvgInterval duration       `json:"avgInterval"`
+	MaxInterval duration       `json:"maxInterval"`
+	Frames      map[int]uint64 `json:"frames"`
+	Alarms      uint64         `json:"alarms"`
+}
+
+func (st gopStats) framesString() string {
+	keys := make([]int, 0, len(st.Frames))
+	for k := range st.Frames {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	l := make([]string, 0, len(keys))
+	for _, k := range keys {
+		l = append(l, fmt.Sprintf("%d:%d", k, st.Frames[k]))
+	}
+	return "{" + strings.Join(l, " ") + "}"
+}
+
+// gopMeter measures the interval between keyframes (IDR/IRAP access units).
+type gopMeter struct {
+	clockRate int
+
+	started bool
+	lastTS  uint32
+	frames  int
+	sum     time.Duration
+	stats   gopStats
+}
+
+func newGOPMeter(clockRate int) *gopMeter {
+	return &gopMeter{
+		clockRate: clockRate,
+		stats:     gopStats{Frames: make(map[int]uint64)},
+	}
+}
+
+// onAccessUnit returns the keyframe interval when a keyframe closes a GOP.
+func (g *gopMeter) onAccessUnit(ts uint32, keyframe bool) (time.Duration, bool) {
+	if !keyframe {
+		if g.started {
+			g.frames++
+		}
+		return 0, false
+	}
+
+	g.stats.Keyframes++
+	if !g.started {
+		g.started = true
+		g.lastTS = ts
+		g.frames = 1
+		return 0, false
+	}
+
+	interval := time.Duration(ts-g.lastTS) * time.Second / time.Duration(g.clockRate)
+	g.stats.Frames[g.frames]++
+	if g.stats.MinInterval == 0 || duration(interval) < g.stats.MinInterval {
+		g.stats.MinInterval = duration(interval)
+	}
+	if duration(interval) > g.stats.MaxInterval {
+		g.stats.MaxInterval = duration(interval)
+	}
+	g.sum += interval
+	g.stats.AvgInterval = duration(g.sum / time.Duration(g.stats.Keyframes-1))
+
+	g.lastTS = ts
+	g.frames = 1
+	return interval, true
+}
+
+func (g *gopMeter) snapshot() gopStats {
+	st := g.stats
+	st.Frames = make(map[int]uint64, len(g.stats.Frames))
+	for k, v := range g.stats.Frames {
+		st.Frames[k] = v
+	}
+	return st
+}
@@ -0,0 +1,288 @@
+//go:build !nogrpc
+
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/castisdev/rtspclient/proto/controlpb"
+)
+
+func init() {
+	registerFeature("grpc-api")
+}
+
+// the interval of StreamStats if not given, and the interval StreamErrors polls the errors
+const (
+	grpcStatsInterval  = time.Second
+	grpcErrorsInterval = time.Second
+)
+
+// grpcControl is the gRPC control service of proto/control.proto, the same as the REST control api.
+type grpcControl struct {
+	controlpb.UnimplementedControlServer
+	// the runs by the path prefix of their namespace, as the routes of serveAPI
+	routes map[string]*run
+}
+
+// serveGRPC starts the gRPC control service on addr, routes as serveAPI.
+func serveGRPC(addr string, routes map[string]*run) {
+	srv := grpc.NewServer()
+	controlpb.RegisterControlServer(srv, &grpcControl{routes: routes})
+	go func() {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Printf("failed to serve grpc control api, %v", err)
+			return
+		}
+		log.Printf("grpc control api listening on %s", addr)
+		if err := srv.Serve(l); err != nil {
+			log.Printf("failed to serve grpc control api, %v", err)
+		}
+	}()
+}
+
+// run returns the run of a namespace, the tenants of -tenants or the targets of several -url.
+func (g *grpcControl) run(ns *controlpb.Namespace) (*run, error) {
+	name := ns.GetTenant()
+	if name == "" {
+		if r := g.routes[""]; r != nil {
+			return r, nil
+		}
+		return nil, status.Errorf(codes.InvalidArgument, "namespace needed, the runs are %s", g.names())
+	}
+	for _, prefix := range []string{"/tenants/", "/targets/"} {
+		if r := g.routes[prefix+name]; r != nil {
+			return r, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "namespace not found, %s", name)
+}
+
+func (g *grpcControl) names() string {
+	var l []string
+	for prefix := range g.routes {
+		l = append(l, prefix[strings.LastIndex(prefix, "/")+1:])
+	}
+	return strings.Join(l, ", ")
+}
+
+func sessionMessage(info sessionInfo) *controlpb.Session {
+	return &controlpb.Session{
+		Id:         info.ID,
+		Url:        info.URL,
+		Class:      info.Class,
+		State:      info.State,
+		StateSince: timestamppb.New(info.StateSince),
+		Packets:    info.Packets,
+		Bytes:      info.Bytes,
+		Lost:       info.Lost,
+		Bitrate:    float64(info.Bitrate),
+	}
+}
+
+func (g *grpcControl) ListSessions(ctx context.Context, req *controlpb.ListSessionsRequest) (*controlpb.ListSessionsResponse, error) {
+	r, err := g.run(req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	var res controlpb.ListSessionsResponse
+	for _, info := range r.sessionInfos() {
+		res.Sessions = append(res.Sessions, sessionMessage(info))
+	}
+	return &res, nil
+}
+
+func (g *grpcControl) AddSessions(ctx context.Context, req *controlpb.AddSessionsRequest) (*controlpb.AddSessionsResponse, error) {
+	r, err := g.run(req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	count := int(req.Count)
+	if count == 0 {
+		count = 1
+	}
+	if count < 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "count should be at least 1")
+	}
+	if strings.Contains(req.Url, "{NUM}") {
+		return nil, status.Errorf(codes.InvalidArgument, "url should not contain {NUM}")
+	}
+	ids := r.addSessions(req.Url, count)
+	r.logger.Printf("%d sessions added by the grpc control api", len(ids))
+	return &controlpb.AddSessionsResponse{Added: ids}, nil
+}
+
+func (g *grpcControl) TeardownSession(ctx context.Context, req *controlpb.TeardownSessionRequest) (*controlpb.TeardownSessionResponse, error) {
+	r, err := g.run(req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	s := r.sessions.get(req.Id)
+	if s == nil {
+		return nil, status.Errorf(codes.NotFound, "session not found, %s", req.Id)
+	}
+	s.teardown()
+	return &controlpb.TeardownSessionResponse{TornDown: []string{s.id}}, nil
+}
+
+func (g *grpcControl) SetConcurrency(ctx context.Context, req *controlpb.SetConcurrencyRequest) (*controlpb.SetConcurrencyResponse, error) {
+	r, err := g.run(req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if req.Target < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "target should not be negative")
+	}
+	if strings.Contains(req.Url, "{NUM}") {
+		return nil, status.Errorf(codes.InvalidArgument, "url should not contain {NUM}")
+	}
+	added, tornDown := r.setConcurrency(int(req.Target), req.Url)
+	r.logger.Printf("concurrency changed to %d by the grpc control api, %d added, %d torn down",
+		req.Target, len(added), len(tornDown))
+	return &controlpb.SetConcurrencyResponse{Target: req.Target, Added: added, TornDown: tornDown}, nil
+}
+
+func thresholdsMessage(ns *controlpb.Namespace, t thresholds) *controlpb.Thresholds {
+	return &controlpb.Thresholds{
+		Namespace:     ns,
+		DelayTimeout:  durationpb.New(time.Duration(t.DelayTimeout)),
+		LossThreshold: int32(t.LossThreshold),
+		MaxGop:        durationpb.New(time.Duration(t.MaxGOP)),
+		MinBitrate:    float64(t.MinBitrate),
+		MaxBitrate:    float64(t.MaxBitrate),
+	}
+}
+
+func (g *grpcControl) GetThresholds(ctx context.Context, req *controlpb.GetThresholdsRequest) (*controlpb.Thresholds, error) {
+	r, err := g.run(req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return thresholdsMessage(req.Namespace, r.getThresholds()), nil
+}
+
+// SetThresholds leaves the durations not set and a loss_threshold of 0 unchanged,
+// proto3 has no presence for the other scalars: the bitrates are set as given, 0 turns them off.
+func (g *grpcControl) SetThresholds(ctx context.Context, req *controlpb.Thresholds) (*controlpb.Thresholds, error) {
+	r, err := g.run(req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	t := r.getThresholds()
+	if req.DelayTimeout != nil {
+		t.DelayTimeout = duration(req.DelayTimeout.AsDuration())
+	}
+	if req.LossThreshold != 0 {
+		t.LossThreshold = int(req.LossThreshold)
+	}
+	if req.MaxGop != nil {
+		t.MaxGOP = duration(req.MaxGop.AsDuration())
+	}
+	t.MinBitrate, t.MaxBitrate = bitrate(req.MinBitrate), bitrate(req.MaxBitrate)
+	if err := t.validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	r.setThresholds(t)
+	r.logger.Printf("thresholds changed by the grpc control api, delayTimeout: %v, lossThreshold: %d, maxGOP: %v, "+
+		"minBitrate: %v, maxBitrate: %v",
+		t.DelayTimeout, t.LossThreshold, t.MaxGOP, t.MinBitrate, t.MaxBitrate)
+	return thresholdsMessage(req.Namespace, t), nil
+}
+
+func (g *grpcControl) StreamStats(req *controlpb.StreamStatsRequest, stream controlpb.Control_StreamStatsServer) error {
+	r, err := g.run(req.Namespace)
+	if err != nil {
+		return err
+	}
+	interval := grpcStatsInterval
+	if req.Interval != nil {
+		interval = req.Interval.AsDuration()
+	}
+	if interval <= 0 {
+		return status.Errorf(codes.InvalidArgument, "interval should be positive")
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		u := &controlpb.StatsUpdate{
+			Time:      timestamppb.Now(),
+			Succeeded: atomic.LoadInt64(&r.succeeded),
+			Failed:    atomic.LoadInt64(&r.failed),
+		}
+		for _, info := range r.sessionInfos() {
+			u.Sessions++
+			if info.State == statePlaying || info.State == stateRecording {
+				u.Playing++
+			}
+			u.Packets += info.Packets
+			u.Bytes += info.Bytes
+			u.Bitrate += float64(info.Bitrate)
+			u.Details = append(u.Details, sessionMessage(info))
+		}
+		if err := stream.Send(u); err != nil {
+			return err
+		}
+		select {
+		case <-t.C:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// StreamErrors sends the last errors kept for the dashboard, oldest first, then the new ones.
+// The errors dropped from the feed between two polls are not sent.
+func (g *grpcControl) StreamErrors(req *controlpb.StreamErrorsRequest, stream controlpb.Control_StreamErrorsServer) error {
+	r, err := g.run(req.Namespace)
+	if err != nil {
+		return err
+	}
+	sent := 0
+	t := time.NewTicker(grpcErrorsInterval)
+	defer t.Stop()
+	for {
+		r.errorsMu.Lock()
+		n := r.errorsTotal - sent
+		if n > len(r.errors) {
+			n = len(r.errors)
+		}
+		l := append([]errorEvent(nil), r.errors[len(r.errors)-n:]...)
+		sent = r.errorsTotal
+		r.errorsMu.Unlock()
+		for _, e := range l {
+			err := stream.Send(&controlpb.ErrorEvent{Time: timestamppb.New(e.Time), Id: e.ID, Url: e.URL, Error: e.Error})
+			if err != nil {
+				return err
+			}
+		}
+		select {
+		case <-t.C:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (g *grpcControl) GetVersion(ctx context.Context, req *controlpb.GetVersionRequest) (*controlpb.BuildInfo, error) {
+	bi := getBuildInfo()
+	return &controlpb.BuildInfo{
+		Version:   bi.Version,
+		Commit:    bi.Commit,
+		Date:      bi.Date,
+		GoVersion: bi.GoVersion,
+		Platform:  bi.Platform,
+		Features:  bi.Features,
+	}, nil
+}
@@ -0,0 +1,10 @@
+//go:build nogrpc
+
+package main
+
+import "log"
+
+// serveGRPC is left out of a build with the nogrpc tag, -grpc-addr is rejected by validate.
+func serveGRPC(addr string, routes map[string]*run) {
+	log.Printf("grpc api is not built in, %s is not served", addr)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+func init() {
+	registerFeature("custom-headers")
+}
+
+// headerMethods are the requests carrying the headers of -header,
+// ANNOUNCE and RECORD are those of the publishers.
+var headerMethods = []base.Method{base.Describe, base.Announce, base.Setup, base.Play, base.Record}
+
+// reservedHeaders are managed by the client and can't be set.
+var reservedHeaders = []string{"CSeq", "Session", "Transport", "Content-Length"}
+
+// requestHeaders are the custom headers of the requests, by method.
+type requestHeaders map[base.Method]base.Header
+
+func (h requestHeaders) String() string {
+	var fields []string
+	for m, hdr := range h {
+		for k, vs := range hdr {
+			for _, v := range vs {
+				fields = append(fields, string(m)+" "+k+": "+v)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ", ")
+}
+
+// Set implements flag.Value, s is "Name: value" added to the requests of headerMethods, it can be repeated.
+func (h *requestHeaders) Set(s string) error {
+	kv := strings.SplitN(s, ":", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("invalid header %q, should be \"Name: value\"", s)
+	}
+	for _, m := range headerMethods {
+		if err := h.add(m, kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add adds a header to the requests of a method.
+func (h *requestHeaders) add(method base.Method, name, value string) error {
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if name == "" || strings.ContainsAny(name, " \t\r\n") || strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("invalid header %q", name+": "+value)
+	}
+	for _, r := range reservedHeaders {
+		if strings.EqualFold(name, r) {
+			return fmt.Errorf("header %s is set by the client", r)
+		}
+	}
+	if *h == nil {
+		*h = make(requestHeaders)
+	}
+	if (*h)[method] == nil {
+		(*h)[method] = make(base.Header)
+	}
+	(*h)[method][name] = append((*h)[method][name], value)
+	return nil
+}
+
+// addMethods adds the headers of the tenants file, by method then name.
+func (h *requestHeaders) addMethods(headers map[string]map[string]string) error {
+	for method, hdr := range headers {
+		m := base.Method(strings.ToUpper(method))
+		known := false
+		for _, hm := range headerMethods {
+			known = known || m == hm
+		}
+		if !known {
+			return fmt.Errorf("invalid method %q of headers, should be DESCRIBE, ANNOUNCE, SETUP, PLAY or RECORD", method)
+		}
+		for name, value := range hdr {
+			if err := h.add(m, name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// apply sets the headers of the method of a request, they replace those of the client (ex) User-Agent.
+func (h requestHeaders) apply(req *base.Request) {
+	for k, v := range h[req.Method] {
+		for rk := range req.Header {
+			if strings.EqualFold(rk, k) {
+				delete(req.Header, rk)
+			}
+		}
+		req.Header[k] = v
+	}
+}
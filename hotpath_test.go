@@ -0,0 +1,293 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+// The per-packet path must not allocate, the tests fail on any allocation
+// but those of hotPathAllocs and the benchmarks report the cost, run with
+//
+//	go test -run Allocs -bench . -benchmem
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// packetSource generates the packets of a 90kHz stream at 1000 packets per second,
+// so that the delay checker never finds a delay.
+type packetSource struct {
+	base time.Time
+	i    uint32
+	pkt  rtp.Packet
+}
+
+func newPacketSource(payloadSize int) *packetSource {
+	src := &packetSource{base: time.Unix(1700000000, 0)}
+	src.pkt.Header = rtp.Header{Version: 2, PayloadType: 96, SSRC: 0x12345678}
+	src.pkt.Payload = make([]byte, payloadSize)
+	return src
+}
+
+func (src *packetSource) next() (time.Time, *rtp.Packet) {
+	src.i++
+	src.pkt.SequenceNumber = uint16(src.i)
+	src.pkt.Timestamp = src.i * 90
+	return src.base.Add(time.Duration(src.i) * time.Millisecond), &src.pkt
+}
+
+func newTestDelayChecker() *DelayChecker {
+	r := &run{thresholds: thresholds{DelayTimeout: duration(time.Second), LossThreshold: 1}, logger: log.New(io.Discard, "", 0)}
+	return &DelayChecker{s: &session{run: r}}
+}
+
+func tsPayload() []byte {
+	p := make([]byte, 7*tsPacketSize)
+	for i := 0; i < len(p); i += tsPacketSize {
+		p[i] = 0x47
+	}
+	return p
+}
+
+// tsSource generates the RTP packets of 7 TS packets of a PID with a PCR every 40ms,
+// the continuity counters in sequence.
+type tsSource struct {
+	*packetSource
+	cc byte
+}
+
+func newTSSource() *tsSource {
+	src := &tsSource{packetSource: newPacketSource(0)}
+	src.pkt.PayloadType = 33
+	src.pkt.Payload = tsPayload()
+	return src
+}
+
+func (src *tsSource) next() (time.Time, *rtp.Packet) {
+	now, pkt := src.packetSource.next()
+	for i := 0; i < len(pkt.Payload); i += tsPacketSize {
+		p := pkt.Payload[i : i+tsPacketSize]
+		p[1], p[2], p[3] = 0x01, 0x00, 0x10|src.cc
+		src.cc = (src.cc + 1) & 0x0F
+		if i == 0 && src.i%40 == 0 {
+			// adaptation field of a PCR
+			pcr := uint64(src.i) * 27000
+			p[3] |= 0x20
+			p[4], p[5] = 7, 0x10
+			base := pcr / 300
+			p[6], p[7], p[8], p[9] = byte(base>>25), byte(base>>17), byte(base>>9), byte(base>>1)
+			p[10], p[11] = byte(base<<7)|0x7E|byte(pcr%300>>8), byte(pcr%300)
+		} else {
+			p[4] = 0
+		}
+	}
+	return now, pkt
+}
+
+// shardSource generates the packets of a session processed on a shard, from a ring larger
+// than the queue of the shard so that a packet is not changed while queued.
+type shardSource struct {
+	i    int
+	pkts [2 * shardQueueSize]rtp.Packet
+}
+
+func (src *shardSource) next() (time.Time, *rtp.Packet) {
+	pkt := &src.pkts[src.i%len(src.pkts)]
+	src.i++
+	pkt.Version, pkt.PayloadType, pkt.SSRC = 2, 96, 0x12345678
+	pkt.SequenceNumber, pkt.Timestamp = uint16(src.i), uint32(src.i*90)
+	return time.Unix(1700000000, 0).Add(time.Duration(src.i) * time.Millisecond), pkt
+}
+
+// videoSource generates the packets of a 25fps H264 stream, access units of a SEI with captions
+// and a slice, the keyframes fragmented in FU-A packets.
+type videoSource struct {
+	i    int
+	pkts []rtp.Packet
+}
+
+func newVideoSource() *videoSource {
+	sei := []byte{0x06, 0x04, 0x0D, 0xB5, 0x00, 0x31, 'G', 'A', '9', '4', 0x03, 0x42, 0xFF, 0xFC, 0x94, 0x2C, 0x80}
+	idr := make([]byte, 4000)
+	idr[0] = 0x65
+	slice := make([]byte, 800)
+	slice[0] = 0x41
+	src := &videoSource{}
+	for f := 0; f < 25; f++ {
+		src.pkts = append(src.pkts, rtp.Packet{Payload: sei})
+		if f != 0 {
+			src.pkts = append(src.pkts, rtp.Packet{Header: rtp.Header{Marker: true}, Payload: slice})
+			continue
+		}
+		for off := 1; off < len(idr); off += 1000 {
+			end := off + 1000
+			fu := []byte{0x7C, 0x05}
+			if off == 1 {
+				fu[1] |= 0x80
+			}
+			if end >= len(idr) {
+				end, fu[1] = len(idr), fu[1]|0x40
+			}
+			src.pkts = append(src.pkts, rtp.Packet{Header: rtp.Header{Marker: end == len(idr)}, Payload: append(fu, idr[off:end]...)})
+		}
+	}
+	return src
+}
+
+func (src *videoSource) next() (time.Time, *rtp.Packet) {
+	pkt := &src.pkts[src.i%len(src.pkts)]
+	frame := src.i / len(src.pkts) * 25
+	for _, p := range src.pkts[:src.i%len(src.pkts)] {
+		if p.Marker {
+			frame++
+		}
+	}
+	src.i++
+	pkt.Version, pkt.PayloadType, pkt.SSRC = 2, 96, 0x12345678
+	pkt.SequenceNumber = uint16(src.i)
+	pkt.Timestamp = uint32(frame * 3600)
+	return time.Unix(1700000000, 0).Add(time.Duration(frame) * 40 * time.Millisecond), pkt
+}
+
+// optionalHotPaths are the paths of the subsystems a build tag can leave out, added by their tests.
+var optionalHotPaths = make(map[string]func() func())
+
+func hotPaths() map[string]func() func() {
+	paths := map[string]func() func(){
+		"DelayChecker": func() func() {
+			dc, src := newTestDelayChecker(), newPacketSource(1200)
+			return func() {
+				now, pkt := src.next()
+				dc.Check(now, pkt, 90000)
+			}
+		},
+		"BitrateMeter": func() func() {
+			var m bitrateMeter
+			src := newPacketSource(1200)
+			return func() {
+				now, pkt := src.next()
+				m.add(now, len(pkt.Payload), nil)
+			}
+		},
+		"MediaTrack": func() func() {
+			t := &mediaTrack{name: "video/96", codec: "H264", clockRate: 90000}
+			src := newPacketSource(1200)
+			return func() {
+				now, pkt := src.next()
+				t.onPacket(now, pkt)
+			}
+		},
+		"VideoTrack": func() func() {
+			cfg := &config{measureGOP: true, checkCaptions: true, freezeTimeout: time.Second}
+			s := &session{cfg: cfg, run: &run{cfg: cfg, logger: log.New(io.Discard, "", 0)}}
+			vt, _ := newVideoTrack(s, &format.H264{PayloadTyp: 96, PacketizationMode: 1})
+			vt.hasSPS, vt.hasPPS = true, true
+			src := newVideoSource()
+			return func() {
+				now, pkt := src.next()
+				vt.onPacketRTP(now, pkt)
+			}
+		},
+		"TSAnalyzer": func() func() {
+			cfg := &config{}
+			ta := newTSAnalyzer(&session{cfg: cfg, run: &run{cfg: cfg, logger: log.New(io.Discard, "", 0)}}, "video/33")
+			src := newTSSource()
+			return func() {
+				now, pkt := src.next()
+				ta.onPacketRTP(now, pkt)
+			}
+		},
+		"PlayoutBuffer": func() func() {
+			p := newPlayoutBuffer(time.Second, 90000)
+			src := newPacketSource(1200)
+			return func() {
+				now, pkt := src.next()
+				p.onPacket(now, pkt.SSRC, pkt.Timestamp)
+			}
+		},
+		"GapHistogram": func() func() {
+			var g gapHistogram
+			i := 0
+			return func() {
+				i++
+				g.add(time.Duration(i%200) * time.Millisecond)
+			}
+		},
+		"ShardDispatch": func() func() {
+			logger := log.New(io.Discard, "", 0)
+			cfg := &config{}
+			forma := &format.H264{PayloadTyp: 96, PacketizationMode: 1}
+			medi := &description.Media{Type: description.MediaTypeVideo, Formats: []format.Format{forma}}
+			s := &session{
+				cfg:        cfg,
+				run:        &run{cfg: cfg, logger: logger, latency: newLatencyRecorder()},
+				dc:         newTestDelayChecker(),
+				mediaNames: map[*description.Media]string{medi: "video"},
+			}
+			sh := newShardPool(1, false, logger).shards[0]
+			var src shardSource
+			return func() {
+				now, pkt := src.next()
+				sh.onPacketRTP(s, now, medi, forma, pkt)
+			}
+		},
+		"TSWriter": func() func() {
+			tw := newTSWriterTo(nopWriteCloser{io.Discard})
+			src := newPacketSource(0)
+			src.pkt.PayloadType = 33
+			src.pkt.Payload = tsPayload()
+			return func() {
+				_, pkt := src.next()
+				tw.write(pkt)
+			}
+		},
+	}
+	for name, path := range optionalHotPaths {
+		paths[name] = path
+	}
+	return paths
+}
+
+// hotPathAllocs are the allocations per packet allowed on a path: the AES-CM stream of cipher.NewCTR
+// of SRTP, its assembly is faster than a key stream of a block at a time without allocation.
+var hotPathAllocs = map[string]float64{
+	"SRTPDecrypter": 2,
+}
+
+func TestHotPathAllocs(t *testing.T) {
+	for name, newPath := range hotPaths() {
+		f := newPath()
+		// the first packets initialize the state
+		for i := 0; i < 10; i++ {
+			f()
+		}
+		if allocs := testing.AllocsPerRun(1000, f); allocs > hotPathAllocs[name] {
+			t.Errorf("%s: %v allocations per packet, should be %v", name, allocs, hotPathAllocs[name])
+		}
+	}
+}
+
+func BenchmarkDelayChecker(b *testing.B)  { benchmarkHotPath(b, "DelayChecker") }
+func BenchmarkBitrateMeter(b *testing.B)  { benchmarkHotPath(b, "BitrateMeter") }
+func BenchmarkMediaTrack(b *testing.B)    { benchmarkHotPath(b, "MediaTrack") }
+func BenchmarkVideoTrack(b *testing.B)    { benchmarkHotPath(b, "VideoTrack") }
+func BenchmarkTSWriter(b *testing.B)      { benchmarkHotPath(b, "TSWriter") }
+func BenchmarkTSAnalyzer(b *testing.B)    { benchmarkHotPath(b, "TSAnalyzer") }
+func BenchmarkPlayoutBuffer(b *testing.B) { benchmarkHotPath(b, "PlayoutBuffer") }
+func BenchmarkGapHistogram(b *testing.B)  { benchmarkHotPath(b, "GapHistogram") }
+func BenchmarkShardDispatch(b *testing.B) { benchmarkHotPath(b, "ShardDispatch") }
+
+func benchmarkHotPath(b *testing.B, name string) {
+	f := hotPaths()[name]()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f()
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// humanizer formats the numbers of the human-readable outputs in appropriate units,
+// with precision digits after the decimal point. Machine outputs (json) stay raw.
+type humanizer struct {
+	precision int
+}
+
+func (cfg *config) human() humanizer {
+	return humanizer{precision: cfg.precision}
+}
+
+func (h humanizer) float(v float64) string {
+	return strconv.FormatFloat(v, 'f', h.precision, 64)
+}
+
+func (h humanizer) bitrate(b bitrate) string {
+	switch {
+	case b >= 1e9:
+		return h.float(float64(b)/1e9) + " Gbps"
+	case b >= 1e6:
+		return h.float(float64(b)/1e6) + " Mbps"
+	case b >= 1e3:
+		return h.float(float64(b)/1e3) + " kbps"
+	}
+	return strconv.FormatFloat(float64(b), 'f', 0, 64) + " bps"
+}
+
+func (h humanizer) bytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return h.float(float64(n)/(1<<30)) + " GiB"
+	case n >= 1<<20:
+		return h.float(float64(n)/(1<<20)) + " MiB"
+	case n >= 1<<10:
+		return h.float(float64(n)/(1<<10)) + " KiB"
+	}
+	return strconv.FormatUint(n, 10) + " B"
+}
+
+func (h humanizer) duration(d time.Duration) string {
+	neg := ""
+	if d < 0 {
+		neg, d = "-", -d
+	}
+	switch {
+	case d >= time.Hour:
+		return neg + d.Round(time.Second).String()
+	case d >= time.Minute:
+		return neg + h.float(d.Minutes()) + "m"
+	case d >= time.Second:
+		return neg + h.float(d.Seconds()) + "s"
+	case d >= time.Millisecond:
+		return neg + h.float(float64(d)/float64(time.Millisecond)) + "ms"
+	case d > 0:
+		return neg + h.float(float64(d)/float64(time.Microsecond)) + "µs"
+	}
+	return "0s"
+}
@@ -0,0 +1,178 @@
+package main
+
+import "fmt"
+
+// languages are the supported languages of the human-readable summary.
+var languages = []string{"en", "ko"}
+
+// messages are the translations of the human-readable summary,
+// by language and English format. Missing formats are printed in English.
+var messages = map[string]map[string]string{
+	"ko": {
+		"bitrate %s: avg %s, min %s, max %s": "비트레이트 %s: 평균 %s, 최소 %s, 최대 %s",
+
+		"stats %s %s: packets %d, bytes %s, lost %d": "통계 %s %s: 패킷 %d, 바이트 %s, 손실 %d",
+		"gaps %s: p50 %s, p99 %s, p999 %s, max %s":   "패킷 간격 %s: p50 %s, p99 %s, p999 %s, 최대 %s",
+
+		"stats %s ssrc %s: packets %d, bytes %s, lost %d, jitter %s": "통계 %s ssrc %s: 패킷 %d, 바이트 %s, 손실 %d, 지터 %s",
+
+		"average bitrate %s %s": "평균 비트레이트 %s %s",
+
+		"rtcp: %d packets multiplexed on the RTP port are ignored, use -transport TCP to analyze them": "rtcp: RTP port 로 mux 된 패킷 %d 개를 무시함, 분석하려면 -transport TCP 사용",
+
+		"rtcp %s: sender reports %d, interval min/avg/max %s/%s/%s, interval alarms %d, " +
+			"media clock drift %s ppm, wall clock drift %s ppm": "rtcp %s: sender report %d, 간격 최소/평균/최대 %s/%s/%s, 간격 경보 %d, " +
+			"미디어 클럭 drift %s ppm, 서버 시계 drift %s ppm",
+
+		"audio %s %s: loudness %s, max silence %s, silence alarms %d":                               "오디오 %s %s: 음량 %s, 최대 무음 %s, 무음 경보 %d",
+		"av sync %s/%s: skew min/avg/max %s/%s/%s, max-av-skew alarms %d":                           "av sync %s/%s: 차이 최소/평균/최대 %s/%s/%s, max-av-skew 경보 %d",
+		"captions %s %s: frames with captions %d, cea-608 %d (%s/s), cea-708 %d (%s/s), max gap %s": "자막 %s %s: 자막 있는 프레임 %d, cea-608 %d (%s/s), cea-708 %d (%s/s), 최대 공백 %s",
+		"freeze %s %s: freezes %d, total %s, max %s":                                                "화면 멈춤 %s %s: 횟수 %d, 합계 %s, 최대 %s",
+		"gop %s %s: keyframes %d, interval min/avg/max %s/%s/%s, frames %s, max-gop alarms %d":      "gop %s %s: 키프레임 %d, 간격 최소/평균/최대 %s/%s/%s, 프레임 수 %s, max-gop 경보 %d",
+
+		"bitstream %s %s: access units %d, malformed %d " +
+			"(corrupted nalus %d, missing sps/pps %d, incomplete %d, decode errors %d)": "bitstream %s %s: access unit %d, 비정상 %d " +
+			"(손상된 nalu %d, sps/pps 없음 %d, 불완전 %d, 디코딩 오류 %d)",
+
+		"mpegts %s: packets %d, cc errors %d, sync loss %d, pcrs %d, pcr repetition errors %d, pcr discontinuities %d, max pcr interval %s, pcr jitter avg/max %s/%s, pts discontinuities %d": "mpegts %s: 패킷 %d, cc 오류 %d, sync 손실 %d, pcr %d, pcr 반복 오류 %d, pcr 불연속 %d, 최대 pcr 간격 %s, pcr 지터 평균/최대 %s/%s, pts 불연속 %d",
+		"scte35 %s: splice_insert %d, time_signal %d, splice_null %d, other %d, invalid %d":                                                                                                   "scte35 %s: splice_insert %d, time_signal %d, splice_null %d, 기타 %d, 잘못된 메시지 %d",
+		"mpegts: wrote %d ts packets, dropped %d invalid rtp payloads":                                                                                                                        "mpegts: ts 패킷 %d 개 저장, 잘못된 rtp payload %d 개 버림",
+
+		"handshake latency:%s": "handshake 소요 시간:%s",
+
+		"integrity %s: content %s of %s, chunks verified %d, mismatched %d, gops verified %d, mismatched %d, whole %s": "무결성 %s: 내용 %s / %s, chunk 일치 %d, 불일치 %d, gop 일치 %d, 불일치 %d, 전체 %s",
+
+		"subtitles %s: packets %d, bytes %s, interval min/avg/max %s/%s/%s, gap alarms %d": "자막 %s: 패킷 %d, 바이트 %s, 간격 최소/평균/최대 %s/%s/%s, 간격 경보 %d",
+
+		"nack %s: requested %d, recovered %d (%s%%), rtx packets %d, duplicates %d, unrecovered %d, recovery avg %s, max %s": "nack %s: 요청 %d, 복구 %d (%s%%), rtx 패킷 %d, 중복 %d, 복구 안 됨 %d, 복구 시간 평균 %s, 최대 %s",
+
+		"srtp: decrypted rtp %d, rtcp %d, authentication failures %d": "srtp: 복호화한 rtp %d, rtcp %d, 인증 실패 %d",
+
+		"fault injection: dropped %d, reordered %d, delayed %d of %d rtp packets": "fault injection: rtp 패킷 %[4]d 개 중 버림 %[1]d, 순서 바꿈 %[2]d, 지연 %[3]d",
+
+		"read rate %s: reads waited %s, the server sent faster if long (see the losses and the delays)": "read rate %s: 읽기 대기 %s, 길면 서버가 더 빨리 보낸 것 (손실과 지연 참고)",
+
+		"continuity breaks %d (set up again after 454), without packets %s": "연속성 끊김 %d 회 (454 후 다시 setup), 패킷 없던 시간 %s",
+
+		"describe load: sent %d (%s/s), ok %d, failed %d (%s%%), skipped %d over -describe-concurrency": "describe load: 요청 %d (%s/s), 성공 %d, 실패 %d (%s%%), -describe-concurrency 초과로 건너뜀 %d",
+
+		"describe load errors %s: %d": "describe load 오류 %s: %d",
+
+		"%s: handshakes %d, failed %d, handshake avg %s, packets %d, bytes %s, lost %d (%s%%)": "%s: handshake %d, 실패 %d, handshake 평균 %s, 패킷 %d, 바이트 %s, 손실 %d (%s%%)",
+
+		"resolve %s: %s sessions %d": "resolve %s: %s 세션 %d",
+
+		"describe cache: urls %d, sessions described from the cache %d": "describe cache: url %d, cache 로 describe 한 세션 %d",
+
+		"retries %d: sessions recovered %d, given up %d": "재시도 %d: 복구된 세션 %d, 포기 %d",
+
+		"probe: urls %d, failed %d, with conformance issues %d, profiles %s, codecs %s": "probe: url %d, 실패 %d, conformance 문제 있음 %d, profile %s, codec %s",
+
+		"stats: sessions %d, playing %d, %s, packets %s/s, errors %d, delays %d, max delay %s":                           "stats: 세션 %d, 재생 %d, %s, 패킷 %s/s, 오류 %d, 지연 %d, 최대 지연 %s",
+		"self: cpu %s%% of %d cores, %s per 1000 sessions, heap %s, goroutines %d, gc %d cycles, pause total %s, max %s": "self: cpu %s%% (코어 %d 개), 세션 1000 개당 %s, heap %s, goroutine %d, gc %d 회, pause 합계 %s, 최대 %s",
+
+		"alert %s %s: %s": "경보 %s %s: %s",
+		"alert %s %s":     "경보 %s %s",
+
+		"sla %s: %s, max %s, %s": "sla %s: %s, 최대 %s, %s",
+		"passed":                 "통과",
+		"breached":               "위반",
+
+		"soak %s: samples %d, first %s, last %s, slope %s/h, %s": "soak %s: 샘플 %d, 처음 %s, 마지막 %s, 기울기 %s/h, %s",
+
+		"handshake latency %s: count %d, p50 %s, p95 %s, p99 %s, max %s": "handshake 소요 시간 %s: 세션 %d, p50 %s, p95 %s, p99 %s, 최대 %s",
+
+		"time to %s: count %d, p50 %s, p95 %s, p99 %s, max %s": "%s 까지 시간: 세션 %d, p50 %s, p95 %s, p99 %s, 최대 %s",
+
+		"excluded, measured from": "제외, 측정 시작",
+
+		"rtspclient test report": "rtspclient 테스트 결과",
+		"url":                    "url",
+		"transport":              "transport",
+		"labels":                 "레이블",
+		"warm-up":                "워밍업",
+		"start":                  "시작",
+		"end":                    "종료",
+		"duration":               "시간",
+		"sessions":               "세션",
+		"failed":                 "실패",
+		"latency":                "소요 시간",
+		"count":                  "개수",
+		"max":                    "최대",
+		"bitrate over time":      "시간별 비트레이트",
+		"time":                   "시각",
+		"bitrate":                "비트레이트",
+		"errors":                 "오류",
+		"failure":                "실패 유형",
+		"example":                "예",
+		"none":                   "없음",
+		"urls":                   "url 별 결과",
+		"avg bitrate":            "평균 비트레이트",
+		"bytes":                  "바이트",
+		"lost":                   "손실",
+		"avg handshake":          "평균 handshake",
+		"cycles":                 "횟수",
+		"pause total":            "총 정지 시간",
+		"resource usage":         "rtspclient 자원 사용량",
+		"partial results":        "부분 결과",
+		"running":                "진행 중",
+		"leak detection":         "누수 탐지",
+		"metric":                 "지표",
+		"samples":                "샘플",
+		"first":                  "처음",
+		"last":                   "마지막",
+		"slope per hour":         "시간당 기울기",
+		"suspected leak":         "누수 의심",
+		"stable":                 "안정",
+		"retries":                "재시도",
+		"recovered":              "복구",
+		"given up":               "포기",
+		"error rate":             "오류율",
+		"loss rate":              "손실률",
+		"packets":                "패킷",
+		"rtspclient comparison":  "rtspclient 비교",
+
+		"time to first rtp packet %s: %s":         "첫 rtp 패킷까지 시간 %s: %s",
+		"kernel timestamps: %d of %d rtp packets": "커널 수신 시각: rtp 패킷 %d / %d",
+		"server requests: %s":                     "서버 요청: %s",
+
+		"channel change: %s":             "채널 전환: %s",
+		"channel change to keyframe: %s": "keyframe 까지 채널 전환: %s",
+		"time to first keyframe %s: %s":  "첫 keyframe 까지 시간 %s: %s",
+		"zapping: zaps %d, failed %d":    "zapping: 채널 전환 %d, 실패 %d",
+
+		"playout %s: buffer %s, underruns %d, stalled %s": "playout %s: buffer %s, underrun %d, 멈춤 %s",
+
+		"backchannel %s %s: sent %d packets, %s, errors %d": "backchannel %s %s: 보낸 패킷 %d, %s, 오류 %d",
+
+		"parameters: requests %d, failed %d, latency avg %s, max %s": "parameter: 요청 %d, 실패 %d, 응답 시간 평균 %s, 최대 %s",
+
+		"udp: the kernel dropped %d packets, the receive buffer overflows, these losses are local": "udp: 커널이 패킷 %d 개를 버림, 수신 buffer 가 넘침, 이 손실은 client 쪽 원인",
+
+		"udp: the kernel dropped %d packets, the receive buffers of the sessions overflow, these losses are local": "udp: 커널이 패킷 %d 개를 버림, 세션들의 수신 buffer 가 넘침, 이 손실은 client 쪽 원인",
+
+		"gc: %d cycles, pause total %s, p50 %s, p99 %s, max %s, heap %s": "gc: %d 회, 총 정지 시간 %s, p50 %s, p99 %s, 최대 %s, heap %s",
+	},
+}
+
+func validLanguage(lang string) error {
+	for _, l := range languages {
+		if l == lang {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported lang %q, should be one of %v", lang, languages)
+}
+
+// tr returns the translation of a summary format in the language of -lang.
+func (cfg *config) tr(format string) string {
+	if m, ok := messages[cfg.lang][format]; ok {
+		return m
+	}
+	return format
+}
+
+// summaryf logs a line of the human-readable summary of the session.
+func (s *session) summaryf(format string, v ...interface{}) {
+	s.logf(s.cfg.tr(format), v...)
+}
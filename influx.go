@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerFeature("influx")
+}
+
+// influxTags are the tags added to all the points pushed to -influx-url.
+type influxTags map[string]string
+
+func (t influxTags) String() string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + "=" + t[k]
+	}
+	return strings.Join(keys, ",")
+}
+
+// Set implements flag.Value, s is "key=value[,key=value]", it can be repeated.
+func (t *influxTags) Set(s string) error {
+	if *t == nil {
+		*t = make(influxTags)
+	}
+	for _, kv := range strings.Split(s, ",") {
+		tmp := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(tmp) != 2 || tmp[0] == "" || tmp[1] == "" {
+			return fmt.Errorf("invalid influx tag %q, should be key=value", kv)
+		}
+		(*t)[tmp[0]] = tmp[1]
+	}
+	return nil
+}
+
+var (
+	lineKeyEscaper    = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	lineStringEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// linePoint builds a point of the InfluxDB line protocol.
+type linePoint struct {
+	b      strings.Builder
+	fields int
+}
+
+func newLinePoint(measurement string, tags string) *linePoint {
+	p := &linePoint{}
+	p.b.WriteString(measurement)
+	p.b.WriteString(tags)
+	return p
+}
+
+// tag adds a tag, tags should be added before fields.
+func (p *linePoint) tag(k, v string) *linePoint {
+	if v != "" {
+		p.b.WriteString("," + lineKeyEscaper.Replace(k) + "=" + lineKeyEscaper.Replace(v))
+	}
+	return p
+}
+
+func (p *linePoint) field(k, v string) *linePoint {
+	if p.fields == 0 {
+		p.b.WriteByte(' ')
+	} else {
+		p.b.WriteByte(',')
+	}
+	p.fields++
+	p.b.WriteString(lineKeyEscaper.Replace(k) + "=" + v)
+	return p
+}
+
+func (p *linePoint) intField(k string, v uint64) *linePoint {
+	return p.field(k, strconv.FormatUint(v, 10)+"i")
+}
+
+func (p *linePoint) floatField(k string, v float64) *linePoint {
+	return p.field(k, strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+func (p *linePoint) stringField(k, v string) *linePoint {
+	return p.field(k, `"`+lineStringEscaper.Replace(v)+`"`)
+}
+
+func (p *linePoint) line(t time.Time) string {
+	return p.b.String() + " " + strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// influxPusher pushes the metrics of a run to an InfluxDB write endpoint
+// (or any endpoint accepting the line protocol) every -influx-interval.
+type influxPusher struct {
+	url    string
+	token  string
+	tags   string
+	client http.Client
+
+	mu      sync.Mutex
+	pending []string
+}
+
+func newInfluxPusher(cfg *config, runName string) *influxPusher {
+	tags := influxTags{}
+	if h, err := os.Hostname(); err == nil {
+		tags["host"] = h
+	}
+	if runName != "" {
+		tags["run"] = runName
+	}
+	for k, v := range cfg.runLabels() {
+		tags[k] = v
+	}
+	for k, v := range cfg.influxTags {
+		tags[k] = v
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString("," + lineKeyEscaper.Replace(k) + "=" + lineKeyEscaper.Replace(tags[k]))
+	}
+	return &influxPusher{
+		url:    cfg.influxURL,
+		token:  cfg.influxToken,
+		tags:   b.String(),
+		client: http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (ip *influxPusher) point(measurement string) *linePoint {
+	return newLinePoint(measurement, ip.tags)
+}
+
+func (ip *influxPusher) sessionPoint(measurement string, ss *sessionSnapshot) *linePoint {
+	var lost int64
+	var maxJitter duration
+	for _, t := range ss.Tracks {
+		lost += t.Lost
+		for _, st := range t.SSRCs {
+			if st.Jitter > maxJitter {
+				maxJitter = st.Jitter
+			}
+		}
+	}
+	if lost < 0 {
+		lost = 0
+	}
+	return ip.point(measurement).
+		tag("session", ss.ID).tag("url", ss.URL).tag("class", ss.Class).
+		stringField("state", ss.State).
+		intField("packets", ss.Packets).
+		intField("bytes", ss.Bytes).
+		floatField("bitrate", float64(ss.Bitrate.Current)).
+		floatField("bitrate_avg", float64(ss.Bitrate.Average)).
+		intField("lost", uint64(lost)).
+		floatField("jitter_ms", float64(maxJitter)/float64(time.Millisecond))
+}
+
+// addResult queues the final point of a finished session for the next push.
+func (ip *influxPusher) addResult(s *session, err error) {
+	ss := s.snapshot()
+	p := ip.sessionPoint("rtspclient_result", ss)
+	if err != nil {
+		failure := s.failure
+		if failure == "" {
+			failure = "other"
+		}
+		p.stringField("result", "failed").stringField("failure", failure).stringField("error", err.Error())
+	} else {
+		p.stringField("result", "ok")
+	}
+	ip.mu.Lock()
+	ip.pending = append(ip.pending, p.line(ss.Time))
+	ip.mu.Unlock()
+}
+
+// collect returns the points of the running sessions and the aggregate of r,
+// with the queued results.
+func (ip *influxPusher) collect(r *run, now time.Time) []string {
+	ip.mu.Lock()
+	lines := ip.pending
+	ip.pending = nil
+	ip.mu.Unlock()
+
+	for _, s := range r.sessions.list() {
+		lines = append(lines, ip.sessionPoint("rtspclient_session", s.snapshot()).line(now))
+	}
+	tot := r.totals()
+	lines = append(lines, ip.point("rtspclient_run").
+		intField("sessions", uint64(tot.Sessions)).
+		intField("playing", uint64(tot.Playing)).
+		intField("packets", tot.Packets).
+		intField("bytes", tot.Bytes).
+		floatField("bitrate", float64(tot.Bitrate)).
+		line(now))
+	return lines
+}
+
+func (ip *influxPusher) push(lines []string) error {
+	req, err := http.NewRequest(http.MethodPost, ip.url, bytes.NewBufferString(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if ip.token != "" {
+		req.Header.Set("Authorization", "Token "+ip.token)
+	}
+	res, err := ip.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("bad status %s, %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// start pushes the metrics of r every interval until the returned func is called,
+// which pushes the remaining results.
+func (ip *influxPusher) start(r *run, interval time.Duration) func() {
+	pushNow := func(now time.Time) {
+		if err := ip.push(ip.collect(r, now)); err != nil {
+			r.logger.Printf("failed to push metrics to influx, %v", err)
+		}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case now := <-t.C:
+				pushNow(now)
+			case <-done:
+				pushNow(time.Now())
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+)
+
+func init() {
+	registerFeature("integrity")
+}
+
+// manifestChunkSize is the chunk size of the manifests written by -manifest-record.
+const manifestChunkSize = 1 << 20
+
+// manifestEntry are the expected hashes (sha256, hex) of the content of an asset: the MPEG-TS bytes of
+// its MP2T track, else the slice NALUs of its H264/H265 track, each prefixed by its 4-byte length.
+// The parameter sets, SEI and delimiters are not hashed, servers insert them.
+type manifestEntry struct {
+	// whole content, verified if the session received all of it
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	// content by chunks of ChunkSize bytes, the last one shorter
+	ChunkSize int64    `json:"chunkSize,omitempty"`
+	Chunks    []string `json:"chunks,omitempty"`
+	// video content by GOP, from each keyframe
+	GOPs []string `json:"gops,omitempty"`
+}
+
+// manifest are the entries of -manifest by asset, the url without query, its path or the last element of its path.
+type manifest map[string]*manifestEntry
+
+func loadManifest(name string) (manifest, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// assetKeys returns the keys of an url in a manifest, from the most specific.
+func assetKeys(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return []string{rawURL}
+	}
+	u.RawQuery = ""
+	return []string{u.String(), u.Path, path.Base(u.Path)}
+}
+
+// lookup returns the key and the entry of an url, nil if the manifest has none.
+func (m manifest) lookup(rawURL string) (string, *manifestEntry) {
+	for _, k := range assetKeys(rawURL) {
+		if e := m[k]; e != nil {
+			return k, e
+		}
+	}
+	return "", nil
+}
+
+// record adds the entry of an asset written by -manifest-record, the largest if several sessions played it.
+func (r *run) recordManifest(key string, e *manifestEntry) {
+	r.manifestMu.Lock()
+	defer r.manifestMu.Unlock()
+	if r.manifest == nil {
+		r.manifest = make(manifest)
+	}
+	if prev := r.manifest[key]; prev == nil || prev.Size < e.Size {
+		r.manifest[key] = e
+	}
+}
+
+// writeManifest writes the entries of -manifest-record into -manifest.
+func (r *run) writeManifest() error {
+	r.manifestMu.Lock()
+	defer r.manifestMu.Unlock()
+	b, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.cfg.manifest, append(b, '\n'))
+}
+
+// integrityStats are the results of the verification of the content of a session.
+type integrityStats struct {
+	Asset          string `json:"asset"`
+	Size           int64  `json:"size"`
+	ChunksVerified int    `json:"chunksVerified"`
+	ChunksMismatch int    `json:"chunksMismatch"`
+	GOPsVerified   int    `json:"gopsVerified"`
+	GOPsMismatch   int    `json:"gopsMismatch"`
+	// ok, mismatch or incomplete, empty without sha256 in the manifest
+	Whole string `json:"whole,omitempty"`
+}
+
+// integrityChecker hashes the content of a format of a session, and compares it with the entry of the manifest,
+// or records it with -manifest-record.
+type integrityChecker struct {
+	s     *session
+	forma format.Format
+	key   string
+	want  *manifestEntry
+	got   manifestEntry
+
+	mu         sync.Mutex
+	whole      hash.Hash
+	chunk      hash.Hash
+	chunkLen   int64
+	gop        hash.Hash
+	stats      integrityStats
+	mismatches int
+
+	finishOnce sync.Once
+	err        error
+}
+
+// setupIntegrity creates the checker of the first MP2T format of the medias, else of the first H264/H265 format,
+// nil if the manifest has no entry for the url and it is not recorded.
+func (s *session) setupIntegrity(medias []*description.Media) {
+	var forma format.Format
+	for _, medi := range medias {
+		for _, f := range medi.Formats {
+			if isMPEGTS(f) {
+				forma = f
+				break
+			}
+			if _, ok := s.videoTracks[f]; ok && forma == nil {
+				forma = f
+			}
+		}
+	}
+	if forma == nil {
+		s.logf("integrity: no MP2T or H264/H265 format to verify")
+		return
+	}
+	ic := &integrityChecker{s: s, forma: forma, whole: sha256.New()}
+	if s.cfg.manifestRecord {
+		ic.key = assetKeys(s.url)[1]
+		ic.got.ChunkSize = manifestChunkSize
+	} else {
+		ic.key, ic.want = s.run.manifest.lookup(s.url)
+		if ic.want == nil {
+			s.logf("integrity: no entry of %s in %s", s.url, s.cfg.manifest)
+			return
+		}
+		ic.got.ChunkSize = ic.want.ChunkSize
+	}
+	ic.stats.Asset = ic.key
+	if vt := s.videoTracks[forma]; vt != nil && !isMPEGTS(forma) {
+		vt.content = ic
+	}
+	s.integrity = ic
+}
+
+// writeTS hashes the MPEG-TS payload of an RTP packet.
+func (ic *integrityChecker) writeTS(payload []byte) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	ic.write(payload)
+}
+
+// writeAU hashes the slice NALUs of a video access unit, from the first keyframe.
+func (ic *integrityChecker) writeAU(au [][]byte, keyframe, isH265 bool) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	if keyframe {
+		ic.endGOP()
+		ic.gop = sha256.New()
+	}
+	if ic.gop == nil {
+		return
+	}
+	var l [4]byte
+	for _, nalu := range au {
+		if len(nalu) == 0 || !isSliceNALU(nalu, isH265) {
+			continue
+		}
+		binary.BigEndian.PutUint32(l[:], uint32(len(nalu)))
+		ic.write(l[:])
+		ic.write(nalu)
+		ic.gop.Write(l[:])
+		ic.gop.Write(nalu)
+	}
+}
+
+func isSliceNALU(nalu []byte, isH265 bool) bool {
+	if isH265 {
+		typ := h265.NALUType((nalu[0] >> 1) & 0x3f)
+		return typ < h265.NALUType_VPS_NUT
+	}
+	typ := h264.NALUType(nalu[0] & 0x1f)
+	return typ >= h264.NALUTypeNonIDR && typ <= h264.NALUTypeIDR
+}
+
+// write hashes content into the whole hash and the chunks.
+func (ic *integrityChecker) write(b []byte) {
+	ic.whole.Write(b)
+	ic.stats.Size += int64(len(b))
+	if ic.got.ChunkSize <= 0 {
+		return
+	}
+	for len(b) > 0 {
+		if ic.chunk == nil {
+			ic.chunk = sha256.New()
+		}
+		n := ic.got.ChunkSize - ic.chunkLen
+		if n > int64(len(b)) {
+			n = int64(len(b))
+		}
+		ic.chunk.Write(b[:n])
+		ic.chunkLen += n
+		b = b[n:]
+		if ic.chunkLen == ic.got.ChunkSize {
+			ic.endChunk()
+		}
+	}
+}
+
+func (ic *integrityChecker) endChunk() {
+	if ic.chunk == nil {
+		return
+	}
+	sum := hex.EncodeToString(ic.chunk.Sum(nil))
+	i := len(ic.got.Chunks)
+	ic.got.Chunks = append(ic.got.Chunks, sum)
+	ic.chunk, ic.chunkLen = nil, 0
+	if ic.want == nil || i >= len(ic.want.Chunks) {
+		return
+	}
+	if ic.want.Chunks[i] == sum {
+		ic.stats.ChunksVerified++
+		return
+	}
+	ic.stats.ChunksMismatch++
+	ic.mismatch("chunk %d (bytes %d-) differs", i, int64(i)*ic.got.ChunkSize)
+}
+
+func (ic *integrityChecker) endGOP() {
+	if ic.gop == nil {
+		return
+	}
+	sum := hex.EncodeToString(ic.gop.Sum(nil))
+	i := len(ic.got.GOPs)
+	ic.got.GOPs = append(ic.got.GOPs, sum)
+	ic.gop = nil
+	if ic.want == nil || i >= len(ic.want.GOPs) {
+		return
+	}
+	if ic.want.GOPs[i] == sum {
+		ic.stats.GOPsVerified++
+		return
+	}
+	ic.stats.GOPsMismatch++
+	ic.mismatch("gop %d differs", i)
+}
+
+// mismatch logs the first mismatches, a damaged stream would flood the log.
+func (ic *integrityChecker) mismatch(format string, v ...interface{}) {
+	ic.mismatches++
+	if ic.mismatches <= 10 {
+		ic.s.logf("integrity %s: "+format, append([]interface{}{ic.key}, v...)...)
+	}
+}
+
+// finish hashes the last chunk and GOP and verifies the whole content, or records the entry, once.
+// It returns an error if any hash differs.
+func (ic *integrityChecker) finish() error {
+	ic.finishOnce.Do(func() { ic.err = ic.verify() })
+	return ic.err
+}
+
+// end hashes the last chunk and GOP and the whole content, it is called with ic.mu locked.
+func (ic *integrityChecker) end() {
+	ic.endGOP()
+	ic.endChunk()
+	ic.got.Size = ic.stats.Size
+	ic.got.SHA256 = hex.EncodeToString(ic.whole.Sum(nil))
+}
+
+func (ic *integrityChecker) verify() error {
+	ic.mu.Lock()
+	ic.end()
+	if ic.want != nil && ic.want.SHA256 != "" {
+		switch {
+		case ic.stats.Size < ic.want.Size:
+			ic.stats.Whole = "incomplete"
+		case ic.stats.Size == ic.want.Size && ic.got.SHA256 == ic.want.SHA256:
+			ic.stats.Whole = "ok"
+		default:
+			ic.stats.Whole = "mismatch"
+		}
+	}
+	st := ic.stats
+	ic.mu.Unlock()
+
+	h := ic.s.cfg.human()
+	if ic.want == nil {
+		ic.s.run.recordManifest(ic.key, &ic.got)
+		ic.s.logf("integrity %s: recorded %s, chunks %d, gops %d", ic.key, h.bytes(uint64(st.Size)), len(ic.got.Chunks), len(ic.got.GOPs))
+		return nil
+	}
+	whole := st.Whole
+	if whole == "" {
+		whole = "not in the manifest"
+	}
+	ic.s.summaryf("integrity %s: content %s of %s, chunks verified %d, mismatched %d, gops verified %d, mismatched %d, whole %s",
+		ic.key, h.bytes(uint64(st.Size)), h.bytes(uint64(ic.want.Size)), st.ChunksVerified, st.ChunksMismatch,
+		st.GOPsVerified, st.GOPsMismatch, whole)
+	if st.ChunksMismatch != 0 || st.GOPsMismatch != 0 || st.Whole == "mismatch" {
+		return fmt.Errorf("%d chunks and %d gops differ from the manifest, whole %s", st.ChunksMismatch, st.GOPsMismatch, st.Whole)
+	}
+	return nil
+}
+
+// checkIntegrity fails a session whose content differs from the manifest.
+func (s *session) checkIntegrity() error {
+	if s.integrity == nil {
+		return nil
+	}
+	if err := s.integrity.finish(); err != nil {
+		return s.errorf("integrity check failed, %v", err)
+	}
+	return nil
+}
+
+func (ic *integrityChecker) snapshot() integrityStats {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	return ic.stats
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+)
+
+func init() {
+	registerFeature("keepalive")
+}
+
+// -keepalive methods
+const (
+	keepaliveAuto         = "auto"
+	keepaliveOptions      = "OPTIONS"
+	keepaliveGetParameter = "GET_PARAMETER"
+	keepaliveNone         = "none"
+)
+
+// keepaliveDefaultTimeout is the session timeout of a server without timeout in its Session header, RFC 2326.
+const keepaliveDefaultTimeout = 60 * time.Second
+
+// keepaliveDisabledTimeout is the session timeout in seconds given to the client of -keepalive none,
+// its first keepalive would be after decades.
+const keepaliveDisabledTimeout = 1000000000
+
+// keepaliveTimeout returns the session timeout in seconds for which the client sends keepalives
+// at interval or a bit earlier, it sends them at 80% of the timeout.
+func keepaliveTimeout(interval time.Duration) uint {
+	t := uint(interval * 10 / 8 / time.Second)
+	if t == 0 {
+		t = 1
+	}
+	return t
+}
+
+// keepalive makes the client of a session send the keepalives of -keepalive, at -keepalive-interval
+// or at the session timeout of the server divided by -keepalive-divisor.
+// The client has no setting for them: it sends GET_PARAMETER if the Public header of the OPTIONS response
+// has it, else OPTIONS, at 80% of the timeout of the Session header, so the responses are rewritten.
+type keepalive struct {
+	s        *session
+	method   string
+	interval time.Duration
+	divisor  float64
+
+	mu sync.Mutex
+	// method of the request in progress, the requests of the handshake are sequential
+	request base.Method
+	logged  bool
+}
+
+// newKeepalive returns the keepalive of a session, nil for a publisher, the client sends no keepalive while recording.
+func newKeepalive(s *session) *keepalive {
+	if s.publisher() {
+		return nil
+	}
+	return &keepalive{s: s, method: s.cfg.keepalive, interval: s.cfg.keepaliveInterval, divisor: s.cfg.keepaliveDivisor}
+}
+
+func (k *keepalive) onRequest(req *base.Request) {
+	k.mu.Lock()
+	k.request = req.Method
+	k.mu.Unlock()
+}
+
+func (k *keepalive) onResponse(res *base.Response) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.request == base.Options {
+		k.rewritePublic(res)
+	}
+
+	v, ok := res.Header["Session"]
+	if !ok {
+		return
+	}
+	var sx headers.Session
+	if err := sx.Unmarshal(v); err != nil {
+		// the client fails on it
+		return
+	}
+	server := "not set"
+	serverTimeout := keepaliveDefaultTimeout
+	if sx.Timeout != nil {
+		server = k.s.cfg.human().duration(time.Duration(*sx.Timeout) * time.Second)
+		serverTimeout = time.Duration(*sx.Timeout) * time.Second
+	}
+	var timeout uint
+	switch {
+	case k.method == keepaliveNone:
+		timeout = keepaliveDisabledTimeout
+	case k.interval > 0:
+		timeout = keepaliveTimeout(k.interval)
+	default:
+		timeout = keepaliveTimeout(time.Duration(float64(serverTimeout) / k.divisor))
+	}
+	sx.Timeout = &timeout
+	res.Header["Session"] = sx.Marshal()
+	period := time.Duration(timeout) * time.Second * 8 / 10
+
+	if k.logged {
+		return
+	}
+	k.logged = true
+	if k.method == keepaliveNone {
+		k.s.logf("session timeout %s, keepalives disabled", server)
+		return
+	}
+	k.s.logf("session timeout %s, keepalive %s every %s", server, k.method, k.s.cfg.human().duration(period))
+}
+
+// rewritePublic lists GET_PARAMETER in the Public header of an OPTIONS response,
+// or removes it, for the method of the keepalives.
+func (k *keepalive) rewritePublic(res *base.Response) {
+	if k.method != keepaliveOptions && k.method != keepaliveGetParameter {
+		return
+	}
+	var methods []string
+	if pub := res.Header["Public"]; len(pub) == 1 {
+		for _, m := range strings.Split(pub[0], ",") {
+			if m = strings.TrimSpace(m); m != "" && m != keepaliveGetParameter {
+				methods = append(methods, m)
+			}
+		}
+	}
+	if k.method == keepaliveGetParameter {
+		methods = append(methods, keepaliveGetParameter)
+	}
+	res.Header["Public"] = base.HeaderValue{strings.Join(methods, ", ")}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// SIOCGSTAMPNS returns the receive time of the last packet read from a socket.
+const sioCGSTAMPNS = 0x8907
+
+// enableKernelTimestamps makes the kernel timestamp the packets received on the socket.
+func enableKernelTimestamps(rc syscall.RawConn) error {
+	var err error
+	err2 := rc.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_TIMESTAMPNS, 1)
+	})
+	if err2 != nil {
+		return err2
+	}
+	return err
+}
+
+// kernelRxTime returns the kernel receive time of the last packet read from the socket.
+func kernelRxTime(rc syscall.RawConn) (time.Time, error) {
+	var ts syscall.Timespec
+	var errno syscall.Errno
+	err := rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, sioCGSTAMPNS, uintptr(unsafe.Pointer(&ts)))
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if errno != 0 {
+		return time.Time{}, errno
+	}
+	return time.Unix(ts.Unix()), nil
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+var errKernelTimestamps = fmt.Errorf("kernel timestamps are not supported on this platform")
+
+// enableKernelTimestamps makes the kernel timestamp the packets received on the socket,
+// only supported on Linux.
+func enableKernelTimestamps(rc syscall.RawConn) error {
+	return errKernelTimestamps
+}
+
+// kernelRxTime returns the kernel receive time of the last packet read from the socket.
+func kernelRxTime(rc syscall.RawConn) (time.Time, error) {
+	return time.Time{}, errKernelTimestamps
+}
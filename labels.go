@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+func init() {
+	registerFeature("labels")
+}
+
+// testIDLabel is the label of -test-id.
+const testIDLabel = "test-id"
+
+// labels are the key=value labels of -label.
+type labels map[string]string
+
+// keys returns the keys of the labels, sorted.
+func (l labels) keys() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (l labels) String() string {
+	fields := make([]string, 0, len(l))
+	for _, k := range l.keys() {
+		fields = append(fields, k+"="+l[k])
+	}
+	return strings.Join(fields, ",")
+}
+
+// Set implements flag.Value, s is "key=value[,key=value]", it can be repeated.
+func (l *labels) Set(s string) error {
+	if *l == nil {
+		*l = make(labels)
+	}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || strings.ContainsAny(k, " \t\r\n:|#") || strings.ContainsAny(v, "\r\n|#") {
+			return fmt.Errorf("invalid label %q, should be key=value", kv)
+		}
+		(*l)[k] = v
+	}
+	return nil
+}
+
+// runLabels returns the labels of -label and -test-id, nil if there is none.
+func (cfg *config) runLabels() labels {
+	if len(cfg.labels) == 0 && cfg.testID == "" {
+		return nil
+	}
+	l := make(labels, len(cfg.labels)+1)
+	for k, v := range cfg.labels {
+		l[k] = v
+	}
+	if cfg.testID != "" {
+		l[testIDLabel] = cfg.testID
+	}
+	return l
+}
+
+// setLabelHeader sets the header of -label-header to the labels of the run in the requests of headerMethods.
+func (cfg *config) setLabelHeader() {
+	l := cfg.runLabels()
+	if cfg.labelHeader == "" || len(l) == 0 {
+		return
+	}
+	if cfg.headers == nil {
+		cfg.headers = make(requestHeaders)
+	}
+	for _, m := range headerMethods {
+		if cfg.headers[m] == nil {
+			cfg.headers[m] = make(base.Header)
+		}
+		cfg.headers[m][cfg.labelHeader] = base.HeaderValue{l.String()}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+// handshakePhases are the measured phases of the RTSP handshake, in order.
+var handshakePhases = []string{"connect", "OPTIONS", "DESCRIBE", "ANNOUNCE", "SETUP", "PLAY", "RECORD"}
+
+// handshakeTimer measures the time spent in each phase of the RTSP handshake of a session.
+// The time of a request is from when it is sent (after -request-rate) to its response,
+// the times of the SETUP requests of all medias are summed.
+type handshakeTimer struct {
+	mu      sync.Mutex
+	method  base.Method
+	reqTime time.Time
+	phases  map[string]time.Duration
+	done    bool
+	// time of the PLAY (or RECORD) response
+	playTime time.Time
+}
+
+func (h *handshakeTimer) add(phase string, d time.Duration) {
+	if h.phases == nil {
+		h.phases = make(map[string]time.Duration)
+	}
+	h.phases[phase] += d
+}
+
+func (h *handshakeTimer) connected(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.add("connect", d)
+}
+
+func (h *handshakeTimer) onRequest(req *base.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.method = req.Method
+	h.reqTime = time.Now()
+}
+
+func (h *handshakeTimer) onResponse(*base.Response) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.done || h.reqTime.IsZero() {
+		return
+	}
+	switch h.method {
+	case base.Options, base.Describe, base.Announce, base.Setup, base.Play, base.Record:
+		h.add(string(h.method), time.Since(h.reqTime))
+	}
+	if h.method == base.Play || h.method == base.Record {
+		// requests after PLAY (keepalive, ...) are not part of the handshake
+		h.done = true
+		h.playTime = time.Now()
+	}
+	h.reqTime = time.Time{}
+}
+
+// lastMethod returns the method of the last request of the client.
+func (h *handshakeTimer) lastMethod() base.Method {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.method
+}
+
+// pending returns the phase in progress of the handshake, the request waiting for its response,
+// connect before the first request, empty between requests.
+func (h *handshakeTimer) pending() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case h.method == "":
+		return "connect"
+	case h.reqTime.IsZero():
+		return ""
+	}
+	return string(h.method)
+}
+
+// sincePlay returns the time elapsed since the PLAY response, 0 if there was none.
+func (h *handshakeTimer) sincePlay(now time.Time) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.playTime.IsZero() || now.Before(h.playTime) {
+		return 0
+	}
+	return now.Sub(h.playTime)
+}
+
+func (h *handshakeTimer) snapshot() map[string]duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ret := make(map[string]duration, len(h.phases))
+	for p, d := range h.phases {
+		ret[p] = duration(d)
+	}
+	return ret
+}
+
+// latencyPercentiles are the percentiles of a handshake phase across sessions.
+type latencyPercentiles struct {
+	Count int      `json:"count"`
+	P50   duration `json:"p50"`
+	P95   duration `json:"p95"`
+	P99   duration `json:"p99"`
+	Max   duration `json:"max"`
+}
+
+// latencyRecorder collects the handshake phase times of the sessions of a run.
+type latencyRecorder struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	// end of the warm-up of -warmup, the samples until then are excluded
+	from time.Time
+}
+
+func newLatencyRecorder() *latencyRecorder {
+	return &latencyRecorder{samples: make(map[string][]time.Duration)}
+}
+
+func (l *latencyRecorder) record(phases map[string]duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Now().Before(l.from) {
+		return
+	}
+	for p, d := range phases {
+		l.samples[p] = append(l.samples[p], time.Duration(d))
+	}
+}
+
+func (l *latencyRecorder) excludeUntil(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.from = t
+}
+
+func (l *latencyRecorder) samplesCopy() map[string][]time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ret := make(map[string][]time.Duration, len(l.samples))
+	for p, samples := range l.samples {
+		ret[p] = append([]time.Duration(nil), samples...)
+	}
+	return ret
+}
+
+// percentile returns the nearest-rank percentile of sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func (l *latencyRecorder) percentiles() map[string]latencyPercentiles {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ret := make(map[string]latencyPercentiles)
+	for p, samples := range l.samples {
+		sorted := append([]time.Duration(nil), samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		ret[p] = latencyPercentiles{
+			Count: len(sorted),
+			P50:   duration(percentile(sorted, 0.50)),
+			P95:   duration(percentile(sorted, 0.95)),
+			P99:   duration(percentile(sorted, 0.99)),
+			Max:   duration(sorted[len(sorted)-1]),
+		}
+	}
+	return ret
+}
+
+// firstPacketPhase is the latency phase of the time from the PLAY response
+// to the first RTP packet of a media.
+func firstPacketPhase(media string) string {
+	return "first-rtp " + media
+}
+
+// firstKeyframePhase is the latency phase of the time from the PLAY response
+// to the first decodable keyframe of a video track.
+func firstKeyframePhase(track string) string {
+	return "first-idr " + track
+}
+
+// timeToPhases are the prefixes of the latency phases measured after the handshake, logged as "time to".
+var timeToPhases = []string{firstPacketPhase(""), firstKeyframePhase(""), channelChangePhase}
+
+func isTimeToPhase(p string) bool {
+	for _, prefix := range timeToPhases {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// logLatency logs the handshake and first packet latency percentiles of the run.
+func (r *run) logLatency() {
+	pcts := r.latency.percentiles()
+	for _, p := range handshakePhases {
+		if lp, ok := pcts[p]; ok {
+			r.logger.Printf(r.cfg.tr("handshake latency %s: count %d, p50 %s, p95 %s, p99 %s, max %s"),
+				r.latencyArgs(p, lp)...)
+		}
+	}
+
+	var others []string
+	for p := range pcts {
+		if isTimeToPhase(p) {
+			others = append(others, p)
+		}
+	}
+	sort.Strings(others)
+	for _, p := range others {
+		r.logger.Printf(r.cfg.tr("time to %s: count %d, p50 %s, p95 %s, p99 %s, max %s"),
+			r.latencyArgs(p, pcts[p])...)
+	}
+}
+
+func (r *run) latencyArgs(phase string, lp latencyPercentiles) []interface{} {
+	h := r.cfg.human()
+	return []interface{}{phase, lp.Count,
+		h.duration(time.Duration(lp.P50)), h.duration(time.Duration(lp.P95)),
+		h.duration(time.Duration(lp.P99)), h.duration(time.Duration(lp.Max))}
+}
+
+// handleLatency returns the handshake latency percentiles of the run.
+func (r *run) handleLatency(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, r.latency.percentiles())
+}
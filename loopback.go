@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtph264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("loopback")
+	registerCodec("loopback", "H264")
+}
+
+// loopbackUUID identifies the markers of -loopback, the uuid of their user data unregistered SEI.
+var loopbackUUID = []byte("rtspclient-loop1")
+
+// loopbackGrace is the time the player of a loopback session keeps playing
+// after the publisher stopped, for the frames in flight.
+const loopbackGrace = 2 * time.Second
+
+// loopback verifies the H264 frames of a publisher received by a player of the same url.
+// The publisher inserts a marker before each frame, its sequence number, send time
+// and the checksum of the NALUs of the frame, which the player checks.
+type loopback struct {
+	mu   sync.Mutex
+	sent uint32
+
+	// player side
+	decoder *rtph264.Decoder
+	forma   format.Format
+	// sequence number of the first frame received, the frames sent before the player started are not missing
+	first     uint32
+	next      uint32
+	received  bool
+	verified  uint64
+	corrupted uint64
+	reordered uint64
+	missing   uint64
+	unmarked  uint64
+	latencies []time.Duration
+}
+
+func loopbackChecksum(au [][]byte) uint32 {
+	var crc uint32
+	for _, nalu := range au {
+		if h264.NALUType(nalu[0]&0x1f) == h264.NALUTypeSEI {
+			continue
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, nalu)
+	}
+	return crc
+}
+
+// mark returns the access unit with a marker SEI before the first slice.
+func (l *loopback) mark(au [][]byte, now time.Time) [][]byte {
+	l.mu.Lock()
+	seq := l.sent
+	l.sent++
+	l.mu.Unlock()
+
+	var w bitWriter
+	w.u(8, 5) // user_data_unregistered
+	w.u(8, uint32(len(loopbackUUID)+16))
+	w.buf = append(w.buf, loopbackUUID...)
+	w.buf = binary.BigEndian.AppendUint32(w.buf, seq)
+	w.buf = binary.BigEndian.AppendUint64(w.buf, uint64(now.UnixNano()))
+	w.buf = binary.BigEndian.AppendUint32(w.buf, loopbackChecksum(au))
+	w.trailing()
+	sei := w.nalu(byte(h264.NALUTypeSEI))
+
+	ret := make([][]byte, 0, len(au)+1)
+	for i, nalu := range au {
+		if typ := h264.NALUType(nalu[0] & 0x1f); typ >= h264.NALUTypeNonIDR && typ <= h264.NALUTypeIDR {
+			ret = append(ret, sei)
+			return append(ret, au[i:]...)
+		}
+		ret = append(ret, nalu)
+	}
+	return append(ret, sei)
+}
+
+// unmark returns the marker of an access unit.
+func unmark(au [][]byte) (seq uint32, sent time.Time, crc uint32, ok bool) {
+	for _, nalu := range au {
+		if h264.NALUType(nalu[0]&0x1f) != h264.NALUTypeSEI {
+			continue
+		}
+		p := h264.EmulationPreventionRemove(nalu[1:])
+		if len(p) < 2+len(loopbackUUID)+16 || p[0] != 5 || !bytes.Equal(p[2:2+len(loopbackUUID)], loopbackUUID) {
+			continue
+		}
+		p = p[2+len(loopbackUUID):]
+		return binary.BigEndian.Uint32(p), time.Unix(0, int64(binary.BigEndian.Uint64(p[4:]))),
+			binary.BigEndian.Uint32(p[12:]), true
+	}
+	return 0, time.Time{}, 0, false
+}
+
+// onPacketRTP checks the frames of the first H264 format received by the player.
+func (l *loopback) onPacketRTP(now time.Time, forma format.Format, pkt *rtp.Packet) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.forma == nil {
+		f, ok := forma.(*format.H264)
+		if !ok {
+			return
+		}
+		d, err := f.CreateDecoder()
+		if err != nil {
+			return
+		}
+		l.forma, l.decoder = forma, d
+	}
+	if forma != l.forma {
+		return
+	}
+	au, err := l.decoder.Decode(pkt)
+	if err != nil {
+		return
+	}
+
+	seq, sent, crc, ok := unmark(au)
+	switch {
+	case !ok:
+		l.unmarked++
+		return
+	case crc != loopbackChecksum(au):
+		l.corrupted++
+	default:
+		l.verified++
+	}
+	l.latencies = append(l.latencies, now.Sub(sent))
+	switch {
+	case !l.received:
+		l.received = true
+		l.first, l.next = seq, seq+1
+	case seq >= l.next:
+		l.missing += uint64(seq - l.next)
+		l.next = seq + 1
+	case l.missing != 0:
+		// counted missing when skipped
+		l.reordered++
+		l.missing--
+	}
+}
+
+// result logs the verification of the session and returns an error if it failed.
+// The frames sent after the last received one are missing.
+func (l *loopback) result(s *session) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sent, missing := l.sent, l.missing
+	if l.received {
+		sent -= l.first
+		missing += uint64(l.sent - l.next)
+	}
+	h := s.cfg.human()
+	var p50, p95, max time.Duration
+	if n := len(l.latencies); n != 0 {
+		sort.Slice(l.latencies, func(i, j int) bool { return l.latencies[i] < l.latencies[j] })
+		p50, p95, max = l.latencies[(n-1)*50/100], l.latencies[(n-1)*95/100], l.latencies[n-1]
+	}
+	s.logf("loopback: frames sent %d, verified %d, corrupted %d, missing %d, reordered %d, unmarked %d, latency p50 %s, p95 %s, max %s",
+		sent, l.verified, l.corrupted, missing, l.reordered, l.unmarked, h.duration(p50), h.duration(p95), h.duration(max))
+	switch {
+	case !l.received:
+		return s.errorf("loopback verification failed, no marked frame received of %d sent (%d unmarked)", sent, l.unmarked)
+	case l.corrupted != 0:
+		return s.errorf("loopback verification failed, %d of %d frames corrupted", l.corrupted, l.verified+l.corrupted)
+	}
+	return nil
+}
+
+// loopbackInternal publishes the -publish source to the url of the session, plays it back
+// from the same url once recording, and verifies the frames received.
+func (s *session) loopbackInternal() error {
+	l := &loopback{}
+	s.loopback = l
+	s.recording = make(chan struct{})
+	p := s.run.newSession(s.url, s.id+"/play")
+	p.loopback = l
+
+	pubErr := make(chan error, 1)
+	go func() { pubErr <- s.publishInternal() }()
+	select {
+	case <-s.recording:
+	case err := <-pubErr:
+		return err
+	}
+
+	playErr := make(chan error, 1)
+	go func() { playErr <- p.playInternal() }()
+	select {
+	case err := <-pubErr:
+		if err != nil {
+			p.teardown()
+			<-playErr
+			return err
+		}
+		t := time.NewTimer(loopbackGrace)
+		select {
+		case <-t.C:
+			p.teardown()
+			<-playErr
+		case err := <-playErr:
+			t.Stop()
+			if err != nil && !p.isTornDown() {
+				s.logf("player stopped, %v", err)
+			}
+		}
+	case err := <-playErr:
+		s.teardown()
+		<-pubErr
+		if err != nil {
+			p.handshakeDone(err)
+			return err
+		}
+	}
+	p.handshakeDone(nil)
+	return l.result(s)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("audio-analysis")
+	registerCodec("audio-analysis", "G711", "LPCM")
+}
+
+const (
+	// duration of the loudness blocks of ITU-R BS.1770
+	loudnessBlock = 400 * time.Millisecond
+	// absolute and relative gates of the integrated loudness
+	loudnessAbsoluteGate = -70.0
+	loudnessRelativeGate = -10.0
+	// bins of the block loudness histogram, 0.1 LU from the absolute gate
+	loudnessBins = 800
+	// peak of the blocks of digital silence, -90 dBFS
+	silenceLevel = 3.1623e-5
+)
+
+// audioStats are the loudness and the silences of an audio track.
+type audioStats struct {
+	// integrated loudness in LUFS, approximate (non overlapping blocks, no channel weights)
+	Loudness float64 `json:"loudness"`
+	Measured bool    `json:"measured"`
+	// longest digital silence of a channel, and the silences longer than -max-silence
+	MaxSilence    duration `json:"maxSilence"`
+	SilenceAlarms uint64   `json:"silenceAlarms"`
+}
+
+// biquad is a second order IIR filter.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the two stages of the K-weighting filter of BS.1770 at a sample rate.
+func kWeighting(rate int) [2]biquad {
+	fs := float64(rate)
+	// high shelf
+	k := math.Tan(math.Pi * 1681.974450955533 / fs)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	// high pass
+	k = math.Tan(math.Pi * 38.13547087602444 / fs)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	highPass := biquad{b0: 1, b1: -2, b2: 1, a1: 2 * (k*k - 1) / a0, a2: (1 - k/q + k*k) / a0}
+	return [2]biquad{shelf, highPass}
+}
+
+// ulaw and alaw return a G711 sample in [-1, 1].
+func ulaw(b byte) float64 {
+	u := ^b
+	t := (int(u&0x0F)<<3 + 0x84) << ((u >> 4) & 0x07)
+	if u&0x80 != 0 {
+		return float64(0x84-t) / 32768
+	}
+	return float64(t-0x84) / 32768
+}
+
+func alaw(b byte) float64 {
+	a := b ^ 0x55
+	t := int(a&0x0F) << 4
+	if e := (a >> 4) & 0x07; e == 0 {
+		t += 8
+	} else {
+		t = (t + 0x108) << (e - 1)
+	}
+	if a&0x80 == 0 {
+		t = -t
+	}
+	return float64(t) / 32768
+}
+
+// audioTrack measures the loudness and the digital silences of an audio format of the PCM codecs,
+// G711 and LPCM. AAC needs an AAC-LC decoder which is split out of this analysis into its own request,
+// until then the AAC formats are logged as not analyzed.
+type audioTrack struct {
+	s        *session
+	name     string
+	codec    string
+	rate     int
+	channels int
+
+	// size bytes per sample
+	size   int
+	sample func(b []byte) float64
+
+	mu        sync.Mutex
+	filters   [][2]biquad
+	blockLen  int
+	frames    int
+	power     []float64
+	peak      []float64
+	silent    []int
+	alarmed   []bool
+	binCount  [loudnessBins]uint32
+	binPower  [loudnessBins]float64
+	stats     audioStats
+	maxSilent int
+}
+
+// newAudioTrack returns nil if the codec of the format is not analyzed.
+func newAudioTrack(s *session, name string, forma format.Format) (*audioTrack, error) {
+	at := &audioTrack{s: s, name: name, codec: forma.Codec(), rate: forma.ClockRate(), channels: 1}
+	switch f := forma.(type) {
+	case *format.G711:
+		at.size, at.sample = 1, func(b []byte) float64 { return alaw(b[0]) }
+		if f.MULaw {
+			at.sample = func(b []byte) float64 { return ulaw(b[0]) }
+		}
+	case *format.LPCM:
+		at.channels, at.size = f.ChannelCount, f.BitDepth/8
+		switch f.BitDepth {
+		case 8:
+			at.sample = func(b []byte) float64 { return float64(int(b[0])-128) / 128 }
+		case 16:
+			at.sample = func(b []byte) float64 { return float64(int16(uint16(b[0])<<8|uint16(b[1]))) / 32768 }
+		case 24:
+			at.sample = func(b []byte) float64 {
+				return float64(int32(uint32(b[0])<<24|uint32(b[1])<<16|uint32(b[2])<<8)>>8) / (1 << 23)
+			}
+		default:
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+	if at.rate <= 0 || at.channels <= 0 {
+		return nil, nil
+	}
+	at.blockLen = int(int64(at.rate) * int64(loudnessBlock) / int64(time.Second))
+	at.filters = make([][2]biquad, at.channels)
+	for i := range at.filters {
+		at.filters[i] = kWeighting(at.rate)
+	}
+	at.power = make([]float64, at.channels)
+	at.peak = make([]float64, at.channels)
+	at.silent = make([]int, at.channels)
+	at.alarmed = make([]bool, at.channels)
+	return at, nil
+}
+
+func (at *audioTrack) onPacketRTP(pkt *rtp.Packet) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	frame := at.size * at.channels
+	p := pkt.Payload
+	for ; len(p) >= frame; p = p[frame:] {
+		for ch := 0; ch < at.channels; ch++ {
+			v := at.sample(p[ch*at.size:])
+			f := &at.filters[ch]
+			w := f[1].process(f[0].process(v))
+			at.power[ch] += w * w
+			if math.Abs(v) > at.peak[ch] {
+				at.peak[ch] = math.Abs(v)
+			}
+		}
+		at.frames++
+		if at.frames == at.blockLen {
+			at.endBlock()
+		}
+	}
+}
+
+// endBlock adds the loudness of a block and checks the silences of its channels, it is called with at.mu locked.
+func (at *audioTrack) endBlock() {
+	max := at.s.cfg.maxSilence
+	var z float64
+	for ch := 0; ch < at.channels; ch++ {
+		z += at.power[ch] / float64(at.frames)
+		if at.peak[ch] >= silenceLevel {
+			if at.alarmed[ch] {
+				at.s.logf("audio %s channel %d: sound again after %v of silence", at.name, ch+1, at.duration(at.silent[ch]))
+			}
+			at.silent[ch], at.alarmed[ch] = 0, false
+		} else {
+			at.silent[ch] += at.frames
+			if at.silent[ch] > at.maxSilent {
+				at.maxSilent = at.silent[ch]
+				at.stats.MaxSilence = duration(at.duration(at.maxSilent))
+			}
+			if d := at.duration(at.silent[ch]); max > 0 && d > max && !at.alarmed[ch] {
+				at.alarmed[ch] = true
+				at.stats.SilenceAlarms++
+				at.s.logf("audio %s channel %d: silent for %v, over -max-silence %v", at.name, ch+1, d, max)
+			}
+		}
+		at.power[ch], at.peak[ch] = 0, 0
+	}
+	if z > 0 {
+		if l := -0.691 + 10*math.Log10(z); l > loudnessAbsoluteGate {
+			bin := int((l - loudnessAbsoluteGate) * 10)
+			if bin >= loudnessBins {
+				bin = loudnessBins - 1
+			}
+			at.binCount[bin]++
+			at.binPower[bin] += z
+		}
+	}
+	at.frames = 0
+}
+
+func (at *audioTrack) duration(samples int) time.Duration {
+	return time.Duration(int64(samples) * int64(time.Second) / int64(at.rate))
+}
+
+// loudness returns the integrated loudness of the blocks above the absolute and relative gates.
+func (at *audioTrack) loudness() (float64, bool) {
+	mean := func(from int) (float64, bool) {
+		var n uint32
+		var sum float64
+		for i := from; i < loudnessBins; i++ {
+			n, sum = n+at.binCount[i], sum+at.binPower[i]
+		}
+		if n == 0 {
+			return 0, false
+		}
+		return -0.691 + 10*math.Log10(sum/float64(n)), true
+	}
+	l, ok := mean(0)
+	if !ok {
+		return 0, false
+	}
+	from := int((l + loudnessRelativeGate - loudnessAbsoluteGate) * 10)
+	if from < 0 {
+		from = 0
+	}
+	return mean(from)
+}
+
+func (at *audioTrack) snapshot() audioStats {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	st := at.stats
+	st.Loudness, st.Measured = at.loudness()
+	return st
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+)
+
+// the kinds of the source assets of runManifest
+const (
+	assetTS   = "ts"
+	assetH264 = "h264"
+	assetH265 = "h265"
+)
+
+// assetKind returns the kind of a source asset by its extension, else by its first byte.
+func assetKind(name string) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ts", ".m2ts", ".mts", ".trp":
+		return assetTS, nil
+	case ".h264", ".264", ".avc":
+		return assetH264, nil
+	case ".h265", ".265", ".hevc":
+		return assetH265, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var b [1]byte
+	if _, err := io.ReadFull(f, b[:]); err != nil {
+		return "", err
+	}
+	if b[0] == 0x47 {
+		return assetTS, nil
+	}
+	return "", fmt.Errorf("unknown kind of asset %s, should be .ts, .h264 or .h265", name)
+}
+
+// annexBNALUs calls fn with each NALU of an H264/H265 Annex B byte stream.
+func annexBNALUs(r io.Reader, fn func(nalu []byte)) error {
+	br := bufio.NewReaderSize(r, 1<<20)
+	var nalu []byte
+	zeros := 0
+	started := false
+	emit := func() {
+		// the zero bytes before a start code are not part of the NALU
+		for len(nalu) != 0 && nalu[len(nalu)-1] == 0 {
+			nalu = nalu[:len(nalu)-1]
+		}
+		if started && len(nalu) != 0 {
+			fn(nalu)
+		}
+		nalu = nalu[:0]
+	}
+	for {
+		b, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			emit()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b == 1 && zeros >= 2 {
+			nalu = nalu[:len(nalu)-2]
+			emit()
+			started, zeros = true, 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		nalu = append(nalu, b)
+	}
+}
+
+// assetManifest hashes a source asset as -manifest-record would hash it received from a server.
+func assetManifest(name string, chunkSize int64) (*manifestEntry, error) {
+	kind, err := assetKind(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ic := &integrityChecker{whole: sha256.New()}
+	ic.got.ChunkSize = chunkSize
+	switch kind {
+	case assetTS:
+		buf := make([]byte, 1<<20)
+		for {
+			n, err := f.Read(buf)
+			ic.writeTS(buf[:n])
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		isH265 := kind == assetH265
+		err := annexBNALUs(f, func(nalu []byte) {
+			if !isSliceNALU(nalu, isH265) {
+				return
+			}
+			// a GOP starts at the first slice of a keyframe
+			var keyframe bool
+			if isH265 {
+				typ := h265.NALUType((nalu[0] >> 1) & 0x3F)
+				keyframe = len(nalu) > 2 && nalu[2]&0x80 != 0 &&
+					typ >= h265.NALUType_BLA_W_LP && typ <= h265.NALUType_CRA_NUT
+			} else {
+				keyframe = len(nalu) > 1 && nalu[1]&0x80 != 0 && h264.NALUType(nalu[0]&0x1F) == h264.NALUTypeIDR
+			}
+			ic.writeAU([][]byte{nalu}, keyframe, isH265)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	ic.end()
+	return &ic.got, nil
+}
+
+// runManifest writes the manifest of -manifest from the source assets, without a reference server.
+// The entries are keyed by the file names, those of the other assets of the file are kept.
+func runManifest(args []string) error {
+	fs := flag.NewFlagSet("manifest", flag.ContinueOnError)
+	out := fs.String("o", "manifest.json", "manifest file to write")
+	chunkSize := fs.Int64("chunk-size", manifestChunkSize, "chunk size of the hashes in bytes, 0 for no chunks")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rtspclient manifest [-o manifest.json] [-chunk-size bytes] asset.ts|asset.h264|asset.h265 ...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || *chunkSize < 0 {
+		fs.Usage()
+		return fmt.Errorf("no asset")
+	}
+
+	m := make(manifest)
+	if _, err := os.Stat(*out); err == nil {
+		if m, err = loadManifest(*out); err != nil {
+			return fmt.Errorf("failed to load %s, %v", *out, err)
+		}
+	}
+	if m == nil {
+		m = make(manifest)
+	}
+	h := humanizer{precision: 2}
+	for _, name := range fs.Args() {
+		e, err := assetManifest(name, *chunkSize)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s, %v", name, err)
+		}
+		key := filepath.Base(name)
+		m[key] = e
+		fmt.Printf("%s: %s, chunks %d, gops %d\n", key, h.bytes(uint64(e.Size)), len(e.Chunks), len(e.GOPs))
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(*out, append(b, '\n'))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+)
+
+func init() {
+	registerFeature("media-select")
+}
+
+// mediaAll is the -media of the sessions setting up all the medias of the SDP.
+const mediaAll = "all"
+
+// selectableMedias are the media types of -media.
+var selectableMedias = []description.MediaType{
+	description.MediaTypeVideo,
+	description.MediaTypeAudio,
+	description.MediaTypeApplication,
+}
+
+// mediaTypes returns the media types of -media, nil for all.
+func (cfg *config) mediaTypes() ([]description.MediaType, error) {
+	if cfg.media == mediaAll {
+		return nil, nil
+	}
+	var types []description.MediaType
+	for _, t := range strings.Split(cfg.media, ",") {
+		typ := description.MediaType(strings.ToLower(strings.TrimSpace(t)))
+		found := false
+		for _, st := range selectableMedias {
+			found = found || st == typ
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown media type %q", t)
+		}
+		types = append(types, typ)
+	}
+	return types, nil
+}
+
+// selectMedias keeps the medias of the types of -media in the description, and the back channels of -backchannel,
+// so that only these are set up. It returns the RTCP features of the medias kept.
+func (s *session) selectMedias(desc *description.Session, feats []rtcpFeatures) ([]rtcpFeatures, error) {
+	types, err := s.cfg.mediaTypes()
+	if err != nil || types == nil {
+		return feats, err
+	}
+	var medias []*description.Media
+	var kept []rtcpFeatures
+	var offered, selected []string
+	for i, medi := range desc.Medias {
+		name := mediaName(desc.Medias, i)
+		offered = append(offered, name)
+		keep := medi.IsBackChannel && s.cfg.backchannel
+		for _, typ := range types {
+			keep = keep || (medi.Type == typ && !medi.IsBackChannel)
+		}
+		if keep {
+			medias = append(medias, medi)
+			kept = append(kept, feats[i])
+			selected = append(selected, name)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no %s media, the medias are %s", s.cfg.media, strings.Join(offered, ", "))
+	}
+	s.logf("medias %s selected of %s", strings.Join(selected, ", "), strings.Join(offered, ", "))
+	desc.Medias = medias
+	return kept, nil
+}
@@ -0,0 +1,346 @@
+//go:build !nosrtp
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+func init() {
+	registerFeature("mikey")
+}
+
+// the MIKEY payloads (RFC 3830 6)
+const (
+	mikeyLast    = 0
+	mikeyKEMAC   = 1
+	mikeySign    = 4
+	mikeyT       = 5
+	mikeyID      = 6
+	mikeyCert    = 7
+	mikeyCHash   = 8
+	mikeyV       = 9
+	mikeySP      = 10
+	mikeyRAND    = 11
+	mikeyKeyData = 20
+	mikeyGenExt  = 21
+)
+
+// the constants of the key derivations (RFC 3830 4.1.3, 4.1.4)
+const (
+	mikeyEncrKeyConst = 0x150533E1
+	mikeyAuthKeyConst = 0x2D22AC75
+	mikeySaltKeyConst = 0x29B88916
+	mikeyTEKConst     = 0x2AD01C64
+	mikeyTEKSaltConst = 0x39A2C14B
+)
+
+// the SRTP policy parameters of an SP payload (RFC 3830 6.10.1) the decrypter depends on
+const (
+	mikeySPEncrAlg  = 0
+	mikeySPAuthAlg  = 2
+	mikeySPKDR      = 6
+	mikeySPTagLen   = 11
+	mikeyAESCM      = 1
+	mikeyHMACSHA1   = 1
+	mikeySHA1MACLen = 20
+)
+
+// mikeyKeys are the SRTP keys of a MIKEY message, and the rollover counters of its SSRCs.
+type mikeyKeys struct {
+	keys []*srtpKey
+	rocs map[uint32]uint32
+}
+
+// mikeyReader reads the fields of a MIKEY message.
+type mikeyReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *mikeyReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.b) {
+		r.err = fmt.Errorf("truncated message")
+		return nil
+	}
+	v := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return v
+}
+
+func (r *mikeyReader) u8() int {
+	if v := r.bytes(1); v != nil {
+		return int(v[0])
+	}
+	return 0
+}
+
+func (r *mikeyReader) u16() int {
+	if v := r.bytes(2); v != nil {
+		return int(binary.BigEndian.Uint16(v))
+	}
+	return 0
+}
+
+func (r *mikeyReader) u32() uint32 {
+	if v := r.bytes(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+// mikeyPRF is the PRF of MIKEY (RFC 3830 4.1.2): the P-SHA1 of the 256 bits pieces of inkey, xored.
+func mikeyPRF(inkey, label []byte, n int) []byte {
+	out := make([]byte, n)
+	for len(inkey) > 0 {
+		s := inkey
+		if len(s) > 32 {
+			s = s[:32]
+		}
+		inkey = inkey[len(s):]
+		mac := hmac.New(sha1.New, s)
+		a := label
+		for off := 0; off < n; off += sha1.Size {
+			mac.Reset()
+			mac.Write(a)
+			a = mac.Sum(nil)
+			mac.Reset()
+			mac.Write(a)
+			mac.Write(label)
+			for i, v := range mac.Sum(nil) {
+				if off+i < n {
+					out[off+i] ^= v
+				}
+			}
+		}
+	}
+	return out
+}
+
+// mikeyLabel returns the label of a key derivation, constant || cs id || csb id || RAND.
+func mikeyLabel(constant uint32, csID byte, csbID uint32, rand []byte) []byte {
+	l := make([]byte, 9, 9+len(rand))
+	binary.BigEndian.PutUint32(l, constant)
+	l[4] = csID
+	binary.BigEndian.PutUint32(l[5:], csbID)
+	return append(l, rand...)
+}
+
+// parseMIKEY returns the SRTP keys of the base64 MIKEY message of an a=key-mgmt:mikey attribute (RFC 4567),
+// the pre-shared key mode only (RFC 3830 3.1). The KEMAC is authenticated and decrypted with the keys
+// derived from psk, the TEKs of the crypto sessions are derived from its TGK or taken as is.
+func parseMIKEY(data string, psk []byte) (*mikeyKeys, error) {
+	msg, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64, %v", err)
+	}
+	r := &mikeyReader{b: msg}
+
+	// common header
+	if v := r.u8(); v != 1 && r.err == nil {
+		return nil, fmt.Errorf("unsupported version %d", v)
+	}
+	if t := r.u8(); t != 0 && r.err == nil {
+		return nil, fmt.Errorf("unsupported data type %d, only the pre-shared key mode", t)
+	}
+	next := r.u8()
+	if prf := r.u8() & 0x7f; prf != 0 && r.err == nil {
+		return nil, fmt.Errorf("unsupported prf %d", prf)
+	}
+	csbID := r.u32()
+	ncs := r.u8()
+	if m := r.u8(); m != 0 && r.err == nil {
+		return nil, fmt.Errorf("unsupported crypto session map type %d", m)
+	}
+	mk := &mikeyKeys{rocs: make(map[uint32]uint32)}
+	policies := make([]int, ncs)
+	for i := 0; i < ncs; i++ {
+		policies[i] = r.u8()
+		ssrc, roc := r.u32(), r.u32()
+		if ssrc != 0 {
+			mk.rocs[ssrc] = roc
+		}
+	}
+
+	var ts [8]byte
+	var rand, keyData []byte
+	kemac := false
+	tagLens := make(map[int]int)
+	for next != mikeyLast && r.err == nil {
+		typ := next
+		next = r.u8()
+		switch typ {
+		case mikeyT:
+			switch t := r.u8(); t {
+			case 0, 1:
+				copy(ts[:], r.bytes(8))
+			case 2:
+				copy(ts[4:], r.bytes(4))
+			default:
+				return nil, fmt.Errorf("unsupported timestamp type %d", t)
+			}
+		case mikeyRAND:
+			rand = r.bytes(r.u8())
+		case mikeyID:
+			r.u8()
+			r.bytes(r.u16())
+		case mikeyGenExt:
+			r.u8()
+			r.bytes(r.u16())
+		case mikeySP:
+			no := r.u8()
+			if prot := r.u8(); prot != 0 && r.err == nil {
+				return nil, fmt.Errorf("unsupported security protocol %d", prot)
+			}
+			sp := &mikeyReader{b: r.bytes(r.u16())}
+			for sp.err == nil && sp.pos < len(sp.b) {
+				typ, v := sp.u8(), sp.bytes(sp.u8())
+				if len(v) == 0 {
+					continue
+				}
+				switch {
+				case typ == mikeySPEncrAlg && v[0] != mikeyAESCM:
+					return nil, fmt.Errorf("unsupported srtp encryption %d, only AES-CM", v[0])
+				case typ == mikeySPAuthAlg && v[0] != mikeyHMACSHA1:
+					return nil, fmt.Errorf("unsupported srtp authentication %d, only HMAC-SHA1", v[0])
+				case typ == mikeySPKDR:
+					for _, b := range v {
+						if b != 0 {
+							return nil, fmt.Errorf("unsupported key derivation rate")
+						}
+					}
+				case typ == mikeySPTagLen:
+					tagLens[no] = int(v[len(v)-1])
+				}
+			}
+			if sp.err != nil {
+				return nil, fmt.Errorf("security policy, %v", sp.err)
+			}
+		case mikeyKEMAC:
+			if next != mikeyLast {
+				return nil, fmt.Errorf("KEMAC is not the last payload")
+			}
+			kemac = true
+			encr := r.u8()
+			keyData = r.bytes(r.u16())
+			macAlg := r.u8()
+			var mac []byte
+			switch macAlg {
+			case 0:
+			case mikeyHMACSHA1:
+				mac = r.bytes(mikeySHA1MACLen)
+			default:
+				return nil, fmt.Errorf("unsupported mac %d", macAlg)
+			}
+			if r.err != nil {
+				break
+			}
+			if rand == nil {
+				return nil, fmt.Errorf("no RAND payload")
+			}
+			if mac != nil {
+				auth := hmac.New(sha1.New, mikeyPRF(psk, mikeyLabel(mikeyAuthKeyConst, 0xff, csbID, rand), 20))
+				auth.Write(msg[:r.pos-len(mac)])
+				if !hmac.Equal(auth.Sum(nil), mac) {
+					return nil, fmt.Errorf("authentication failed, wrong -mikey-psk")
+				}
+			}
+			switch encr {
+			case 0:
+			case mikeyAESCM:
+				block, err := aes.NewCipher(mikeyPRF(psk, mikeyLabel(mikeyEncrKeyConst, 0xff, csbID, rand), 16))
+				if err != nil {
+					return nil, err
+				}
+				// IV = S xor (0x0000 || CSB ID || T), with the 16 bits block counter
+				var iv [16]byte
+				copy(iv[:], mikeyPRF(psk, mikeyLabel(mikeySaltKeyConst, 0xff, csbID, rand), srtpSaltLen))
+				var v [14]byte
+				binary.BigEndian.PutUint32(v[2:], csbID)
+				copy(v[6:], ts[:])
+				for i := range v {
+					iv[i] ^= v[i]
+				}
+				plain := make([]byte, len(keyData))
+				cipher.NewCTR(block, iv[:]).XORKeyStream(plain, keyData)
+				keyData = plain
+			default:
+				return nil, fmt.Errorf("unsupported key encryption %d, only AES-CM", encr)
+			}
+		case mikeySign, mikeyCert, mikeyCHash, mikeyV, mikeyKeyData:
+			return nil, fmt.Errorf("unexpected payload %d in the pre-shared key mode", typ)
+		default:
+			return nil, fmt.Errorf("unsupported payload %d", typ)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if !kemac {
+		return nil, fmt.Errorf("no KEMAC payload")
+	}
+
+	// the key data sub-payloads of the KEMAC, the first TGK or TEK is the key of the crypto sessions
+	kd := &mikeyReader{b: keyData}
+	kd.u8()
+	typ := kd.u8()
+	key := kd.bytes(kd.u16())
+	var salt []byte
+	if typ>>4 == 1 || typ>>4 == 3 {
+		salt = kd.bytes(kd.u16())
+	}
+	if kd.err != nil {
+		return nil, fmt.Errorf("key data, %v", kd.err)
+	}
+	if kv := typ & 0x0f; kv == 1 {
+		return nil, fmt.Errorf("unsupported SPI/MKI key validity")
+	}
+	tagLen := func(cs int) int {
+		if l, ok := tagLens[policies[cs]]; ok {
+			return l
+		}
+		return srtpSuites["AES_CM_128_HMAC_SHA1_80"]
+	}
+	switch typ >> 4 {
+	case 0, 1:
+		for cs := 0; cs < ncs; cs++ {
+			tek := mikeyPRF(key, mikeyLabel(mikeyTEKConst, byte(cs+1), csbID, rand), srtpKeyLen)
+			s := salt
+			if s == nil {
+				s = mikeyPRF(key, mikeyLabel(mikeyTEKSaltConst, byte(cs+1), csbID, rand), srtpSaltLen)
+			}
+			k, err := newSRTPKey(tagLen(cs), tek, s)
+			if err != nil {
+				return nil, err
+			}
+			mk.keys = append(mk.keys, k)
+		}
+	case 2, 3:
+		if salt == nil {
+			return nil, fmt.Errorf("TEK without salt")
+		}
+		for cs := 0; cs < ncs; cs++ {
+			k, err := newSRTPKey(tagLen(cs), key, salt)
+			if err != nil {
+				return nil, err
+			}
+			mk.keys = append(mk.keys, k)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key data type %d", typ>>4)
+	}
+	if len(mk.keys) == 0 {
+		return nil, fmt.Errorf("no crypto session")
+	}
+	return mk, nil
+}
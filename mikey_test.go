@@ -0,0 +1,47 @@
+//go:build !nosrtp
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// mikeyTestMessage is a MIKEY message of the pre-shared key mode (RFC 3830 3.1) with the psk 101112...1F:
+// CSB ID 12345678, a crypto session of SSRC CAFEBABE and ROC 3, an SRTP policy of AES-CM, HMAC-SHA1 and
+// a 32 bits tag, and a KEMAC of the TGK 00112233...EEFF encrypted with AES-CM and authenticated with HMAC-SHA1.
+const mikeyTestMessage = "AQAFABI0VngBAADK/rq+AAAAAwsA6cH1oAAAAAAKEAECAwQFBgcICQoLDA0ODxABAAAACQABAQIBAQsBBAABABQAlbU0yVY7" +
+	"QUkM3J67b3YXPTtvCQEWImcFUMfcekkSabc+drGdEhRKcw=="
+
+func TestParseMIKEY(t *testing.T) {
+	psk := unhex("101112131415161718191A1B1C1D1E1F")
+	mk, err := parseMIKEY(mikeyTestMessage, psk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mk.keys) != 1 || mk.rocs[0xCAFEBABE] != 3 {
+		t.Fatalf("%d keys, rocs %v, should be 1 key and the ROC 3 of CAFEBABE", len(mk.keys), mk.rocs)
+	}
+
+	// the TEK and salt derived from the TGK with the PRF of RFC 3830 4.1.2
+	want, err := newSRTPKey(4, unhex("BC44C0B98861598AEACEECC253B27D57"), unhex("EC76515B24BCAB99345EC24E754F"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := mk.keys[0]
+	if k.tagLen != 4 || !bytes.Equal(k.rtpSalt, want.rtpSalt) || !bytes.Equal(k.rtcpSalt, want.rtcpSalt) {
+		t.Fatalf("tag of %d bytes, salt %X, should be 4 and %X", k.tagLen, k.rtpSalt, want.rtpSalt)
+	}
+	var got, exp [16]byte
+	k.rtpBlock.Encrypt(got[:], got[:])
+	want.rtpBlock.Encrypt(exp[:], exp[:])
+	if got != exp {
+		t.Errorf("TEK differs from BC44C0B98861598AEACEECC253B27D57")
+	}
+
+	psk[0] ^= 1
+	if _, err := parseMIKEY(mikeyTestMessage, psk); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("wrong psk: %v, should fail the authentication", err)
+	}
+}
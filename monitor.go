@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	registerFeature("monitor")
+}
+
+// the kinds of the alerts of -mode monitor
+const (
+	alertFailure          = "failure"
+	alertRecovered        = "recovered"
+	alertDelay            = "delay"
+	alertBitrateDrop      = "bitrate drop"
+	alertBitrateRecovered = "bitrate recovered"
+)
+
+// monitorBitrateGrace is the time a session plays before its bitrate is checked, longer than the bitrate window.
+const monitorBitrateGrace = 2 * time.Second
+
+// alert is the body of the webhook requests, the text field is that of Slack, the message field that of Opsgenie.
+type alert struct {
+	Text    string    `json:"text"`
+	Message string    `json:"message"`
+	Alert   string    `json:"alert"`
+	Session string    `json:"session"`
+	URL     string    `json:"url"`
+	Detail  string    `json:"detail,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// monitorSlot is a session kept alive by the monitor, started again after it ends.
+type monitorSlot struct {
+	id  string
+	url string
+
+	mu sync.Mutex
+	s  *session
+	// the session failed and did not play again yet
+	down bool
+	// the bitrate is below -min-bitrate
+	low    bool
+	delays int64
+}
+
+// monitor keeps the sessions of the flags alive indefinitely, a lightweight canary of the servers.
+// The failures of the sessions, their delayed packets and their bitrate below -min-bitrate are alerted
+// in the logs and to -webhook, once until they recover.
+func (r *run) monitor() error {
+	var slots []*monitorSlot
+	for _, u := range r.cfg.urls() {
+		if u != r.cfg.url {
+			slots = append(slots, &monitorSlot{id: u, url: u})
+			continue
+		}
+		for i := 0; i < r.cfg.count; i++ {
+			slots = append(slots, &monitorSlot{id: u + ":" + strconv.Itoa(i), url: u})
+		}
+	}
+	r.logger.Printf("monitor: %d sessions, checked every %s, started again %s after they end",
+		len(slots), r.cfg.monitorInterval, r.cfg.monitorRetry)
+
+	for _, slot := range slots {
+		slot := slot
+		go r.keepAlive(slot)
+		r.stagger.wait()
+	}
+	t := time.NewTicker(r.cfg.monitorInterval)
+	defer t.Stop()
+	for range t.C {
+		for _, slot := range slots {
+			r.checkSlot(slot)
+		}
+	}
+	return nil
+}
+
+// keepAlive plays the session of a slot, again after -monitor-retry when it ends.
+func (r *run) keepAlive(slot *monitorSlot) {
+	for {
+		s := r.newSession(slot.url, slot.id)
+		slot.mu.Lock()
+		slot.s, slot.low, slot.delays = s, false, 0
+		slot.mu.Unlock()
+
+		err := r.play(s)
+		detail := "the stream ended"
+		if err != nil {
+			detail = err.Error()
+		}
+		slot.mu.Lock()
+		down := slot.down
+		slot.down = true
+		slot.mu.Unlock()
+		if !down {
+			r.alert(alertFailure, slot, detail)
+		}
+		time.Sleep(r.cfg.monitorRetry)
+	}
+}
+
+// checkSlot alerts the recovery of a slot, and the delays and the bitrate of its session playing.
+func (r *run) checkSlot(slot *monitorSlot) {
+	slot.mu.Lock()
+	s := slot.s
+	slot.mu.Unlock()
+	if s == nil {
+		return
+	}
+	ss := s.snapshot()
+	if ss.State != statePlaying && ss.State != stateRecording {
+		return
+	}
+	var alerts [][2]string
+	delays := atomic.LoadInt64(&s.delays)
+	minBitrate := r.getThresholds().MinBitrate
+
+	slot.mu.Lock()
+	if slot.s != s {
+		slot.mu.Unlock()
+		return
+	}
+	if slot.down {
+		slot.down = false
+		alerts = append(alerts, [2]string{alertRecovered, ""})
+	}
+	if n := delays - slot.delays; n > 0 {
+		slot.delays = delays
+		alerts = append(alerts, [2]string{alertDelay, fmt.Sprintf("%d delayed RTP packets over %s", n, r.getThresholds().DelayTimeout)})
+	}
+	h := r.cfg.human()
+	// the bitrate of a session that just started is not measured yet
+	low := minBitrate > 0 && ss.Bitrate.Current < minBitrate && time.Since(ss.StateSince) > monitorBitrateGrace
+	switch {
+	case low && !slot.low:
+		alerts = append(alerts, [2]string{alertBitrateDrop, fmt.Sprintf("bitrate %s below %s", h.bitrate(ss.Bitrate.Current), h.bitrate(minBitrate))})
+	case !low && slot.low:
+		alerts = append(alerts, [2]string{alertBitrateRecovered, "bitrate " + h.bitrate(ss.Bitrate.Current)})
+	}
+	slot.low = low
+	slot.mu.Unlock()
+
+	for _, a := range alerts {
+		r.alert(a[0], slot, a[1])
+	}
+}
+
+// alert logs an alert and posts it to -webhook.
+func (r *run) alert(kind string, slot *monitorSlot, detail string) {
+	text := fmt.Sprintf("[rtspclient] %s %s", kind, slot.id)
+	if detail != "" {
+		text += ": " + detail
+	}
+	if detail != "" {
+		r.logger.Printf(r.cfg.tr("alert %s %s: %s"), kind, slot.id, detail)
+	} else {
+		r.logger.Printf(r.cfg.tr("alert %s %s"), kind, slot.id)
+	}
+	if r.cfg.webhook == "" {
+		return
+	}
+	a := alert{
+		Text:    text,
+		Message: text,
+		Alert:   kind,
+		Session: slot.id,
+		URL:     slot.url,
+		Detail:  detail,
+		Time:    time.Now().In(tz),
+	}
+	go func() {
+		if err := postAlert(r.cfg.webhook, a); err != nil {
+			r.logger.Printf("failed to post alert to %s, %v", r.cfg.webhook, err)
+		}
+	}()
+}
+
+func postAlert(url string, a alert) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	c := http.Client{Timeout: 10 * time.Second}
+	res, err := c.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("bad status %s", res.Status)
+	}
+	return nil
+}
+
+// isWebhookURL tells if v is an http or https url.
+func isWebhookURL(v string) bool {
+	return strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://")
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+)
+
+// mp4Box is a box of an MP4 file, data is its content without the header.
+type mp4Box struct {
+	typ  string
+	data []byte
+}
+
+// mp4Boxes returns the boxes of buf.
+func mp4Boxes(buf []byte) ([]mp4Box, error) {
+	var ret []mp4Box
+	for len(buf) != 0 {
+		if len(buf) < 8 {
+			return nil, fmt.Errorf("truncated box")
+		}
+		size := uint64(binary.BigEndian.Uint32(buf))
+		typ := string(buf[4:8])
+		hdr := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(buf))
+		case 1:
+			if len(buf) < 16 {
+				return nil, fmt.Errorf("truncated box %s", typ)
+			}
+			size, hdr = binary.BigEndian.Uint64(buf[8:]), 16
+		}
+		if size < hdr || size > uint64(len(buf)) {
+			return nil, fmt.Errorf("invalid size of box %s", typ)
+		}
+		ret = append(ret, mp4Box{typ: typ, data: buf[hdr:size]})
+		buf = buf[size:]
+	}
+	return ret, nil
+}
+
+// mp4Child returns the first child box of a box path, (ex) "mdia", "minf", "stbl".
+func mp4Child(data []byte, path ...string) ([]byte, bool) {
+	for _, typ := range path {
+		boxes, err := mp4Boxes(data)
+		if err != nil {
+			return nil, false
+		}
+		found := false
+		for _, b := range boxes {
+			if b.typ == typ {
+				data, found = b.data, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// mp4Table returns the entries of size bytes of a full box table.
+func mp4Table(data []byte, size int) ([][]byte, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("truncated table")
+	}
+	n := int(binary.BigEndian.Uint32(data[4:]))
+	data = data[8:]
+	if n < 0 || n > len(data)/size {
+		return nil, fmt.Errorf("truncated table")
+	}
+	ret := make([][]byte, n)
+	for i := range ret {
+		ret[i] = data[i*size : (i+1)*size]
+	}
+	return ret, nil
+}
+
+// ticksToDuration converts ticks of a clock rate into a duration without overflow.
+func ticksToDuration(v, rate int64) time.Duration {
+	return time.Duration(v/rate)*time.Second + time.Duration(v%rate)*time.Second/time.Duration(rate)
+}
+
+// mp4Track is a supported track of an MP4 file.
+type mp4Track struct {
+	publishTrack
+	timescale int64
+	// length of the NALU sizes of H264 samples, 0 for audio
+	lengthSize int
+	sps, pps   []byte
+}
+
+// mp4SampleEntry parses the H264 (avc1) or AAC (mp4a) sample entry of a stsd box.
+func mp4SampleEntry(stsd []byte) (*mp4Track, error) {
+	if len(stsd) < 8 {
+		return nil, fmt.Errorf("truncated stsd")
+	}
+	entries, err := mp4Boxes(stsd[8:])
+	if err != nil || len(entries) == 0 {
+		return nil, fmt.Errorf("invalid stsd")
+	}
+	e := entries[0]
+	switch e.typ {
+	case "avc1", "avc3":
+		// the children follow the visual sample entry
+		if len(e.data) < 78 {
+			return nil, fmt.Errorf("truncated %s", e.typ)
+		}
+		avcC, ok := mp4Child(e.data[78:], "avcC")
+		if !ok || len(avcC) < 7 {
+			return nil, fmt.Errorf("avcC not found")
+		}
+		t := &mp4Track{lengthSize: int(avcC[4]&3) + 1}
+		pos := 5
+		params := func() ([]byte, error) {
+			if pos+2 > len(avcC) {
+				return nil, fmt.Errorf("truncated avcC")
+			}
+			n := int(binary.BigEndian.Uint16(avcC[pos:]))
+			if pos+2+n > len(avcC) {
+				return nil, fmt.Errorf("truncated avcC")
+			}
+			pos += 2 + n
+			return avcC[pos-n : pos], nil
+		}
+		nsps := int(avcC[pos] & 0x1f)
+		pos++
+		for i := 0; i < nsps; i++ {
+			p, err := params()
+			if err != nil {
+				return nil, err
+			}
+			if t.sps == nil {
+				t.sps = p
+			}
+		}
+		if pos < len(avcC) {
+			npps := int(avcC[pos])
+			pos++
+			for i := 0; i < npps; i++ {
+				p, err := params()
+				if err != nil {
+					return nil, err
+				}
+				if t.pps == nil {
+					t.pps = p
+				}
+			}
+		}
+		if t.sps == nil || t.pps == nil {
+			return nil, fmt.Errorf("no SPS/PPS in avcC")
+		}
+		sps, pps := t.sps, t.pps
+		t.newFormat = func() format.Format {
+			return &format.H264{PayloadTyp: 96, SPS: sps, PPS: pps, PacketizationMode: 1}
+		}
+		return t, nil
+
+	case "mp4a":
+		// the children follow the audio sample entry, longer in QuickTime versions 1 and 2
+		skip := 28
+		if len(e.data) >= 10 {
+			switch binary.BigEndian.Uint16(e.data[8:]) {
+			case 1:
+				skip += 16
+			case 2:
+				skip += 36
+			}
+		}
+		if len(e.data) < skip {
+			return nil, fmt.Errorf("truncated mp4a")
+		}
+		esds, ok := mp4Child(e.data[skip:], "esds")
+		if !ok || len(esds) < 4 {
+			return nil, fmt.Errorf("esds not found")
+		}
+		asc, err := mp4DecoderSpecificInfo(esds[4:])
+		if err != nil {
+			return nil, err
+		}
+		var conf mpeg4audio.Config
+		if err := conf.Unmarshal(asc); err != nil {
+			return nil, fmt.Errorf("invalid AudioSpecificConfig, %v", err)
+		}
+		t := &mp4Track{}
+		t.newFormat = func() format.Format {
+			c := conf
+			return &format.MPEG4Audio{PayloadTyp: 97, Config: &c, SizeLength: 13, IndexLength: 3, IndexDeltaLength: 3}
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("unsupported codec %s", e.typ)
+}
+
+// mp4DecoderSpecificInfo returns the DecoderSpecificInfo of the ES_Descriptor of an esds box.
+func mp4DecoderSpecificInfo(b []byte) ([]byte, error) {
+	// descriptor returns the content of the descriptor tag at the start of b
+	descriptor := func(b []byte, tag byte) ([]byte, error) {
+		if len(b) < 2 || b[0] != tag {
+			return nil, fmt.Errorf("descriptor %d not found", tag)
+		}
+		size, pos := 0, 1
+		for ; pos < len(b) && pos < 5; pos++ {
+			size = size<<7 | int(b[pos]&0x7f)
+			if b[pos]&0x80 == 0 {
+				break
+			}
+		}
+		pos++
+		if pos+size > len(b) {
+			return nil, fmt.Errorf("truncated descriptor %d", tag)
+		}
+		return b[pos : pos+size], nil
+	}
+
+	es, err := descriptor(b, 0x03)
+	if err != nil || len(es) < 3 {
+		return nil, fmt.Errorf("invalid ES_Descriptor")
+	}
+	flags, pos := es[2], 3
+	if flags&0x80 != 0 {
+		pos += 2
+	}
+	if flags&0x40 != 0 && pos < len(es) {
+		pos += 1 + int(es[pos])
+	}
+	if flags&0x20 != 0 {
+		pos += 2
+	}
+	if pos > len(es) {
+		return nil, fmt.Errorf("invalid ES_Descriptor")
+	}
+	dc, err := descriptor(es[pos:], 0x04)
+	if err != nil || len(dc) < 13 {
+		return nil, fmt.Errorf("invalid DecoderConfigDescriptor")
+	}
+	return descriptor(dc[13:], 0x05)
+}
+
+// mp4Sample is a sample of a track, the times are in the timescale of the track.
+type mp4Sample struct {
+	offset, size int64
+	dts, cts     int64
+	sync         bool
+}
+
+// mp4Samples returns the samples of a stbl box.
+func mp4Samples(stbl []byte) ([]mp4Sample, error) {
+	box := func(typ string) []byte {
+		b, _ := mp4Child(stbl, typ)
+		return b
+	}
+
+	stsz := box("stsz")
+	if len(stsz) < 12 {
+		return nil, fmt.Errorf("stsz not found")
+	}
+	fixed := int64(binary.BigEndian.Uint32(stsz[4:]))
+	n := int(binary.BigEndian.Uint32(stsz[8:]))
+	if fixed == 0 && n > (len(stsz)-12)/4 {
+		return nil, fmt.Errorf("truncated stsz")
+	}
+	samples := make([]mp4Sample, n)
+	for i := range samples {
+		samples[i].size = fixed
+		if fixed == 0 {
+			samples[i].size = int64(binary.BigEndian.Uint32(stsz[12+i*4:]))
+		}
+	}
+
+	// chunk offsets
+	var chunks []int64
+	if stco := box("stco"); stco != nil {
+		t, err := mp4Table(stco, 4)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range t {
+			chunks = append(chunks, int64(binary.BigEndian.Uint32(e)))
+		}
+	} else if co64 := box("co64"); co64 != nil {
+		t, err := mp4Table(co64, 8)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range t {
+			chunks = append(chunks, int64(binary.BigEndian.Uint64(e)))
+		}
+	} else {
+		return nil, fmt.Errorf("stco not found")
+	}
+
+	// samples of the chunks
+	stsc, err := mp4Table(box("stsc"), 12)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stsc, %v", err)
+	}
+	i := 0
+	for k, e := range stsc {
+		first := int(binary.BigEndian.Uint32(e)) - 1
+		perChunk := int(binary.BigEndian.Uint32(e[4:]))
+		last := len(chunks)
+		if k+1 < len(stsc) {
+			last = int(binary.BigEndian.Uint32(stsc[k+1])) - 1
+		}
+		for c := first; c >= 0 && c < last && c < len(chunks); c++ {
+			off := chunks[c]
+			for j := 0; j < perChunk && i < n; j++ {
+				samples[i].offset = off
+				off += samples[i].size
+				i++
+			}
+		}
+	}
+	if i != n {
+		return nil, fmt.Errorf("%d samples are not in chunks", n-i)
+	}
+
+	// decoding times
+	stts, err := mp4Table(box("stts"), 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stts, %v", err)
+	}
+	i = 0
+	var dts int64
+	for _, e := range stts {
+		count := int(binary.BigEndian.Uint32(e))
+		delta := int64(binary.BigEndian.Uint32(e[4:]))
+		for j := 0; j < count && i < n; j++ {
+			samples[i].dts, samples[i].cts = dts, dts
+			dts += delta
+			i++
+		}
+	}
+
+	// composition offsets, signed in version 1 and in practice
+	if ctts := box("ctts"); ctts != nil {
+		t, err := mp4Table(ctts, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ctts, %v", err)
+		}
+		i = 0
+		for _, e := range t {
+			count := int(binary.BigEndian.Uint32(e))
+			off := int64(int32(binary.BigEndian.Uint32(e[4:])))
+			for j := 0; j < count && i < n; j++ {
+				samples[i].cts += off
+				i++
+			}
+		}
+	}
+
+	// sync samples, all of them without stss
+	if stss := box("stss"); stss != nil {
+		t, err := mp4Table(stss, 4)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stss, %v", err)
+		}
+		for _, e := range t {
+			if k := int(binary.BigEndian.Uint32(e)) - 1; k >= 0 && k < n {
+				samples[k].sync = true
+			}
+		}
+	} else {
+		for i := range samples {
+			samples[i].sync = true
+		}
+	}
+	return samples, nil
+}
+
+// splitNALUs splits an H264 sample of NALUs prefixed by their length.
+func splitNALUs(b []byte, lengthSize int) ([][]byte, error) {
+	var ret [][]byte
+	for len(b) != 0 {
+		if len(b) < lengthSize {
+			return nil, fmt.Errorf("truncated NALU length")
+		}
+		n := 0
+		for _, c := range b[:lengthSize] {
+			n = n<<8 | int(c)
+		}
+		b = b[lengthSize:]
+		if n > len(b) {
+			return nil, fmt.Errorf("truncated NALU")
+		}
+		ret = append(ret, b[:n])
+		b = b[n:]
+	}
+	return ret, nil
+}
+
+// loadMP4 loads the H264 and AAC tracks of a (non-fragmented) MP4 file for -publish.
+// The keyframes are prefixed with the SPS and PPS.
+func loadMP4(name string, buf []byte) (*publishMedia, error) {
+	boxes, err := mp4Boxes(buf)
+	if err != nil {
+		return nil, err
+	}
+	var moov []byte
+	for _, b := range boxes {
+		switch b.typ {
+		case "moov":
+			moov = b.data
+		case "moof":
+			return nil, fmt.Errorf("fragmented mp4 is not supported")
+		}
+	}
+	if moov == nil {
+		return nil, fmt.Errorf("moov not found")
+	}
+	traks, err := mp4Boxes(moov)
+	if err != nil {
+		return nil, err
+	}
+
+	pm := &publishMedia{name: name}
+	for _, trak := range traks {
+		if trak.typ != "trak" {
+			continue
+		}
+		mdhd, ok1 := mp4Child(trak.data, "mdia", "mdhd")
+		stbl, ok2 := mp4Child(trak.data, "mdia", "minf", "stbl")
+		stsd, ok3 := mp4Child(stbl, "stsd")
+		if !ok1 || !ok2 || !ok3 || len(mdhd) < 24 {
+			continue
+		}
+		t, err := mp4SampleEntry(stsd)
+		if err != nil {
+			pm.skipped = append(pm.skipped, err.Error())
+			continue
+		}
+		if mdhd[0] == 1 {
+			if len(mdhd) < 32 {
+				continue
+			}
+			t.timescale = int64(binary.BigEndian.Uint32(mdhd[20:]))
+		} else {
+			t.timescale = int64(binary.BigEndian.Uint32(mdhd[12:]))
+		}
+		if t.timescale == 0 {
+			return nil, fmt.Errorf("invalid timescale")
+		}
+		samples, err := mp4Samples(stbl)
+		if err != nil {
+			return nil, err
+		}
+
+		ti := len(pm.tracks)
+		pm.tracks = append(pm.tracks, t.publishTrack)
+		var end int64
+		for _, s := range samples {
+			if s.offset < 0 || s.offset+s.size > int64(len(buf)) {
+				return nil, fmt.Errorf("sample out of the file")
+			}
+			data := buf[s.offset : s.offset+s.size]
+			f := publishFrame{
+				track: ti,
+				dts:   ticksToDuration(s.dts, t.timescale),
+				pts:   ticksToDuration(s.cts, t.timescale),
+				au:    [][]byte{data},
+			}
+			if t.lengthSize != 0 {
+				nalus, err := splitNALUs(data, t.lengthSize)
+				if err != nil {
+					return nil, err
+				}
+				if s.sync {
+					nalus = append([][]byte{t.sps, t.pps}, nalus...)
+				}
+				f.au = nalus
+			}
+			pm.frames = append(pm.frames, f)
+			if s.dts > end {
+				end = s.dts
+			}
+		}
+		// the loop lasts until the end of the last sample
+		if n := len(samples); n > 1 {
+			end += (samples[n-1].dts - samples[0].dts) / int64(n-1)
+		}
+		if d := ticksToDuration(end, t.timescale); d > pm.duration {
+			pm.duration = d
+		}
+	}
+	if len(pm.tracks) == 0 {
+		return nil, fmt.Errorf("no H264 or AAC track")
+	}
+	sort.SliceStable(pm.frames, func(i, j int) bool { return pm.frames[i].dts < pm.frames[j].dts })
+	return pm, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("mpegts")
+	registerCodec("mpegts", "MPEG-TS")
+}
+
+const tsPacketSize = 188
+
+var fileNameRE = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// sessionFileName returns the file name of a session output in dir, the .ts, .pcap and subtitle files.
+func sessionFileName(dir, id, ext string) string {
+	return filepath.Join(dir, fileNameRE.ReplaceAllString(id, "_")+ext)
+}
+
+// isMPEGTS reports whether a format is MP2T over RTP (RFC 2250), static (33) or dynamic.
+func isMPEGTS(forma format.Format) bool {
+	if _, ok := forma.(*format.MPEGTS); ok {
+		return true
+	}
+	return strings.HasPrefix(strings.ToUpper(forma.RTPMap()), "MP2T/")
+}
+
+// tsWriter writes the MPEG-TS payload of a MP2T over RTP format into a .ts file, stdout or a pipe.
+type tsWriter struct {
+	mu      sync.Mutex
+	c       io.Closer
+	w       *bufio.Writer
+	packets uint64
+	invalid uint64
+	// first write error, nothing is written after it
+	err error
+}
+
+// newTSWriter creates the .ts file of a session in dir, or writes to stdout if dir is "-".
+func newTSWriter(dir, id string) (*tsWriter, error) {
+	if dir == "-" {
+		return &tsWriter{w: bufio.NewWriter(os.Stdout)}, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(sessionFileName(dir, id, ".ts"))
+	if err != nil {
+		return nil, err
+	}
+	return newTSWriterTo(f), nil
+}
+
+// newTSWriterTo returns a tsWriter writing to w, it closes w on close.
+func newTSWriterTo(w io.WriteCloser) *tsWriter {
+	return &tsWriter{c: w, w: bufio.NewWriter(w)}
+}
+
+// write writes the TS packets of an RTP packet, payloads that are not
+// a sequence of TS packets are counted as invalid and dropped.
+func (tw *tsWriter) write(pkt *rtp.Packet) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.err != nil {
+		return
+	}
+	p := pkt.Payload
+	if len(p) == 0 || len(p)%tsPacketSize != 0 {
+		tw.invalid++
+		return
+	}
+	for i := 0; i < len(p); i += tsPacketSize {
+		if p[i] != 0x47 {
+			tw.invalid++
+			return
+		}
+	}
+	tw.packets += uint64(len(p) / tsPacketSize)
+	_, tw.err = tw.w.Write(p)
+}
+
+func (tw *tsWriter) stats() (packets, invalid uint64) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.packets, tw.invalid
+}
+
+func (tw *tsWriter) close() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	err := tw.err
+	if err2 := tw.w.Flush(); err == nil {
+		err = err2
+	}
+	if tw.c != nil {
+		if err2 := tw.c.Close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("nack")
+}
+
+// nackStats are the retransmissions requested and received for a media.
+type nackStats struct {
+	// packets requested by NACK
+	Requested uint64 `json:"requested"`
+	// requested packets received later, in RTX packets or in the stream
+	Recovered   uint64   `json:"recovered"`
+	Unrecovered uint64   `json:"unrecovered"`
+	RTXPackets  uint64   `json:"rtxPackets"`
+	Duplicates  uint64   `json:"duplicates"`
+	AvgRecovery duration `json:"avgRecovery"`
+	MaxRecovery duration `json:"maxRecovery"`
+}
+
+// nackMedia requests the lost RTP packets of a media with RTCP NACK (RFC 4585) and receives their
+// retransmissions, in RTX packets (RFC 4588) of the formats with an apt, or in the stream.
+// The retransmitted packets are analyzed as the original ones, those that were not requested are duplicates.
+type nackMedia struct {
+	s           *session
+	medi        *description.Media
+	name        string
+	ssrc        uint32
+	reducedSize bool
+	// formats and original formats of the RTX formats, by payload type
+	formats map[uint8]format.Format
+	rtx     map[uint8]format.Format
+
+	mu        sync.Mutex
+	started   bool
+	mediaSSRC uint32
+	lastSeq   uint16
+	// requested packets by sequence number, with the time of the request
+	missing map[uint16]time.Time
+	total   time.Duration
+	stats   nackStats
+}
+
+// setupNACK creates the NACK senders of the medias, and logs the retransmission support of their SDP.
+func (s *session) setupNACK(medias []*description.Media, feats []rtcpFeatures) {
+	nacks := make(map[*description.Media]*nackMedia)
+	for i, medi := range medias {
+		nm := &nackMedia{
+			s:           s,
+			medi:        medi,
+			name:        s.mediaNames[medi],
+			ssrc:        rand.Uint32(),
+			reducedSize: feats[i].ReducedSize,
+			formats:     make(map[uint8]format.Format),
+			rtx:         make(map[uint8]format.Format),
+			missing:     make(map[uint16]time.Time),
+		}
+		if rs := s.rrs[medi]; rs != nil {
+			nm.ssrc = rs.ssrc
+		}
+		var rtx []string
+		for _, forma := range medi.Formats {
+			nm.formats[forma.PayloadType()] = forma
+			if main := rtxOriginal(medi, forma); main != nil {
+				nm.rtx[forma.PayloadType()] = main
+				rtx = append(rtx, strconv.Itoa(int(forma.PayloadType()))+" of "+strconv.Itoa(int(main.PayloadType())))
+			}
+		}
+		s.logf("nack %s: rtcp-fb nack offered %v, rtx %v", nm.name, feats[i].NACK, rtx)
+		nacks[medi] = nm
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nacks = nacks
+}
+
+// deliverNACK delivers an RTP packet after its NACK processing, requesting the lost packets with c.
+func (s *session) deliverNACK(c *gortsplib.Client, now time.Time, medi *description.Media, forma format.Format, pkt *rtp.Packet) {
+	forma, pkt, ok := s.nacks[medi].onPacketRTP(c, now, forma, pkt)
+	if ok {
+		s.deliverRTP(now, medi, forma, pkt)
+	}
+}
+
+// rtxOriginal returns the format retransmitted by an RTX format, nil if forma is not an RTX format.
+func rtxOriginal(medi *description.Media, forma format.Format) format.Format {
+	names := codecNames(forma)
+	if len(names) < 2 || !strings.EqualFold(names[1], "rtx") {
+		return nil
+	}
+	apt, err := strconv.ParseUint(forma.FMTP()["apt"], 10, 8)
+	if err != nil {
+		return nil
+	}
+	for _, f := range medi.Formats {
+		if f.PayloadType() == uint8(apt) {
+			return f
+		}
+	}
+	return nil
+}
+
+// onPacketRTP returns the packet to analyze, the original packet of an RTX packet,
+// false for a duplicate. It requests the packets missing before pkt with c.
+func (nm *nackMedia) onPacketRTP(c *gortsplib.Client, now time.Time, forma format.Format, pkt *rtp.Packet) (format.Format, *rtp.Packet, bool) {
+	// the client passes the last format of the media with the packets of all its formats
+	if f := nm.formats[pkt.PayloadType]; f != nil {
+		forma = f
+	}
+	nm.mu.Lock()
+	nm.expire(now)
+	if main := nm.rtx[pkt.PayloadType]; main != nil {
+		nm.stats.RTXPackets++
+		if len(pkt.Payload) < 2 {
+			nm.mu.Unlock()
+			return nil, nil, false
+		}
+		osn := binary.BigEndian.Uint16(pkt.Payload)
+		if !nm.recover(now, osn) {
+			nm.stats.Duplicates++
+			nm.mu.Unlock()
+			return nil, nil, false
+		}
+		nm.mu.Unlock()
+		orig := *pkt
+		orig.SSRC = nm.mediaSSRC
+		orig.SequenceNumber = osn
+		orig.PayloadType = main.PayloadType()
+		orig.Payload = pkt.Payload[2:]
+		return main, &orig, true
+	}
+
+	if !nm.started || pkt.SSRC != nm.mediaSSRC {
+		nm.started, nm.mediaSSRC, nm.lastSeq = true, pkt.SSRC, pkt.SequenceNumber
+		nm.missing = make(map[uint16]time.Time)
+		nm.mu.Unlock()
+		return forma, pkt, true
+	}
+	diff := pkt.SequenceNumber - nm.lastSeq
+	if diff == 0 || diff >= 0x8000 {
+		// late, retransmitted in the stream if it was requested
+		nm.recover(now, pkt.SequenceNumber)
+		nm.mu.Unlock()
+		return forma, pkt, true
+	}
+	var lost []uint16
+	// a larger gap is a jump of the stream, not a loss
+	if diff > 1 && diff < 0x1000 {
+		for seq := nm.lastSeq + 1; seq != pkt.SequenceNumber; seq++ {
+			nm.missing[seq] = now
+			lost = append(lost, seq)
+		}
+		nm.stats.Requested += uint64(len(lost))
+	}
+	nm.lastSeq = pkt.SequenceNumber
+	mediaSSRC := nm.mediaSSRC
+	nm.mu.Unlock()
+
+	if len(lost) != 0 && c != nil {
+		if err := c.WritePacketRTCP(nm.medi, nm.request(mediaSSRC, lost)); err != nil {
+			nm.s.logf("failed to send nack, %v", err)
+		}
+	}
+	return forma, pkt, true
+}
+
+// recover counts a requested packet received, it returns false if it was not requested.
+func (nm *nackMedia) recover(now time.Time, seq uint16) bool {
+	t, ok := nm.missing[seq]
+	if !ok {
+		return false
+	}
+	delete(nm.missing, seq)
+	d := now.Sub(t)
+	nm.stats.Recovered++
+	nm.total += d
+	nm.stats.AvgRecovery = duration(nm.total / time.Duration(nm.stats.Recovered))
+	if duration(d) > nm.stats.MaxRecovery {
+		nm.stats.MaxRecovery = duration(d)
+	}
+	return true
+}
+
+// expire counts the requested packets not received within -nack-timeout as unrecovered.
+func (nm *nackMedia) expire(now time.Time) {
+	for seq, t := range nm.missing {
+		if now.Sub(t) > nm.s.cfg.nackTimeout {
+			delete(nm.missing, seq)
+			nm.stats.Unrecovered++
+		}
+	}
+}
+
+// request returns the NACK of the lost packets, in a compound packet with an empty receiver report
+// unless the media offers reduced-size RTCP.
+func (nm *nackMedia) request(mediaSSRC uint32, lost []uint16) rtcp.Packet {
+	nack := &rtcp.TransportLayerNack{
+		SenderSSRC: nm.ssrc,
+		MediaSSRC:  mediaSSRC,
+		Nacks:      rtcp.NackPairsFromSequenceNumbers(lost),
+	}
+	if nm.reducedSize {
+		return nack
+	}
+	return &rtcp.CompoundPacket{&rtcp.ReceiverReport{SSRC: nm.ssrc}, &rtcp.SourceDescription{
+		Chunks: []rtcp.SourceDescriptionChunk{{
+			Source: nm.ssrc,
+			Items:  []rtcp.SourceDescriptionItem{{Type: rtcp.SDESCNAME, Text: "rtspclient"}},
+		}},
+	}, nack}
+}
+
+func (nm *nackMedia) snapshot() nackStats {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	return nm.stats
+}
+
+// logNACK logs the retransmissions of each media.
+func (s *session) logNACK() {
+	h := s.cfg.human()
+	for _, nm := range s.nacks {
+		st := nm.snapshot()
+		rate := 0.0
+		if st.Requested != 0 {
+			rate = float64(st.Recovered) * 100 / float64(st.Requested)
+		}
+		s.summaryf("nack %s: requested %d, recovered %d (%s%%), rtx packets %d, duplicates %d, unrecovered %d, recovery avg %s, max %s",
+			nm.name, st.Requested, st.Recovered, h.float(rate), st.RTXPackets, st.Duplicates, st.Unrecovered,
+			h.duration(time.Duration(st.AvgRecovery)), h.duration(time.Duration(st.MaxRecovery)))
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+)
+
+func init() {
+	registerFeature("parameters")
+}
+
+// parameterList are the parameters of -set-parameter, "name: value", it can be repeated.
+type parameterList []string
+
+func (pl parameterList) String() string {
+	return strings.Join(pl, ", ")
+}
+
+// Set implements flag.Value.
+func (pl *parameterList) Set(s string) error {
+	name, value, ok := strings.Cut(s, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid parameter %q, should be name: value", s)
+	}
+	*pl = append(*pl, strings.TrimSpace(name)+": "+strings.TrimSpace(value))
+	return nil
+}
+
+// parameterExpectation is an assertion of -expect-parameter on a parameter of the GET_PARAMETER responses.
+type parameterExpectation struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// parameterExpectations are parsed from "name=regexp", it can be repeated.
+type parameterExpectations []parameterExpectation
+
+func (pe parameterExpectations) String() string {
+	l := make([]string, len(pe))
+	for i, e := range pe {
+		l[i] = e.name + "=" + e.re.String()
+	}
+	return strings.Join(l, " ")
+}
+
+// Set implements flag.Value.
+func (pe *parameterExpectations) Set(s string) error {
+	name, expr, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid expectation %q, should be name=regexp", s)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid regexp of %s, %v", name, err)
+	}
+	*pe = append(*pe, parameterExpectation{name: strings.TrimSpace(name), re: re})
+	return nil
+}
+
+// parameterRequests reports whether the sessions send the GET_PARAMETER or SET_PARAMETER requests of the flags.
+func (cfg *config) parameterRequests() bool {
+	return cfg.getParameter != "" || len(cfg.setParameters) != 0
+}
+
+// parameterStats are the results of the GET_PARAMETER and SET_PARAMETER requests of a session.
+type parameterStats struct {
+	// answered requests
+	Requests int `json:"requests"`
+	// requests without response, with a status other than 200 or a parameter not matching -expect-parameter
+	Failed       int      `json:"failed"`
+	LastFailure  string   `json:"lastFailure,omitempty"`
+	AvgLatency   duration `json:"avgLatency"`
+	MaxLatency   duration `json:"maxLatency"`
+	totalLatency time.Duration
+}
+
+// parameterClient sends the requests of -get-parameter and -set-parameter of a playing session
+// at -parameter-interval, on the RTSP connection of its client, and checks the responses.
+type parameterClient struct {
+	s *session
+
+	mu    sync.Mutex
+	stats parameterStats
+}
+
+// onSessionHeader records the session id of the server for the requests of the tool.
+func (s *session) onSessionHeader(res *base.Response) {
+	v, ok := res.Header["Session"]
+	if !ok {
+		return
+	}
+	var sx headers.Session
+	if err := sx.Unmarshal(v); err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.rtspSession = sx.Session
+	s.mu.Unlock()
+}
+
+// startParameterRequests sends the requests of -get-parameter and -set-parameter until the returned func is called.
+func (s *session) startParameterRequests() func() {
+	if !s.cfg.parameterRequests() {
+		return func() {}
+	}
+	if s.params == nil {
+		s.params = &parameterClient{s: s}
+	}
+	done := make(chan struct{})
+	go s.params.run(done)
+	return func() { close(done) }
+}
+
+func (pc *parameterClient) run(done chan struct{}) {
+	t := time.NewTicker(pc.s.cfg.parameterInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if len(pc.s.cfg.setParameters) != 0 {
+				pc.request(base.SetParameter, strings.Join(pc.s.cfg.setParameters, "\r\n")+"\r\n")
+			}
+			if pc.s.cfg.getParameter != "" {
+				var body strings.Builder
+				for _, name := range strings.Split(pc.s.cfg.getParameter, ",") {
+					body.WriteString(strings.TrimSpace(name) + "\r\n")
+				}
+				pc.request(base.GetParameter, body.String())
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// request sends a request on the connection of the session and checks its response.
+func (pc *parameterClient) request(method base.Method, body string) {
+	s := pc.s
+	s.mu.Lock()
+	conn, session, rawURL := s.rtspConn, s.rtspSession, s.url
+	s.mu.Unlock()
+	if conn == nil {
+		pc.fail(fmt.Sprintf("%s not sent, rtsps connections are not supported", method))
+		return
+	}
+	u, err := base.ParseURL(rawURL)
+	if err != nil {
+		pc.fail(fmt.Sprintf("%s not sent, %v", method, err))
+		return
+	}
+	req := &base.Request{
+		Method: method,
+		URL:    u,
+		Header: base.Header{
+			"Content-Type": base.HeaderValue{"text/parameters"},
+			"Session":      base.HeaderValue{session},
+		},
+		Body: []byte(body),
+	}
+	s.cfg.headers.apply(req)
+	start := time.Now()
+	res, err := conn.do(req, s.cfg.readTimeout)
+	latency := time.Since(start)
+	if err != nil {
+		pc.fail(fmt.Sprintf("%s failed, %v", method, err))
+		return
+	}
+	pc.mu.Lock()
+	pc.stats.Requests++
+	pc.stats.totalLatency += latency
+	if duration(latency) > pc.stats.MaxLatency {
+		pc.stats.MaxLatency = duration(latency)
+	}
+	pc.mu.Unlock()
+
+	values := parseParameters(res.Body)
+	var l []string
+	for _, k := range sortedKeys(values) {
+		l = append(l, k+": "+values[k])
+	}
+	s.logf("parameter %s: %d %s in %s, %s", method, res.StatusCode, res.StatusMessage,
+		s.cfg.human().duration(latency), strings.Join(l, ", "))
+	if res.StatusCode != base.StatusOK {
+		pc.fail(fmt.Sprintf("%s status %d %s", method, res.StatusCode, res.StatusMessage))
+		return
+	}
+	if method != base.GetParameter {
+		return
+	}
+	for _, e := range s.cfg.expectParameters {
+		v, ok := values[strings.ToLower(e.name)]
+		switch {
+		case !ok:
+			pc.fail(fmt.Sprintf("no %s in the GET_PARAMETER response", e.name))
+		case !e.re.MatchString(v):
+			pc.fail(fmt.Sprintf("%s %q does not match %q", e.name, v, e.re))
+		}
+	}
+}
+
+// fail counts a failed request or assertion.
+func (pc *parameterClient) fail(reason string) {
+	pc.s.logf("parameter assertion failed, %s", reason)
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.stats.Failed++
+	pc.stats.LastFailure = reason
+}
+
+func (pc *parameterClient) snapshot() parameterStats {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	st := pc.stats
+	if st.Requests != 0 {
+		st.AvgLatency = duration(st.totalLatency / time.Duration(st.Requests))
+	}
+	return st
+}
+
+// parseParameters returns the "name: value" lines of a text/parameters body, by lower case name.
+func parseParameters(body []byte) map[string]string {
+	values := make(map[string]string)
+	for _, l := range strings.Split(string(body), "\n") {
+		if k, v, ok := strings.Cut(l, ":"); ok {
+			values[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+	return values
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// logParameters logs the results of the parameter requests of the session.
+func (s *session) logParameters() {
+	if s.params == nil {
+		return
+	}
+	st := s.params.snapshot()
+	h := s.cfg.human()
+	s.summaryf("parameters: requests %d, failed %d, latency avg %s, max %s",
+		st.Requests, st.Failed, h.duration(time.Duration(st.AvgLatency)), h.duration(time.Duration(st.MaxLatency)))
+}
+
+// checkParameters fails a session whose parameter requests failed.
+func (s *session) checkParameters() error {
+	if s.params == nil {
+		return nil
+	}
+	if st := s.params.snapshot(); st.Failed != 0 {
+		return s.errorf("parameter assertions failed %d times, last %s", st.Failed, st.LastFailure)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func init() {
+	registerFeature("partial-results")
+}
+
+// startedRuns are the runs in progress, their results are written when the process exits abnormally.
+var startedRuns = struct {
+	sync.Mutex
+	m map[*run]struct{}
+}{m: make(map[*run]struct{})}
+
+var exitSignalsOnce sync.Once
+
+// handleExitSignals writes the results of the runs in progress on SIGINT, SIGTERM or SIGHUP before exiting.
+// A second signal exits immediately.
+func handleExitSignals() {
+	exitSignalsOnce.Do(func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		go func() {
+			sig := <-c
+			signal.Reset()
+			finishStartedRuns(fmt.Sprintf("interrupted by %s", sig))
+			os.Exit(1)
+		}()
+	})
+}
+
+// exitOnPanic writes the results of the runs in progress before crashing on a panic,
+// deferred at the top of the goroutines and callbacks of the sessions.
+func exitOnPanic() {
+	v := recover()
+	if v == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "panic: %v\n\n%s\n", v, debug.Stack())
+	finishStartedRuns(fmt.Sprintf("panic: %v", v))
+	os.Exit(exitCrash)
+}
+
+func finishStartedRuns(partial string) {
+	startedRuns.Lock()
+	runs := make([]*run, 0, len(startedRuns.m))
+	for r := range startedRuns.m {
+		runs = append(runs, r)
+	}
+	startedRuns.Unlock()
+	for _, r := range runs {
+		r.logger.Printf("writing the partial results, %s", partial)
+		r.finish(partial)
+	}
+}
+
+// finish logs the latency and the GC pauses of the run and writes its report, once.
+// partial is why the run ended abnormally, empty at its end.
+func (r *run) finish(partial string) {
+	r.finishOnce.Do(func() {
+		r.logLatency()
+		r.logFamilies()
+		r.logResolved()
+		r.logDescribeCache()
+		r.logUDPDrops()
+		r.logRetries()
+		r.logLeaks()
+		r.logGC()
+		if r.state != nil {
+			if err := r.state.flush(); err != nil {
+				r.logger.Printf("failed to write state file, %v", err)
+			}
+		}
+		if r.cfg.manifestRecord {
+			if err := r.writeManifest(); err != nil {
+				r.logger.Printf("failed to write manifest, %v", err)
+			} else {
+				r.logger.Printf("manifest written to %s", r.cfg.manifest)
+			}
+		}
+		if r.report == nil || r.cfg.report == "" {
+			return
+		}
+		if err := r.writeReport(r.cfg.report, time.Now(), partial); err != nil {
+			r.logger.Printf("failed to write report, %v", err)
+		} else {
+			r.logger.Printf("report written to %s", r.cfg.report)
+		}
+	})
+}
+
+// checkpointReport rewrites the report of the run in progress every interval until the returned func is called,
+// so that a run killed without writing it (ex) by the OOM killer) leaves a recent one.
+func (r *run) checkpointReport(interval time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case now := <-t.C:
+				if err := r.writeReport(r.cfg.report, now, "checkpoint, the run is in progress"); err != nil {
+					r.logger.Printf("failed to write report checkpoint, %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
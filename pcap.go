@@ -0,0 +1,159 @@
+//go:build !nopcap
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+)
+
+func init() {
+	registerFeature("pcap")
+}
+
+const (
+	pcapLinkTypeRaw = 101
+	pcapSnapLen     = 65535
+	// RTP port of the first media in the synthetic UDP headers, RTCP port is RTP port + 1
+	pcapBasePort = 10000
+	// maximum UDP payload of an IPv4 packet
+	pcapMaxPayload = 65535 - 20 - 8
+)
+
+// pcapWriter writes the received RTP/RTCP packets of a session into a pcap file.
+// Packets are wrapped in synthetic IPv4/UDP headers from the server to the client,
+// the UDP ports are RTP pcapBasePort+2*media index and RTCP +1,
+// so that TCP interleaved data can also be analyzed in Wireshark (Decode As RTP).
+type pcapWriter struct {
+	src    net.IP
+	dst    net.IP
+	medias map[*description.Media]int
+
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+	id uint16
+}
+
+// pcapIP returns the IPv4 address of a host:port, or def if it is not an IPv4 address.
+func pcapIP(addr string, def net.IP) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return def
+	}
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		return ip
+	}
+	return def
+}
+
+func newPcapWriter(dir, id, remoteAddr, localAddr string, medias []*description.Media) (*pcapWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(sessionFileName(dir, id, ".pcap"))
+	if err != nil {
+		return nil, err
+	}
+
+	pw := &pcapWriter{
+		src:    pcapIP(remoteAddr, net.IPv4(10, 0, 0, 1).To4()),
+		dst:    pcapIP(localAddr, net.IPv4(10, 0, 0, 2).To4()),
+		medias: make(map[*description.Media]int),
+		f:      f,
+		w:      bufio.NewWriter(f),
+	}
+	for i, medi := range medias {
+		pw.medias[medi] = i
+	}
+
+	var hdr [24]byte
+	binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], pcapLinkTypeRaw)
+	if _, err := pw.w.Write(hdr[:]); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return pw, nil
+}
+
+type marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+func (pw *pcapWriter) writeRTP(medi *description.Media, pkt marshaler) {
+	pw.write(pcapBasePort+2*pw.medias[medi], pkt)
+}
+
+func (pw *pcapWriter) writeRTCP(medi *description.Media, pkt marshaler) {
+	pw.write(pcapBasePort+2*pw.medias[medi]+1, pkt)
+}
+
+func (pw *pcapWriter) write(port int, pkt marshaler) {
+	payload, err := pkt.Marshal()
+	if err != nil {
+		return
+	}
+	if len(payload) > pcapMaxPayload {
+		payload = payload[:pcapMaxPayload]
+	}
+	now := time.Now()
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	pw.id++
+	n := 20 + 8 + len(payload)
+	buf := make([]byte, 16+28, 16+n)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(n))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(n))
+
+	ip := buf[16:36]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(n))
+	binary.BigEndian.PutUint16(ip[4:], pw.id)
+	ip[8] = 64
+	ip[9] = 17
+	copy(ip[12:], pw.src)
+	copy(ip[16:], pw.dst)
+	binary.BigEndian.PutUint16(ip[10:], ipChecksum(ip))
+
+	udp := buf[36:44]
+	binary.BigEndian.PutUint16(udp[0:], uint16(port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+
+	pw.w.Write(append(buf, payload...))
+}
+
+func ipChecksum(hdr []byte) uint16 {
+	var sum uint32
+	for i := 0; i < len(hdr); i += 2 {
+		sum += uint32(hdr[i])<<8 | uint32(hdr[i+1])
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+func (pw *pcapWriter) close() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if err := pw.w.Flush(); err != nil {
+		pw.f.Close()
+		return err
+	}
+	return pw.f.Close()
+}
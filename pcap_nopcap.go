@@ -0,0 +1,26 @@
+//go:build nopcap
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+)
+
+// pcapWriter is left out of a build with the nopcap tag, -pcap-dir is rejected by validate.
+type pcapWriter struct{}
+
+func newPcapWriter(dir, id, remoteAddr, localAddr string, medias []*description.Media) (*pcapWriter, error) {
+	return nil, fmt.Errorf("pcap is not built in")
+}
+
+type marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+func (pw *pcapWriter) writeRTP(medi *description.Media, pkt marshaler) {}
+
+func (pw *pcapWriter) writeRTCP(medi *description.Media, pkt marshaler) {}
+
+func (pw *pcapWriter) close() error { return nil }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+)
+
+func init() {
+	registerFeature("playout")
+}
+
+// playoutStats are the stalls of the playout buffer model of a track.
+type playoutStats struct {
+	Buffer    duration `json:"buffer"`
+	Underruns int      `json:"underruns"`
+	// time the playback waited for the buffer to fill again
+	Stalled duration `json:"stalled"`
+}
+
+// playoutBuffer models the jitter buffer of a decoder playing a track: the playback starts once
+// -playout-buffer of media arrived and drains the buffer at the media rate (RTP timestamps).
+// A packet arriving after its playout time means the buffer ran dry, an underrun a viewer sees
+// as a stall, and the playback waits for the buffer to fill again.
+// Unlike the delay of -delay-timeout, a late packet is not an underrun while the buffer covers it.
+type playoutBuffer struct {
+	size      time.Duration
+	clockRate int
+
+	started bool
+	ssrc    uint32
+	// playout time of the first timestamp, moved by the stalls
+	base   time.Time
+	lastTS uint32
+	// ticks from the first timestamp, unwrapped
+	ticks int64
+
+	stats playoutStats
+}
+
+func newPlayoutBuffer(size time.Duration, clockRate int) *playoutBuffer {
+	if size <= 0 || clockRate <= 0 {
+		return nil
+	}
+	return &playoutBuffer{size: size, clockRate: clockRate, stats: playoutStats{Buffer: duration(size)}}
+}
+
+// onPacket plays out a packet, it returns the stall of an underrun, 0 if none.
+// A new SSRC starts the buffering again.
+func (p *playoutBuffer) onPacket(now time.Time, ssrc, ts uint32) time.Duration {
+	if !p.started || ssrc != p.ssrc {
+		p.started, p.ssrc, p.lastTS, p.ticks = true, ssrc, ts, 0
+		p.base = now.Add(p.size)
+		return 0
+	}
+	p.ticks += int64(int32(ts - p.lastTS))
+	p.lastTS = ts
+	due := p.base.Add(ticksToDuration(p.ticks, int64(p.clockRate)))
+	if !now.After(due) {
+		return 0
+	}
+	// the playback stopped at due and resumes once the buffer is full again
+	stall := now.Sub(due) + p.size
+	p.base = p.base.Add(stall)
+	p.stats.Underruns++
+	p.stats.Stalled += duration(stall)
+	return stall
+}
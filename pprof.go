@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+)
+
+func init() {
+	registerFeature("pprof")
+}
+
+const (
+	// 1 in pprofMutexFraction contention events is sampled, and a blocking event per pprofBlockRate ns blocked
+	pprofMutexFraction = 100
+	pprofBlockRate     = 1000
+)
+
+// servePprof starts the net/http/pprof handlers on addr, apart from the control api,
+// with the mutex and block profiles to see the contention between the goroutines of the sessions.
+func servePprof(addr string) {
+	runtime.SetMutexProfileFraction(pprofMutexFraction)
+	runtime.SetBlockProfileRate(pprofBlockRate)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		log.Printf("pprof listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("failed to serve pprof, %v", err)
+		}
+	}()
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("preflight")
+}
+
+// urls returns the distinct urls of the sessions.
+func (cfg *config) urls() []string {
+	if !strings.Contains(cfg.url, "{NUM}") {
+		return []string{cfg.url}
+	}
+	ret := make([]string, 0, cfg.sessionCount())
+	for i := cfg.nStart; i <= cfg.nEnd; i++ {
+		ret = append(ret, strings.ReplaceAll(cfg.url, "{NUM}", strconv.Itoa(i)))
+	}
+	return ret
+}
+
+// preflightResult is the preflight check of a server.
+type preflightResult struct {
+	server string
+	url    string
+	addrs  []string
+	// time of each passed step
+	steps []string
+	// failed step, empty if passed
+	failed string
+	err    error
+}
+
+func (pr *preflightResult) passed(h humanizer, step string, d time.Duration) {
+	pr.steps = append(pr.steps, step+" "+h.duration(d))
+}
+
+func (pr *preflightResult) fail(step string, err error) preflightResult {
+	pr.failed, pr.err = step, err
+	return *pr
+}
+
+// preflightServer checks the DNS, the TCP reachability and a full handshake with the url of a server,
+// up to the first RTP packet when playing. A publisher only announces and records.
+func preflightServer(cfg *config, sources *sourcePool, resolver *resolver, server, rawURL string, pm *publishMedia) preflightResult {
+	pr := preflightResult{server: server, url: rawURL}
+	h := cfg.human()
+	u, err := base.ParseURL(rawURL)
+	if err != nil {
+		return pr.fail("url", err)
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "554"
+		if u.Scheme == "rtsps" {
+			port = "322"
+		}
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.preflightTimeout)
+	defer cancel()
+	if sources.proxy != nil {
+		// the proxy resolves the host name
+		pr.addrs = []string{host}
+	} else {
+		// only the addresses of -force-ipv4 or -force-ipv6
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip"+cfg.ipFamily(), host)
+		if err != nil {
+			return pr.fail("dns", err)
+		}
+		for _, ip := range ips {
+			pr.addrs = append(pr.addrs, ip.String())
+		}
+		pr.passed(h, "dns", time.Since(start))
+	}
+
+	start = time.Now()
+	localIP := sources.get()
+	tcpCtx, tcpCancel := context.WithTimeout(context.Background(), cfg.preflightTimeout)
+	defer tcpCancel()
+	conn, err := sources.dial(tcpCtx, localIP, "tcp", net.JoinHostPort(pr.addrs[0], port))
+	if err != nil {
+		return pr.fail("tcp", err)
+	}
+	conn.Close()
+	pr.passed(h, "tcp", time.Since(start))
+
+	tr := gortsplib.TransportUDP
+	if cfg.transport == "TCP" {
+		tr = gortsplib.TransportTCP
+	}
+	c := gortsplib.Client{
+		Transport:    &tr,
+		ReadTimeout:  cfg.preflightTimeout,
+		WriteTimeout: cfg.preflightTimeout,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			address, err := resolver.address(ctx, address, nil)
+			if err != nil {
+				return nil, err
+			}
+			return sources.dial(ctx, localIP, network, address)
+		},
+		ListenPacket: sources.portListener(localIP),
+		// the same fixes of the SDP as the sessions
+		OnRequest: func(req *base.Request) {
+			cfg.headers.apply(req)
+		},
+		OnResponse: func(res *base.Response) {
+			if ct := res.Header["Content-Type"]; len(ct) == 1 && strings.HasPrefix(ct[0], "application/sdp") {
+				res.Body, _ = cfg.clockRates.fixSDP(fixTextMedias(res.Body))
+			}
+		},
+	}
+	start = time.Now()
+	if err := c.Start(u.Scheme, u.Host); err != nil {
+		return pr.fail("handshake", err)
+	}
+	defer c.Close()
+
+	if pm != nil {
+		desc := pm.description()
+		if _, err := c.Announce(u, desc); err != nil {
+			return pr.fail("announce", err)
+		}
+		if err := c.SetupAll(u, desc.Medias); err != nil {
+			return pr.fail("setup", err)
+		}
+		if _, err := c.Record(); err != nil {
+			return pr.fail("record", err)
+		}
+		pr.passed(h, "handshake", time.Since(start))
+		return pr
+	}
+
+	desc, res, err := c.Describe(u)
+	if err != nil {
+		return pr.fail("describe", err)
+	}
+	if err := cfg.controlPolicy(u).apply(desc, res, u); err != nil {
+		return pr.fail("describe", err)
+	}
+	if err := c.SetupAll(desc.BaseURL, desc.Medias); err != nil {
+		return pr.fail("setup", err)
+	}
+	firstPacket := make(chan struct{})
+	var once sync.Once
+	c.OnPacketRTPAny(func(*description.Media, format.Format, *rtp.Packet) {
+		once.Do(func() { close(firstPacket) })
+	})
+	if _, err := c.Play(nil); err != nil {
+		return pr.fail("play", err)
+	}
+	pr.passed(h, "handshake", time.Since(start))
+
+	start = time.Now()
+	t := time.NewTimer(cfg.preflightTimeout)
+	defer t.Stop()
+	select {
+	case <-firstPacket:
+		pr.passed(h, "first rtp "+cfg.transport, time.Since(start))
+	case <-t.C:
+		return pr.fail("first rtp "+cfg.transport, fmt.Errorf("no rtp packet within %v", cfg.preflightTimeout))
+	}
+	return pr
+}
+
+// servers returns the servers of the urls of the run, sorted, and the first url of each.
+func (r *run) servers() ([]string, map[string]string) {
+	var servers []string
+	first := make(map[string]string)
+	for _, raw := range r.cfg.urls() {
+		server := raw
+		if u, err := base.ParseURL(raw); err == nil {
+			server = u.Host
+		}
+		if _, ok := first[server]; !ok {
+			first[server] = raw
+			servers = append(servers, server)
+		}
+	}
+	sort.Strings(servers)
+	return servers, first
+}
+
+// preflight checks each server of the urls of the run once, concurrently, before the sessions start.
+// It logs the result of each server and returns an error if any failed.
+func (r *run) preflight() error {
+	servers, first := r.servers()
+
+	results := make([]preflightResult, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		i, server := i, server
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = preflightServer(r.cfg, r.sources, r.resolver, server, r.expandURL(first[server], 1), r.publish)
+		}()
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, pr := range results {
+		if pr.err != nil {
+			passed := "none"
+			if len(pr.steps) != 0 {
+				passed = strings.Join(pr.steps, ", ")
+			}
+			r.logger.Printf("preflight %s: failed at %s, %v (%s, passed: %s)",
+				pr.server, pr.failed, pr.err, pr.url, passed)
+			failed = append(failed, pr.server)
+			continue
+		}
+		r.logger.Printf("preflight %s: ok, %s (%s)", pr.server, strings.Join(pr.steps, ", "), strings.Join(pr.addrs, " "))
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("preflight failed for %d of %d servers, %s", len(failed), len(servers), strings.Join(failed, ", "))
+	}
+	return nil
+}
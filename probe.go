@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/sdp"
+)
+
+func init() {
+	registerFeature("probe")
+}
+
+// probeConcurrency is the number of urls probed at once by -probe.
+const probeConcurrency = 16
+
+// playMethods are the methods a server needs to list in the Public header to be played.
+var playMethods = []string{"DESCRIBE", "SETUP", "PLAY", "TEARDOWN"}
+
+// probeMedia is a media of the SDP of a probed url.
+type probeMedia struct {
+	name string
+	// transport profile of the m= line (ex) RTP/AVP
+	profile string
+	codecs  []string
+	control string
+}
+
+// probeResult is the capabilities of the server of a url found by -probe, and its deviations from RFC 2326.
+type probeResult struct {
+	url    string
+	server string
+	// methods of the Public header of OPTIONS
+	methods []string
+	// schemes of the WWW-Authenticate headers of the 401 responses
+	auth   []string
+	medias []probeMedia
+	issues []string
+	// failed step, empty if probed
+	failed string
+	err    error
+}
+
+func (pr *probeResult) fail(step string, err error) probeResult {
+	pr.failed, pr.err = step, err
+	return *pr
+}
+
+func (pr *probeResult) issuef(format string, v ...interface{}) {
+	pr.issues = append(pr.issues, fmt.Sprintf(format, v...))
+}
+
+// probeURL sends OPTIONS and DESCRIBE to a url, without SETUP and PLAY, and returns what the server offers.
+func probeURL(cfg *config, sources *sourcePool, resolver *resolver, rawURL string) probeResult {
+	pr := probeResult{url: rawURL}
+	u, err := base.ParseURL(rawURL)
+	if err != nil {
+		return pr.fail("url", err)
+	}
+
+	localIP := sources.get()
+	// the callbacks run on the client while the requests wait for them
+	var request base.Method
+	c := gortsplib.Client{
+		ReadTimeout:  cfg.readTimeout,
+		WriteTimeout: cfg.writeTimeout,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			address, err := resolver.address(ctx, address, nil)
+			if err != nil {
+				return nil, err
+			}
+			return sources.dial(ctx, localIP, network, address)
+		},
+		OnRequest: func(req *base.Request) {
+			cfg.headers.apply(req)
+			request = req.Method
+		},
+		OnResponse: func(res *base.Response) {
+			if v := res.Header["Server"]; len(v) == 1 && pr.server == "" {
+				pr.server = v[0]
+			}
+			if res.StatusCode == base.StatusUnauthorized {
+				for _, v := range res.Header["WWW-Authenticate"] {
+					scheme, _, _ := strings.Cut(strings.TrimSpace(v), " ")
+					pr.auth = appendUnique(pr.auth, scheme)
+				}
+				return
+			}
+			if request == base.Options && res.StatusCode == base.StatusOK {
+				pr.checkOptions(res)
+			}
+		},
+	}
+	if err := c.Start(u.Scheme, u.Host); err != nil {
+		return pr.fail("connect", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Options(u); err != nil {
+		pr.issuef("OPTIONS failed, %v", err)
+	}
+	desc, res, err := c.Describe(u)
+	if err != nil {
+		return pr.fail("describe", err)
+	}
+	pr.checkDescribe(res, len(desc.Medias))
+	for i, medi := range desc.Medias {
+		pm := probeMedia{name: mediaName(desc.Medias, i), control: medi.Control}
+		for _, forma := range medi.Formats {
+			pm.codecs = appendUnique(pm.codecs, forma.Codec())
+		}
+		if i < len(pr.medias) {
+			pm.profile = pr.medias[i].profile
+			pr.medias[i] = pm
+		} else {
+			pr.medias = append(pr.medias, pm)
+		}
+	}
+	return pr
+}
+
+// checkOptions reads the methods of the Public header of an OPTIONS response.
+func (pr *probeResult) checkOptions(res *base.Response) {
+	pub := res.Header["Public"]
+	if len(pub) != 1 {
+		pr.issuef("OPTIONS response without Public header")
+		return
+	}
+	for _, m := range strings.Split(pub[0], ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			pr.methods = appendUnique(pr.methods, m)
+		}
+	}
+	var missing []string
+	for _, m := range playMethods {
+		if !containsString(pr.methods, m) {
+			missing = append(missing, m)
+		}
+	}
+	if len(missing) != 0 {
+		pr.issuef("Public header lacks %s", strings.Join(missing, ", "))
+	}
+}
+
+// checkDescribe reads the transport profiles of the medias of the SDP of a DESCRIBE response.
+func (pr *probeResult) checkDescribe(res *base.Response, medias int) {
+	if ct := res.Header["Content-Type"]; len(ct) != 1 || !strings.HasPrefix(ct[0], "application/sdp") {
+		pr.issuef("DESCRIBE response without Content-Type application/sdp")
+	}
+	if _, ok := res.Header["Content-Base"]; !ok {
+		if _, ok := res.Header["Content-Location"]; !ok {
+			pr.issuef("DESCRIBE response without Content-Base or Content-Location, the request url is the base")
+		}
+	}
+	var sd sdp.SessionDescription
+	if err := sd.Unmarshal(res.Body); err != nil {
+		pr.issuef("invalid sdp, %v", err)
+		return
+	}
+	for _, md := range sd.MediaDescriptions {
+		pm := probeMedia{profile: strings.Join(md.MediaName.Protos, "/")}
+		if _, ok := md.Attribute("control"); !ok && len(sd.MediaDescriptions) > 1 {
+			pr.issuef("media %s without a=control", md.MediaName.Media)
+		}
+		pr.medias = append(pr.medias, pm)
+	}
+	if len(pr.medias) != medias {
+		pr.issuef("sdp has %d medias, %d are supported by the client", len(pr.medias), medias)
+	}
+}
+
+func appendUnique(l []string, s string) []string {
+	if containsString(l, s) {
+		return l
+	}
+	return append(l, s)
+}
+
+func containsString(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// probe is the -probe mode: OPTIONS and DESCRIBE of each url of the run, at most probeConcurrency at once,
+// it logs the methods, the authentication schemes, the transport profiles and the codecs of each url
+// and the deviations from RFC 2326 found, without playing. It returns an error if any url failed.
+func (r *run) probe() error {
+	urls := r.cfg.urls()
+	results := make([]probeResult, len(urls))
+	sem := make(chan struct{}, probeConcurrency)
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		i, u := i, u
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = probeURL(r.cfg, r.sources, r.resolver, r.expandURL(u, int64(i+1)))
+		}()
+	}
+	wg.Wait()
+
+	var failed, issues int
+	profiles := make(map[string]int)
+	codecs := make(map[string]int)
+	for _, pr := range results {
+		if pr.err != nil {
+			failed++
+			r.logger.Printf("probe %s: failed at %s, %v", pr.url, pr.failed, pr.err)
+			continue
+		}
+		auth := "none"
+		if len(pr.auth) != 0 {
+			auth = strings.Join(pr.auth, ", ")
+		}
+		r.logger.Printf("probe %s: server %q, methods %s, auth %s", pr.url, pr.server, strings.Join(pr.methods, ", "), auth)
+		for _, pm := range pr.medias {
+			r.logger.Printf("probe %s: media %s, profile %s, codecs %s, control %q",
+				pr.url, pm.name, pm.profile, strings.Join(pm.codecs, ", "), pm.control)
+			profiles[pm.profile]++
+			for _, c := range pm.codecs {
+				codecs[c]++
+			}
+		}
+		for _, issue := range pr.issues {
+			r.logger.Printf("probe %s: conformance, %s", pr.url, issue)
+		}
+		if len(pr.issues) != 0 {
+			issues++
+		}
+	}
+	r.logger.Printf(r.cfg.tr("probe: urls %d, failed %d, with conformance issues %d, profiles %s, codecs %s"),
+		len(urls), failed, issues, countsString(profiles), countsString(codecs))
+	if failed != 0 {
+		return fmt.Errorf("probe failed for %d of %d urls", failed, len(urls))
+	}
+	return nil
+}
+
+// countsString returns counts by name sorted by name, (ex) H264 3, MPEG-4 Audio 2
+func countsString(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s %d", name, counts[name])
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func init() {
+	registerFeature("proxy")
+}
+
+// parseProxy parses -proxy, socks5://[user:password@]host:port or http://[user:password@]host:port.
+func parseProxy(v string) (*url.URL, error) {
+	u, err := url.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "socks5" && u.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("no port in %s", v)
+	}
+	return u, nil
+}
+
+// dialProxy connects to address through the proxy with d, by a SOCKS5 CONNECT or an HTTP CONNECT request.
+// Only the RTSP connections go through it, the media too over -transport TCP.
+func dialProxy(ctx context.Context, d *net.Dialer, network string, proxy *url.URL, address string) (net.Conn, error) {
+	conn, err := d.DialContext(ctx, network, proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if proxy.Scheme == "socks5" {
+		err = socks5Connect(conn, proxy.User, address)
+	} else {
+		err = httpConnect(conn, proxy.User, address)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s, %v", proxy.Host, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// socks5Connect requests a connection to address (RFC 1928), authenticated by user (RFC 1929) if not nil.
+func socks5Connect(conn net.Conn, user *url.Userinfo, address string) error {
+	host, v, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(v, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	method := byte(0x00)
+	if user != nil {
+		method = 0x02
+	}
+	if _, err := conn.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+	var res [2]byte
+	if _, err := io.ReadFull(conn, res[:]); err != nil {
+		return err
+	}
+	if res[0] != 5 || res[1] != method {
+		return fmt.Errorf("socks5 authentication method %#x refused", method)
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req := []byte{1, byte(len(user.Username()))}
+		req = append(req, user.Username()...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, res[:]); err != nil {
+			return err
+		}
+		if res[1] != 0 {
+			return fmt.Errorf("socks5 authentication failed")
+		}
+	}
+
+	req := []byte{5, 1, 0}
+	switch ip := net.ParseIP(host); {
+	case ip == nil:
+		req = append(req, 3, byte(len(host)))
+		req = append(req, host...)
+	case ip.To4() != nil:
+		req = append(req, 1)
+		req = append(req, ip.To4()...)
+	default:
+		req = append(req, 4)
+		req = append(req, ip.To16()...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	var hdr [5]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return err
+	}
+	if hdr[1] != 0 {
+		return fmt.Errorf("socks5 connect failed, reply %d", hdr[1])
+	}
+	// the bound address, its first byte is in hdr
+	var n int
+	switch hdr[3] {
+	case 1:
+		n = 4 - 1 + 2
+	case 4:
+		n = 16 - 1 + 2
+	case 3:
+		n = int(hdr[4]) + 2
+	default:
+		return fmt.Errorf("socks5 invalid address type %d", hdr[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, n))
+	return err
+}
+
+// httpConnect requests a tunnel to address with an HTTP CONNECT request, with the basic credentials of user if not nil.
+func httpConnect(conn net.Conn, user *url.Userinfo, address string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	// the server speaks after the client in RTSP, nothing is read past the response
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("http connect status %s", res.Status)
+	}
+	return nil
+}
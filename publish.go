@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("publish")
+	registerCodec("publish", "H264", "MPEG-4 Audio", "MPEG-TS")
+}
+
+// publishTestPattern is the -publish source of the synthetic test pattern.
+const publishTestPattern = "testpattern"
+
+// tsPacketsPerRTP is the number of TS packets of an MP2T RTP packet, within a 1500 bytes MTU.
+const tsPacketsPerRTP = 7
+
+// publishTrack is a track of a -publish source.
+type publishTrack struct {
+	// newFormat returns the format of a publisher, formats are not shared by sessions
+	newFormat func() format.Format
+}
+
+// publishFrame is an access unit of a track, H264 NALUs, an AAC access unit or TS packets.
+type publishFrame struct {
+	track    int
+	dts, pts time.Duration
+	au       [][]byte
+}
+
+// publishMedia is the loaded -publish source, shared by the publishers.
+type publishMedia struct {
+	name   string
+	tracks []publishTrack
+	// ordered by dts
+	frames []publishFrame
+	// duration of a loop
+	duration time.Duration
+	// unsupported tracks of the source
+	skipped []string
+}
+
+// loadPublishMedia loads the source of -publish, an MP4 or MPEG-TS file or the test pattern.
+func loadPublishMedia(source string) (*publishMedia, error) {
+	if source == publishTestPattern {
+		return newTestPattern(), nil
+	}
+	buf, err := os.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(source)
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".ts", ".m2ts", ".mts":
+		return loadTS(name, buf)
+	case ".mp4", ".m4v", ".mov":
+		return loadMP4(name, buf)
+	}
+	return nil, fmt.Errorf("unsupported file %s, should be .mp4 or .ts", name)
+}
+
+// tsPCR returns the PCR of a TS packet in 27MHz units.
+func tsPCR(p []byte) (int64, bool) {
+	if p[3]&0x20 == 0 || p[4] < 7 || p[5]&0x10 == 0 {
+		return 0, false
+	}
+	base := int64(p[6])<<25 | int64(p[7])<<17 | int64(p[8])<<9 | int64(p[9])<<1 | int64(p[10])>>7
+	ext := int64(p[10]&1)<<8 | int64(p[11])
+	return base*300 + ext, true
+}
+
+// loadTS loads an MPEG-TS file, published as MP2T over RTP.
+// The packets are paced by the PCRs of the first PID carrying them.
+func loadTS(name string, buf []byte) (*publishMedia, error) {
+	n := len(buf) / tsPacketSize
+	if n == 0 || buf[0] != 0x47 {
+		return nil, fmt.Errorf("not an MPEG-TS file")
+	}
+
+	type pcrAt struct {
+		packet int
+		pcr    int64
+	}
+	var pcrs []pcrAt
+	pcrPID := -1
+	for i := 0; i < n; i++ {
+		p := buf[i*tsPacketSize : (i+1)*tsPacketSize]
+		if p[0] != 0x47 {
+			return nil, fmt.Errorf("lost sync at packet %d", i)
+		}
+		pid := int(p[1]&0x1f)<<8 | int(p[2])
+		if pcrPID != -1 && pid != pcrPID {
+			continue
+		}
+		pcr, ok := tsPCR(p)
+		if !ok {
+			continue
+		}
+		pcrPID = pid
+		if l := len(pcrs); l != 0 && pcr < pcrs[l-1].pcr {
+			// wrapped around 2^33 of the 90kHz base
+			pcr += (1 << 33) * 300
+		}
+		pcrs = append(pcrs, pcrAt{packet: i, pcr: pcr})
+	}
+	if len(pcrs) < 2 || pcrs[len(pcrs)-1].pcr == pcrs[0].pcr {
+		return nil, fmt.Errorf("not enough PCRs to pace the file")
+	}
+
+	// the time of a packet is interpolated between the PCRs around it,
+	// extrapolated before the first and after the last
+	k := 0
+	at := func(i int) time.Duration {
+		for k < len(pcrs)-2 && i >= pcrs[k+1].packet {
+			k++
+		}
+		a, b := pcrs[k], pcrs[k+1]
+		pcr := a.pcr + int64(i-a.packet)*(b.pcr-a.pcr)/int64(b.packet-a.packet)
+		return ticksToDuration(pcr-pcrs[0].pcr, 27000000)
+	}
+	start := at(0)
+
+	pm := &publishMedia{
+		name:   name,
+		tracks: []publishTrack{{newFormat: func() format.Format { return &format.MPEGTS{} }}},
+	}
+	for i := 0; i < n; i += tsPacketsPerRTP {
+		end := i + tsPacketsPerRTP
+		if end > n {
+			end = n
+		}
+		t := at(i) - start
+		pm.frames = append(pm.frames, publishFrame{
+			dts: t,
+			pts: t,
+			au:  [][]byte{buf[i*tsPacketSize : end*tsPacketSize]},
+		})
+	}
+	pm.duration = at(n) - start
+	return pm, nil
+}
+
+// description returns the session description of a publisher, with its own formats.
+func (pm *publishMedia) description() *description.Session {
+	desc := &description.Session{Title: pm.name}
+	for _, t := range pm.tracks {
+		forma := t.newFormat()
+		typ := description.MediaTypeVideo
+		if _, ok := forma.(*format.MPEG4Audio); ok {
+			typ = description.MediaTypeAudio
+		}
+		desc.Medias = append(desc.Medias, &description.Media{Type: typ, Formats: []format.Format{forma}})
+	}
+	return desc
+}
+
+func (pm *publishMedia) hasH264() bool {
+	for _, t := range pm.tracks {
+		if _, ok := t.newFormat().(*format.H264); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rtpEncoder packetizes the access units of a track.
+type rtpEncoder interface {
+	Encode(au [][]byte) ([]*rtp.Packet, error)
+}
+
+// tsEncoder packetizes the TS packets of an access unit into a single MP2T RTP packet.
+type tsEncoder struct {
+	ssrc uint32
+	seq  uint16
+}
+
+func (e *tsEncoder) Encode(au [][]byte) ([]*rtp.Packet, error) {
+	pkts := make([]*rtp.Packet, len(au))
+	for i, p := range au {
+		pkts[i] = &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    33,
+				SequenceNumber: e.seq,
+				SSRC:           e.ssrc,
+			},
+			Payload: p,
+		}
+		e.seq++
+	}
+	return pkts, nil
+}
+
+func newRTPEncoder(forma format.Format) (rtpEncoder, error) {
+	switch f := forma.(type) {
+	case *format.H264:
+		return f.CreateEncoder()
+	case *format.MPEG4Audio:
+		return f.CreateEncoder()
+	case *format.MPEGTS:
+		return &tsEncoder{ssrc: rand.Uint32(), seq: uint16(rand.Uint32())}, nil
+	}
+	return nil, fmt.Errorf("unsupported format %s", forma.Codec())
+}
+
+// durationToTicks converts a duration into ticks of a clock rate without overflow.
+func durationToTicks(d time.Duration, rate int) int64 {
+	return int64(d/time.Second)*int64(rate) + int64(d%time.Second)*int64(rate)/int64(time.Second)
+}
+
+// publisher tells if the session publishes, the player of a -loopback session plays.
+func (s *session) publisher() bool {
+	return s.run.publish != nil && (!s.cfg.loopback || s.recording != nil)
+}
+
+// onPacketSent counts a packet sent by a publisher like a received one.
+func (s *session) onPacketSent(now time.Time, medi *description.Media, pkt *rtp.Packet) {
+	s.mu.Lock()
+	s.lastPackets[s.packets%lastPacketsSize] = packetInfo{
+		Time:           now,
+		Media:          string(medi.Type),
+		PayloadType:    pkt.PayloadType,
+		SequenceNumber: pkt.SequenceNumber,
+		Timestamp:      pkt.Timestamp,
+		Marker:         pkt.Marker,
+		Size:           len(pkt.Payload),
+	}
+	s.packets++
+	s.bytes += uint64(len(pkt.Payload))
+	s.lastPacket = now
+	s.bitrate.add(now, len(pkt.Payload), s.checkBitrate)
+	s.mu.Unlock()
+	if s.run.report != nil {
+		s.run.report.addBytes(len(pkt.Payload))
+	}
+	if s.run.statsd != nil {
+		s.run.statsd.addPacket(len(pkt.Payload))
+	}
+}
+
+// publishInternal pushes the -publish source to the url of the session with ANNOUNCE/SETUP/RECORD,
+// in real time, looping if -publish-loop.
+func (s *session) publishInternal() error {
+	s.dc = &DelayChecker{s: s}
+	s.setState(stateConnecting)
+	s.run.sessions.add(s)
+	defer func() {
+		s.setState(stateClosed)
+		s.run.sessions.remove(s)
+	}()
+
+	c := s.newClient()
+	u, err := base.ParseURL(s.url)
+	if err != nil {
+		return s.errorf("failed to parse url, %v", err)
+	}
+	err = s.startClient(c, u)
+	if err != nil {
+		return s.errorf("failed to start client, %v", err)
+	}
+	defer c.Close()
+	s.mu.Lock()
+	s.closeClient = c.Close
+	tornDown := s.tornDown
+	s.mu.Unlock()
+	if tornDown {
+		return nil
+	}
+	stopDeadline := s.startSetupDeadline(c)
+	defer stopDeadline()
+
+	pm := s.run.publish
+	desc := pm.description()
+	s.setState(stateAnnouncing)
+	if _, err := c.Announce(u, desc); err != nil {
+		return s.errorf("failed to announce, %v", err)
+	}
+	s.logf("success to announce %s", pm.name)
+
+	s.setState(stateSettingUp)
+	for _, medi := range desc.Medias {
+		if _, err := c.Setup(u, medi, 0, 0); err != nil {
+			return s.errorf("failed to setup, %v", err)
+		}
+	}
+	s.logf("success to setup")
+
+	encoders := make([]rtpEncoder, len(desc.Medias))
+	timestamps := make([]uint32, len(desc.Medias))
+	for i, medi := range desc.Medias {
+		encoders[i], err = newRTPEncoder(medi.Formats[0])
+		if err != nil {
+			return s.errorf("failed to create encoder, %v", err)
+		}
+		timestamps[i] = rand.Uint32()
+	}
+
+	s.setState(stateStarting)
+	if _, err := c.Record(); err != nil {
+		return s.errorf("failed to record, %v", err)
+	}
+	s.logf("success to record")
+	s.setState(stateRecording)
+	stopDeadline()
+	s.handshakeDone(nil)
+	if s.recording != nil {
+		close(s.recording)
+	}
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- c.Wait() }()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	start := time.Now()
+	var offset time.Duration
+	for loops := 1; ; loops++ {
+		for _, f := range pm.frames {
+			if d := time.Until(start.Add(offset + f.dts)); d > 0 {
+				timer.Reset(d)
+				select {
+				case <-timer.C:
+				case err := <-waitErr:
+					if err != nil && !s.isTornDown() {
+						return s.errorf("failed to record process, %v", err)
+					}
+					return nil
+				}
+			}
+
+			medi := desc.Medias[f.track]
+			forma := medi.Formats[0]
+			au := f.au
+			if _, ok := forma.(*format.H264); ok && s.loopback != nil {
+				au = s.loopback.mark(au, time.Now())
+			}
+			pkts, err := encoders[f.track].Encode(au)
+			if err != nil {
+				return s.errorf("failed to encode, %v", err)
+			}
+			ts := timestamps[f.track] + uint32(durationToTicks(offset+f.pts, forma.ClockRate()))
+			now := time.Now()
+			for _, pkt := range pkts {
+				pkt.Timestamp += ts
+				if err := c.WritePacketRTP(medi, pkt); err != nil {
+					if s.isTornDown() {
+						return nil
+					}
+					return s.errorf("failed to write, %v", err)
+				}
+				s.onPacketSent(now, medi, pkt)
+			}
+		}
+		if !s.cfg.publishLoop {
+			s.logf("published %s", pm.name)
+			return nil
+		}
+		offset += pm.duration
+		if loops == 1 {
+			s.logf("looping %s every %s", pm.name, s.cfg.human().duration(pm.duration))
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	registerFeature("udp-rcvbuf")
+}
+
+// udpDropsInterval is the interval of the samples of the packets dropped by the kernel.
+const udpDropsInterval = time.Second
+
+// setReadBuffers sets the receive buffers of the UDP sockets listened since the last call to -udp-rcvbuf,
+// after the SETUP since the client sets its own size when it listens.
+func (s *session) setReadBuffers() {
+	s.mu.Lock()
+	conns := s.udpConns
+	s.udpConns = nil
+	s.mu.Unlock()
+	for _, uc := range conns {
+		if err := uc.SetReadBuffer(int(s.cfg.udpRcvbuf)); err != nil {
+			s.logf("failed to set udp receive buffer, %v", err)
+			return
+		}
+	}
+}
+
+// udpDropMonitor samples the packets dropped by the kernel on the UDP sockets of the sessions
+// when their receive buffers overflow, these losses are local.
+type udpDropMonitor struct {
+	mu sync.Mutex
+	// drops of each socket of the sessions, by inode
+	sockets map[uint64]*udpSocket
+	total   uint64
+}
+
+type udpSocket struct {
+	s     *session
+	drops uint64
+}
+
+// newUDPDropMonitor returns nil if the drops of the sockets are not available on this platform.
+func newUDPDropMonitor() *udpDropMonitor {
+	if _, err := udpSocketDrops(); err != nil {
+		return nil
+	}
+	return &udpDropMonitor{sockets: make(map[uint64]*udpSocket)}
+}
+
+// add monitors a UDP socket of a session.
+func (m *udpDropMonitor) add(s *session, uc *net.UDPConn) {
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return
+	}
+	inode, err := socketInode(rc)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	m.sockets[inode] = &udpSocket{s: s}
+	m.mu.Unlock()
+	s.mu.Lock()
+	s.udpInodes = append(s.udpInodes, inode)
+	s.mu.Unlock()
+}
+
+// remove stops monitoring the sockets of a session.
+func (m *udpDropMonitor) remove(s *session) {
+	s.mu.Lock()
+	inodes := s.udpInodes
+	s.mu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, inode := range inodes {
+		delete(m.sockets, inode)
+	}
+}
+
+// sample adds the drops since the last sample to the sessions, it returns their sum.
+func (m *udpDropMonitor) sample() uint64 {
+	drops, err := udpSocketDrops()
+	if err != nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n uint64
+	for inode, sock := range m.sockets {
+		if d, ok := drops[inode]; ok && d > sock.drops {
+			atomic.AddUint64(&sock.s.kernelDrops, d-sock.drops)
+			n += d - sock.drops
+			sock.drops = d
+		}
+	}
+	m.total += n
+	return n
+}
+
+// start samples the drops every udpDropsInterval until the returned func is called.
+func (m *udpDropMonitor) start(r *run) func() {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(udpDropsInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if n := m.sample(); n > 0 {
+					r.logger.Printf("udp: the kernel dropped %d packets of the sessions in %v, their receive buffers overflow (see -udp-rcvbuf)", n, udpDropsInterval)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (r *run) logUDPDrops() {
+	if r.udpDrops == nil {
+		return
+	}
+	r.udpDrops.mu.Lock()
+	total := r.udpDrops.total
+	r.udpDrops.mu.Unlock()
+	if total > 0 {
+		r.logger.Printf(r.cfg.tr("udp: the kernel dropped %d packets, the receive buffers of the sessions overflow, these losses are local"), total)
+	}
+}
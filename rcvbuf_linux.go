@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// udpSocketDrops returns the packets dropped by the kernel on each UDP socket of the host by inode,
+// the last column of /proc/net/udp and /proc/net/udp6.
+func udpSocketDrops() (map[uint64]uint64, error) {
+	drops := make(map[uint64]uint64)
+	for i, path := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			if i > 0 {
+				// without IPv6
+				continue
+			}
+			return nil, err
+		}
+		sc := bufio.NewScanner(bytes.NewReader(b))
+		// header
+		sc.Scan()
+		for sc.Scan() {
+			f := strings.Fields(sc.Text())
+			if len(f) < 13 {
+				continue
+			}
+			inode, err := strconv.ParseUint(f[9], 10, 64)
+			if err != nil {
+				continue
+			}
+			d, err := strconv.ParseUint(f[len(f)-1], 10, 64)
+			if err != nil {
+				continue
+			}
+			drops[inode] = d
+		}
+	}
+	return drops, nil
+}
+
+// socketInode returns the inode of a socket, as in /proc/net/udp.
+func socketInode(rc syscall.RawConn) (uint64, error) {
+	var st syscall.Stat_t
+	var err error
+	err2 := rc.Control(func(fd uintptr) {
+		err = syscall.Fstat(int(fd), &st)
+	})
+	if err2 != nil {
+		return 0, err2
+	}
+	return st.Ino, err
+}
+
+// rmemMax returns net.core.rmem_max, the maximum receive buffer of a socket, 0 if unknown.
+func rmemMax() int64 {
+	b, err := os.ReadFile("/proc/sys/net/core/rmem_max")
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	return n
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+var errUDPDrops = fmt.Errorf("the drops of the udp sockets are not supported on this platform")
+
+// udpSocketDrops returns the packets dropped by the kernel on each UDP socket, only supported on Linux.
+func udpSocketDrops() (map[uint64]uint64, error) {
+	return nil, errUDPDrops
+}
+
+// socketInode returns the inode of a socket.
+func socketInode(rc syscall.RawConn) (uint64, error) {
+	return 0, errUDPDrops
+}
+
+// rmemMax returns the maximum receive buffer of a socket, 0 if unknown.
+func rmemMax() int64 {
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	registerFeature("read-rate")
+}
+
+// throttledConn reads the RTSP connection of a session at most at -read-rate, to simulate a slow client:
+// the kernel receive buffer and then the send buffer of the server fill, and the server drops frames
+// (lost packets), stalls (delays) or kills the session (error).
+type throttledConn struct {
+	net.Conn
+	// bytes per second
+	rate  float64
+	chunk int
+	next  time.Time
+	// total time waited, shared by the connections of the session
+	throttled *int64
+}
+
+func newThrottledConn(conn net.Conn, rate bitrate, throttled *int64) *throttledConn {
+	c := &throttledConn{Conn: conn, rate: float64(rate) / 8, throttled: throttled}
+	// reads of 20ms of the rate, a smaller buffer of the client reads less at once
+	c.chunk = int(c.rate / 50)
+	if c.chunk < 512 {
+		c.chunk = 512
+	}
+	return c
+}
+
+// Read paces the reads, without credit for the idle time so that the rate is never exceeded.
+func (c *throttledConn) Read(b []byte) (int, error) {
+	if len(b) > c.chunk {
+		b = b[:c.chunk]
+	}
+	if d := time.Until(c.next); d > 0 {
+		time.Sleep(d)
+		atomic.AddInt64(c.throttled, int64(d))
+	}
+	n, err := c.Conn.Read(b)
+	now := time.Now()
+	if c.next.Before(now) {
+		c.next = now
+	}
+	c.next = c.next.Add(time.Duration(float64(n) / c.rate * float64(time.Second)))
+	return n, err
+}
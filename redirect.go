@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+func init() {
+	registerFeature("redirect")
+}
+
+// defaultMaxRedirects is the default of -max-redirects.
+const defaultMaxRedirects = 5
+
+// methodRedirect is the REDIRECT request of a server, RFC 2326 10.10.
+const methodRedirect base.Method = "REDIRECT"
+
+// playRedirected plays the session, following the redirects of the server up to -max-redirects:
+// the 3xx responses to the requests of the handshake and the REDIRECT requests while playing.
+// The client follows the 3xx responses to DESCRIBE itself, on the same connection attempt,
+// the other redirects connect to the new location with a new DESCRIBE. The session keeps its id.
+func (s *session) playRedirected() error {
+	for {
+		err := s.playInternal()
+		s.mu.Lock()
+		chain := s.redirectsOver
+		s.redirectsOver = ""
+		s.mu.Unlock()
+		if chain == "" {
+			location := s.takeRedirect()
+			if location == "" || s.isTornDown() {
+				return err
+			}
+			if chain = s.redirectTo(location); chain == "" {
+				s.failure = ""
+				continue
+			}
+		}
+		return s.errorf("too many redirects, over -max-redirects %d, %s", s.cfg.maxRedirects, chain)
+	}
+}
+
+// redirectTo moves the session to the location of a redirect. Over -max-redirects,
+// it returns the chain of the redirects and the session stays.
+func (s *session) redirectTo(location string) string {
+	s.mu.Lock()
+	chain := strings.Join(append(append([]string(nil), s.redirects...), s.url, location), " -> ")
+	if len(s.redirects) >= s.cfg.maxRedirects {
+		s.mu.Unlock()
+		return chain
+	}
+	s.redirects = append(s.redirects, s.url)
+	s.url = location
+	s.mu.Unlock()
+	s.logf("redirected to %s, %s", location, chain)
+	return ""
+}
+
+// onRedirectResponse records the location of a 3xx response. The client follows the redirects
+// of DESCRIBE with an absolute Location, they are counted and the client is closed over -max-redirects.
+// The other requests fail and the session is redirected by playRedirected.
+func (s *session) onRedirectResponse(res *base.Response) {
+	if s.publisher() || res.StatusCode/100 != 3 {
+		return
+	}
+	location, ok := s.redirectLocation(res.Header)
+	if !ok {
+		return
+	}
+	followed := s.handshake.lastMethod() == base.Describe &&
+		res.StatusCode >= base.StatusMovedPermanently && res.StatusCode <= base.StatusUseProxy
+	if followed {
+		if u, err := base.ParseURL(res.Header["Location"][0]); err == nil {
+			// the client dials the location next
+			s.mu.Lock()
+			s.dialScheme = u.Scheme
+			s.mu.Unlock()
+			if chain := s.redirectTo(location); chain != "" {
+				s.mu.Lock()
+				s.redirectsOver = chain
+				closeClient := s.closeClient
+				s.mu.Unlock()
+				if closeClient != nil {
+					go closeClient()
+				}
+			}
+			return
+		}
+	}
+	if s.cfg.maxRedirects == 0 {
+		return
+	}
+	s.mu.Lock()
+	s.redirect = location
+	s.mu.Unlock()
+}
+
+// onRedirectRequest closes the client of a session the server redirects while playing,
+// so that the session plays the new location. The client is closed in the background.
+func (s *session) onRedirectRequest(closeClient func(), req *base.Request) {
+	if s.cfg.maxRedirects == 0 || s.publisher() {
+		s.logf("REDIRECT of the server is not followed, -max-redirects is 0")
+		return
+	}
+	location, ok := s.redirectLocation(req.Header)
+	if !ok {
+		s.logf("REDIRECT of the server without a valid Location, ignored")
+		return
+	}
+	s.mu.Lock()
+	s.redirect = location
+	s.mu.Unlock()
+	go closeClient()
+}
+
+// takeRedirect returns the location the session is redirected to, empty if none, and clears it.
+func (s *session) takeRedirect() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	location := s.redirect
+	s.redirect = ""
+	return location
+}
+
+// redirectLocation returns the Location header of a redirect, resolved against the url of the session.
+func (s *session) redirectLocation(h base.Header) (string, bool) {
+	v, ok := h["Location"]
+	if !ok || len(v) != 1 {
+		return "", false
+	}
+	ref, err := url.Parse(strings.TrimSpace(v[0]))
+	if err != nil {
+		return "", false
+	}
+	s.mu.Lock()
+	cur, err := url.Parse(s.url)
+	s.mu.Unlock()
+	if err != nil {
+		return "", false
+	}
+	u := cur.ResolveReference(ref)
+	if u.Scheme != "rtsp" && u.Scheme != "rtsps" {
+		return "", false
+	}
+	return u.String(), true
+}
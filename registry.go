@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// registry holds the running sessions.
+type registry struct {
+	mu        sync.Mutex
+	sessions  map[string]*session
+	snapshots map[string]*sessionSnapshot
+}
+
+func newRegistry() *registry {
+	return &registry{
+		sessions:  make(map[string]*session),
+		snapshots: make(map[string]*sessionSnapshot),
+	}
+}
+
+func (r *registry) add(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[s.id] = s
+}
+
+func (r *registry) remove(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sessions[s.id] == s {
+		delete(r.sessions, s.id)
+		delete(r.snapshots, s.id)
+	}
+}
+
+func (r *registry) get(id string) *session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sessions[id]
+}
+
+// list returns the running sessions sorted by id.
+func (r *registry) list() []*session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l := make([]*session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		l = append(l, s)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].id < l[j].id })
+	return l
+}
+
+// takeSnapshot returns a new snapshot of the session and the previous one taken, if any.
+func (r *registry) takeSnapshot(s *session) (cur, prev *sessionSnapshot) {
+	cur = s.snapshot()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev = r.snapshots[s.id]
+	r.snapshots[s.id] = cur
+	return cur, prev
+}
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	texttemplate "text/template"
+	"time"
+)
+
+func init() {
+	registerFeature("report")
+}
+
+// sessionResult is the result of a finished session, kept for the report.
+type sessionResult struct {
+	ID      string
+	URL     string
+	Err     string
+	Failure string
+	Final   *sessionSnapshot
+}
+
+// bitrateSample is the bitrate of all the sessions of a run in a second.
+type bitrateSample struct {
+	Time    time.Time
+	Bitrate bitrate
+}
+
+// reportCollector collects the data of the run report.
+type reportCollector struct {
+	start   time.Time
+	rxBytes uint64
+
+	mu      sync.Mutex
+	results []sessionResult
+	samples []bitrateSample
+
+	resources []resourceSample
+}
+
+func (rc *reportCollector) addBytes(n int) {
+	atomic.AddUint64(&rc.rxBytes, uint64(n))
+}
+
+func (rc *reportCollector) addResult(s *session, err error) {
+	res := sessionResult{ID: s.id, URL: s.url, Final: s.snapshot()}
+	if err != nil {
+		res.Err = err.Error()
+		res.Failure = s.failure
+		if res.Failure == "" {
+			res.Failure = "other"
+		}
+	}
+	rc.mu.Lock()
+	rc.results = append(rc.results, res)
+	rc.mu.Unlock()
+}
+
+// sampleBitrate samples the bitrate every bitrateWindow until the returned func is called.
+func (rc *reportCollector) sampleBitrate() func() {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(bitrateWindow)
+		defer t.Stop()
+		last := atomic.LoadUint64(&rc.rxBytes)
+		for {
+			select {
+			case now := <-t.C:
+				cur := atomic.LoadUint64(&rc.rxBytes)
+				rc.mu.Lock()
+				rc.samples = append(rc.samples, bitrateSample{
+					Time:    now,
+					Bitrate: bitrate(float64(cur-last) * 8 / bitrateWindow.Seconds()),
+				})
+				rc.mu.Unlock()
+				last = cur
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// latencyBuckets are the upper bounds of the latency histogram buckets.
+var latencyBuckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second,
+}
+
+type reportBucket struct {
+	Label string
+	Count int
+}
+
+type reportLatency struct {
+	Phase              string
+	Count              int
+	P50, P95, P99, Max string
+	Histogram          []reportBucket
+}
+
+type reportError struct {
+	Failure string
+	Count   int
+	Example string
+}
+
+type reportURL struct {
+	URL       string
+	Sessions  int
+	Failed    int
+	Bitrate   string
+	Bytes     string
+	Lost      int64
+	Handshake string
+}
+
+type reportData struct {
+	Title     string
+	Name      string
+	URL       string
+	Transport string
+	// labels of -test-id and -label
+	Labels string
+	// warm-up of -warmup excluded from the results, and the start of the measurement
+	Warmup   string
+	Measured string
+	Start    string
+	End      string
+	Duration string
+	Sessions int
+	Running  int
+	Failed   int
+	// retries of -retry-attempts, the retried sessions that started and those given up
+	Retries   int64
+	Recovered int64
+	GivenUp   int64
+	// why the report is partial, empty if the run ended
+	Partial   string
+	Latency   []reportLatency
+	GC        reportGC
+	Resources reportResources
+	Bitrate   []bitrateSample
+	MaxRate   string
+	Errors    []reportError
+	URLs      []reportURL
+	// trends of -soak-interval
+	Leaks []leakFinding
+}
+
+// reportGC is the GC pauses of the run, to tell the delays caused by the tool itself.
+type reportGC struct {
+	Cycles int64
+	Total  string
+	P50    string
+	P99    string
+	Max    string
+	Heap   string
+}
+
+func histogram(samples []time.Duration) []reportBucket {
+	buckets := make([]reportBucket, len(latencyBuckets)+1)
+	for i, b := range latencyBuckets {
+		if i == 0 {
+			buckets[i].Label = "<" + b.String()
+		} else {
+			buckets[i].Label = latencyBuckets[i-1].String() + "-" + b.String()
+		}
+	}
+	buckets[len(latencyBuckets)].Label = "≥" + latencyBuckets[len(latencyBuckets)-1].String()
+	for _, d := range samples {
+		i := sort.Search(len(latencyBuckets), func(i int) bool { return d < latencyBuckets[i] })
+		buckets[i].Count++
+	}
+	return buckets
+}
+
+func (r *run) reportData(end time.Time, partial string) *reportData {
+	h := r.cfg.human()
+	rc := r.report
+
+	rc.mu.Lock()
+	results := append([]sessionResult(nil), rc.results...)
+	var samples []bitrateSample
+	for _, s := range rc.samples {
+		if !r.warmingUp(s.Time) {
+			samples = append(samples, s)
+		}
+	}
+	var resources []resourceSample
+	for _, s := range rc.resources {
+		if !r.warmingUp(s.Time) {
+			resources = append(resources, s)
+		}
+	}
+	rc.mu.Unlock()
+	// the sessions in progress of a partial report
+	running := r.sessions.list()
+	for _, s := range running {
+		results = append(results, sessionResult{ID: s.id, URL: s.url, Final: s.snapshot()})
+	}
+
+	d := &reportData{
+		Title:     r.cfg.tr("rtspclient test report"),
+		Name:      r.name,
+		URL:       r.cfg.url,
+		Transport: r.cfg.transport,
+		Labels:    r.cfg.runLabels().String(),
+		Start:     timestamp(rc.start),
+		End:       timestamp(end),
+		Duration:  h.duration(end.Sub(rc.start)),
+		Sessions:  len(results),
+		Running:   len(running),
+		Partial:   partial,
+		Bitrate:   samples,
+	}
+
+	if r.cfg.warmup > 0 {
+		d.Warmup, d.Measured = h.duration(r.cfg.warmup), timestamp(r.warmupEnd)
+	}
+	if r.retry != nil {
+		d.Retries, d.Recovered, d.GivenUp = r.retry.stats()
+	}
+
+	var maxRate bitrate
+	for _, s := range samples {
+		if s.Bitrate > maxRate {
+			maxRate = s.Bitrate
+		}
+	}
+	d.MaxRate = h.bitrate(maxRate)
+	d.Resources = newReportResources(h, resources)
+	if r.soak != nil {
+		d.Leaks = r.soak.findings(h)
+	}
+
+	gc := r.gcSince()
+	d.GC = reportGC{Cycles: gc.Cycles, Total: h.duration(gc.Total), P50: h.duration(gc.P50),
+		P99: h.duration(gc.P99), Max: h.duration(gc.Max), Heap: h.bytes(gc.HeapSys)}
+
+	pcts := r.latency.percentiles()
+	all := r.latency.samplesCopy()
+	phases := append([]string(nil), handshakePhases...)
+	var others []string
+	for p := range pcts {
+		if isTimeToPhase(p) {
+			others = append(others, p)
+		}
+	}
+	sort.Strings(others)
+	for _, p := range append(phases, others...) {
+		lp, ok := pcts[p]
+		if !ok {
+			continue
+		}
+		d.Latency = append(d.Latency, reportLatency{
+			Phase:     p,
+			Count:     lp.Count,
+			P50:       h.duration(time.Duration(lp.P50)),
+			P95:       h.duration(time.Duration(lp.P95)),
+			P99:       h.duration(time.Duration(lp.P99)),
+			Max:       h.duration(time.Duration(lp.Max)),
+			Histogram: histogram(all[p]),
+		})
+	}
+
+	errs := make(map[string]*reportError)
+	type urlAcc struct {
+		reportURL
+		bitrate   bitrate
+		bytes     uint64
+		handshake time.Duration
+	}
+	urls := make(map[string]*urlAcc)
+	for _, res := range results {
+		u := urls[res.URL]
+		if u == nil {
+			u = &urlAcc{reportURL: reportURL{URL: res.URL}}
+			urls[res.URL] = u
+		}
+		u.Sessions++
+		if res.Err != "" {
+			d.Failed++
+			u.Failed++
+			e := errs[res.Failure]
+			if e == nil {
+				e = &reportError{Failure: res.Failure, Example: res.Err}
+				errs[res.Failure] = e
+			}
+			e.Count++
+		}
+		if res.Final != nil {
+			u.bitrate += res.Final.Bitrate.Average
+			u.bytes += res.Final.Bytes
+			for _, t := range res.Final.Tracks {
+				u.Lost += t.Lost
+			}
+			for _, ph := range res.Final.Handshake {
+				u.handshake += time.Duration(ph)
+			}
+		}
+	}
+	for _, e := range errs {
+		d.Errors = append(d.Errors, *e)
+	}
+	sort.Slice(d.Errors, func(i, j int) bool { return d.Errors[i].Count > d.Errors[j].Count })
+	for _, u := range urls {
+		u.Bitrate = h.bitrate(u.bitrate / bitrate(u.Sessions))
+		u.Bytes = h.bytes(u.bytes)
+		u.Handshake = h.duration(u.handshake / time.Duration(u.Sessions))
+		d.URLs = append(d.URLs, u.reportURL)
+	}
+	sort.Slice(d.URLs, func(i, j int) bool { return d.URLs[i].URL < d.URLs[j].URL })
+	return d
+}
+
+// histogramSVG renders a latency histogram as an inline SVG bar chart.
+func histogramSVG(buckets []reportBucket) htmltemplate.HTML {
+	const w, h, labelH = 640, 140, 40
+	max := 0
+	for _, b := range buckets {
+		if b.Count > max {
+			max = b.Count
+		}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">`, w, h+labelH)
+	bw := w / len(buckets)
+	for i, b := range buckets {
+		bh := 0
+		if max > 0 {
+			bh = b.Count * (h - 14) / max
+		}
+		x := i * bw
+		fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="%d" height="%d" fill="#4e79a7"><title>%s: %d</title></rect>`,
+			x+2, h-bh, bw-4, bh, htmltemplate.HTMLEscapeString(b.Label), b.Count)
+		if b.Count > 0 {
+			fmt.Fprintf(&sb, `<text x="%d" y="%d" font-size="10" text-anchor="middle">%d</text>`, x+bw/2, h-bh-2, b.Count)
+		}
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" font-size="9" text-anchor="middle">%s</text>`,
+			x+bw/2, h+14+(i%2)*12, htmltemplate.HTMLEscapeString(b.Label))
+	}
+	sb.WriteString(`</svg>`)
+	return htmltemplate.HTML(sb.String())
+}
+
+// bitrateSVG renders the bitrate samples as an inline SVG line chart.
+func bitrateSVG(samples []bitrateSample) htmltemplate.HTML {
+	const w, h = 640, 160
+	if len(samples) < 2 {
+		return ""
+	}
+	var max bitrate
+	for _, s := range samples {
+		if s.Bitrate > max {
+			max = s.Bitrate
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">`, w, h)
+	sb.WriteString(`<polyline fill="none" stroke="#e15759" stroke-width="1.5" points="`)
+	for i, s := range samples {
+		x := float64(i) * float64(w) / float64(len(samples)-1)
+		y := float64(h) - float64(s.Bitrate)/float64(max)*float64(h-4)
+		fmt.Fprintf(&sb, "%.1f,%.1f ", x, y)
+	}
+	sb.WriteString(`"/></svg>`)
+	return htmltemplate.HTML(sb.String())
+}
+
+// textBar renders a count as a bar of the markdown report.
+func textBar(count int, buckets []reportBucket) string {
+	max := 0
+	for _, b := range buckets {
+		if b.Count > max {
+			max = b.Count
+		}
+	}
+	if max == 0 {
+		return ""
+	}
+	return strings.Repeat("█", (count*30+max-1)/max)
+}
+
+// downsample returns at most n samples, averaging neighbors.
+func downsample(samples []bitrateSample, n int) []bitrateSample {
+	if len(samples) <= n {
+		return samples
+	}
+	ret := make([]bitrateSample, 0, n)
+	step := float64(len(samples)) / float64(n)
+	for i := 0; i < n; i++ {
+		from, to := int(float64(i)*step), int(float64(i+1)*step)
+		var sum bitrate
+		for _, s := range samples[from:to] {
+			sum += s.Bitrate
+		}
+		ret = append(ret, bitrateSample{Time: samples[from].Time, Bitrate: sum / bitrate(to-from)})
+	}
+	return ret
+}
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; }
+</style></head><body>
+<h1>{{.Title}}{{if .Name}} - {{.Name}}{{end}}</h1>
+{{if .Partial}}<p><b>{{tr "partial results"}}</b>: {{.Partial}}</p>
+{{end}}<table>
+<tr><th>{{tr "url"}}</th><td>{{.URL}}</td></tr>
+<tr><th>{{tr "transport"}}</th><td>{{.Transport}}</td></tr>
+{{if .Labels}}<tr><th>{{tr "labels"}}</th><td>{{.Labels}}</td></tr>
+{{end}}{{if .Warmup}}<tr><th>{{tr "warm-up"}}</th><td>{{.Warmup}}, {{tr "excluded, measured from"}} {{.Measured}}</td></tr>
+{{end}}<tr><th>{{tr "start"}}</th><td>{{.Start}}</td></tr>
+<tr><th>{{tr "end"}}</th><td>{{.End}}</td></tr>
+<tr><th>{{tr "duration"}}</th><td>{{.Duration}}</td></tr>
+<tr><th>{{tr "sessions"}}</th><td>{{.Sessions}}</td></tr>
+{{if .Running}}<tr><th>{{tr "running"}}</th><td>{{.Running}}</td></tr>
+{{end}}<tr><th>{{tr "failed"}}</th><td>{{.Failed}}</td></tr>
+{{if .Retries}}<tr><th>{{tr "retries"}}</th><td>{{.Retries}}, {{tr "recovered"}} {{.Recovered}}, {{tr "given up"}} {{.GivenUp}}</td></tr>
+{{end}}</table>
+
+<h2>{{tr "latency"}}</h2>
+{{range .Latency}}
+<h3>{{.Phase}}</h3>
+<p>{{tr "count"}} {{.Count}}, p50 {{.P50}}, p95 {{.P95}}, p99 {{.P99}}, {{tr "max"}} {{.Max}}</p>
+{{histogram .Histogram}}
+{{end}}
+
+<h2>GC</h2>
+<p>{{tr "cycles"}} {{.GC.Cycles}}, {{tr "pause total"}} {{.GC.Total}}, p50 {{.GC.P50}}, p99 {{.GC.P99}}, {{tr "max"}} {{.GC.Max}}, heap {{.GC.Heap}}</p>
+
+<h2>{{tr "bitrate over time"}}</h2>
+<p>{{tr "max"}} {{.MaxRate}}</p>
+{{bitrateChart .Bitrate}}
+
+<h2>{{tr "resource usage"}}</h2>
+{{with .Resources}}
+<p>cpu {{tr "max"}} {{.MaxCPU}} ({{.CPUs}} cores), rss {{tr "max"}} {{.MaxRSS}}, goroutines {{tr "max"}} {{.MaxGoroutines}}, fds {{tr "max"}} {{fds .MaxFDs}}</p>
+<h3>cpu</h3>
+{{resourceChart .Samples "cpu"}}
+<h3>rss</h3>
+{{resourceChart .Samples "rss"}}
+<h3>goroutines</h3>
+{{resourceChart .Samples "goroutines"}}
+<h3>fds</h3>
+{{resourceChart .Samples "fds"}}
+{{end}}
+
+{{if .Leaks}}
+<h2>{{tr "leak detection"}}</h2>
+<table><tr><th>{{tr "metric"}}</th><th>{{tr "samples"}}</th><th>{{tr "first"}}</th><th>{{tr "last"}}</th><th>{{tr "slope per hour"}}</th><th></th></tr>
+{{range .Leaks}}<tr><td>{{.Metric}}</td><td>{{.Samples}}</td><td>{{.First}}</td><td>{{.Last}}</td><td>{{.Slope}}</td><td>{{if .Suspected}}<b>{{tr "suspected leak"}}</b>{{else}}{{tr "stable"}}{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>{{tr "errors"}}</h2>
+{{if .Errors}}
+<table><tr><th>{{tr "failure"}}</th><th>{{tr "count"}}</th><th>{{tr "example"}}</th></tr>
+{{range .Errors}}<tr><td>{{.Failure}}</td><td>{{.Count}}</td><td>{{.Example}}</td></tr>
+{{end}}</table>
+{{else}}<p>{{tr "none"}}</p>{{end}}
+
+<h2>{{tr "urls"}}</h2>
+<table><tr><th>{{tr "url"}}</th><th>{{tr "sessions"}}</th><th>{{tr "failed"}}</th><th>{{tr "avg bitrate"}}</th><th>{{tr "bytes"}}</th><th>{{tr "lost"}}</th><th>{{tr "avg handshake"}}</th></tr>
+{{range .URLs}}<tr><td>{{.URL}}</td><td>{{.Sessions}}</td><td>{{.Failed}}</td><td>{{.Bitrate}}</td><td>{{.Bytes}}</td><td>{{.Lost}}</td><td>{{.Handshake}}</td></tr>
+{{end}}</table>
+</body></html>
+`
+
+const markdownReportTemplate = `# {{.Title}}{{if .Name}} - {{.Name}}{{end}}
+{{if .Partial}}
+> **{{tr "partial results"}}**: {{md .Partial}}
+{{end}}
+| | |
+|---|---|
+| {{tr "url"}} | {{.URL}} |
+| {{tr "transport"}} | {{.Transport}} |
+{{if .Labels}}| {{tr "labels"}} | {{md .Labels}} |
+{{end}}{{if .Warmup}}| {{tr "warm-up"}} | {{.Warmup}}, {{tr "excluded, measured from"}} {{.Measured}} |
+{{end}}| {{tr "start"}} | {{.Start}} |
+| {{tr "end"}} | {{.End}} |
+| {{tr "duration"}} | {{.Duration}} |
+| {{tr "sessions"}} | {{.Sessions}} |
+{{if .Running}}| {{tr "running"}} | {{.Running}} |
+{{end}}| {{tr "failed"}} | {{.Failed}} |
+{{if .Retries}}| {{tr "retries"}} | {{.Retries}}, {{tr "recovered"}} {{.Recovered}}, {{tr "given up"}} {{.GivenUp}} |
+{{end}}
+## {{tr "latency"}}
+{{range .Latency}}{{$h := .Histogram}}
+### {{.Phase}}
+
+{{tr "count"}} {{.Count}}, p50 {{.P50}}, p95 {{.P95}}, p99 {{.P99}}, {{tr "max"}} {{.Max}}
+
+| | {{tr "count"}} | |
+|---|---|---|
+{{range .Histogram}}| {{.Label}} | {{.Count}} | {{bar .Count $h}} |
+{{end}}{{end}}
+## GC
+
+{{tr "cycles"}} {{.GC.Cycles}}, {{tr "pause total"}} {{.GC.Total}}, p50 {{.GC.P50}}, p99 {{.GC.P99}}, {{tr "max"}} {{.GC.Max}}, heap {{.GC.Heap}}
+
+## {{tr "bitrate over time"}}
+
+| {{tr "time"}} | {{tr "bitrate"}} |
+|---|---|
+{{range downsample .Bitrate 60}}| {{ts .Time}} | {{rate .Bitrate}} |
+{{end}}
+## {{tr "resource usage"}}
+{{with .Resources}}
+cpu {{tr "max"}} {{.MaxCPU}} ({{.CPUs}} cores), rss {{tr "max"}} {{.MaxRSS}}, goroutines {{tr "max"}} {{.MaxGoroutines}}, fds {{tr "max"}} {{fds .MaxFDs}}
+
+| {{tr "time"}} | cpu | rss | goroutines | fds |
+|---|---|---|---|---|
+{{range downsampleResources .Samples 60}}| {{ts .Time}} | {{pct .CPU}} | {{size .RSS}} | {{.Goroutines}} | {{fds .FDs}} |
+{{end}}{{end}}{{if .Leaks}}
+## {{tr "leak detection"}}
+
+| {{tr "metric"}} | {{tr "samples"}} | {{tr "first"}} | {{tr "last"}} | {{tr "slope per hour"}} | |
+|---|---|---|---|---|---|
+{{range .Leaks}}| {{.Metric}} | {{.Samples}} | {{.First}} | {{.Last}} | {{.Slope}} | {{if .Suspected}}**{{tr "suspected leak"}}**{{else}}{{tr "stable"}}{{end}} |
+{{end}}{{end}}
+## {{tr "errors"}}
+{{if .Errors}}
+| {{tr "failure"}} | {{tr "count"}} | {{tr "example"}} |
+|---|---|---|
+{{range .Errors}}| {{.Failure}} | {{.Count}} | {{md .Example}} |
+{{end}}{{else}}
+{{tr "none"}}
+{{end}}
+## {{tr "urls"}}
+
+| {{tr "url"}} | {{tr "sessions"}} | {{tr "failed"}} | {{tr "avg bitrate"}} | {{tr "bytes"}} | {{tr "lost"}} | {{tr "avg handshake"}} |
+|---|---|---|---|---|---|---|
+{{range .URLs}}| {{.URL}} | {{.Sessions}} | {{.Failed}} | {{.Bitrate}} | {{.Bytes}} | {{.Lost}} | {{.Handshake}} |
+{{end}}`
+
+// writeReport writes the report of the run, markdown if the file extension is .md, html otherwise.
+// partial is why the run has not ended.
+func (r *run) writeReport(path string, end time.Time, partial string) error {
+	d := r.reportData(end, partial)
+	h := r.cfg.human()
+
+	var buf bytes.Buffer
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".md" || ext == ".markdown" {
+		t, err := texttemplate.New("report").Funcs(texttemplate.FuncMap{
+			"tr":         r.cfg.tr,
+			"bar":        textBar,
+			"downsample": downsample,
+			"ts":         timestamp,
+			"rate":       h.bitrate,
+			"md":         func(s string) string { return strings.ReplaceAll(s, "|", `\|`) },
+
+			"downsampleResources": downsampleResources,
+			"pct":                 func(v float64) string { return h.float(v) + "%" },
+			"size":                h.bytes,
+			"fds":                 formatFDs,
+		}).Parse(markdownReportTemplate)
+		if err != nil {
+			return err
+		}
+		if err := t.Execute(&buf, d); err != nil {
+			return err
+		}
+	} else {
+		t, err := htmltemplate.New("report").Funcs(htmltemplate.FuncMap{
+			"tr":           r.cfg.tr,
+			"histogram":    histogramSVG,
+			"bitrateChart": bitrateSVG,
+
+			"resourceChart": resourceSVG,
+			"fds":           formatFDs,
+		}).Parse(htmlReportTemplate)
+		if err != nil {
+			return err
+		}
+		if err := t.Execute(&buf, d); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// writeFileAtomic replaces the file with a renamed temporary file,
+// the file is never left half written by a killed process.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
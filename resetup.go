@@ -0,0 +1,96 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+)
+
+func init() {
+	registerFeature("resetup")
+}
+
+// onSessionNotFound closes the client of a playing session whose server answered 454 Session Not Found
+// (ex) to a keepalive after the server expired the session), so that the session is set up again.
+// It is called by the client, which is closed in the background.
+func (s *session) onSessionNotFound(c *gortsplib.Client, res *base.Response) {
+	s.mu.Lock()
+	if s.state != statePlaying || s.sessionLost {
+		s.mu.Unlock()
+		return
+	}
+	s.sessionLost = true
+	last := s.lastPacket
+	s.mu.Unlock()
+	since := "no packet"
+	if !last.IsZero() {
+		since = "last packet " + s.cfg.human().duration(time.Since(last)) + " ago"
+	}
+	s.logf("session not found (%d %s), setting up again, %s", res.StatusCode, res.StatusMessage, since)
+	go c.Close()
+}
+
+// takeSessionLost tells if the client was closed by onSessionNotFound, and clears it.
+func (s *session) takeSessionLost() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lost := s.sessionLost
+	s.sessionLost = false
+	return lost
+}
+
+// resetup sets up the medias of the description again with a new client and plays them,
+// the outputs and the statistics of the session continue. The time until the next packet
+// is counted as a continuity break, apart from the stalls of the network.
+// It returns a nil client if the session was torn down.
+func (s *session) resetup(u *base.URL, desc *description.Session, feats []rtcpFeatures) (*gortsplib.Client, error) {
+	s.mu.Lock()
+	s.breakSince = s.lastPacket
+	if s.breakSince.IsZero() {
+		s.breakSince = time.Now()
+	}
+	s.mu.Unlock()
+
+	s.setState(stateConnecting)
+	c := s.newClient()
+	if err := s.startClient(c, u); err != nil {
+		return nil, s.errorf("failed to start client, %v", err)
+	}
+	s.mu.Lock()
+	s.closeClient = c.Close
+	tornDown := s.tornDown
+	s.mu.Unlock()
+	if tornDown {
+		c.Close()
+		return nil, nil
+	}
+
+	s.setState(stateSettingUp)
+	if err := s.setupMedias(c, desc, feats); err != nil {
+		c.Close()
+		return nil, err
+	}
+	s.dc.reset()
+	s.onPackets(c)
+	s.setState(stateStarting)
+	if _, err := c.Play(nil); err != nil {
+		c.Close()
+		return nil, s.errorf("failed to play, %v", err)
+	}
+	s.mu.Lock()
+	s.breaks++
+	breaks := s.breaks
+	s.mu.Unlock()
+	s.logf("success to play again, continuity break %d", breaks)
+	s.setState(statePlaying)
+	return c, nil
+}
+
+// reset forgets the timestamps of the stream, a new RTP session starts.
+func (dc *DelayChecker) reset() {
+	dc.mu.Lock()
+	dc.lastTS, dc.lastT, dc.checkedTS = 0, time.Time{}, 0
+	dc.mu.Unlock()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+func init() {
+	registerFeature("dns-control")
+}
+
+// the modes of -resolve-mode
+const (
+	// the host names are resolved by each connection, as the system does
+	resolveSystem = "system"
+	// resolved once, all the sessions connect to the first address
+	resolveOnce = "once"
+	// resolved by each session, that connects to the first address
+	resolveSession = "session"
+	// resolved once, the sessions connect to all the addresses in turn
+	resolveRoundRobin = "round-robin"
+)
+
+// resolvePins are the addresses of -resolve by host name.
+type resolvePins map[string]net.IP
+
+func (p resolvePins) String() string {
+	var l []string
+	for host, ip := range p {
+		l = append(l, host+":"+ip.String())
+	}
+	sort.Strings(l)
+	return strings.Join(l, ",")
+}
+
+// Set implements flag.Value, s is "host:ip", comma separated, it can be repeated.
+func (p *resolvePins) Set(s string) error {
+	for _, pin := range strings.Split(s, ",") {
+		host, addr, ok := strings.Cut(strings.TrimSpace(pin), ":")
+		ip := net.ParseIP(strings.Trim(addr, "[]"))
+		if !ok || host == "" || ip == nil {
+			return fmt.Errorf("invalid %q, should be host:ip", pin)
+		}
+		if *p == nil {
+			*p = make(resolvePins)
+		}
+		(*p)[strings.ToLower(host)] = ip
+	}
+	return nil
+}
+
+// resolver chooses the server address each session connects to by -resolve-mode and -resolve,
+// to spread the load over the servers behind a DNS name, or to focus it on one, deterministically.
+// A session keeps its address when it connects again.
+type resolver struct {
+	mode   string
+	pins   resolvePins
+	family string
+
+	mu sync.Mutex
+	// addresses by host name of the modes resolving once
+	addrs map[string][]net.IP
+	next  map[string]int
+	// sessions by host name and address
+	picks map[string]map[string]int
+}
+
+func newResolver(cfg *config) *resolver {
+	return &resolver{
+		mode:   cfg.resolveMode,
+		pins:   cfg.resolvePins,
+		family: cfg.ipFamily(),
+		addrs:  make(map[string][]net.IP),
+		next:   make(map[string]int),
+		picks:  make(map[string]map[string]int),
+	}
+}
+
+// lookup returns the addresses of host of the family of -force-ipv4 or -force-ipv6.
+func (rs *resolver) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip"+rs.family, host)
+	if err == nil && len(ips) == 0 {
+		err = fmt.Errorf("no address of %s", host)
+	}
+	return ips, err
+}
+
+// pick returns the address to connect to for host, nil to let the dialer resolve it.
+func (rs *resolver) pick(ctx context.Context, host string) (net.IP, error) {
+	if ip := rs.pins[strings.ToLower(host)]; ip != nil {
+		return ip, nil
+	}
+	if net.ParseIP(host) != nil {
+		return nil, nil
+	}
+	switch rs.mode {
+	case resolveSession:
+		ips, err := rs.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		return ips[0], nil
+	case resolveOnce, resolveRoundRobin:
+		rs.mu.Lock()
+		ips := rs.addrs[host]
+		rs.mu.Unlock()
+		if ips == nil {
+			var err error
+			if ips, err = rs.lookup(ctx, host); err != nil {
+				return nil, err
+			}
+		}
+		rs.mu.Lock()
+		defer rs.mu.Unlock()
+		if rs.addrs[host] == nil {
+			rs.addrs[host] = ips
+		}
+		ips = rs.addrs[host]
+		if rs.mode == resolveOnce {
+			return ips[0], nil
+		}
+		ip := ips[rs.next[host]%len(ips)]
+		rs.next[host]++
+		return ip, nil
+	}
+	return nil, nil
+}
+
+// address returns the host:port to dial for address, resolved by sticky once and kept there.
+func (rs *resolver) address(ctx context.Context, address string, sticky map[string]net.IP) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	ip := sticky[host]
+	if ip == nil {
+		if ip, err = rs.pick(ctx, host); err != nil || ip == nil {
+			return address, err
+		}
+		if sticky != nil {
+			sticky[host] = ip
+			rs.mu.Lock()
+			if rs.picks[host] == nil {
+				rs.picks[host] = make(map[string]int)
+			}
+			rs.picks[host][ip.String()]++
+			rs.mu.Unlock()
+		}
+	}
+	return net.JoinHostPort(ip.String(), port), nil
+}
+
+// logResolved logs the sessions by address of each host name resolved by the run.
+func (r *run) logResolved() {
+	r.resolver.mu.Lock()
+	defer r.resolver.mu.Unlock()
+	hosts := make([]string, 0, len(r.resolver.picks))
+	for host := range r.resolver.picks {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		ips := make([]string, 0, len(r.resolver.picks[host]))
+		for ip := range r.resolver.picks[host] {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+		for _, ip := range ips {
+			r.logger.Printf(r.cfg.tr("resolve %s: %s sessions %d"), host, ip, r.resolver.picks[host][ip])
+		}
+	}
+}
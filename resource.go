@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerFeature("resource-timeline")
+}
+
+// resourceInterval is the interval of the resource usage samples of the report.
+const resourceInterval = 5 * time.Second
+
+// resourceSample is the resource usage of the tool itself,
+// to confirm the load generator was not the bottleneck of a run.
+type resourceSample struct {
+	Time time.Time
+	// CPU usage since the previous sample, 100 is a core
+	CPU        float64
+	RSS        uint64
+	Goroutines int
+	// -1 if unknown
+	FDs int
+}
+
+// sampleResources samples the resource usage every resourceInterval until the returned func is called.
+func (rc *reportCollector) sampleResources() func() {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(resourceInterval)
+		defer t.Stop()
+		lastTime, lastCPU := time.Now(), processCPU()
+		for {
+			select {
+			case now := <-t.C:
+				cpu := processCPU()
+				s := resourceSample{
+					Time:       now,
+					CPU:        float64(cpu-lastCPU) / float64(now.Sub(lastTime)) * 100,
+					RSS:        processRSS(),
+					Goroutines: runtime.NumGoroutine(),
+					FDs:        processFDs(),
+				}
+				rc.mu.Lock()
+				rc.resources = append(rc.resources, s)
+				rc.mu.Unlock()
+				lastTime, lastCPU = now, cpu
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// reportResources is the summary of the resource usage of the report.
+type reportResources struct {
+	CPUs          int
+	MaxCPU        string
+	MaxRSS        string
+	MaxGoroutines int
+	MaxFDs        int
+	Samples       []resourceSample
+}
+
+func newReportResources(h humanizer, samples []resourceSample) reportResources {
+	rr := reportResources{CPUs: runtime.NumCPU(), MaxFDs: -1, Samples: samples}
+	var maxCPU float64
+	var maxRSS uint64
+	for _, s := range samples {
+		if s.CPU > maxCPU {
+			maxCPU = s.CPU
+		}
+		if s.RSS > maxRSS {
+			maxRSS = s.RSS
+		}
+		if s.Goroutines > rr.MaxGoroutines {
+			rr.MaxGoroutines = s.Goroutines
+		}
+		if s.FDs > rr.MaxFDs {
+			rr.MaxFDs = s.FDs
+		}
+	}
+	rr.MaxCPU = h.float(maxCPU) + "%"
+	rr.MaxRSS = h.bytes(maxRSS)
+	return rr
+}
+
+// downsampleResources returns at most n samples, the maximums of consecutive samples,
+// so that the peaks remain.
+func downsampleResources(samples []resourceSample, n int) []resourceSample {
+	if len(samples) <= n {
+		return samples
+	}
+	ret := make([]resourceSample, 0, n)
+	step := float64(len(samples)) / float64(n)
+	for i := 0; i < n; i++ {
+		from, to := int(float64(i)*step), int(float64(i+1)*step)
+		m := samples[from]
+		for _, s := range samples[from+1 : to] {
+			if s.CPU > m.CPU {
+				m.CPU = s.CPU
+			}
+			if s.RSS > m.RSS {
+				m.RSS = s.RSS
+			}
+			if s.Goroutines > m.Goroutines {
+				m.Goroutines = s.Goroutines
+			}
+			if s.FDs > m.FDs {
+				m.FDs = s.FDs
+			}
+		}
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+func formatFDs(n int) string {
+	if n < 0 {
+		return "-"
+	}
+	return strconv.Itoa(n)
+}
+
+// resourceSVG draws the timeline of a resource, field is cpu, rss, goroutines or fds.
+func resourceSVG(samples []resourceSample, field string) htmltemplate.HTML {
+	const w, h = 640, 80
+	if len(samples) < 2 {
+		return ""
+	}
+	values := make([]float64, len(samples))
+	max := 1.0
+	for i, s := range samples {
+		switch field {
+		case "cpu":
+			values[i] = s.CPU
+		case "rss":
+			values[i] = float64(s.RSS)
+		case "goroutines":
+			values[i] = float64(s.Goroutines)
+		case "fds":
+			values[i] = float64(s.FDs)
+		}
+		if values[i] > max {
+			max = values[i]
+		}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">`, w, h)
+	sb.WriteString(`<polyline fill="none" stroke="#4e79a7" stroke-width="1.5" points="`)
+	for i, v := range values {
+		x := float64(i) * float64(w) / float64(len(values)-1)
+		y := float64(h) - v/max*float64(h-4)
+		fmt.Fprintf(&sb, "%.1f,%.1f ", x, y)
+	}
+	sb.WriteString(`"/></svg>`)
+	return htmltemplate.HTML(sb.String())
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import "time"
+
+// processCPU returns the CPU time used by the process, only supported on Linux.
+func processCPU() time.Duration {
+	return 0
+}
+
+// processRSS returns the resident set size of the process, only supported on Linux.
+func processRSS() uint64 {
+	return 0
+}
+
+// processFDs returns the number of open file descriptors, only supported on Linux.
+func processFDs() int {
+	return -1
+}
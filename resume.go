@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerFeature("resume")
+}
+
+// stateFlushInterval is the interval of the writes of -state-file while running.
+const stateFlushInterval = time.Second
+
+// the results of the sessions of -state-file
+const (
+	resultOK     = "ok"
+	resultFailed = "failed"
+)
+
+// runState is the content of -state-file, the sessions finished by a run and the flags they depend on.
+type runState struct {
+	URL   string `json:"url"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Count int    `json:"count"`
+	// results of the finished sessions by id, ok or failed
+	Sessions map[string]string `json:"sessions"`
+}
+
+// stateRecorder records the finished sessions of a run to -state-file,
+// and with -resume skips those finished by the previous runs.
+type stateRecorder struct {
+	path string
+	// writes of the file, in order
+	writeMu sync.Mutex
+
+	mu    sync.Mutex
+	state runState
+	dirty bool
+}
+
+// newStateRecorder returns the recorder of -state-file, loaded from the file with -resume.
+func newStateRecorder(cfg *config) (*stateRecorder, error) {
+	sr := &stateRecorder{
+		path: cfg.stateFile,
+		state: runState{
+			URL:      cfg.url,
+			Start:    cfg.nStart,
+			End:      cfg.nEnd,
+			Count:    cfg.count,
+			Sessions: make(map[string]string),
+		},
+	}
+	if !cfg.resume {
+		return sr, nil
+	}
+	b, err := os.ReadFile(cfg.stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return sr, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st runState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	if st.URL != cfg.url || st.Start != cfg.nStart || st.End != cfg.nEnd || st.Count != cfg.count {
+		return nil, fmt.Errorf("the state is of another run, url %s, start %d, end %d, count %d", st.URL, st.Start, st.End, st.Count)
+	}
+	for id, result := range st.Sessions {
+		sr.state.Sessions[id] = result
+	}
+	return sr, nil
+}
+
+// counts returns the finished sessions by result.
+func (sr *stateRecorder) counts() (ok, failed int) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	for _, result := range sr.state.Sessions {
+		if result == resultOK {
+			ok++
+		} else {
+			failed++
+		}
+	}
+	return ok, failed
+}
+
+// finished returns whether the session of the id has finished.
+func (sr *stateRecorder) finished(id string) bool {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	_, ok := sr.state.Sessions[id]
+	return ok
+}
+
+func (sr *stateRecorder) record(id string, err error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.state.Sessions[id] = resultOK
+	if err != nil {
+		sr.state.Sessions[id] = resultFailed
+	}
+	sr.dirty = true
+}
+
+// flush writes the state file if a session has finished since the last write.
+func (sr *stateRecorder) flush() error {
+	sr.writeMu.Lock()
+	defer sr.writeMu.Unlock()
+	sr.mu.Lock()
+	if !sr.dirty {
+		sr.mu.Unlock()
+		return nil
+	}
+	b, err := json.MarshalIndent(sr.state, "", "  ")
+	sr.dirty = false
+	sr.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(sr.path, append(b, '\n'))
+}
+
+// start writes the state file every stateFlushInterval until the returned func is called.
+func (sr *stateRecorder) start(r *run) func() {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(stateFlushInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := sr.flush(); err != nil {
+					r.logger.Printf("failed to write state file, %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
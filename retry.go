@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	registerFeature("retry")
+}
+
+// retryQueue retries the sessions whose handshake failed -retry-attempts times,
+// after an exponential backoff from -retry-backoff to -retry-max-backoff and at most -retry-rate retries per second.
+type retryQueue struct {
+	cfg *config
+	// nil if unlimited
+	limiter *rateLimiter
+
+	retries   int64
+	recovered int64
+	givenUp   int64
+}
+
+func newRetryQueue(cfg *config) *retryQueue {
+	q := &retryQueue{cfg: cfg}
+	if cfg.retryRate > 0 {
+		q.limiter = newRateLimiter(cfg.retryRate, 1)
+	}
+	return q
+}
+
+// backoff returns the delay before a retry, 1 for the first.
+func (q *retryQueue) backoff(retry int) time.Duration {
+	d := q.cfg.retryBackoff
+	for i := 1; i < retry && d < q.cfg.retryMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.cfg.retryMaxBackoff {
+		d = q.cfg.retryMaxBackoff
+	}
+	return d
+}
+
+// retryable returns whether a session ended by err is retried, the retries before it failed too.
+// Only the failed handshakes are retried, a session that played has started.
+func (q *retryQueue) retryable(s *session, err error, retry int) bool {
+	if err == nil || s.handshakeOK || s.isTornDown() {
+		return false
+	}
+	if retry > q.cfg.retryAttempts {
+		atomic.AddInt64(&q.givenUp, 1)
+		return false
+	}
+	return true
+}
+
+// wait waits for the retry of a session ended by err and returns the session to play again.
+func (q *retryQueue) wait(r *run, s *session, err error, retry int) *session {
+	d := q.backoff(retry)
+	s.logf("retry %d of %d in %v, %v", retry, q.cfg.retryAttempts, d, err)
+	time.Sleep(d)
+	if q.limiter != nil {
+		q.limiter.wait()
+	}
+	atomic.AddInt64(&q.retries, 1)
+	n := r.newSession(s.url, s.id)
+	n.stateKey = s.stateKey
+	return n
+}
+
+// done counts a retried session that has started.
+func (q *retryQueue) done(s *session, retries int) {
+	if retries > 0 && s.handshakeOK {
+		atomic.AddInt64(&q.recovered, 1)
+	}
+}
+
+// stats returns the retries, the retried sessions that started and those given up after -retry-attempts.
+func (q *retryQueue) stats() (retries, recovered, givenUp int64) {
+	return atomic.LoadInt64(&q.retries), atomic.LoadInt64(&q.recovered), atomic.LoadInt64(&q.givenUp)
+}
+
+func (r *run) logRetries() {
+	if r.retry == nil {
+		return
+	}
+	retries, recovered, givenUp := r.retry.stats()
+	r.logger.Printf(r.cfg.tr("retries %d: sessions recovered %d, given up %d"), retries, recovered, givenUp)
+}
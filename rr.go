@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("rtcp-rr")
+}
+
+// rrSender builds RTCP receiver reports of a media from the received RTP
+// packets and sender reports (RFC 3550 6.4.2, A.3, A.8).
+// The reported loss and jitter can be replaced with fabricated values
+// to test how servers react to receiver feedback.
+// Reports are compound packets with a CNAME, unless the media offers reduced-size RTCP.
+type rrSender struct {
+	clockRate   int
+	reducedSize bool
+	ssrc        uint32
+
+	mu           sync.Mutex
+	mediaSSRC    uint32
+	stream       rtpStream
+	lastExp      uint32
+	lastRecv     uint32
+	lastSR       uint32
+	lastSRTime   time.Time
+	injectedLost uint32
+}
+
+func newRRSender(clockRate int, reducedSize bool) *rrSender {
+	return &rrSender{
+		clockRate:   clockRate,
+		reducedSize: reducedSize,
+		ssrc:        rand.Uint32(),
+	}
+}
+
+func (rs *rrSender) onPacketRTP(now time.Time, pkt *rtp.Packet) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if pkt.SSRC != rs.mediaSSRC {
+		rs.mediaSSRC = pkt.SSRC
+		rs.stream = rtpStream{}
+		rs.lastExp = 0
+		rs.lastRecv = 0
+	}
+	rs.stream.onPacket(now, pkt, rs.clockRate)
+}
+
+func (rs *rrSender) onPacketRTCP(now time.Time, pkt rtcp.Packet) {
+	sr, ok := pkt.(*rtcp.SenderReport)
+	if !ok {
+		return
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.lastSR = uint32(sr.NTPTime >> 16)
+	rs.lastSRTime = now
+}
+
+// report returns the receiver report, nil if no RTP packet has been received.
+// fractionLost (0~1) and jitter replace the measured values if positive.
+func (rs *rrSender) report(now time.Time, fractionLost float64, jitter time.Duration) rtcp.Packet {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if !rs.stream.started {
+		return nil
+	}
+
+	extMax := rs.stream.extendedMaxSeq()
+	expected := rs.stream.expected()
+	expInterval := expected - rs.lastExp
+	recvInterval := rs.stream.received - rs.lastRecv
+	rs.lastExp = expected
+	rs.lastRecv = rs.stream.received
+
+	var fraction uint8
+	if lostInterval := int64(expInterval) - int64(recvInterval); expInterval != 0 && lostInterval > 0 {
+		fraction = uint8((lostInterval << 8) / int64(expInterval))
+	}
+	if fractionLost > 0 {
+		fraction = uint8(fractionLost * 255)
+		rs.injectedLost += uint32(float64(expInterval) * fractionLost)
+	}
+
+	totalLost := rs.stream.lost() + int64(rs.injectedLost)
+	if totalLost < 0 {
+		totalLost = 0
+	} else if totalLost > 0x7fffff {
+		totalLost = 0x7fffff
+	}
+
+	jit := uint32(rs.stream.jitter)
+	if jitter > 0 {
+		jit = uint32(jitter.Seconds() * float64(rs.clockRate))
+	}
+
+	var dlsr uint32
+	if !rs.lastSRTime.IsZero() {
+		dlsr = uint32(now.Sub(rs.lastSRTime).Seconds() * 65536)
+	}
+
+	rr := &rtcp.ReceiverReport{
+		SSRC: rs.ssrc,
+		Reports: []rtcp.ReceptionReport{{
+			SSRC:               rs.mediaSSRC,
+			FractionLost:       fraction,
+			TotalLost:          uint32(totalLost),
+			LastSequenceNumber: extMax,
+			Jitter:             jit,
+			LastSenderReport:   rs.lastSR,
+			Delay:              dlsr,
+		}},
+	}
+	if rs.reducedSize {
+		return rr
+	}
+	return &rtcp.CompoundPacket{rr, &rtcp.SourceDescription{
+		Chunks: []rtcp.SourceDescriptionChunk{{
+			Source: rs.ssrc,
+			Items:  []rtcp.SourceDescriptionItem{{Type: rtcp.SDESCNAME, Text: "rtspclient"}},
+		}},
+	}}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+// rtcpStats is the RTCP features and sender report analysis of a media.
+// Drifts are in ppm, positive when the media clock (RTP timestamps) or the
+// server wall clock (NTP timestamps) runs faster than the reference
+// (NTP timestamps and local clock respectively).
+type rtcpStats struct {
+	rtcpFeatures
+
+	SenderReports   uint64   `json:"senderReports"`
+	MinInterval     duration `json:"minInterval"`
+	AvgInterval     duration `json:"avgInterval"`
+	MaxInterval     duration `json:"maxInterval"`
+	IntervalAlarms  uint64   `json:"intervalAlarms"`
+	MediaClockDrift float64  `json:"mediaClockDrift"`
+	WallClockDrift  float64  `json:"wallClockDrift"`
+}
+
+// ntpSeconds converts a difference of NTP timestamps to seconds.
+func ntpSeconds(d uint64) float64 {
+	return float64(int64(d)) / (1 << 32)
+}
+
+// srAnalyzer correlates the NTP/RTP timestamps of the sender reports of a media.
+type srAnalyzer struct {
+	s         *session
+	name      string
+	clockRate int
+
+	mu       sync.Mutex
+	first    *rtcp.SenderReport
+	last     *rtcp.SenderReport
+	firstT   time.Time
+	lastT    time.Time
+	sumInter time.Duration
+	// rtpTicks is the RTP timestamp of the last sender report unwrapped from the first one,
+	// the int32 deltas between consecutive reports are accumulated so it does not wrap after 2^31 ticks.
+	rtpTicks int64
+	stats    rtcpStats
+}
+
+func (a *srAnalyzer) onPacketRTCP(now time.Time, pkt rtcp.Packet) {
+	sr, ok := pkt.(*rtcp.SenderReport)
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stats.SenderReports++
+	prev := a.last
+	a.last = sr
+	if a.first == nil {
+		a.first = sr
+		a.firstT = now
+		a.lastT = now
+		return
+	}
+
+	a.rtpTicks += int64(int32(sr.RTPTime - prev.RTPTime))
+
+	interval := now.Sub(a.lastT)
+	a.lastT = now
+	if a.stats.MinInterval == 0 || duration(interval) < a.stats.MinInterval {
+		a.stats.MinInterval = duration(interval)
+	}
+	if duration(interval) > a.stats.MaxInterval {
+		a.stats.MaxInterval = duration(interval)
+	}
+	a.sumInter += interval
+	a.stats.AvgInterval = duration(a.sumInter / time.Duration(a.stats.SenderReports-1))
+	if max := a.s.cfg.maxRTCPInterval; max > 0 && interval > max {
+		a.stats.IntervalAlarms++
+		a.s.logf("rtcp %s sender report interval %v exceeds %v", a.name, interval, max)
+	}
+
+	ntpElapsed := ntpSeconds(sr.NTPTime - a.first.NTPTime)
+	if ntpElapsed <= 0 || a.clockRate <= 0 {
+		return
+	}
+	mediaElapsed := float64(a.rtpTicks) / float64(a.clockRate)
+	a.stats.MediaClockDrift = (mediaElapsed - ntpElapsed) / ntpElapsed * 1e6
+
+	localElapsed := now.Sub(a.firstT).Seconds()
+	if localElapsed > 0 {
+		a.stats.WallClockDrift = (ntpElapsed - localElapsed) / localElapsed * 1e6
+	}
+}
+
+// captureTime returns the NTP time in seconds of an RTP timestamp of the media, by the last sender report.
+func (a *srAnalyzer) captureTime(ts uint32) (float64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.last == nil || a.clockRate <= 0 {
+		return 0, false
+	}
+	return float64(a.last.NTPTime>>32) + float64(uint32(a.last.NTPTime))/(1<<32) +
+		float64(int32(ts-a.last.RTPTime))/float64(a.clockRate), true
+}
+
+func (a *srAnalyzer) snapshot() rtcpStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stats
+}
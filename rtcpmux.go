@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/sdp"
+)
+
+// rtcpFeatures are the RTCP multiplexing (RFC 5761, RFC 8858), reduced-size RTCP (RFC 5506)
+// and generic NACK feedback (RFC 4585) features of a media,
+// offered in the SDP and negotiated in SETUP.
+type rtcpFeatures struct {
+	MuxOffered  bool `json:"muxOffered"`
+	MuxOnly     bool `json:"muxOnly"`
+	Mux         bool `json:"mux"`
+	ReducedSize bool `json:"reducedSize"`
+	NACK        bool `json:"nack"`
+}
+
+// sdpRTCPFeatures returns the RTCP features offered by the medias of a raw SDP.
+func sdpRTCPFeatures(body []byte, n int) []rtcpFeatures {
+	feats := make([]rtcpFeatures, n)
+
+	var sd sdp.SessionDescription
+	if err := sd.Unmarshal(body); err != nil {
+		return feats
+	}
+	for i, md := range sd.MediaDescriptions {
+		if i >= n {
+			break
+		}
+		_, feats[i].MuxOnly = md.Attribute("rtcp-mux-only")
+		_, feats[i].MuxOffered = md.Attribute("rtcp-mux")
+		feats[i].MuxOffered = feats[i].MuxOffered || feats[i].MuxOnly
+		_, feats[i].ReducedSize = md.Attribute("rtcp-rsize")
+		for _, a := range md.Attributes {
+			// a=rtcp-fb:<pt or *> nack, a nack with a parameter (pli) is another feedback
+			if f := strings.Fields(a.Value); a.Key == "rtcp-fb" && len(f) == 2 && f[1] == "nack" {
+				feats[i].NACK = true
+			}
+		}
+	}
+	return feats
+}
+
+// requestRTCPMux adds the RTCP-mux parameter (RFC 7826) to the Transport header of a SETUP request.
+func requestRTCPMux(req *base.Request) {
+	if req.Method != base.Setup {
+		return
+	}
+	if v := req.Header["Transport"]; len(v) != 0 {
+		v[0] += ";RTCP-mux"
+	}
+}
+
+// transportHasRTCPMux reports whether the Transport header of a SETUP response has the RTCP-mux parameter.
+func transportHasRTCPMux(v base.HeaderValue) bool {
+	if len(v) == 0 {
+		return false
+	}
+	for _, p := range strings.Split(v[0], ";") {
+		if strings.EqualFold(strings.TrimSpace(p), "RTCP-mux") {
+			return true
+		}
+	}
+	return false
+}
+
+// isMuxedRTCP reports whether an RTP payload type is in the range
+// RTCP packet types occupy when RTCP is multiplexed on the RTP port (RFC 5761 4).
+func isMuxedRTCP(payloadType uint8) bool {
+	return payloadType >= 64 && payloadType <= 95
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// run is a test run defined by a config.
+// Several runs (tenants) can be executed in a process,
+// each with its own thresholds, sessions, outputs and control api namespace.
+type run struct {
+	name   string
+	cfg    *config
+	logger *log.Logger
+
+	// exit the process when a session fails
+	exitOnError bool
+
+	thresholdsMu sync.RWMutex
+	thresholds   thresholds
+
+	sessions *registry
+
+	// limits the concurrent sessions, nil if unlimited
+	quota chan struct{}
+	// limits the handshakes in progress, nil if unlimited
+	setups chan struct{}
+	// nil without -retry-attempts
+	retry *retryQueue
+
+	// limits the outbound RTSP requests, nil if unlimited
+	limiter *rateLimiter
+
+	// nil if -describe-cache is not set
+	describeCache *describeCache
+	// nil with -transport TCP or if not supported
+	udpDrops *udpDropMonitor
+
+	breakersMu sync.Mutex
+	breakers   map[string]*circuitBreaker
+
+	latency *latencyRecorder
+
+	// nil if -report is not set
+	report *reportCollector
+
+	// nil if -csv-out is not set
+	csv *csvExporter
+
+	// nil if -influx-url is not set
+	influx *influxPusher
+
+	// nil if -statsd-addr is not set
+	statsd *statsdEmitter
+
+	// nil if -stats-interval is not set
+	stats *statsLog
+
+	// nil if -shards is not set
+	shards *shardPool
+
+	// nil if -publish is not set
+	publish *publishMedia
+
+	// the GC counters at the start of the run, or at the end of its warm-up
+	gcMu    sync.Mutex
+	gcStart gcSnapshot
+	// end of the warm-up of -warmup
+	warmupEnd time.Time
+
+	finishOnce sync.Once
+
+	// number of the finished sessions
+	succeeded int64
+	failed    int64
+	// delayed RTP packets of all the sessions
+	delays int64
+
+	// last session errors for the dashboard, and the number of errors ever recorded
+	errorsMu    sync.Mutex
+	errors      []errorEvent
+	errorsTotal int
+
+	// sessions added by the control api
+	added sync.WaitGroup
+	// sequence of the ids of the added sessions
+	seq int64
+	// sequence of the {NUM} of the added sessions
+	numSeq int64
+	// sequence of the sessions for the {SEQ} and {CSV:column} of the url
+	urlSeq int64
+
+	// nil if -url-values is not set
+	urlValues *urlValues
+
+	// start intervals and order of the sessions
+	stagger *stagger
+
+	// nil if -soak-interval is not set
+	soak *soakMonitor
+
+	// source addresses of -local-ip and interface of -interface
+	sources *sourcePool
+
+	// sessions by address family
+	families *familyRecorder
+
+	// server addresses of -resolve-mode and -resolve
+	resolver *resolver
+
+	// expected content hashes of -manifest, or those recorded by -manifest-record
+	manifestMu sync.Mutex
+	manifest   manifest
+
+	// finished sessions of -state-file
+	state *stateRecorder
+}
+
+func newRun(name string, cfg *config) (*run, error) {
+	r := &run{
+		name:       name,
+		cfg:        cfg,
+		logger:     log.Default(),
+		thresholds: cfg.thresholds(),
+		sessions:   newRegistry(),
+		breakers:   make(map[string]*circuitBreaker),
+		latency:    newLatencyRecorder(),
+		seq:        int64(cfg.count),
+		stagger:    newStagger(cfg),
+		sources:    newSourcePool(cfg),
+		families:   newFamilyRecorder(),
+		resolver:   newResolver(cfg),
+	}
+
+	if cfg.logFile != "" {
+		f, err := os.OpenFile(cfg.logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file, %v", err)
+		}
+		r.logger = log.New(timestampWriter{w: &watchedWriter{name: "log file " + cfg.logFile, w: f}}, "", 0)
+	}
+	prefix := ""
+	if name != "" {
+		prefix = "[" + name + "] "
+	}
+	if l := cfg.runLabels(); len(l) != 0 {
+		prefix += "{" + l.String() + "} "
+	}
+	if prefix != "" {
+		r.logger = log.New(r.logger.Writer(), prefix, r.logger.Flags()|log.Lmsgprefix)
+	}
+	cfg.setLabelHeader()
+
+	if r.stagger.random(cfg) {
+		r.logger.Printf("start jitter %s, shuffle %v, seed %d", cfg.startJitter, cfg.shuffle, r.stagger.seed)
+	}
+	if cfg.maxSessions > 0 {
+		r.quota = make(chan struct{}, cfg.maxSessions)
+	}
+	if cfg.maxConcurrentSetups > 0 {
+		r.setups = make(chan struct{}, cfg.maxConcurrentSetups)
+	}
+	if cfg.retryAttempts > 0 {
+		r.retry = newRetryQueue(cfg)
+	}
+	if cfg.report != "" || cfg.compared {
+		r.report = &reportCollector{}
+	}
+	if cfg.csvOut != "" {
+		e, err := newCSVExporter(cfg.csvOut)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open csv file, %v", err)
+		}
+		r.csv = e
+	}
+	if cfg.influxURL != "" {
+		r.influx = newInfluxPusher(cfg, name)
+	}
+	if cfg.statsdAddr != "" {
+		e, err := newStatsdEmitter(cfg, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open statsd, %v", err)
+		}
+		r.statsd = e
+	}
+	if cfg.shards > 0 {
+		r.shards = newShardPool(cfg.shards, cfg.pinThreads, r.logger)
+	}
+	if cfg.requestRate > 0 {
+		r.limiter = newRateLimiter(cfg.requestRate, cfg.requestBurst)
+	}
+	if cfg.describeCache {
+		r.describeCache = newDescribeCache()
+	}
+	if cfg.transport == "UDP" {
+		r.udpDrops = newUDPDropMonitor()
+	}
+	if max := rmemMax(); cfg.udpRcvbuf > 0 && max > 0 && int64(cfg.udpRcvbuf) > max {
+		r.logger.Printf("udp receive buffers of %v are capped to %v by net.core.rmem_max, raise it, ex) sysctl -w net.core.rmem_max=%d",
+			cfg.udpRcvbuf, byteSize(max), int64(cfg.udpRcvbuf))
+	}
+	if cfg.urlValues != "" {
+		v, err := loadURLValues(cfg.urlValues, urlColumns(cfg.url))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s, %v", cfg.urlValues, err)
+		}
+		r.urlValues = v
+	}
+	if cfg.manifest != "" && !cfg.manifestRecord {
+		m, err := loadManifest(cfg.manifest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s, %v", cfg.manifest, err)
+		}
+		r.manifest = m
+	}
+	if cfg.soakInterval > 0 {
+		r.soak = newSoakMonitor(r)
+	}
+	if cfg.statsInterval > 0 {
+		r.stats = &statsLog{}
+	}
+	if cfg.stateFile != "" {
+		sr, err := newStateRecorder(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s, %v", cfg.stateFile, err)
+		}
+		r.state = sr
+	}
+	if n := len(r.sources.ips); n != 0 {
+		r.logger.Printf("source addresses: %d, from %s to %s", n, r.sources.ips[0], r.sources.ips[n-1])
+	}
+	if cfg.loopback && cfg.publish == "" {
+		cfg.publish = publishTestPattern
+	}
+	if cfg.publish != "" {
+		pm, err := loadPublishMedia(cfg.publish)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s, %v", cfg.publish, err)
+		}
+		for _, t := range pm.skipped {
+			r.logger.Printf("publish: skipped a track of %s, %s", pm.name, t)
+		}
+		if cfg.loopback && !pm.hasH264() {
+			return nil, fmt.Errorf("no H264 track in %s to mark for -loopback", pm.name)
+		}
+		r.publish = pm
+	}
+	return r, nil
+}
+
+// runTotals are the sums over the running sessions of a run.
+type runTotals struct {
+	Sessions int     `json:"sessions"`
+	Playing  int     `json:"playing"` // playing or recording
+	Packets  uint64  `json:"packets"`
+	Bytes    uint64  `json:"bytes"`
+	Bitrate  bitrate `json:"bitrate"`
+}
+
+func (r *run) totals() runTotals {
+	var tot runTotals
+	for _, s := range r.sessions.list() {
+		ss := s.snapshot()
+		tot.Sessions++
+		if ss.State == statePlaying || ss.State == stateRecording {
+			tot.Playing++
+		}
+		tot.Packets += ss.Packets
+		tot.Bytes += ss.Bytes
+		tot.Bitrate += ss.Bitrate.Current
+	}
+	return tot
+}
+
+// newSession returns a session of url with its placeholders expanded,
+// the id is the expanded url if it is the url. The id given is the key of -state-file.
+func (r *run) newSession(url, id string) *session {
+	expanded := r.expandURL(url, atomic.AddInt64(&r.urlSeq, 1))
+	key := id
+	if id == url {
+		id = expanded
+	}
+	url = expanded
+	s := &session{
+		id:       id,
+		url:      url,
+		class:    r.cfg.class,
+		cfg:      r.cfg,
+		run:      r,
+		stateKey: key,
+		created:  time.Now(),
+	}
+	if r.shards != nil {
+		s.shard = r.shards.get(id)
+	}
+	s.faults = newFaultInjector(r.cfg, r.stagger.derive)
+	s.localIP = r.sources.get()
+	s.listen = r.sources.portListener(s.localIP)
+	s.resolved = make(map[string]net.IP)
+	if r.cfg.srtp {
+		s.srtp = &srtpDecrypter{}
+	}
+	return s
+}
+
+func (r *run) play(s *session) error {
+	defer exitOnPanic()
+	err := r.playAttempt(s)
+	if r.retry != nil {
+		retry := 1
+		for ; r.retry.retryable(s, err, retry); retry++ {
+			s = r.retry.wait(r, s, err, retry)
+			err = r.playAttempt(s)
+		}
+		r.retry.done(s, retry-1)
+	}
+
+	if r.report != nil && !r.warmingUp(time.Now()) {
+		r.report.addResult(s, err)
+	}
+	if r.influx != nil {
+		r.influx.addResult(s, err)
+	}
+	if r.statsd != nil {
+		r.statsd.onResult(err)
+	}
+	if r.state != nil {
+		r.state.record(s.stateKey, err)
+	}
+	if r.csv != nil {
+		if err := r.csv.addResult(r.name, s, err); err != nil {
+			r.logger.Printf("failed to write csv row, %v", err)
+		}
+	}
+	if err != nil {
+		atomic.AddInt64(&r.failed, 1)
+		if r.stats != nil {
+			r.stats.onError()
+		}
+	} else {
+		atomic.AddInt64(&r.succeeded, 1)
+	}
+	if err != nil {
+		r.recordError(s, err)
+		r.logger.Println(err)
+		if r.exitOnError {
+			r.finish("stopped by the failed session " + s.id)
+			os.Exit(1)
+		}
+	}
+	return err
+}
+
+// playAttempt plays a session once, in the limits of -max-sessions, the breaker and -max-concurrent-setups.
+func (r *run) playAttempt(s *session) error {
+	if r.quota != nil {
+		r.quota <- struct{}{}
+		defer func() { <-r.quota }()
+	}
+
+	if b := r.breaker(s.url); b != nil {
+		b.wait()
+		s.onHandshake = func(err error) {
+			b.record(err == nil)
+		}
+	}
+	if r.setups != nil {
+		// released at the end of the handshake, successful or not
+		r.setups <- struct{}{}
+		onHandshake := s.onHandshake
+		s.onHandshake = func(err error) {
+			<-r.setups
+			if onHandshake != nil {
+				onHandshake(err)
+			}
+		}
+	}
+	return s.play()
+}
+
+// start starts the sessions of the run, after the preflight if any, and waits for them,
+// then logs the latency and GC summary and writes the report and the csv files.
+// The metrics are pushed to influx and statsd meanwhile.
+func (r *run) start() error {
+	if r.cfg.preflight {
+		if err := r.preflight(); err != nil {
+			return err
+		}
+	}
+	r.gcStart = takeGCSnapshot()
+	if r.cfg.warmup > 0 {
+		defer r.startWarmup()()
+	}
+	startedRuns.Lock()
+	startedRuns.m[r] = struct{}{}
+	startedRuns.Unlock()
+	handleExitSignals()
+	defer func() {
+		startedRuns.Lock()
+		delete(startedRuns.m, r)
+		startedRuns.Unlock()
+	}()
+	defer r.finish("")
+	if r.report != nil {
+		r.report.start = time.Now()
+		stop := r.report.sampleBitrate()
+		stopResources := r.report.sampleResources()
+		defer func() {
+			stop()
+			stopResources()
+		}()
+		if r.cfg.reportCheckpoint > 0 && r.cfg.report != "" {
+			defer r.checkpointReport(r.cfg.reportCheckpoint)()
+		}
+	}
+	if r.csv != nil {
+		stop := r.csv.sampleSessions(r, r.cfg.csvInterval)
+		defer func() {
+			stop()
+			r.csv.close()
+		}()
+	}
+	if r.influx != nil {
+		stop := r.influx.start(r, r.cfg.influxInterval)
+		defer stop()
+	}
+	if r.statsd != nil {
+		stop := r.statsd.start(r, r.cfg.statsdInterval)
+		defer stop()
+	}
+	if r.soak != nil {
+		stop := r.soak.start()
+		defer stop()
+	}
+	if r.stats != nil {
+		stop := r.stats.start(r, r.cfg.statsInterval)
+		defer stop()
+	}
+	if r.state != nil {
+		stop := r.state.start(r)
+		defer stop()
+	}
+	if r.udpDrops != nil {
+		stop := r.udpDrops.start(r)
+		defer stop()
+	}
+	var err error
+	if r.cfg.monitor {
+		err = r.monitor()
+	} else if r.cfg.describeRate > 0 {
+		err = r.describeLoad()
+	} else if r.cfg.probe {
+		err = r.probe()
+	} else if r.cfg.zapInterval > 0 {
+		err = r.zap()
+	} else {
+		r.startSessions()
+	}
+	r.added.Wait()
+	if r.shards != nil {
+		r.shards.close()
+	}
+	return err
+}
+
+// nextURL returns the url of a session added without url,
+// the url of the run with {NUM} replaced in turn from start to end.
+func (r *run) nextURL() string {
+	cfg := r.cfg
+	if !strings.Contains(cfg.url, "{NUM}") {
+		return cfg.url
+	}
+	n := atomic.AddInt64(&r.numSeq, 1) - 1
+	num := cfg.nStart + int(n%int64(cfg.nEnd-cfg.nStart+1))
+	return strings.ReplaceAll(cfg.url, "{NUM}", strconv.Itoa(num))
+}
+
+// addSessions starts n sessions of url at -start-interval, url of the run if empty,
+// and returns their ids.
+func (r *run) addSessions(url string, n int) []string {
+	var sessions []*session
+	for i := 0; i < n; i++ {
+		u := url
+		if u == "" {
+			u = r.nextURL()
+		}
+		id := u + ":" + strconv.FormatInt(atomic.AddInt64(&r.seq, 1)-1, 10)
+		sessions = append(sessions, r.newSession(u, id))
+	}
+
+	r.stagger.shuffle(len(sessions), func(i, j int) { sessions[i], sessions[j] = sessions[j], sessions[i] })
+	ids := make([]string, len(sessions))
+	r.added.Add(len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.id
+	}
+	go func() {
+		for _, s := range sessions {
+			go func(s *session) {
+				defer r.added.Done()
+				r.play(s)
+			}(s)
+			r.stagger.wait()
+		}
+	}()
+	return ids
+}
+
+// setConcurrency adds or tears down sessions to have target running sessions,
+// the newest sessions are torn down first. It returns the ids of the added or torn down sessions.
+func (r *run) setConcurrency(target int, url string) (added, tornDown []string) {
+	sessions := r.sessions.list()
+	var running []*session
+	for _, s := range sessions {
+		if !s.isTornDown() {
+			running = append(running, s)
+		}
+	}
+	if len(running) < target {
+		return r.addSessions(url, target-len(running)), nil
+	}
+	sort.Slice(running, func(i, j int) bool { return running[i].created.After(running[j].created) })
+	for _, s := range running[:len(running)-target] {
+		s.teardown()
+		tornDown = append(tornDown, s.id)
+	}
+	return nil, tornDown
+}
+
+// startSessions plays the sessions of -count or of the {NUM} range and waits for them.
+// Their errors are logged and counted in r.failed, the exit code of the run is given by exitCode,
+// a failed session without -continue-on-error exits in play.
+func (r *run) startSessions() {
+	cfg := r.cfg
+	useNum := strings.Contains(cfg.url, "{NUM}")
+
+	if r.state != nil && cfg.resume {
+		ok, failed := r.state.counts()
+		atomic.AddInt64(&r.succeeded, int64(ok))
+		atomic.AddInt64(&r.failed, int64(failed))
+		r.logger.Printf("resume: %d sessions finished by the previous runs are skipped, ok %d, failed %d", ok+failed, ok, failed)
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	if !useNum {
+		for i := 0; i < cfg.count; i++ {
+			id := cfg.url + ":" + strconv.Itoa(i)
+			if r.state != nil && r.state.finished(id) {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.play(r.newSession(cfg.url, id))
+			}()
+			r.stagger.wait()
+		}
+		return
+	}
+
+	var urls []string
+	for i := cfg.nStart; i <= cfg.nEnd; i++ {
+		urls = append(urls, strings.ReplaceAll(cfg.url, "{NUM}", strconv.Itoa(i)))
+	}
+	r.stagger.shuffle(len(urls), func(i, j int) { urls[i], urls[j] = urls[j], urls[i] })
+	for _, u := range urls {
+		u := u
+		if r.state != nil && r.state.finished(u) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.play(r.newSession(u, u))
+		}()
+		r.stagger.wait()
+	}
+}
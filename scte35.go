@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func init() {
+	registerFeature("scte35")
+}
+
+const (
+	tsPATPID         = 0
+	tsStreamSCTE35   = 0x86
+	scte35TableID    = 0xFC
+	scte35SpliceNull = 0x00
+	scte35Insert     = 0x05
+	scte35TimeSignal = 0x06
+)
+
+// scte35Stats are the SCTE-35 splice_info_section messages of a MP2T over RTP format.
+type scte35Stats struct {
+	SpliceInserts uint64 `json:"spliceInserts"`
+	TimeSignals   uint64 `json:"timeSignals"`
+	SpliceNulls   uint64 `json:"spliceNulls"`
+	Others        uint64 `json:"others"`
+	Invalid       uint64 `json:"invalid"`
+}
+
+// onSection reassembles the sections of the PAT, of the PMTs and of the SCTE-35 PIDs they list,
+// it is called with ta.mu locked.
+func (ta *tsAnalyzer) onSection(pid uint16, st *tsPID, start bool, payload []byte) {
+	if pid != tsPATPID && !ta.pmts[pid] && !ta.scte35[pid] {
+		return
+	}
+	if start {
+		if len(payload) == 0 || int(payload[0]) >= len(payload) {
+			st.section = st.section[:0]
+			return
+		}
+		st.section = append(st.section[:0], payload[1+int(payload[0]):]...)
+	} else {
+		if len(st.section) == 0 {
+			return
+		}
+		st.section = append(st.section, payload...)
+	}
+	if len(st.section) < 3 {
+		return
+	}
+	n := 3 + (int(st.section[1]&0x0F)<<8 | int(st.section[2]))
+	if len(st.section) < n {
+		return
+	}
+	section := st.section[:n]
+	st.section = st.section[:0]
+	switch {
+	case pid == tsPATPID && section[0] == 0x00:
+		ta.onPAT(section)
+	case ta.pmts[pid] && section[0] == 0x02:
+		ta.onPMT(section)
+	case ta.scte35[pid] && section[0] == scte35TableID:
+		ta.onSpliceInfo(pid, section)
+	}
+}
+
+func (ta *tsAnalyzer) onPAT(section []byte) {
+	// programs up to the CRC
+	for i := 8; i+4 <= len(section)-4; i += 4 {
+		program := uint16(section[i])<<8 | uint16(section[i+1])
+		if program != 0 {
+			ta.pmts[uint16(section[i+2]&0x1F)<<8|uint16(section[i+3])] = true
+		}
+	}
+}
+
+func (ta *tsAnalyzer) onPMT(section []byte) {
+	if len(section) < 12 {
+		return
+	}
+	i := 12 + (int(section[10]&0x0F)<<8 | int(section[11]))
+	for i+5 <= len(section)-4 {
+		pid := uint16(section[i+1]&0x1F)<<8 | uint16(section[i+2])
+		if section[i] == tsStreamSCTE35 && !ta.scte35[pid] {
+			ta.scte35[pid] = true
+			ta.s.logf("scte35 %s: pid %d", ta.name, pid)
+		}
+		i += 5 + (int(section[i+3]&0x0F)<<8 | int(section[i+4]))
+	}
+}
+
+// spliceTime parses a splice_time(), it returns its length and the PTS if the time is specified.
+func spliceTime(b []byte) (int, uint64, bool) {
+	if len(b) < 1 {
+		return 0, 0, false
+	}
+	if b[0]&0x80 == 0 {
+		return 1, 0, false
+	}
+	if len(b) < 5 {
+		return 0, 0, false
+	}
+	return 5, uint64(b[0]&0x01)<<32 | uint64(b[1])<<24 | uint64(b[2])<<16 | uint64(b[3])<<8 | uint64(b[4]), true
+}
+
+// ptsString returns a PTS in seconds, and its distance from the last PTS of the stream if any.
+func (ta *tsAnalyzer) ptsString(pts uint64) string {
+	s := fmt.Sprintf("%.3fs", float64(pts)/tsPTSClock)
+	if ta.hasPTS {
+		d := int64((pts + tsPTSWrap - ta.lastPTS) % tsPTSWrap)
+		if d > tsPTSWrap/2 {
+			d -= tsPTSWrap
+		}
+		s += fmt.Sprintf(" (in %v)", time.Duration(d)*time.Second/tsPTSClock)
+	}
+	return s
+}
+
+func (ta *tsAnalyzer) onSpliceInfo(pid uint16, section []byte) {
+	if len(section) < 14+4 || section[4]&0x80 != 0 {
+		// too short or encrypted
+		ta.scte35Stats.Invalid++
+		return
+	}
+	adjustment := uint64(section[4]&0x01)<<32 | uint64(section[5])<<24 | uint64(section[6])<<16 |
+		uint64(section[7])<<8 | uint64(section[8])
+	command := section[13]
+	b := section[14 : len(section)-4]
+
+	switch command {
+	case scte35SpliceNull:
+		ta.scte35Stats.SpliceNulls++
+
+	case scte35Insert:
+		ta.scte35Stats.SpliceInserts++
+		if len(b) < 5 {
+			ta.scte35Stats.Invalid++
+			return
+		}
+		event := uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+		if b[4]&0x80 != 0 {
+			ta.s.logf("scte35 %s pid %d: splice_insert event %d cancelled", ta.name, pid, event)
+			return
+		}
+		if len(b) < 6 {
+			ta.scte35Stats.Invalid++
+			return
+		}
+		out, program, hasDuration, immediate := b[5]&0x80 != 0, b[5]&0x40 != 0, b[5]&0x20 != 0, b[5]&0x10 != 0
+		b = b[6:]
+		at := "immediate"
+		if !immediate {
+			at = "per component"
+			if program {
+				n, pts, ok := spliceTime(b)
+				if n == 0 {
+					ta.scte35Stats.Invalid++
+					return
+				}
+				b = b[n:]
+				at = "unspecified"
+				if ok {
+					at = ta.ptsString((pts + adjustment) % tsPTSWrap)
+				}
+			}
+		}
+		dur := ""
+		if hasDuration && program && len(b) >= 5 {
+			d := uint64(b[0]&0x01)<<32 | uint64(b[1])<<24 | uint64(b[2])<<16 | uint64(b[3])<<8 | uint64(b[4])
+			dur = fmt.Sprintf(", duration %v", time.Duration(d)*time.Second/tsPTSClock)
+		}
+		ta.s.logf("scte35 %s pid %d: splice_insert event %d, out of network %v, splice time %s%s",
+			ta.name, pid, event, out, at, dur)
+
+	case scte35TimeSignal:
+		ta.scte35Stats.TimeSignals++
+		n, pts, ok := spliceTime(b)
+		if n == 0 {
+			ta.scte35Stats.Invalid++
+			return
+		}
+		at := "unspecified"
+		if ok {
+			at = ta.ptsString((pts + adjustment) % tsPTSWrap)
+		}
+		ta.s.logf("scte35 %s pid %d: time_signal, splice time %s", ta.name, pid, at)
+
+	default:
+		ta.scte35Stats.Others++
+		ta.s.logf("scte35 %s pid %d: splice command 0x%02x", ta.name, pid, command)
+	}
+}
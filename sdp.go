@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+)
+
+// codecNames returns the names a format can be matched by,
+// the gortsplib codec name and the encoding name of the rtpmap.
+func codecNames(forma format.Format) []string {
+	names := []string{forma.Codec()}
+	if rtpMap := forma.RTPMap(); rtpMap != "" {
+		names = append(names, strings.SplitN(rtpMap, "/", 2)[0])
+	}
+	return names
+}
+
+func formatString(forma format.Format) string {
+	s := fmt.Sprintf("pt=%d codec=%s clock=%d", forma.PayloadType(), forma.Codec(), forma.ClockRate())
+	if rtpMap := forma.RTPMap(); rtpMap != "" {
+		s += " rtpmap=" + rtpMap
+	}
+	if fmtp := forma.FMTP(); len(fmtp) != 0 {
+		keys := make([]string, 0, len(fmtp))
+		for k := range fmtp {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		params := make([]string, 0, len(keys))
+		for _, k := range keys {
+			params = append(params, k+"="+fmtp[k])
+		}
+		s += " fmtp=" + strings.Join(params, ";")
+	}
+	return s
+}
+
+// sdpString returns the session description in a readable form.
+func sdpString(desc *description.Session) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "base url: %v\n", desc.BaseURL)
+	if desc.Title != "" {
+		fmt.Fprintf(&b, "title: %s\n", desc.Title)
+	}
+	for i, medi := range desc.Medias {
+		fmt.Fprintf(&b, "media #%d: type=%s control=%s", i, medi.Type, medi.Control)
+		if medi.ID != "" {
+			fmt.Fprintf(&b, " mid=%s", medi.ID)
+		}
+		if medi.IsBackChannel {
+			b.WriteString(" backchannel")
+		}
+		b.WriteString("\n")
+		for _, forma := range medi.Formats {
+			fmt.Fprintf(&b, "  %s\n", formatString(forma))
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// checkCodec checks that a media of the type exists
+// and one of its formats is one of the expected codecs (comma separated).
+func checkCodec(desc *description.Session, typ description.MediaType, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	var found []string
+	for _, medi := range desc.Medias {
+		if medi.Type != typ {
+			continue
+		}
+		for _, forma := range medi.Formats {
+			for _, name := range codecNames(forma) {
+				for _, e := range strings.Split(expected, ",") {
+					if strings.EqualFold(strings.TrimSpace(e), name) {
+						return nil
+					}
+				}
+			}
+			found = append(found, forma.Codec())
+		}
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("no %s media, expected %s", typ, expected)
+	}
+	return fmt.Errorf("unexpected %s codec %s, expected %s", typ, strings.Join(found, ","), expected)
+}
+
+// checkSDP checks the negotiated formats against the expectations of the config.
+func (cfg *config) checkSDP(desc *description.Session) error {
+	if err := checkCodec(desc, description.MediaTypeVideo, cfg.expectVideoCodec); err != nil {
+		return err
+	}
+	return checkCodec(desc, description.MediaTypeAudio, cfg.expectAudioCodec)
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+func init() {
+	registerFeature("server-requests")
+}
+
+// methodPlayNotify is the PLAY_NOTIFY request of a server, RTSP 2.0 (RFC 7826 13.5).
+const methodPlayNotify base.Method = "PLAY_NOTIFY"
+
+// serverMethods are the requests of the servers answered 200 OK by default, the others 501 Not Implemented.
+var serverMethods = map[base.Method]bool{
+	base.Options:      true,
+	base.Announce:     true,
+	base.GetParameter: true,
+	base.SetParameter: true,
+	methodRedirect:    true,
+	methodPlayNotify:  true,
+}
+
+// serverResponses are the scripted statuses of the responses to the requests of the servers, by method,
+// parsed from "SET_PARAMETER=200,451", the nth request of a session gets the nth status, the last one repeats.
+type serverResponses map[base.Method][]base.StatusCode
+
+func (sr serverResponses) String() string {
+	methods := make([]string, 0, len(sr))
+	for m := range sr {
+		methods = append(methods, string(m))
+	}
+	sort.Strings(methods)
+	l := make([]string, len(methods))
+	for i, m := range methods {
+		codes := make([]string, len(sr[base.Method(m)]))
+		for j, c := range sr[base.Method(m)] {
+			codes[j] = strconv.Itoa(int(c))
+		}
+		l[i] = m + "=" + strings.Join(codes, ",")
+	}
+	return strings.Join(l, " ")
+}
+
+// Set implements flag.Value, it can be repeated.
+func (sr *serverResponses) Set(s string) error {
+	if *sr == nil {
+		*sr = make(serverResponses)
+	}
+	method, statuses, ok := strings.Cut(strings.TrimSpace(s), "=")
+	if !ok || method == "" || method != strings.ToUpper(method) {
+		return fmt.Errorf("invalid server response %q, should be METHOD=status[,status...]", s)
+	}
+	var codes []base.StatusCode
+	for _, st := range strings.Split(statuses, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(st))
+		if err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("invalid status %q of %s", st, method)
+		}
+		codes = append(codes, base.StatusCode(code))
+	}
+	(*sr)[base.Method(method)] = codes
+	return nil
+}
+
+// status returns the status of the response to the nth request of a method, from 1.
+func (sr serverResponses) status(method base.Method, n int) base.StatusCode {
+	codes := sr[method]
+	if len(codes) == 0 {
+		if serverMethods[method] {
+			return base.StatusOK
+		}
+		return base.StatusNotImplemented
+	}
+	if n > len(codes) {
+		n = len(codes)
+	}
+	return codes[n-1]
+}
+
+// onServerRequest logs a request of the server and returns its response, of -server-response if scripted.
+// A REDIRECT is followed, an end of stream announced by ANNOUNCE or PLAY_NOTIFY ends the session without error.
+func (s *session) onServerRequest(req *base.Request) *base.Response {
+	n := s.countServerRequest(req)
+	s.mu.Lock()
+	closeClient := s.closeClient
+	s.mu.Unlock()
+
+	res := &base.Response{
+		StatusCode: s.cfg.serverResponses.status(req.Method, n),
+		Header:     base.Header{"CSeq": req.Header["CSeq"]},
+	}
+	if sx, ok := req.Header["Session"]; ok {
+		res.Header["Session"] = sx
+	}
+	s.logf("server request %s %d, answered %d", req.Method, n, res.StatusCode)
+	s.logServerParameters(req)
+	if res.StatusCode != base.StatusOK || closeClient == nil {
+		return res
+	}
+
+	switch req.Method {
+	case methodRedirect:
+		s.onRedirectRequest(closeClient, req)
+	case base.Announce, methodPlayNotify:
+		if notice := endOfStreamNotice(req.Header); notice != "" {
+			s.logf("end of stream announced by the server, %s", notice)
+			s.mu.Lock()
+			s.endOfStream = true
+			s.mu.Unlock()
+			go closeClient()
+		} else if ct := req.Header["Content-Type"]; len(ct) == 1 && strings.HasPrefix(ct[0], "application/sdp") {
+			s.logf("server announced a new session description, %d bytes", len(req.Body))
+		}
+	}
+	return res
+}
+
+// onUnansweredServerRequest logs a request of the server over rtsps. The client reads it inside tls
+// and does not answer it, it fails on the requests other than OPTIONS: -server-response, REDIRECT
+// and the end of stream notices do not apply.
+func (s *session) onUnansweredServerRequest(req *base.Request) {
+	n := s.countServerRequest(req)
+	s.logf("server request %s %d over rtsps, not answered", req.Method, n)
+	s.logServerParameters(req)
+}
+
+// countServerRequest counts a request of the server and returns its number for its method.
+func (s *session) countServerRequest(req *base.Request) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.serverRequests == nil {
+		s.serverRequests = make(map[string]int)
+	}
+	s.serverRequests[string(req.Method)]++
+	return s.serverRequests[string(req.Method)]
+}
+
+// logServerParameters logs the text/parameters body of a request of the server.
+func (s *session) logServerParameters(req *base.Request) {
+	if ct := req.Header["Content-Type"]; len(ct) == 1 && strings.HasPrefix(ct[0], "text/parameters") {
+		for _, l := range strings.Split(string(req.Body), "\n") {
+			if k, v, ok := strings.Cut(l, ":"); ok {
+				s.logf("server %s %s: %s", req.Method, strings.TrimSpace(k), strings.TrimSpace(v))
+			}
+		}
+	}
+}
+
+// endOfStreamNotice returns the end of stream notice of the headers of a request, empty if none:
+// Notify-Reason: end-of-stream of RTSP 2.0, or the Notice (x-notice) 2101 of RTSP 1.0 servers.
+func endOfStreamNotice(h base.Header) string {
+	for k, v := range h {
+		if len(v) != 1 {
+			continue
+		}
+		switch strings.ToLower(k) {
+		case "notify-reason":
+			if strings.EqualFold(strings.TrimSpace(v[0]), "end-of-stream") {
+				return k + ": " + v[0]
+			}
+		case "notice", "x-notice":
+			if strings.HasPrefix(strings.TrimSpace(v[0]), "2101") {
+				return k + ": " + v[0]
+			}
+		}
+	}
+	return ""
+}
+
+// streamEnded tells if the server announced the end of the stream.
+func (s *session) streamEnded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.endOfStream
+}
+
+// serverRequestsString returns the requests of the server by method, (ex) ANNOUNCE 1, SET_PARAMETER 2
+func (s *session) serverRequestsString() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	methods := make([]string, 0, len(s.serverRequests))
+	for m := range s.serverRequests {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	for i, m := range methods {
+		methods[i] = fmt.Sprintf("%s %d", m, s.serverRequests[m])
+	}
+	return strings.Join(methods, ", ")
+}
+
+// toolCSeqBase is the first CSeq of the requests sent by the tool on the connection of a client,
+// far from the CSeq of the client.
+const toolCSeqBase = 1 << 30
+
+// serverRequestConn answers the RTSP requests of the server read from the connection of a session,
+// the client reads only the responses and the interleaved frames: it fails on the requests other than OPTIONS.
+// The requests of the tool (-get-parameter) are sent on it too, the client does not read their responses.
+// The messages are written with the requests of the client, each message in a single write.
+type serverRequestConn struct {
+	net.Conn
+	s  *session
+	br *bufio.Reader
+	// header of the message to read, then bytes of its body or frame read directly
+	out  []byte
+	pass int
+
+	cseq    uint64
+	mu      sync.Mutex
+	pending map[string]chan *base.Response
+}
+
+func newServerRequestConn(conn net.Conn, s *session) *serverRequestConn {
+	return &serverRequestConn{Conn: conn, s: s, br: bufio.NewReaderSize(conn, 64*1024), cseq: toolCSeqBase}
+}
+
+// do sends a request of the tool and waits for its response at most timeout.
+func (c *serverRequestConn) do(req *base.Request, timeout time.Duration) (*base.Response, error) {
+	cseq := strconv.FormatUint(atomic.AddUint64(&c.cseq, 1), 10)
+	req.Header["CSeq"] = base.HeaderValue{cseq}
+	b, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *base.Response, 1)
+	c.mu.Lock()
+	if c.pending == nil {
+		c.pending = make(map[string]chan *base.Response)
+	}
+	c.pending[cseq] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, cseq)
+		c.mu.Unlock()
+	}()
+
+	if c.s.cfg.trace {
+		(&tracer{s: c.s, redact: c.s.cfg.traceRedact}).request(">>", req)
+	}
+	if _, err := c.Conn.Write(b); err != nil {
+		return nil, err
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case res := <-ch:
+		return res, nil
+	case <-t.C:
+		return nil, fmt.Errorf("no response within %v", timeout)
+	}
+}
+
+func (c *serverRequestConn) Read(b []byte) (int, error) {
+	for len(c.out) == 0 && c.pass == 0 {
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	if len(c.out) != 0 {
+		n := copy(b, c.out)
+		c.out = c.out[n:]
+		return n, nil
+	}
+	if len(b) > c.pass {
+		b = b[:c.pass]
+	}
+	n, err := c.br.Read(b)
+	c.pass -= n
+	return n, err
+}
+
+// next reads the start of the next frame or response, or answers a request.
+func (c *serverRequestConn) next() error {
+	first, err := c.br.Peek(1)
+	if err != nil {
+		return err
+	}
+	if first[0] == '$' {
+		h, err := c.br.Peek(4)
+		if err != nil {
+			return err
+		}
+		c.pass = 4 + int(binary.BigEndian.Uint16(h[2:]))
+		return nil
+	}
+	start, err := c.br.Peek(5)
+	if err != nil {
+		return err
+	}
+	if string(start) == "RTSP/" {
+		return c.nextResponse()
+	}
+
+	var req base.Request
+	if err := req.Unmarshal(c.br); err != nil {
+		return err
+	}
+	var t *tracer
+	if c.s.cfg.trace {
+		t = &tracer{s: c.s, redact: c.s.cfg.traceRedact}
+		t.request("<<", &req)
+	}
+	res := c.s.onServerRequest(&req)
+	if t != nil {
+		t.response(">>", res)
+	}
+	b, err := res.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = c.Conn.Write(b)
+	return err
+}
+
+// nextResponse reads the header of a response, its body is read directly.
+// The response to a request of the tool is read whole and not passed to the client.
+func (c *serverRequestConn) nextResponse() error {
+	var msg []byte
+	length := 0
+	cseq := ""
+	for {
+		line, err := c.br.ReadSlice('\n')
+		msg = append(msg, line...)
+		if err != nil {
+			return err
+		}
+		l := bytes.TrimSpace(line)
+		if len(l) == 0 {
+			break
+		}
+		k, v, ok := strings.Cut(string(l), ":")
+		switch {
+		case !ok:
+		case strings.EqualFold(strings.TrimSpace(k), "Content-Length"):
+			length, _ = strconv.Atoi(strings.TrimSpace(v))
+		case strings.EqualFold(strings.TrimSpace(k), "CSeq"):
+			cseq = strings.TrimSpace(v)
+		}
+	}
+
+	c.mu.Lock()
+	ch := c.pending[cseq]
+	c.mu.Unlock()
+	if ch == nil {
+		c.out, c.pass = msg, length
+		return nil
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.br, body); err != nil {
+		return err
+	}
+	var res base.Response
+	if err := res.Unmarshal(bufio.NewReader(io.MultiReader(bytes.NewReader(msg), bytes.NewReader(body)))); err != nil {
+		return err
+	}
+	if c.s.cfg.trace {
+		(&tracer{s: c.s, redact: c.s.cfg.traceRedact}).response("<<", &res)
+	}
+	ch <- &res
+	return nil
+}
@@ -0,0 +1,1395 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+	"github.com/bluenviron/gortsplib/v4/pkg/liberrors"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// session is a single play session, or a publish session of -publish.
+// class is the grouping/scenario label of the session,
+// it is attached to every output of the session.
+type session struct {
+	id    string
+	url   string
+	class string
+	cfg   *config
+	run   *run
+	// key of the session in -state-file, the id before the placeholders other than {NUM} are expanded
+	stateKey string
+
+	// category of the last error, the format of errorf up to the first ',' or verb
+	failure string
+
+	// called once when the handshake succeeds (PLAY) or fails
+	onHandshake   func(err error)
+	handshakeOnce sync.Once
+	handshake     handshakeTimer
+	// the handshake succeeded, read after play
+	handshakeOK bool
+	// called once with the time of the first RTP packet of the session, of -zap-interval
+	onFirstPacket func(now time.Time)
+	// called once with the time of the first decodable keyframe of the session, of -zap-interval
+	onFirstKeyframe func(now time.Time)
+
+	dc          *DelayChecker
+	videoTracks map[format.Format]*videoTrack
+	tracks      map[format.Format]*mediaTrack
+	mediaNames  map[*description.Media]string
+	rtcp        map[*description.Media]*srAnalyzer
+	rrs         map[*description.Media]*rrSender
+	// nil if the session has no audio or no video
+	avSync *avSync
+	// MPEG-TS analyzers of -ts-analysis and -scte35, by format
+	tsAnalyzers map[format.Format]*tsAnalyzer
+	// loudness and silences of -audio-analysis, by format
+	audioTracks map[format.Format]*audioTrack
+
+	// nil if -pcap-dir is not set
+	pcap *pcapWriter
+
+	// nil if -ts-dir is not set or there is no MPEG-TS format
+	ts       *tsWriter
+	tsFormat format.Format
+
+	// nil if this is not the session of -exec
+	exec *execPipe
+
+	// nil if -shards is not set
+	shard *shard
+
+	// audio media selected by -audio-lang
+	audio *description.Media
+
+	// nil if -manifest is not set or has no entry for the url
+	integrity *integrityChecker
+
+	// timed-text tracks, by format
+	subtitles map[format.Format]*subtitleTrack
+
+	// nil without -inject-drop, -inject-reorder or -inject-delay
+	faults *faultInjector
+
+	// NACK senders of -nack, by media
+	nacks map[*description.Media]*nackMedia
+
+	// sockets of -kernel-timestamps, by local port, then by media (RTP, RTCP)
+	rawConns map[int]syscall.RawConn
+	rxConns  map[*description.Media][2]syscall.RawConn
+	// last kernel receive time of the sockets of rxConns, by media, each written by the goroutine reading the socket
+	rxLast map[*description.Media]*[2]time.Time
+	// UDP sockets of -udp-rcvbuf not set yet and inodes of the sockets of udpDropMonitor, guarded by mu
+	udpConns  []*net.UDPConn
+	udpInodes []uint64
+	// RTP packets timestamped by the kernel
+	kernelTimed uint64
+	// packets dropped by the kernel on the UDP sockets, atomic
+	kernelDrops uint64
+	// time the reads of the RTSP connection waited for -read-rate, atomic
+	readThrottled int64
+
+	// request RTCP-mux in the SETUP in progress
+	setupMux bool
+	// request RTP/SAVP in the SETUP in progress
+	setupSecure bool
+
+	// source address of the sockets of -local-ip, nil to let the system choose
+	localIP net.IP
+	// delayed RTP packets
+	delays int64
+
+	// listens on the UDP ports of the clients
+	listen func(network, address string) (net.PacketConn, error)
+	// server addresses chosen by -resolve-mode and -resolve, by host name
+	resolveMu sync.Mutex
+	resolved  map[string]net.IP
+
+	// nil without -srtp
+	srtp *srtpDecrypter
+	// medias set up with the RTP/SAVP profile
+	srtpMedias map[*description.Media]bool
+
+	// verification of -loopback, shared by the publisher and the player of the session
+	loopback *loopback
+	// closed when the publisher of -loopback records
+	recording chan struct{}
+
+	created time.Time
+
+	mu          sync.Mutex
+	state       string
+	stateSince  time.Time
+	localAddr   string
+	remoteAddr  string
+	udpAddrs    []string
+	packets     uint64
+	bytes       uint64
+	lastPacket  time.Time
+	lastPackets [lastPacketsSize]packetInfo
+	// time from the PLAY response to the first RTP packet, by media name
+	firstPackets map[string]time.Duration
+	// time from the PLAY response to the first decodable keyframe by video track, of -first-idr
+	firstKeyframes map[string]time.Duration
+	bitrate        bitrateMeter
+	// RTCP packets multiplexed on the RTP port of UDP, they are not demultiplexed
+	rtcpMuxPackets uint64
+	// violated bitrate assertion of the last window
+	bitrateAlarm string
+	// closes the client, nil until the client starts
+	closeClient func()
+	// torn down by the control api
+	tornDown bool
+	// phase in progress when -session-setup-deadline was exceeded
+	setupExceeded string
+	// the server answered 454 Session Not Found while playing, the session is set up again
+	sessionLost bool
+	// continuity breaks of the sessions set up again, and the time without packets they caused
+	breaks     int
+	breakGap   time.Duration
+	breakSince time.Time
+	// time without captions when -max-caption-gap was exceeded
+	captionGap time.Duration
+	// location of a redirect of the server to follow, and the urls redirected from
+	redirect  string
+	redirects []string
+	// chain of the redirects of DESCRIBE followed by the client over -max-redirects
+	redirectsOver string
+	// requests of the server by method, and its end of stream notice
+	serverRequests map[string]int
+	endOfStream    bool
+	// connection of the client and session id of the server, for the requests of -get-parameter and -set-parameter
+	rtspConn    *serverRequestConn
+	rtspSession string
+	// scheme of the connection the client dials, the requests of the server over rtsps are not answered
+	dialScheme string
+	// nil without -get-parameter and -set-parameter
+	params *parameterClient
+	// senders of the test tone of -backchannel
+	backchannels []*backchannelSender
+}
+
+const (
+	stateConnecting = "connecting"
+	stateDescribing = "describing"
+	stateAnnouncing = "announcing"
+	stateSettingUp  = "setting up"
+	stateStarting   = "starting"
+	statePlaying    = "playing"
+	stateRecording  = "recording"
+	stateClosed     = "closed"
+)
+
+// trackName returns the name of a format in outputs, (ex) video/96
+func trackName(medi *description.Media, forma format.Format) string {
+	return fmt.Sprintf("%s/%d", medi.Type, forma.PayloadType())
+}
+
+// mediaName returns the media type, suffixed with its index if the type is not unique.
+func mediaName(medias []*description.Media, i int) string {
+	for j, medi := range medias {
+		if j != i && medi.Type == medias[i].Type {
+			return fmt.Sprintf("%s#%d", medias[i].Type, i)
+		}
+	}
+	return string(medias[i].Type)
+}
+
+func (s *session) setState(state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	s.stateSince = time.Now()
+}
+
+// startClient starts a client on the scheme and host of u.
+func (s *session) startClient(c *gortsplib.Client, u *base.URL) error {
+	s.mu.Lock()
+	s.dialScheme = u.Scheme
+	s.mu.Unlock()
+	return c.Start(u.Scheme, u.Host)
+}
+
+func (s *session) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	start := time.Now()
+	s.resolveMu.Lock()
+	address, err := s.run.resolver.address(ctx, address, s.resolved)
+	s.resolveMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.run.sources.dial(ctx, s.localIP, network, address)
+	if err != nil {
+		return nil, err
+	}
+	s.handshake.connected(time.Since(start))
+	s.mu.Lock()
+	s.localAddr = conn.LocalAddr().String()
+	s.remoteAddr = conn.RemoteAddr().String()
+	s.mu.Unlock()
+	if s.cfg.readRate > 0 {
+		conn = newThrottledConn(conn, s.cfg.readRate, &s.readThrottled)
+	}
+	if s.srtp != nil {
+		conn = newSRTPConn(conn, s.srtp)
+	}
+	s.mu.Lock()
+	scheme := s.dialScheme
+	s.mu.Unlock()
+	// rtsps is dialed here and wrapped in tls by the client, its requests are not readable
+	if scheme != "rtsps" {
+		rc := newServerRequestConn(conn, s)
+		s.mu.Lock()
+		s.rtspConn = rc
+		s.mu.Unlock()
+		conn = rc
+	}
+	return conn, nil
+}
+
+func (s *session) listenPacket(network, address string) (net.PacketConn, error) {
+	pc, err := s.listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.udpAddrs = append(s.udpAddrs, pc.LocalAddr().String())
+	s.mu.Unlock()
+
+	if s.cfg.kernelTimestamps {
+		if uc, ok := pc.(*net.UDPConn); ok {
+			rc, err := uc.SyscallConn()
+			if err == nil {
+				err = enableKernelTimestamps(rc)
+			}
+			if err != nil {
+				s.logf("failed to enable kernel timestamps, %v", err)
+			} else {
+				s.mu.Lock()
+				if s.rawConns == nil {
+					s.rawConns = make(map[int]syscall.RawConn)
+				}
+				s.rawConns[uc.LocalAddr().(*net.UDPAddr).Port] = rc
+				s.mu.Unlock()
+			}
+		}
+	}
+	if uc, ok := pc.(*net.UDPConn); ok {
+		if s.cfg.udpRcvbuf > 0 {
+			s.mu.Lock()
+			s.udpConns = append(s.udpConns, uc)
+			s.mu.Unlock()
+		}
+		if s.run.udpDrops != nil {
+			s.run.udpDrops.add(s, uc)
+		}
+	}
+	return pc, nil
+}
+
+// bindRxConns finds the sockets of a setupped media by the client ports of the SETUP response.
+func (s *session) bindRxConns(medi *description.Media, res *base.Response) {
+	var th headers.Transport
+	if err := th.Unmarshal(res.Header["Transport"]); err != nil || th.ClientPorts == nil {
+		s.logf("no client ports in the SETUP response, kernel timestamps are not used for %s", medi.Type)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rxConns == nil {
+		s.rxConns = make(map[*description.Media][2]syscall.RawConn)
+		s.rxLast = make(map[*description.Media]*[2]time.Time)
+	}
+	s.rxConns[medi] = [2]syscall.RawConn{s.rawConns[th.ClientPorts[0]], s.rawConns[th.ClientPorts[1]]}
+	s.rxLast[medi] = &[2]time.Time{}
+}
+
+// arrival returns the receive time of the packet of a media being read,
+// by the kernel if -kernel-timestamps is set and available, rtcp is 0 for RTP and 1 for RTCP.
+// It should be called on the goroutine reading the packet, before the next read, and costs an ioctl.
+// SIOCGSTAMPNS gives the time of the last datagram read, shared by all the packets the reorderer
+// of the client releases with it: only the first one is kernel timed, the packets it held get
+// time.Now() as without -kernel-timestamps. The first one is the packet of the datagram, but
+// when the reorderer gives up on a gap over its buffer, a held packet then.
+func (s *session) arrival(medi *description.Media, rtcp int) time.Time {
+	if rc := s.rxConns[medi][rtcp]; rc != nil {
+		if t, err := kernelRxTime(rc); err == nil {
+			if last := &s.rxLast[medi][rtcp]; !t.Equal(*last) {
+				*last = t
+				if rtcp == 0 {
+					atomic.AddUint64(&s.kernelTimed, 1)
+				}
+				return t
+			}
+		}
+	}
+	return time.Now()
+}
+
+// setupTracks creates the per format analyzers of the setupped medias.
+func (s *session) setupTracks(medias []*description.Media, feats []rtcpFeatures) error {
+	videoTracks := make(map[format.Format]*videoTrack)
+	tracks := make(map[format.Format]*mediaTrack)
+	srs := make(map[*description.Media]*srAnalyzer)
+	names := make(map[*description.Media]string)
+	rrs := make(map[*description.Media]*rrSender)
+	tsAnalyzers := make(map[format.Format]*tsAnalyzer)
+	audioTracks := make(map[format.Format]*audioTrack)
+	for i, medi := range medias {
+		names[medi] = mediaName(medias, i)
+		srs[medi] = &srAnalyzer{
+			s:         s,
+			name:      names[medi],
+			clockRate: medi.Formats[0].ClockRate(),
+			stats:     rtcpStats{rtcpFeatures: feats[i]},
+		}
+		if s.cfg.rrInterval > 0 {
+			rrs[medi] = newRRSender(medi.Formats[0].ClockRate(), feats[i].ReducedSize)
+		}
+		for _, forma := range medi.Formats {
+			tracks[forma] = &mediaTrack{
+				name:      trackName(medi, forma),
+				codec:     forma.Codec(),
+				clockRate: forma.ClockRate(),
+				playout:   newPlayoutBuffer(s.cfg.playoutBuffer, forma.ClockRate()),
+			}
+			if (s.cfg.tsAnalysis || s.cfg.scte35) && isMPEGTS(forma) {
+				tsAnalyzers[forma] = newTSAnalyzer(s, tracks[forma].name)
+			}
+			if s.cfg.analyzeAudio() && medi.Type == description.MediaTypeAudio {
+				at, err := newAudioTrack(s, tracks[forma].name, forma)
+				if err != nil {
+					return err
+				}
+				if at != nil {
+					audioTracks[forma] = at
+				} else {
+					s.logf("audio %s: %s is not analyzed, only G711 and LPCM", tracks[forma].name, forma.Codec())
+				}
+			}
+			if !s.cfg.analyzeVideo() {
+				continue
+			}
+			vt, err := newVideoTrack(s, forma)
+			if err != nil {
+				return err
+			}
+			if vt != nil {
+				vt.name = tracks[forma].name
+				videoTracks[forma] = vt
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.videoTracks = videoTracks
+	s.tracks = tracks
+	s.rtcp = srs
+	s.mediaNames = names
+	s.rrs = rrs
+	s.avSync = newAVSync(s, medias)
+	s.tsAnalyzers = tsAnalyzers
+	s.audioTracks = audioTracks
+	return nil
+}
+
+// logSummary logs the results of the session analyzers.
+func (s *session) logSummary() {
+	h := s.cfg.human()
+	var packets, bytes uint64
+	var lost int64
+	for _, t := range s.tracks {
+		st := t.stats()
+		packets, bytes, lost = packets+st.Packets, bytes+st.Bytes, lost+st.Lost
+		s.summaryf("bitrate %s: avg %s, min %s, max %s",
+			t.name, h.bitrate(st.Bitrate.Average), h.bitrate(st.Bitrate.Min), h.bitrate(st.Bitrate.Max))
+		s.summaryf("stats %s %s: packets %d, bytes %s, lost %d",
+			t.name, st.Codec, st.Packets, h.bytes(st.Bytes), st.Lost)
+		s.summaryf("gaps %s: p50 %s, p99 %s, p999 %s, max %s", t.name, h.duration(time.Duration(st.Gaps.P50)),
+			h.duration(time.Duration(st.Gaps.P99)), h.duration(time.Duration(st.Gaps.P999)), h.duration(time.Duration(st.Gaps.Max)))
+		if p := st.Playout; p != nil {
+			s.summaryf("playout %s: buffer %s, underruns %d, stalled %s",
+				t.name, h.duration(time.Duration(p.Buffer)), p.Underruns, h.duration(time.Duration(p.Stalled)))
+		}
+		for ssrc, ss := range st.SSRCs {
+			s.summaryf("stats %s ssrc %s: packets %d, bytes %s, lost %d, jitter %s",
+				t.name, ssrc, ss.Packets, h.bytes(ss.Bytes), ss.Lost, h.duration(time.Duration(ss.Jitter)))
+		}
+	}
+
+	s.run.families.addTraffic(s.family(), packets, bytes, lost)
+
+	s.mu.Lock()
+	avg := s.bitrate.stats.Average
+	s.mu.Unlock()
+	if alarm := s.run.getThresholds().checkBitrate(avg); alarm != "" {
+		s.summaryf("average bitrate %s %s", h.bitrate(avg), alarm)
+	}
+
+	s.mu.Lock()
+	muxPackets, packets := s.rtcpMuxPackets, s.packets
+	breaks, breakGap := s.breaks, s.breakGap
+	s.mu.Unlock()
+	if breaks != 0 {
+		s.summaryf("continuity breaks %d (set up again after 454), without packets %s", breaks, h.duration(breakGap))
+	}
+	s.logNACK()
+	s.logParameters()
+	s.logBackchannels()
+	if s.srtp != nil {
+		st := s.srtp.snapshot()
+		s.summaryf("srtp: decrypted rtp %d, rtcp %d, authentication failures %d", st.RTP, st.RTCP, st.AuthFailures)
+	}
+	if s.faults != nil {
+		f := s.faults.snapshot()
+		s.summaryf("fault injection: dropped %d, reordered %d, delayed %d of %d rtp packets",
+			f.Dropped, f.Reordered, f.Delayed, packets+f.Dropped)
+	}
+	if s.cfg.readRate > 0 {
+		s.summaryf("read rate %s: reads waited %s, the server sent faster if long (see the losses and the delays)",
+			h.bitrate(s.cfg.readRate), h.duration(time.Duration(atomic.LoadInt64(&s.readThrottled))))
+	}
+	if s.cfg.kernelTimestamps {
+		s.summaryf("kernel timestamps: %d of %d rtp packets", atomic.LoadUint64(&s.kernelTimed), packets)
+	}
+	if drops := atomic.LoadUint64(&s.kernelDrops); drops > 0 {
+		s.summaryf("udp: the kernel dropped %d packets, the receive buffer overflows, these losses are local", drops)
+	}
+	if reqs := s.serverRequestsString(); reqs != "" {
+		s.summaryf("server requests: %s", reqs)
+	}
+	if muxPackets != 0 {
+		s.summaryf("rtcp: %d packets multiplexed on the RTP port are ignored, use -transport TCP to analyze them", muxPackets)
+	}
+
+	for _, a := range s.rtcp {
+		st := a.snapshot()
+		if st.SenderReports == 0 {
+			continue
+		}
+		s.summaryf("rtcp %s: sender reports %d, interval min/avg/max %s/%s/%s, interval alarms %d, "+
+			"media clock drift %s ppm, wall clock drift %s ppm",
+			a.name, st.SenderReports, h.duration(time.Duration(st.MinInterval)),
+			h.duration(time.Duration(st.AvgInterval)), h.duration(time.Duration(st.MaxInterval)),
+			st.IntervalAlarms, h.float(st.MediaClockDrift), h.float(st.WallClockDrift))
+	}
+
+	for _, at := range s.audioTracks {
+		st := at.snapshot()
+		loudness := "n/a"
+		if st.Measured {
+			loudness = h.float(st.Loudness) + " LUFS"
+		}
+		s.summaryf("audio %s %s: loudness %s, max silence %s, silence alarms %d",
+			at.name, at.codec, loudness, h.duration(time.Duration(st.MaxSilence)), st.SilenceAlarms)
+	}
+
+	for _, ta := range s.tsAnalyzers {
+		if s.cfg.scte35 {
+			st := ta.scte35Snapshot()
+			s.summaryf("scte35 %s: splice_insert %d, time_signal %d, splice_null %d, other %d, invalid %d",
+				ta.name, st.SpliceInserts, st.TimeSignals, st.SpliceNulls, st.Others, st.Invalid)
+		}
+		if !s.cfg.tsAnalysis {
+			continue
+		}
+		st := ta.snapshot()
+		s.summaryf("mpegts %s: packets %d, cc errors %d, sync loss %d, pcrs %d, pcr repetition errors %d, "+
+			"pcr discontinuities %d, max pcr interval %s, pcr jitter avg/max %s/%s, pts discontinuities %d",
+			ta.name, st.Packets, st.CCErrors, st.SyncLoss, st.PCRs, st.PCRRepetitionErrors, st.PCRDiscontinuities,
+			h.duration(time.Duration(st.MaxPCRInterval)), h.duration(time.Duration(st.AvgPCRJitter)),
+			h.duration(time.Duration(st.MaxPCRJitter)), st.PTSDiscontinuities)
+	}
+
+	if s.avSync != nil {
+		if st := s.avSync.snapshot(); st.Samples != 0 {
+			s.summaryf("av sync %s/%s: skew min/avg/max %s/%s/%s, max-av-skew alarms %d",
+				s.mediaNames[s.avSync.video], s.mediaNames[s.avSync.audio], h.duration(time.Duration(st.Min)),
+				h.duration(time.Duration(st.Avg)), h.duration(time.Duration(st.Max)), st.Alarms)
+		}
+	}
+
+	for forma, vt := range s.videoTracks {
+		if s.cfg.measureGOP || s.cfg.maxGOP > 0 {
+			g := vt.gopStats()
+			s.summaryf("gop %s %s: keyframes %d, interval min/avg/max %s/%s/%s, frames %s, max-gop alarms %d",
+				s.tracks[forma].name, vt.codec, g.Keyframes, h.duration(time.Duration(g.MinInterval)),
+				h.duration(time.Duration(g.AvgInterval)), h.duration(time.Duration(g.MaxInterval)),
+				g.framesString(), g.Alarms)
+		}
+		if s.cfg.captions() {
+			c := vt.captionStats()
+			s.summaryf("captions %s %s: frames with captions %d, cea-608 %d (%s/s), cea-708 %d (%s/s), max gap %s",
+				s.tracks[forma].name, vt.codec, c.Frames, c.CEA608, h.float(c.CEA608Rate), c.CEA708, h.float(c.CEA708Rate),
+				h.duration(time.Duration(c.MaxGap)))
+		}
+		if s.cfg.freezeTimeout > 0 {
+			vt.endFreeze(time.Now())
+			f := vt.freezeStats()
+			s.summaryf("freeze %s %s: freezes %d, total %s, max %s",
+				s.tracks[forma].name, vt.codec, f.Freezes, h.duration(time.Duration(f.Total)), h.duration(time.Duration(f.Max)))
+		}
+		if !s.cfg.checkBitstream {
+			continue
+		}
+		st := vt.bitstreamStats()
+		s.summaryf("bitstream %s %s: access units %d, malformed %d "+
+			"(corrupted nalus %d, missing sps/pps %d, incomplete %d, decode errors %d)",
+			s.tracks[forma].name, vt.codec, st.AccessUnits, st.Malformed,
+			st.CorruptedNALUs, st.MissingParams, st.Incomplete, st.DecodeErrors)
+	}
+}
+
+// deliverRTP processes a received RTP packet, on the shard if any.
+func (s *session) deliverRTP(now time.Time, medi *description.Media, forma format.Format, pkt *rtp.Packet) {
+	if s.shard != nil {
+		s.shard.onPacketRTP(s, now, medi, forma, pkt)
+		return
+	}
+	s.onPacketRTP(now, medi, forma, pkt)
+}
+
+func (s *session) onPacketRTP(now time.Time, medi *description.Media, forma format.Format, pkt *rtp.Packet) {
+	defer exitOnPanic()
+	s.mu.Lock()
+	s.lastPackets[s.packets%lastPacketsSize] = packetInfo{
+		Time:           now,
+		Media:          string(medi.Type),
+		PayloadType:    pkt.PayloadType,
+		SequenceNumber: pkt.SequenceNumber,
+		Timestamp:      pkt.Timestamp,
+		Marker:         pkt.Marker,
+		Size:           len(pkt.Payload),
+	}
+	s.packets++
+	s.bytes += uint64(len(pkt.Payload))
+	s.lastPacket = now
+	s.bitrate.add(now, len(pkt.Payload), s.checkBitrate)
+	var gap time.Duration
+	if !s.breakSince.IsZero() {
+		gap = now.Sub(s.breakSince)
+		s.breakGap += gap
+		s.breakSince = time.Time{}
+	}
+	if s.run.report != nil {
+		s.run.report.addBytes(len(pkt.Payload))
+	}
+	if s.run.statsd != nil {
+		s.run.statsd.addPacket(len(pkt.Payload))
+	}
+	if s.run.stats != nil {
+		s.run.stats.addPacket()
+	}
+	name := s.mediaNames[medi]
+	_, seen := s.firstPackets[name]
+	firstOfAll := len(s.firstPackets) == 0
+	var ttfp time.Duration
+	if !seen {
+		if s.firstPackets == nil {
+			s.firstPackets = make(map[string]time.Duration)
+		}
+		ttfp = s.handshake.sincePlay(now)
+		s.firstPackets[name] = ttfp
+	}
+	s.mu.Unlock()
+
+	if gap != 0 {
+		s.logf("continuity break: no packets for %s", s.cfg.human().duration(gap))
+	}
+	if !seen {
+		s.summaryf("time to first rtp packet %s: %s", name, s.cfg.human().duration(ttfp))
+		s.run.latency.record(map[string]duration{firstPacketPhase(name): duration(ttfp)})
+	}
+	if firstOfAll && s.onFirstPacket != nil {
+		s.onFirstPacket(now)
+	}
+
+	s.dc.Check(now, pkt, forma.ClockRate())
+
+	if s.pcap != nil {
+		s.pcap.writeRTP(medi, pkt)
+	}
+
+	if s.ts != nil && forma == s.tsFormat {
+		s.ts.write(pkt)
+	}
+
+	if s.integrity != nil && forma == s.integrity.forma && isMPEGTS(forma) {
+		s.integrity.writeTS(pkt.Payload)
+	}
+
+	if s.exec != nil {
+		s.exec.onPacketRTP(forma, pkt)
+	}
+
+	if rs := s.rrs[medi]; rs != nil {
+		rs.onPacketRTP(now, pkt)
+	}
+
+	if t := s.tracks[forma]; t != nil {
+		if stall := t.onPacket(now, pkt); stall != 0 {
+			s.logf("playout %s: buffer underrun, stalled %s", t.name, s.cfg.human().duration(stall))
+		}
+	}
+
+	if st := s.subtitles[forma]; st != nil {
+		st.onPacket(now, pkt)
+	}
+
+	if vt := s.videoTracks[forma]; vt != nil {
+		vt.onPacketRTP(now, pkt)
+	}
+
+	if s.avSync != nil {
+		s.avSync.onPacketRTP(now, medi, pkt)
+	}
+
+	if ta := s.tsAnalyzers[forma]; ta != nil {
+		ta.onPacketRTP(now, pkt)
+	}
+
+	if at := s.audioTracks[forma]; at != nil {
+		at.onPacketRTP(pkt)
+	}
+
+	if s.loopback != nil {
+		s.loopback.onPacketRTP(now, forma, pkt)
+	}
+}
+
+// onDecodableKeyframe records the time from the PLAY response to the first decodable keyframe of a video track.
+func (s *session) onDecodableKeyframe(now time.Time, name string) {
+	s.mu.Lock()
+	if s.firstKeyframes == nil {
+		s.firstKeyframes = make(map[string]time.Duration)
+	}
+	firstOfAll := len(s.firstKeyframes) == 0
+	d := s.handshake.sincePlay(now)
+	s.firstKeyframes[name] = d
+	s.mu.Unlock()
+
+	s.summaryf("time to first keyframe %s: %s", name, s.cfg.human().duration(d))
+	s.run.latency.record(map[string]duration{firstKeyframePhase(name): duration(d)})
+	if firstOfAll && s.onFirstKeyframe != nil {
+		s.onFirstKeyframe(now)
+	}
+}
+
+func (s *session) onPacketRTCP(now time.Time, medi *description.Media, pkt rtcp.Packet) {
+	defer exitOnPanic()
+	if s.pcap != nil {
+		s.pcap.writeRTCP(medi, pkt)
+	}
+	if a := s.rtcp[medi]; a != nil {
+		a.onPacketRTCP(now, pkt)
+	}
+	if rs := s.rrs[medi]; rs != nil {
+		rs.onPacketRTCP(now, pkt)
+	}
+}
+
+// checkBitrate checks the bitrate of a closed window against the thresholds,
+// logging when an assertion starts or stops being violated.
+// It is called with s.mu locked.
+func (s *session) checkBitrate(br bitrate) {
+	alarm := s.run.getThresholds().checkBitrate(br)
+	if alarm == s.bitrateAlarm {
+		return
+	}
+	if alarm != "" {
+		s.logf("bitrate %v %s", br, alarm)
+	} else {
+		s.logf("bitrate %v recovered", br)
+	}
+	s.bitrateAlarm = alarm
+}
+
+func (s *session) snapshot() *sessionSnapshot {
+	s.mu.Lock()
+	ss := &sessionSnapshot{
+		Time:       time.Now(),
+		ID:         s.id,
+		URL:        s.url,
+		Class:      s.class,
+		Labels:     s.cfg.runLabels(),
+		State:      s.state,
+		StateSince: s.stateSince,
+		Transport:  s.cfg.transport,
+		LocalAddr:  s.localAddr,
+		RemoteAddr: s.remoteAddr,
+		UDPAddrs:   append([]string(nil), s.udpAddrs...),
+		Packets:    s.packets,
+		Bytes:      s.bytes,
+		LastPacket: s.lastPacket,
+		Bitrate:    s.bitrate.stats,
+
+		RTCPMuxPackets: s.rtcpMuxPackets,
+
+		ContinuityBreaks: s.breaks,
+		ContinuityGap:    duration(s.breakGap),
+		ReadThrottled:    duration(atomic.LoadInt64(&s.readThrottled)),
+		KernelDrops:      atomic.LoadUint64(&s.kernelDrops),
+		Redirects:        append([]string(nil), s.redirects...),
+	}
+	if len(s.serverRequests) != 0 {
+		ss.ServerRequests = make(map[string]int)
+		for m, n := range s.serverRequests {
+			ss.ServerRequests[m] = n
+		}
+	}
+	if s.faults != nil {
+		f := s.faults.snapshot()
+		ss.InjectedFaults = &f
+	}
+	if s.srtp != nil {
+		st := s.srtp.snapshot()
+		ss.SRTP = &st
+	}
+	if len(s.nacks) != 0 {
+		ss.NACK = make(map[string]nackStats)
+		for _, nm := range s.nacks {
+			ss.NACK[nm.name] = nm.snapshot()
+		}
+	}
+	if s.integrity != nil {
+		st := s.integrity.snapshot()
+		ss.Integrity = &st
+	}
+	if s.params != nil {
+		st := s.params.snapshot()
+		ss.Parameters = &st
+	}
+	for _, bs := range s.backchannels {
+		if ss.Backchannels == nil {
+			ss.Backchannels = make(map[string]backchannelStats)
+		}
+		ss.Backchannels[bs.name] = bs.snapshot()
+	}
+	if len(s.subtitles) != 0 {
+		ss.Subtitles = make(map[string]subtitleStats)
+		for _, st := range s.subtitles {
+			ss.Subtitles[st.name] = st.snapshot()
+		}
+	}
+	if len(s.firstPackets) != 0 {
+		ss.FirstPacket = make(map[string]duration)
+		for name, d := range s.firstPackets {
+			ss.FirstPacket[name] = duration(d)
+		}
+	}
+	if len(s.firstKeyframes) != 0 {
+		ss.FirstKeyframe = make(map[string]duration)
+		for name, d := range s.firstKeyframes {
+			ss.FirstKeyframe[name] = duration(d)
+		}
+	}
+	n := s.packets
+	if n > lastPacketsSize {
+		n = lastPacketsSize
+	}
+	for i := uint64(0); i < n; i++ {
+		ss.LastPackets = append(ss.LastPackets, s.lastPackets[(s.packets-n+i)%lastPacketsSize])
+	}
+
+	videoTracks, tracks, srs, as, tas, ats := s.videoTracks, s.tracks, s.rtcp, s.avSync, s.tsAnalyzers, s.audioTracks
+	s.mu.Unlock()
+
+	ss.DelayChecker = s.dc.state()
+	ss.Handshake = s.handshake.snapshot()
+	ss.Tracks = make(map[string]trackStats)
+	for _, t := range tracks {
+		ss.Tracks[t.name] = t.stats()
+	}
+	if len(srs) != 0 {
+		ss.RTCP = make(map[string]rtcpStats)
+		for _, a := range srs {
+			ss.RTCP[a.name] = a.snapshot()
+		}
+	}
+	if as != nil {
+		st := as.snapshot()
+		ss.AVSync = &st
+	}
+	if len(ats) != 0 {
+		ss.Audio = make(map[string]audioStats)
+		for _, at := range ats {
+			ss.Audio[at.name] = at.snapshot()
+		}
+	}
+	if len(tas) != 0 && s.cfg.tsAnalysis {
+		ss.TS = make(map[string]tsStats)
+		for _, ta := range tas {
+			ss.TS[ta.name] = ta.snapshot()
+		}
+	}
+	if len(tas) != 0 && s.cfg.scte35 {
+		ss.SCTE35 = make(map[string]scte35Stats)
+		for _, ta := range tas {
+			ss.SCTE35[ta.name] = ta.scte35Snapshot()
+		}
+	}
+	if len(videoTracks) != 0 {
+		ss.Bitstream = make(map[string]bitstreamStats)
+		ss.GOP = make(map[string]gopStats)
+		if s.cfg.freezeTimeout > 0 {
+			ss.Freeze = make(map[string]freezeStats)
+		}
+		if s.cfg.captions() {
+			ss.Captions = make(map[string]captionStats)
+		}
+		for forma, vt := range videoTracks {
+			ss.Bitstream[tracks[forma].name] = vt.bitstreamStats()
+			ss.GOP[tracks[forma].name] = vt.gopStats()
+			if s.cfg.freezeTimeout > 0 {
+				ss.Freeze[tracks[forma].name] = vt.freezeStats()
+			}
+			if s.cfg.captions() {
+				ss.Captions[tracks[forma].name] = vt.captionStats()
+			}
+		}
+	}
+	ss.inTZ()
+	return ss
+}
+
+func (s *session) prefix() string {
+	if s.class == "" {
+		return "[" + s.id + "]"
+	}
+	return "[" + s.class + "][" + s.id + "]"
+}
+
+func (s *session) logf(format string, v ...interface{}) {
+	s.run.logger.Printf(s.prefix()+" "+format, v...)
+}
+
+func (s *session) errorf(format string, v ...interface{}) error {
+	s.failure = strings.TrimSpace(strings.SplitN(strings.SplitN(format, ",", 2)[0], "%", 2)[0])
+	return fmt.Errorf(s.prefix()+" "+format, v...)
+}
+
+func (s *session) handshakeDone(err error) {
+	s.handshakeOnce.Do(func() {
+		s.handshakeOK = err == nil
+		phases := s.handshake.snapshot()
+		s.run.latency.record(phases)
+		s.run.families.addHandshake(s.family(), phases, err)
+		if s.run.soak != nil && err == nil {
+			s.run.soak.addHandshake(phases)
+		}
+		if s.run.statsd != nil {
+			s.run.statsd.onHandshake(phases, err)
+		}
+		var b strings.Builder
+		for _, p := range handshakePhases {
+			if d, ok := phases[p]; ok {
+				fmt.Fprintf(&b, " %s %s", p, s.cfg.human().duration(time.Duration(d)))
+			}
+		}
+		s.summaryf("handshake latency:%s", b.String())
+
+		if s.onHandshake != nil {
+			s.onHandshake(err)
+		}
+	})
+}
+
+// teardown closes the session with a TEARDOWN, the session ends without error.
+func (s *session) teardown() {
+	s.mu.Lock()
+	s.tornDown = true
+	closeClient := s.closeClient
+	s.mu.Unlock()
+	if closeClient != nil {
+		closeClient()
+	}
+}
+
+// loseCaptions ends the session whose video has no captions for longer than -max-caption-gap.
+func (s *session) loseCaptions(gap time.Duration) {
+	s.mu.Lock()
+	if s.captionGap != 0 {
+		s.mu.Unlock()
+		return
+	}
+	s.captionGap = gap
+	closeClient := s.closeClient
+	s.mu.Unlock()
+	if closeClient != nil {
+		// not on the goroutine reading the packets, that the client waits for
+		go closeClient()
+	}
+}
+
+func (s *session) isTornDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tornDown
+}
+
+// newClient returns the client of the session, it logs the packet errors,
+// measures the handshake and applies -keepalive.
+func (s *session) newClient() *gortsplib.Client {
+	tr := gortsplib.TransportUDP
+	if s.cfg.transport == "TCP" {
+		tr = gortsplib.TransportTCP
+	}
+	k := newKeepalive(s)
+	var c *gortsplib.Client
+	c = &gortsplib.Client{
+		Transport:    &tr,
+		ReadTimeout:  2 * time.Second,
+		WriteTimeout: 2 * time.Second,
+		DialContext:  s.dial,
+		ListenPacket: s.listenPacket,
+		// Require: www.onvif.org/ver20/backchannel
+		RequestBackChannels: s.cfg.backchannel,
+		OnPacketLost: func(err error) {
+			var lost liberrors.ErrClientRTPPacketsLost
+			if errors.As(err, &lost) && lost.Lost < s.run.getThresholds().LossThreshold {
+				return
+			}
+			s.logf("%v", err)
+		},
+		OnDecodeError: func(err error) {
+			var unknown liberrors.ErrClientRTPPacketUnknownPayloadType
+			if errors.As(err, &unknown) && isMuxedRTCP(unknown.PayloadType) {
+				s.mu.Lock()
+				s.rtcpMuxPackets++
+				s.mu.Unlock()
+				return
+			}
+			s.logf("%v", err)
+		},
+		OnResponse: func(res *base.Response) {
+			s.handshake.onResponse(res)
+			if s.srtp != nil {
+				responseSAVP(res)
+			}
+			if res.StatusCode == base.StatusSessionNotFound {
+				s.onSessionNotFound(c, res)
+			}
+			s.onRedirectResponse(res)
+			if s.cfg.parameterRequests() {
+				s.onSessionHeader(res)
+			}
+			if k != nil {
+				k.onResponse(res)
+			}
+			if ct := res.Header["Content-Type"]; len(ct) == 1 && strings.HasPrefix(ct[0], "application/sdp") {
+				var notes []string
+				res.Body, notes = s.cfg.clockRates.fixSDP(fixTextMedias(res.Body))
+				for _, n := range notes {
+					s.logf("sdp %s", n)
+				}
+			}
+		},
+		OnRequest: func(req *base.Request) {
+			if s.run.limiter != nil {
+				s.run.limiter.wait()
+			}
+			s.cfg.headers.apply(req)
+			s.handshake.onRequest(req)
+			if k != nil {
+				k.onRequest(req)
+			}
+			if s.setupMux {
+				requestRTCPMux(req)
+			}
+			if s.setupSecure {
+				requestSAVP(req)
+			}
+		},
+		// the requests over rtsps, the others are answered by serverRequestConn
+		OnServerRequest: s.onUnansweredServerRequest,
+	}
+	if s.cfg.trace {
+		(&tracer{s: s, redact: s.cfg.traceRedact}).install(c)
+	}
+	return c
+}
+
+func (s *session) play() error {
+	var err error
+	if s.cfg.loopback {
+		err = s.loopbackInternal()
+	} else if s.run.publish != nil {
+		err = s.publishInternal()
+	} else {
+		err = s.playRedirected()
+	}
+	if derr := s.setupDeadlineError(); derr != nil {
+		err = derr
+	}
+	if s.run.udpDrops != nil {
+		s.run.udpDrops.remove(s)
+	}
+	if s.isTornDown() {
+		s.logf("torn down")
+		s.failure = ""
+		err = nil
+	}
+	s.handshakeDone(err)
+	if err == nil {
+		err = s.checkContent()
+	}
+	return err
+}
+
+// checkContent verifies what the session received, a torn down session can fail on it.
+func (s *session) checkContent() error {
+	if err := s.checkAudioData(); err != nil {
+		return err
+	}
+	if err := s.checkSubtitles(); err != nil {
+		return err
+	}
+	if err := s.checkParameters(); err != nil {
+		return err
+	}
+	return s.checkIntegrity()
+}
+
+func (s *session) playInternal() error {
+	s.dc = &DelayChecker{s: s}
+	s.setState(stateConnecting)
+	s.run.sessions.add(s)
+	defer func() {
+		s.setState(stateClosed)
+		s.run.sessions.remove(s)
+	}()
+
+	c := s.newClient()
+
+	u, err := base.ParseURL(s.url)
+	if err != nil {
+		return s.errorf("failed to parse url, %v", err)
+	}
+
+	err = s.startClient(c, u)
+	if err != nil {
+		return s.errorf("failed to start client, %v", err)
+	}
+	// c is replaced by the client of a setup again, nil if it failed
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+	s.mu.Lock()
+	s.closeClient = c.Close
+	tornDown := s.tornDown
+	s.mu.Unlock()
+	if tornDown {
+		return nil
+	}
+	stopDeadline := s.startSetupDeadline(c)
+	defer stopDeadline()
+
+	s.setState(stateDescribing)
+	var desc *description.Session
+	var descRes *base.Response
+	cached := false
+	if s.run.describeCache != nil {
+		desc, descRes, cached, err = s.run.describeCache.describe(c, u)
+	} else {
+		desc, descRes, err = c.Describe(u)
+	}
+	if err != nil {
+		return s.errorf("failed to describe, %v", err)
+	}
+	if cached {
+		s.logf("success to describe from the cache, %v", descRes)
+	} else {
+		s.logf("success to describe, %v", descRes)
+	}
+	if s.cfg.printSDP {
+		s.logf("sdp\n%s", sdpString(desc))
+	}
+	if err := s.cfg.checkSDP(desc); err != nil {
+		return s.errorf("invalid sdp, %v", err)
+	}
+
+	if err := s.cfg.controlPolicy(u).apply(desc, descRes, u); err != nil {
+		return s.errorf("failed to apply control policy, %v", err)
+	}
+	if err := s.setupBackchannels(desc); err != nil {
+		return s.errorf("failed to setup backchannel, %v", err)
+	}
+
+	s.setState(stateSettingUp)
+	feats := sdpRTCPFeatures(descRes.Body, len(desc.Medias))
+	s.srtpMedias, err = s.setupSRTP(desc, descRes.Body)
+	if err != nil {
+		return s.errorf("failed to setup srtp, %v", err)
+	}
+	feats, s.audio, err = s.selectAudio(desc, descRes.Body, feats)
+	if err != nil {
+		return s.errorf("failed to select audio, %v", err)
+	}
+	feats, err = s.selectMedias(desc, feats)
+	if err != nil {
+		return s.errorf("failed to select medias, %v", err)
+	}
+	if err := s.setupMedias(c, desc, feats); err != nil {
+		return err
+	}
+	s.logf("success to setup")
+
+	if err := s.setupTracks(desc.Medias, feats); err != nil {
+		return s.errorf("failed to setup tracks, %v", err)
+	}
+	defer s.logSummary()
+	if s.cfg.nack {
+		s.setupNACK(desc.Medias, feats)
+	}
+	if err := s.setupSubtitles(desc.Medias); err != nil {
+		return s.errorf("failed to create subtitle file, %v", err)
+	}
+	defer s.closeSubtitles()
+	if s.cfg.expectSubtitles && len(s.subtitles) == 0 {
+		return s.errorf("no subtitle track in the sdp")
+	}
+	if s.cfg.manifest != "" {
+		s.setupIntegrity(desc.Medias)
+		if s.integrity != nil {
+			// the results of a session ended by the server are logged too
+			defer s.integrity.finish()
+		}
+	}
+
+	if s.cfg.pcapDir != "" {
+		s.mu.Lock()
+		remoteAddr, localAddr := s.remoteAddr, s.localAddr
+		s.mu.Unlock()
+		s.pcap, err = newPcapWriter(s.cfg.pcapDir, s.id, remoteAddr, localAddr, desc.Medias)
+		if err != nil {
+			return s.errorf("failed to create pcap file, %v", err)
+		}
+		defer func() {
+			if err := s.pcap.close(); err != nil {
+				s.logf("failed to write pcap file, %v", err)
+			}
+		}()
+	}
+
+	if s.cfg.tsDir != "" {
+		if err := s.setupTS(desc.Medias); err != nil {
+			return s.errorf("failed to create ts file, %v", err)
+		}
+		if s.ts != nil {
+			defer func() {
+				packets, invalid := s.ts.stats()
+				s.summaryf("mpegts: wrote %d ts packets, dropped %d invalid rtp payloads", packets, invalid)
+				if err := s.ts.close(); err != nil {
+					s.logf("failed to write ts, %v", err)
+				}
+			}()
+		}
+	}
+
+	if s.cfg.exec != "" && s.id == s.cfg.execSession() {
+		s.exec, err = newExecPipe(s, desc.Medias)
+		if err != nil {
+			return s.errorf("failed to start exec, %v", err)
+		}
+		if s.exec == nil {
+			s.logf("exec: no MPEG-TS or H264/H265 format to pipe")
+		} else {
+			defer s.exec.close()
+		}
+	}
+
+	s.onPackets(c)
+	if s.shard != nil {
+		// the outputs are closed after the queued packets
+		defer s.shard.sync()
+	}
+
+	s.setState(stateStarting)
+	_, err = c.Play(nil)
+	if err != nil {
+		return s.errorf("failed to play, %v", err)
+	}
+	s.logf("success to play")
+	s.setState(statePlaying)
+	stopDeadline()
+	s.handshakeDone(nil)
+
+	stopRRs := s.startReceiverReports(c)
+	defer func() { stopRRs() }()
+	stopParams := s.startParameterRequests()
+	defer stopParams()
+	stopBackchannels := s.startBackchannels(c)
+	defer func() { stopBackchannels() }()
+
+	var firstPacketTimedOut int32
+	if s.cfg.firstPacketTimeout > 0 {
+		t := time.AfterFunc(s.cfg.firstPacketTimeout, func() {
+			s.mu.Lock()
+			packets := s.packets
+			s.mu.Unlock()
+			if packets == 0 {
+				atomic.StoreInt32(&firstPacketTimedOut, 1)
+				c.Close()
+			}
+		})
+		defer t.Stop()
+	}
+
+	err = c.Wait()
+	if atomic.LoadInt32(&firstPacketTimedOut) == 1 {
+		return s.errorf("no rtp packet within %v after play", s.cfg.firstPacketTimeout)
+	}
+	for s.takeSessionLost() && !s.isTornDown() {
+		stopRRs()
+		stopRRs = func() {}
+		stopBackchannels()
+		stopBackchannels = func() {}
+		c.Close()
+		c, err = s.resetup(u, desc, feats)
+		if err != nil || c == nil {
+			return err
+		}
+		stopRRs = s.startReceiverReports(c)
+		stopBackchannels = s.startBackchannels(c)
+		err = c.Wait()
+	}
+	s.mu.Lock()
+	captionGap := s.captionGap
+	s.mu.Unlock()
+	if captionGap != 0 {
+		return s.errorf("no captions for %v, over -max-caption-gap %v", captionGap, s.cfg.maxCaptionGap)
+	}
+	if err != nil && s.streamEnded() {
+		return nil
+	}
+	if err != nil {
+		return s.errorf("failed to play process, %v", err)
+	}
+	return nil
+}
+
+// setupTS creates the writer of the first MPEG-TS format of -ts-dir.
+func (s *session) setupTS(medias []*description.Media) error {
+	for _, medi := range medias {
+		for _, forma := range medi.Formats {
+			if !isMPEGTS(forma) {
+				continue
+			}
+			ts, err := newTSWriter(s.cfg.tsDir, s.id)
+			if err != nil {
+				return err
+			}
+			s.ts, s.tsFormat = ts, forma
+			return nil
+		}
+	}
+	s.logf("no MPEG-TS format to write")
+	return nil
+}
+
+// setupMedias sets up the medias of the description, negotiating the RTCP features.
+func (s *session) setupMedias(c *gortsplib.Client, desc *description.Session, feats []rtcpFeatures) error {
+	defer func() { s.setupMux, s.setupSecure = false, false }()
+	for i, medi := range desc.Medias {
+		// a mux only media fails without RTCP-mux, even over UDP
+		s.setupMux = feats[i].MuxOnly || (s.cfg.rtcpMux && feats[i].MuxOffered)
+		s.setupSecure = s.srtpMedias[medi]
+		res, err := c.Setup(desc.BaseURL, medi, 0, 0)
+		if err != nil {
+			return s.errorf("failed to setup, %v", err)
+		}
+		feats[i].Mux = transportHasRTCPMux(res.Header["Transport"])
+		if s.cfg.kernelTimestamps {
+			s.bindRxConns(medi, res)
+		}
+		if feats[i].MuxOffered || feats[i].Mux || feats[i].ReducedSize {
+			s.logf("rtcp %s: mux offered %v (only %v), negotiated %v, reduced-size offered %v",
+				mediaName(desc.Medias, i), feats[i].MuxOffered, feats[i].MuxOnly, feats[i].Mux, feats[i].ReducedSize)
+		}
+		if feats[i].Mux && s.cfg.transport != "TCP" {
+			s.logf("rtcp %s: multiplexed on the RTP port of UDP, only counted, "+
+				"the sender report analysis, -rr-interval and the A/V skew are unavailable", mediaName(desc.Medias, i))
+		}
+	}
+	s.setReadBuffers()
+	return nil
+}
+
+// onPackets sets the packet callbacks of the client,
+// the packets are timestamped on arrival, and processed on the shard if any.
+func (s *session) onPackets(c *gortsplib.Client) {
+	deliver := s.deliverRTP
+	if len(s.nacks) != 0 {
+		// after the fault injection, the dropped packets are requested too
+		deliver = func(now time.Time, medi *description.Media, forma format.Format, pkt *rtp.Packet) {
+			s.deliverNACK(c, now, medi, forma, pkt)
+		}
+	}
+	c.OnPacketRTPAny(func(medi *description.Media, forma format.Format, pkt *rtp.Packet) {
+		now := s.arrival(medi, 0)
+		if s.faults != nil {
+			s.faults.inject(now, medi, forma, pkt, deliver)
+			return
+		}
+		deliver(now, medi, forma, pkt)
+	})
+
+	c.OnPacketRTCPAny(func(medi *description.Media, pkt rtcp.Packet) {
+		now := s.arrival(medi, 1)
+		if s.shard != nil {
+			s.shard.onPacketRTCP(s, now, medi, pkt)
+			return
+		}
+		s.onPacketRTCP(now, medi, pkt)
+	})
+}
+
+// startReceiverReports sends the receiver reports of -rr-interval with the client until the returned func is called.
+func (s *session) startReceiverReports(c *gortsplib.Client) func() {
+	if len(s.rrs) == 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go s.sendReceiverReports(c, done)
+	return func() { close(done) }
+}
+
+// sendReceiverReports sends the receiver reports of -rr-interval until done is closed.
+func (s *session) sendReceiverReports(c *gortsplib.Client, done chan struct{}) {
+	t := time.NewTicker(s.cfg.rrInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case now := <-t.C:
+			for medi, rs := range s.rrs {
+				pkt := rs.report(now, s.cfg.rrFractionLost, s.cfg.rrJitter)
+				if pkt == nil {
+					continue
+				}
+				if err := c.WritePacketRTCP(medi, pkt); err != nil {
+					s.logf("failed to send receiver report, %v", err)
+				}
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+)
+
+func init() {
+	registerFeature("setup-deadline")
+}
+
+// startSetupDeadline closes the client if the handshake is not done within -session-setup-deadline,
+// the phase in progress is kept for the error of the session. The returned func stops the deadline.
+func (s *session) startSetupDeadline(c *gortsplib.Client) func() bool {
+	if s.cfg.sessionSetupDeadline <= 0 {
+		return func() bool { return true }
+	}
+	t := time.AfterFunc(s.cfg.sessionSetupDeadline, func() {
+		phase := s.handshake.pending()
+		s.mu.Lock()
+		if s.state == statePlaying || s.state == stateRecording {
+			s.mu.Unlock()
+			return
+		}
+		if phase == "" {
+			phase = s.state
+		}
+		s.setupExceeded = phase
+		s.mu.Unlock()
+		c.Close()
+	})
+	return t.Stop
+}
+
+// setupDeadlineError returns the error of a session whose handshake exceeded -session-setup-deadline,
+// nil if it didn't. The failure is attributed to the phase in progress.
+func (s *session) setupDeadlineError() error {
+	s.mu.Lock()
+	phase := s.setupExceeded
+	s.mu.Unlock()
+	if phase == "" {
+		return nil
+	}
+	return s.errorf("session setup deadline exceeded in "+phase+", %v", s.cfg.sessionSetupDeadline)
+}
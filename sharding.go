@@ -0,0 +1,105 @@
+package main
+
+import (
+	"hash/fnv"
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("shards")
+}
+
+// shardQueueSize is the number of pending packets of a shard,
+// the receiving goroutines of the library block when it is full.
+const shardQueueSize = 4096
+
+// shard processes the packets of its sessions in order on a dedicated OS thread,
+// optionally pinned to a CPU.
+type shard struct {
+	work chan shardWork
+}
+
+// shardWork is a packet of a session to process, RTP or RTCP, or a func to run.
+// The packets are passed by value, without a closure allocated per packet.
+type shardWork struct {
+	s     *session
+	now   time.Time
+	medi  *description.Media
+	forma format.Format
+	rtp   *rtp.Packet
+	rtcp  rtcp.Packet
+	f     func()
+}
+
+// onPacketRTP processes an RTP packet of a session on the shard.
+func (sh *shard) onPacketRTP(s *session, now time.Time, medi *description.Media, forma format.Format, pkt *rtp.Packet) {
+	sh.work <- shardWork{s: s, now: now, medi: medi, forma: forma, rtp: pkt}
+}
+
+// onPacketRTCP processes an RTCP packet of a session on the shard.
+func (sh *shard) onPacketRTCP(s *session, now time.Time, medi *description.Media, pkt rtcp.Packet) {
+	sh.work <- shardWork{s: s, now: now, medi: medi, rtcp: pkt}
+}
+
+// sync waits until the work queued so far is done.
+func (sh *shard) sync() {
+	done := make(chan struct{})
+	sh.work <- shardWork{f: func() { close(done) }}
+	<-done
+}
+
+func (sh *shard) run(i int, pin bool, logger *log.Logger) {
+	runtime.LockOSThread()
+	if pin {
+		cpu := i % runtime.NumCPU()
+		if err := pinThread(cpu); err != nil {
+			logger.Printf("failed to pin shard %d to cpu %d, %v", i, cpu, err)
+		}
+	}
+	for w := range sh.work {
+		switch {
+		case w.f != nil:
+			w.f()
+		case w.rtp != nil:
+			w.s.onPacketRTP(w.now, w.medi, w.forma, w.rtp)
+		default:
+			w.s.onPacketRTCP(w.now, w.medi, w.rtcp)
+		}
+	}
+}
+
+// shardPool assigns the sessions of a run to -shards shards by the hash of their id,
+// so that a session is always processed on the same thread.
+type shardPool struct {
+	shards []*shard
+}
+
+func newShardPool(n int, pin bool, logger *log.Logger) *shardPool {
+	p := &shardPool{}
+	for i := 0; i < n; i++ {
+		sh := &shard{work: make(chan shardWork, shardQueueSize)}
+		p.shards = append(p.shards, sh)
+		go sh.run(i, pin, logger)
+	}
+	return p
+}
+
+func (p *shardPool) get(id string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return p.shards[h.Sum32()%uint32(len(p.shards))]
+}
+
+// close stops the shards, after all the sessions ended.
+func (p *shardPool) close() {
+	for _, sh := range p.shards {
+		close(sh.work)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	registerFeature("sla")
+}
+
+// the exit codes of a run, for CI pipelines to gate on the result without parsing the logs
+const (
+	exitOK = 0
+	// invalid flags, a failed start or preflight, or a failed session without -continue-on-error
+	exitError = 1
+	// some sessions failed, within the thresholds of -max-error-rate, -max-p95-setup-ms and -max-delay-events
+	exitPartial = 2
+	// a threshold of -max-error-rate, -max-p95-setup-ms or -max-delay-events is exceeded
+	exitSLABreach = 3
+	// the tool crashed, the results of the runs in progress are written
+	exitCrash = 4
+)
+
+// slaResult is the verdict on a threshold of the run.
+type slaResult struct {
+	Metric   string
+	Value    string
+	Max      string
+	Breached bool
+}
+
+// slaResults checks the results of the run against the thresholds that are set.
+func (r *run) slaResults() []slaResult {
+	cfg := r.cfg
+	h := cfg.human()
+	var ret []slaResult
+	if cfg.maxErrorRate >= 0 {
+		failed, succeeded := atomic.LoadInt64(&r.failed), atomic.LoadInt64(&r.succeeded)
+		rate := 0.0
+		if failed+succeeded != 0 {
+			rate = float64(failed) / float64(failed+succeeded)
+		}
+		ret = append(ret, slaResult{"error rate", h.float(rate), h.float(cfg.maxErrorRate), rate > cfg.maxErrorRate})
+	}
+	if cfg.maxP95SetupMs > 0 {
+		p, ok := r.latency.percentiles()["SETUP"]
+		max := time.Duration(cfg.maxP95SetupMs * float64(time.Millisecond))
+		// no SETUP at all is a breach
+		ret = append(ret, slaResult{"p95 SETUP latency", h.duration(time.Duration(p.P95)), h.duration(max), !ok || time.Duration(p.P95) > max})
+	}
+	if cfg.maxDelayEvents >= 0 {
+		n := atomic.LoadInt64(&r.delays)
+		ret = append(ret, slaResult{"delay events", fmt.Sprint(n), fmt.Sprint(cfg.maxDelayEvents), n > int64(cfg.maxDelayEvents)})
+	}
+	return ret
+}
+
+// exitCode logs the verdicts of the thresholds and returns the exit code of the run that ended.
+func (r *run) exitCode() int {
+	breached := false
+	for _, res := range r.slaResults() {
+		verdict := "passed"
+		if res.Breached {
+			verdict, breached = "breached", true
+		}
+		r.logger.Printf(r.cfg.tr("sla %s: %s, max %s, %s"), res.Metric, res.Value, res.Max, r.cfg.tr(verdict))
+	}
+	switch {
+	case breached:
+		return exitSLABreach
+	case atomic.LoadInt64(&r.failed) != 0:
+		return exitPartial
+	}
+	return exitOK
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// packetInfo is the summary of a received RTP packet.
+type packetInfo struct {
+	Time           time.Time `json:"time"`
+	Media          string    `json:"media"`
+	PayloadType    uint8     `json:"payloadType"`
+	SequenceNumber uint16    `json:"sequenceNumber"`
+	Timestamp      uint32    `json:"timestamp"`
+	Marker         bool      `json:"marker"`
+	Size           int       `json:"size"`
+}
+
+// lastPacketsSize is the number of packets kept for snapshots.
+const lastPacketsSize = 8
+
+type delayCheckerState struct {
+	LastTS    uint32    `json:"lastTS"`
+	LastT     time.Time `json:"lastT"`
+	CheckedTS uint32    `json:"checkedTS"`
+}
+
+// sessionSnapshot is a dump of the internal state of a session,
+// used for debugging sessions that appear hung.
+type sessionSnapshot struct {
+	Time         time.Time           `json:"time"`
+	ID           string              `json:"id"`
+	URL          string              `json:"url"`
+	Class        string              `json:"class"`
+	Labels       labels              `json:"labels,omitempty"`
+	State        string              `json:"state"`
+	StateSince   time.Time           `json:"stateSince"`
+	Transport    string              `json:"transport"`
+	LocalAddr    string              `json:"localAddr"`
+	RemoteAddr   string              `json:"remoteAddr"`
+	UDPAddrs     []string            `json:"udpAddrs"`
+	Packets      uint64              `json:"packets"`
+	Bytes        uint64              `json:"bytes"`
+	LastPacket   time.Time           `json:"lastPacket"`
+	LastPackets  []packetInfo        `json:"lastPackets"`
+	Bitrate      bitrateStats        `json:"bitrate"`
+	DelayChecker delayCheckerState   `json:"delayChecker"`
+	Handshake    map[string]duration `json:"handshake"`
+	FirstPacket  map[string]duration `json:"firstPacket,omitempty"`
+	// of -first-idr
+	FirstKeyframe map[string]duration `json:"firstKeyframe,omitempty"`
+
+	Tracks map[string]trackStats `json:"tracks"`
+	RTCP   map[string]rtcpStats  `json:"rtcp,omitempty"`
+	// RTCP packets multiplexed on the RTP port of UDP
+	RTCPMuxPackets uint64 `json:"rtcpMuxPackets,omitempty"`
+	// sessions set up again after 454 Session Not Found, and the time without packets
+	ContinuityBreaks int      `json:"continuityBreaks,omitempty"`
+	ContinuityGap    duration `json:"continuityGap,omitempty"`
+	// time the reads waited for -read-rate
+	ReadThrottled duration `json:"readThrottled,omitempty"`
+	// packets dropped by the kernel on the UDP sockets, the receive buffers overflow
+	KernelDrops uint64 `json:"kernelDrops,omitempty"`
+	// urls the server redirected the session from, in order
+	Redirects []string `json:"redirects,omitempty"`
+	// requests of the server by method
+	ServerRequests map[string]int `json:"serverRequests,omitempty"`
+	// requests of -get-parameter and -set-parameter
+	Parameters *parameterStats `json:"parameters,omitempty"`
+	// packets sent on the back channels of -backchannel, by media
+	Backchannels map[string]backchannelStats `json:"backchannels,omitempty"`
+	// RTP packets altered before the analysis by the fault injection
+	InjectedFaults *faultStats `json:"injectedFaults,omitempty"`
+	// packets decrypted by -srtp
+	SRTP *srtpStats `json:"srtp,omitempty"`
+	// retransmissions requested by -nack, by media
+	NACK map[string]nackStats `json:"nack,omitempty"`
+
+	Subtitles map[string]subtitleStats `json:"subtitles,omitempty"`
+	Integrity *integrityStats          `json:"integrity,omitempty"`
+
+	Bitstream map[string]bitstreamStats `json:"bitstream,omitempty"`
+	GOP       map[string]gopStats       `json:"gop,omitempty"`
+	Freeze    map[string]freezeStats    `json:"freeze,omitempty"`
+	Captions  map[string]captionStats   `json:"captions,omitempty"`
+	AVSync    *avSyncStats              `json:"avSync,omitempty"`
+	// loudness and silences of -audio-analysis, by track
+	Audio map[string]audioStats `json:"audio,omitempty"`
+	// MPEG-TS metrics of -ts-analysis, by track
+	TS map[string]tsStats `json:"ts,omitempty"`
+	// SCTE-35 messages of -scte35, by track
+	SCTE35 map[string]scte35Stats `json:"scte35,omitempty"`
+}
+
+// inTZ converts the times of the snapshot to tz.
+func (ss *sessionSnapshot) inTZ() {
+	ss.Time = ss.Time.In(tz)
+	ss.StateSince = ss.StateSince.In(tz)
+	ss.LastPacket = ss.LastPacket.In(tz)
+	ss.DelayChecker.LastT = ss.DelayChecker.LastT.In(tz)
+	for i := range ss.LastPackets {
+		ss.LastPackets[i].Time = ss.LastPackets[i].Time.In(tz)
+	}
+}
+
+// snapshotChange is a field that differs between two snapshots.
+type snapshotChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// flatten converts v to a map of dotted field paths to values.
+func flatten(prefix string, v interface{}, out map[string]interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			flatten(prefix+"."+k, e, out)
+		}
+	case []interface{}:
+		for i, e := range t {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), e, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+func flattenSnapshot(ss *sessionSnapshot) (map[string]interface{}, error) {
+	b, err := json.Marshal(ss)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	out := make(map[string]interface{})
+	flatten("", v, out)
+	return out, nil
+}
+
+// diffSnapshots returns the fields changed from a to b, sorted by field.
+func diffSnapshots(a, b *sessionSnapshot) ([]snapshotChange, error) {
+	fa, err := flattenSnapshot(a)
+	if err != nil {
+		return nil, err
+	}
+	fb, err := flattenSnapshot(b)
+	if err != nil {
+		return nil, err
+	}
+	changes := []snapshotChange{}
+	for k, vb := range fb {
+		if va, ok := fa[k]; !ok || !reflect.DeepEqual(va, vb) {
+			changes = append(changes, snapshotChange{Field: k[1:], Old: fa[k], New: vb})
+		}
+	}
+	for k, va := range fa {
+		if _, ok := fb[k]; !ok {
+			changes = append(changes, snapshotChange{Field: k[1:], Old: va})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
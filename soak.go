@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+func init() {
+	registerFeature("soak")
+}
+
+// the heuristics of a leak: the metric rises over the segments of the run, and grows enough
+const (
+	soakMinSamples = 4
+	// the samples are averaged by segment, a single slow handshake is not a trend
+	soakSegments = 8
+	// minimal fraction of the segments not lower than the previous one
+	soakRising = 0.8
+	// minimal growth of the sessions of a server not played by the run
+	soakSessionGrowth = 2
+	// minimal ratio of the last segment to the first of the latencies
+	soakLatencyGrowth = 1.5
+)
+
+// soakSample is a sample of -soak-interval.
+type soakSample struct {
+	Time time.Time
+	// sessions reported by each server, -1 if unknown, and the sessions of the run playing on it
+	ServerSessions map[string]int
+	Playing        map[string]int
+	// medians of the SETUP and whole handshake times of the sessions set up in the interval, 0 if none
+	Setup     time.Duration
+	Handshake time.Duration
+}
+
+// soakMonitor samples the sessions reported by the servers and the handshake latency of a long run,
+// to flag the slow rises that tell a server leaks sessions or degrades.
+type soakMonitor struct {
+	r       *run
+	servers []string
+	first   map[string]string
+
+	mu         sync.Mutex
+	setups     []time.Duration
+	handshakes []time.Duration
+	samples    []soakSample
+	// servers whose probe failure was logged
+	probeFailed map[string]bool
+}
+
+func newSoakMonitor(r *run) *soakMonitor {
+	servers, first := r.servers()
+	return &soakMonitor{r: r, servers: servers, first: first, probeFailed: make(map[string]bool)}
+}
+
+// addHandshake adds the handshake phase times of a session set up.
+func (m *soakMonitor) addHandshake(phases map[string]duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d, ok := phases["SETUP"]; ok {
+		m.setups = append(m.setups, time.Duration(d))
+	}
+	var total time.Duration
+	for _, p := range handshakePhases {
+		total += time.Duration(phases[p])
+	}
+	m.handshakes = append(m.handshakes, total)
+}
+
+// start samples every -soak-interval until the returned func is called.
+func (m *soakMonitor) start() func() {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(m.r.cfg.soakInterval)
+		defer t.Stop()
+		for {
+			select {
+			case now := <-t.C:
+				m.sample(now)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func median(samples []time.Duration) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return percentile(sorted, 0.5)
+}
+
+func (m *soakMonitor) sample(now time.Time) {
+	s := soakSample{Time: now, ServerSessions: make(map[string]int), Playing: make(map[string]int)}
+	if m.r.cfg.serverSessionsParam != "" || m.r.cfg.serverSessionsHeader != "" {
+		for _, server := range m.servers {
+			n, err := m.r.probeServerSessions(m.r.expandURL(m.first[server], 1))
+			if err != nil {
+				n = -1
+				m.mu.Lock()
+				logged := m.probeFailed[server]
+				m.probeFailed[server] = true
+				m.mu.Unlock()
+				if !logged {
+					m.r.logger.Printf("soak %s: failed to get the server sessions, %v", server, err)
+				}
+			}
+			s.ServerSessions[server] = n
+		}
+	}
+	for _, ss := range m.r.sessions.list() {
+		ss.mu.Lock()
+		state := ss.state
+		ss.mu.Unlock()
+		if state != statePlaying && state != stateRecording {
+			continue
+		}
+		if u, err := base.ParseURL(ss.url); err == nil {
+			s.Playing[u.Host]++
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.Setup, s.Handshake = median(m.setups), median(m.handshakes)
+	m.setups, m.handshakes = nil, nil
+	m.samples = append(m.samples, s)
+}
+
+// probeServerSessions returns the sessions reported by the server of rawURL, the value of
+// -server-sessions-param in the response of a GET_PARAMETER request, or -server-sessions-header in that of OPTIONS.
+func (r *run) probeServerSessions(rawURL string) (int, error) {
+	u, err := base.ParseURL(rawURL)
+	if err != nil {
+		return 0, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "554")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.readTimeout)
+	defer cancel()
+	if host, err = r.resolver.address(ctx, host, nil); err != nil {
+		return 0, err
+	}
+	conn, err := r.sources.dial(ctx, r.sources.get(), "tcp", host)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(r.cfg.readTimeout))
+
+	req := base.Request{Method: base.Options, URL: u, Header: base.Header{"CSeq": base.HeaderValue{"1"}}}
+	if r.cfg.serverSessionsParam != "" {
+		req.Method = base.GetParameter
+		req.Header["Content-Type"] = base.HeaderValue{"text/parameters"}
+		req.Body = []byte(r.cfg.serverSessionsParam + "\r\n")
+	}
+	r.cfg.headers.apply(&req)
+	b, err := req.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := conn.Write(b); err != nil {
+		return 0, err
+	}
+	var res base.Response
+	if err := res.Unmarshal(bufio.NewReader(conn)); err != nil {
+		return 0, err
+	}
+	if res.StatusCode != base.StatusOK {
+		return 0, fmt.Errorf("%s status %d", req.Method, res.StatusCode)
+	}
+
+	var value string
+	var found bool
+	if r.cfg.serverSessionsParam != "" {
+		for _, l := range strings.Split(string(res.Body), "\n") {
+			if k, v, ok := strings.Cut(l, ":"); ok && strings.EqualFold(strings.TrimSpace(k), r.cfg.serverSessionsParam) {
+				value, found = strings.TrimSpace(v), true
+				break
+			}
+		}
+	} else {
+		for k, v := range res.Header {
+			if strings.EqualFold(k, r.cfg.serverSessionsHeader) && len(v) != 0 {
+				value, found = strings.TrimSpace(v[0]), true
+				break
+			}
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("no %s in the %s response", r.cfg.serverSessionsParam+r.cfg.serverSessionsHeader, req.Method)
+	}
+	return strconv.Atoi(value)
+}
+
+// trend is the evolution of a metric over the segments of a soak run.
+type trend struct {
+	Samples     int
+	First, Last float64
+	// least squares slope per hour of the samples
+	SlopePerHour float64
+	// fraction of the segments not lower than the previous one
+	Rising float64
+}
+
+func newTrend(times []time.Time, values []float64) trend {
+	t := trend{Samples: len(values)}
+	if len(values) == 0 {
+		return t
+	}
+	var sx, sy, sxx, sxy float64
+	for i, v := range values {
+		x := times[i].Sub(times[0]).Hours()
+		sx, sy, sxx, sxy = sx+x, sy+v, sxx+x*x, sxy+x*v
+	}
+	n := float64(len(values))
+	if den := n*sxx - sx*sx; den != 0 {
+		t.SlopePerHour = (n*sxy - sx*sy) / den
+	}
+
+	segments := soakSegments
+	if len(values) < segments {
+		segments = len(values)
+	}
+	means := make([]float64, segments)
+	step := float64(len(values)) / float64(segments)
+	for i := range means {
+		from, to := int(float64(i)*step), int(float64(i+1)*step)
+		for _, v := range values[from:to] {
+			means[i] += v
+		}
+		means[i] /= float64(to - from)
+	}
+	t.First, t.Last = means[0], means[len(means)-1]
+	rising := 0
+	for i := 1; i < len(means); i++ {
+		if means[i] >= means[i-1] {
+			rising++
+		}
+	}
+	if len(means) > 1 {
+		t.Rising = float64(rising) / float64(len(means)-1)
+	}
+	return t
+}
+
+// rises tells if the metric rises steadily by at least growth, or by the ratio if growth is 0.
+func (t trend) rises(growth, ratio float64) bool {
+	if t.Samples < soakMinSamples || t.SlopePerHour <= 0 || t.Rising < soakRising {
+		return false
+	}
+	if ratio > 0 {
+		return t.First > 0 && t.Last >= t.First*ratio
+	}
+	return t.Last-t.First >= growth
+}
+
+// leakFinding is the verdict on a metric of a soak run, for the logs and the report.
+type leakFinding struct {
+	Metric    string
+	Samples   int
+	First     string
+	Last      string
+	Slope     string
+	Suspected bool
+}
+
+// findings returns the trends of the sessions of each server not played by the run, and of the handshake latencies.
+func (m *soakMonitor) findings(h humanizer) []leakFinding {
+	m.mu.Lock()
+	samples := append([]soakSample(nil), m.samples...)
+	m.mu.Unlock()
+
+	var ret []leakFinding
+	for _, server := range m.servers {
+		var times []time.Time
+		var values []float64
+		for _, s := range samples {
+			if n, ok := s.ServerSessions[server]; ok && n >= 0 {
+				times = append(times, s.Time)
+				values = append(values, float64(n-s.Playing[server]))
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		t := newTrend(times, values)
+		ret = append(ret, leakFinding{
+			Metric:    "server sessions not played " + server,
+			Samples:   t.Samples,
+			First:     h.float(t.First),
+			Last:      h.float(t.Last),
+			Slope:     h.float(t.SlopePerHour),
+			Suspected: t.rises(soakSessionGrowth, 0),
+		})
+	}
+	for _, l := range []struct {
+		metric string
+		get    func(soakSample) time.Duration
+	}{
+		{"SETUP latency", func(s soakSample) time.Duration { return s.Setup }},
+		{"handshake latency", func(s soakSample) time.Duration { return s.Handshake }},
+	} {
+		var times []time.Time
+		var values []float64
+		for _, s := range samples {
+			if d := l.get(s); d > 0 {
+				times = append(times, s.Time)
+				values = append(values, float64(d))
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		t := newTrend(times, values)
+		ret = append(ret, leakFinding{
+			Metric:    l.metric,
+			Samples:   t.Samples,
+			First:     h.duration(time.Duration(t.First)),
+			Last:      h.duration(time.Duration(t.Last)),
+			Slope:     h.duration(time.Duration(t.SlopePerHour)),
+			Suspected: t.rises(0, soakLatencyGrowth),
+		})
+	}
+	return ret
+}
+
+// logLeaks logs the findings of -soak-interval.
+func (r *run) logLeaks() {
+	if r.soak == nil {
+		return
+	}
+	for _, f := range r.soak.findings(r.cfg.human()) {
+		verdict := "stable"
+		if f.Suspected {
+			verdict = "suspected leak"
+		}
+		r.logger.Printf(r.cfg.tr("soak %s: samples %d, first %s, last %s, slope %s/h, %s"),
+			f.Metric, f.Samples, f.First, f.Last, f.Slope, r.cfg.tr(verdict))
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+func init() {
+	registerFeature("source-address")
+}
+
+// maxLocalIPs limits the addresses of the CIDR ranges of -local-ip.
+const maxLocalIPs = 65536
+
+// parseLocalIPs returns the addresses of -local-ip, comma separated addresses and CIDR ranges
+// whose network and broadcast addresses are excluded.
+func parseLocalIPs(v string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", item)
+			}
+			ips = append(ips, ip)
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		ones, bits := ipnet.Mask.Size()
+		var hosts []net.IP
+		for ip := ipnet.IP; ipnet.Contains(ip); ip = nextIP(ip) {
+			if len(ips)+len(hosts) >= maxLocalIPs {
+				return nil, fmt.Errorf("more than %d addresses", maxLocalIPs)
+			}
+			hosts = append(hosts, ip)
+		}
+		if bits == 32 && ones < 31 {
+			hosts = hosts[1 : len(hosts)-1]
+		}
+		ips = append(ips, hosts...)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no address")
+	}
+	return ips, nil
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP(nil), ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// missingLocalIPs returns the addresses that are not on an interface of the host,
+// the loopback range is bound as a whole.
+func missingLocalIPs(ips []net.IP) ([]net.IP, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool)
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			have[ipnet.IP.String()] = true
+		}
+	}
+	var missing []net.IP
+	for _, ip := range ips {
+		if !have[ip.String()] && !ip.IsLoopback() {
+			missing = append(missing, ip)
+		}
+	}
+	return missing, nil
+}
+
+// sourcePool binds the sockets of the sessions to the addresses of -local-ip, in turn,
+// and to the network interface of -interface, to use given NICs or VLANs and to load a server
+// from many client addresses of a multi-homed host. Without them, the system chooses.
+type sourcePool struct {
+	ips    []net.IP
+	device string
+	next   uint64
+	// nil without -udp-ports
+	ports *portRange
+	// network suffix of -force-ipv4 and -force-ipv6
+	family string
+	// nil without -proxy
+	proxy *url.URL
+}
+
+// newSourcePool returns the source pool of the config, validated by validate.
+func newSourcePool(cfg *config) *sourcePool {
+	p := &sourcePool{device: cfg.iface, family: cfg.ipFamily()}
+	if cfg.localIP != "" {
+		p.ips, _ = parseLocalIPs(cfg.localIP)
+	}
+	if cfg.udpPorts != "" {
+		p.ports, _ = parsePortRange(cfg.udpPorts)
+	}
+	if cfg.proxy != "" {
+		p.proxy, _ = parseProxy(cfg.proxy)
+	}
+	return p
+}
+
+// get returns the next address of the pool, nil without -local-ip.
+func (p *sourcePool) get() net.IP {
+	if len(p.ips) == 0 {
+		return nil
+	}
+	return p.ips[(atomic.AddUint64(&p.next, 1)-1)%uint64(len(p.ips))]
+}
+
+// control binds the sockets to -interface.
+func (p *sourcePool) control(network, address string, c syscall.RawConn) error {
+	if p.device == "" {
+		return nil
+	}
+	var err error
+	if cerr := c.Control(func(fd uintptr) { err = bindToDevice(fd, p.device) }); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// network restricts a tcp or udp network to the family of -force-ipv4 or -force-ipv6.
+func (p *sourcePool) network(network string) string {
+	if network == "tcp" || network == "udp" {
+		return network + p.family
+	}
+	return network
+}
+
+// dialer returns a dialer of TCP connections from ip, any address if nil.
+func (p *sourcePool) dialer(ip net.IP) *net.Dialer {
+	d := &net.Dialer{Control: p.control}
+	if ip != nil {
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return d
+}
+
+// dial connects from ip, any address if nil, to address, through -proxy if set.
+func (p *sourcePool) dial(ctx context.Context, ip net.IP, network, address string) (net.Conn, error) {
+	if p.proxy != nil {
+		return dialProxy(ctx, p.dialer(ip), p.network("tcp"), p.proxy, address)
+	}
+	return p.dialer(ip).DialContext(ctx, p.network(network), address)
+}
+
+// listenPacket listens on the port of address on ip, any address if nil.
+// The multicast groups keep their address.
+func (p *sourcePool) listenPacket(ip net.IP, network, address string) (net.PacketConn, error) {
+	if ip != nil {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if host == "" {
+			address = net.JoinHostPort(ip.String(), port)
+		}
+	}
+	return (&net.ListenConfig{Control: p.control}).ListenPacket(context.Background(), p.network(network), address)
+}
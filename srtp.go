@@ -0,0 +1,468 @@
+//go:build !nosrtp
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/sdp"
+)
+
+func init() {
+	registerFeature("srtp")
+}
+
+// srtpSuites are the supported crypto suites (RFC 4568) by name, the length of their SRTP authentication tag.
+// The SRTCP tag is 80 bits with both.
+var srtpSuites = map[string]int{
+	"AES_CM_128_HMAC_SHA1_80": 10,
+	"AES_CM_128_HMAC_SHA1_32": 4,
+}
+
+const (
+	srtpKeyLen     = 16
+	srtpSaltLen    = 14
+	srtcpTagLen    = 10
+	srtcpIndexLen  = 4
+	srtpAuthKeyLen = 20
+)
+
+// srtpKey are the session keys derived from a master key (RFC 3711 4.3), with kdr 0.
+type srtpKey struct {
+	tagLen    int
+	rtpBlock  cipher.Block
+	rtpSalt   []byte
+	rtpAuth   hash.Hash
+	rtcpBlock cipher.Block
+	rtcpSalt  []byte
+	rtcpAuth  hash.Hash
+
+	// the rollover counter and the HMAC of the packet being authenticated, used under the lock of the decrypter
+	roc [4]byte
+	sum [sha1.Size]byte
+}
+
+// parseSRTPKey returns the keys of a suite and a base64 master key followed by the master salt.
+func parseSRTPKey(suite, inline string) (*srtpKey, error) {
+	tagLen, ok := srtpSuites[suite]
+	if !ok {
+		return nil, fmt.Errorf("unsupported crypto suite %s", suite)
+	}
+	master, err := base64.StdEncoding.DecodeString(inline)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key, %v", err)
+	}
+	if len(master) != srtpKeyLen+srtpSaltLen {
+		return nil, fmt.Errorf("key and salt of %d bytes, expected %d", len(master), srtpKeyLen+srtpSaltLen)
+	}
+	return newSRTPKey(tagLen, master[:srtpKeyLen], master[srtpKeyLen:])
+}
+
+// newSRTPKey returns the keys of a master key and master salt, tagLen the length of the SRTP authentication tag.
+func newSRTPKey(tagLen int, master, salt []byte) (*srtpKey, error) {
+	if len(master) != srtpKeyLen || len(salt) != srtpSaltLen {
+		return nil, fmt.Errorf("key of %d bytes and salt of %d bytes, expected %d and %d",
+			len(master), len(salt), srtpKeyLen, srtpSaltLen)
+	}
+	if tagLen != 10 && tagLen != 4 {
+		return nil, fmt.Errorf("unsupported authentication tag of %d bytes", tagLen)
+	}
+	block, err := aes.NewCipher(master)
+	if err != nil {
+		return nil, err
+	}
+	derive := func(label byte, n int) []byte {
+		var iv [16]byte
+		copy(iv[:], salt)
+		iv[7] ^= label
+		out := make([]byte, n)
+		cipher.NewCTR(block, iv[:]).XORKeyStream(out, out)
+		return out
+	}
+	k := &srtpKey{
+		tagLen:   tagLen,
+		rtpSalt:  derive(2, srtpSaltLen),
+		rtpAuth:  hmac.New(sha1.New, derive(1, srtpAuthKeyLen)),
+		rtcpSalt: derive(5, srtpSaltLen),
+		rtcpAuth: hmac.New(sha1.New, derive(4, srtpAuthKeyLen)),
+	}
+	if k.rtpBlock, err = aes.NewCipher(derive(0, srtpKeyLen)); err != nil {
+		return nil, err
+	}
+	if k.rtcpBlock, err = aes.NewCipher(derive(3, srtpKeyLen)); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// parseCrypto returns the keys of an a=crypto attribute (RFC 4568), "tag suite inline:key|lifetime|mki".
+func parseCrypto(value string) (*srtpKey, error) {
+	f := strings.Fields(value)
+	if len(f) < 3 || !strings.HasPrefix(f[2], "inline:") {
+		return nil, fmt.Errorf("invalid crypto attribute %q", value)
+	}
+	params := strings.Split(strings.TrimPrefix(f[2], "inline:"), "|")
+	for _, p := range params[1:] {
+		if strings.Contains(p, ":") {
+			return nil, fmt.Errorf("mki %s is not supported", p)
+		}
+	}
+	return parseSRTPKey(f[1], params[0])
+}
+
+// cryptoIV returns the AES-CM IV of a packet (RFC 3711 4.1.1).
+func cryptoIV(salt []byte, ssrc uint32, index uint64) [16]byte {
+	var iv [16]byte
+	copy(iv[:], salt)
+	var v [8]byte
+	binary.BigEndian.PutUint32(v[:4], ssrc)
+	for i := 0; i < 4; i++ {
+		iv[4+i] ^= v[i]
+	}
+	binary.BigEndian.PutUint64(v[:], index<<16)
+	for i := 0; i < 8; i++ {
+		iv[8+i] ^= v[i]
+	}
+	return iv
+}
+
+// srtpStats are the packets decrypted by -srtp.
+type srtpStats struct {
+	RTP  uint64 `json:"rtp"`
+	RTCP uint64 `json:"rtcp"`
+	// packets dropped, their authentication tag matches no key
+	AuthFailures uint64 `json:"authFailures"`
+}
+
+// srtpStream is the rollover counter of an SRTP stream.
+type srtpStream struct {
+	key     *srtpKey
+	roc     uint32
+	lastSeq uint16
+}
+
+// srtpDecrypter decrypts and authenticates the SRTP and SRTCP packets of a session, before the client reads them.
+// The key of a stream is the key of the medias that authenticates its first packet. With keys, the packets
+// of the clear medias of the session are not authenticated and dropped too.
+type srtpDecrypter struct {
+	mu      sync.Mutex
+	keys    []*srtpKey
+	streams map[uint32]*srtpStream
+	// the rollover counters of the SSRCs given by MIKEY, when the streams start
+	rocs  map[uint32]uint32
+	stats srtpStats
+}
+
+func (d *srtpDecrypter) setKeys(keys []*srtpKey, rocs map[uint32]uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys, d.rocs = keys, rocs
+	d.streams = make(map[uint32]*srtpStream)
+}
+
+// decrypt decrypts an SRTP or SRTCP packet in place and returns it without its authentication tag,
+// false if it is not authenticated. Packets are returned as is without keys.
+func (d *srtpDecrypter) decrypt(b []byte) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.keys) == 0 || len(b) < 12 || b[0]>>6 != 2 {
+		return b, true
+	}
+	var ret []byte
+	if b[1] >= 192 && b[1] <= 223 {
+		ret = d.decryptRTCP(b)
+		if ret != nil {
+			d.stats.RTCP++
+		}
+	} else {
+		ret = d.decryptRTP(b)
+		if ret != nil {
+			d.stats.RTP++
+		}
+	}
+	if ret == nil {
+		d.stats.AuthFailures++
+		return nil, false
+	}
+	return ret, true
+}
+
+func (d *srtpDecrypter) decryptRTP(b []byte) []byte {
+	hdr := 12 + 4*int(b[0]&0x0f)
+	if b[0]&0x10 != 0 {
+		if len(b) < hdr+4 {
+			return nil
+		}
+		hdr += 4 + 4*int(binary.BigEndian.Uint16(b[hdr+2:]))
+	}
+	seq := binary.BigEndian.Uint16(b[2:])
+	ssrc := binary.BigEndian.Uint32(b[8:])
+
+	st := d.streams[ssrc]
+	keys := d.keys
+	if st != nil {
+		keys = []*srtpKey{st.key}
+	}
+	for _, k := range keys {
+		if len(b) < hdr+k.tagLen {
+			continue
+		}
+		roc := d.rocs[ssrc]
+		if st != nil {
+			roc = st.estimate(seq)
+		}
+		n := len(b) - k.tagLen
+		binary.BigEndian.PutUint32(k.roc[:], roc)
+		k.rtpAuth.Reset()
+		k.rtpAuth.Write(b[:n])
+		k.rtpAuth.Write(k.roc[:])
+		if !hmac.Equal(k.rtpAuth.Sum(k.sum[:0])[:k.tagLen], b[n:]) {
+			continue
+		}
+		iv := cryptoIV(k.rtpSalt, ssrc, uint64(roc)<<16|uint64(seq))
+		cipher.NewCTR(k.rtpBlock, iv[:]).XORKeyStream(b[hdr:n], b[hdr:n])
+		if st == nil {
+			st = &srtpStream{key: k, roc: roc, lastSeq: seq}
+			d.streams[ssrc] = st
+		}
+		st.update(roc, seq)
+		return b[:n]
+	}
+	return nil
+}
+
+// estimate returns the rollover counter of a sequence number (RFC 3711 3.3.1).
+func (st *srtpStream) estimate(seq uint16) uint32 {
+	switch {
+	case st.lastSeq < 0x8000 && seq > st.lastSeq+0x8000 && st.roc > 0:
+		return st.roc - 1
+	case st.lastSeq >= 0x8000 && seq < st.lastSeq-0x8000:
+		return st.roc + 1
+	}
+	return st.roc
+}
+
+func (st *srtpStream) update(roc uint32, seq uint16) {
+	if roc > st.roc || (roc == st.roc && seq-st.lastSeq < 0x8000) {
+		st.roc, st.lastSeq = roc, seq
+	}
+}
+
+func (d *srtpDecrypter) decryptRTCP(b []byte) []byte {
+	if len(b) < 8+srtcpIndexLen+srtcpTagLen {
+		return nil
+	}
+	ssrc := binary.BigEndian.Uint32(b[4:])
+	keys := d.keys
+	if st := d.streams[ssrc]; st != nil {
+		keys = []*srtpKey{st.key}
+	}
+	n := len(b) - srtcpTagLen
+	for _, k := range keys {
+		k.rtcpAuth.Reset()
+		k.rtcpAuth.Write(b[:n])
+		if !hmac.Equal(k.rtcpAuth.Sum(k.sum[:0])[:srtcpTagLen], b[n:]) {
+			continue
+		}
+		e := n - srtcpIndexLen
+		index := binary.BigEndian.Uint32(b[e:])
+		if index&0x80000000 != 0 {
+			iv := cryptoIV(k.rtcpSalt, ssrc, uint64(index&0x7fffffff))
+			cipher.NewCTR(k.rtcpBlock, iv[:]).XORKeyStream(b[8:e], b[8:e])
+		}
+		return b[:e]
+	}
+	return nil
+}
+
+func (d *srtpDecrypter) snapshot() srtpStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+// setupSRTP sets the keys of the secure medias of the SDP, from their a=crypto or -srtp-key,
+// and returns the secure medias, set up with the RTP/SAVP profile.
+func (s *session) setupSRTP(desc *description.Session, body []byte) (map[*description.Media]bool, error) {
+	var sd sdp.SessionDescription
+	if err := sd.Unmarshal(body); err != nil {
+		return nil, err
+	}
+	secure := make(map[*description.Media]bool)
+	var keys []*srtpKey
+	rocs := make(map[uint32]uint32)
+	// a session level key-mgmt is parsed once
+	mikeys := make(map[string]bool)
+	for i, md := range sd.MediaDescriptions {
+		if i >= len(desc.Medias) {
+			break
+		}
+		name := mediaName(desc.Medias, i)
+		savp := strings.Contains(strings.Join(md.MediaName.Protos, "/"), "SAVP")
+		crypto, hasCrypto := md.Attribute("crypto")
+		mgmt, hasMgmt := md.Attribute("key-mgmt")
+		if !hasMgmt {
+			mgmt, hasMgmt = sd.Attribute("key-mgmt")
+		}
+		if !savp && !hasCrypto {
+			continue
+		}
+		if !s.cfg.srtp {
+			s.logf("srtp %s: encrypted media, use -srtp to decrypt it", name)
+			continue
+		}
+		secure[desc.Medias[i]] = true
+		switch {
+		case s.cfg.srtpKey != "":
+			k, err := parseSRTPKey(s.cfg.srtpSuite, s.cfg.srtpKey)
+			if err != nil {
+				return nil, fmt.Errorf("-srtp-key, %v", err)
+			}
+			keys = append(keys, k)
+			s.logf("srtp %s: %s of -srtp-key", name, s.cfg.srtpSuite)
+		case hasCrypto:
+			k, err := parseCrypto(crypto)
+			if err != nil {
+				return nil, fmt.Errorf("%s, %v", name, err)
+			}
+			keys = append(keys, k)
+			s.logf("srtp %s: %s", name, strings.Fields(crypto)[1])
+		case hasMgmt:
+			f := strings.Fields(mgmt)
+			if len(f) != 2 || f[0] != "mikey" {
+				return nil, fmt.Errorf("%s, key management %s is not supported, give the master key with -srtp-key", name, f[0])
+			}
+			if s.cfg.mikeyPSK == "" {
+				return nil, fmt.Errorf("%s, MIKEY needs the pre-shared key of -mikey-psk, or the master key of -srtp-key", name)
+			}
+			if mikeys[f[1]] {
+				continue
+			}
+			mikeys[f[1]] = true
+			psk, _ := base64.StdEncoding.DecodeString(s.cfg.mikeyPSK)
+			mk, err := parseMIKEY(f[1], psk)
+			if err != nil {
+				return nil, fmt.Errorf("%s, MIKEY, %v", name, err)
+			}
+			keys = append(keys, mk.keys...)
+			for ssrc, roc := range mk.rocs {
+				rocs[ssrc] = roc
+			}
+			s.logf("srtp %s: MIKEY pre-shared key, %d crypto sessions", name, len(mk.keys))
+		default:
+			return nil, fmt.Errorf("%s, no a=crypto key, give the master key with -srtp-key", name)
+		}
+	}
+	if s.srtp != nil {
+		s.srtp.setKeys(keys, rocs)
+	}
+	return secure, nil
+}
+
+// requestSAVP sets the RTP/SAVP profile in the Transport header of a SETUP request.
+func requestSAVP(req *base.Request) {
+	if req.Method != base.Setup {
+		return
+	}
+	if v := req.Header["Transport"]; len(v) != 0 {
+		v[0] = strings.Replace(v[0], "RTP/AVP", "RTP/SAVP", 1)
+	}
+}
+
+// responseSAVP replaces the RTP/SAVP profile of the Transport header of a response by RTP/AVP,
+// the client does not know it.
+func responseSAVP(res *base.Response) {
+	if v := res.Header["Transport"]; len(v) != 0 {
+		v[0] = strings.Replace(v[0], "RTP/SAVP", "RTP/AVP", 1)
+	}
+}
+
+// srtpConn decrypts the interleaved frames read from the RTSP connection, the unauthenticated frames are dropped.
+// It follows the RTSP messages to find the frames.
+type srtpConn struct {
+	net.Conn
+	d   *srtpDecrypter
+	br  *bufio.Reader
+	out []byte
+}
+
+func newSRTPConn(conn net.Conn, d *srtpDecrypter) *srtpConn {
+	return &srtpConn{Conn: conn, d: d, br: bufio.NewReaderSize(conn, 64*1024)}
+}
+
+func (c *srtpConn) Read(b []byte) (int, error) {
+	for len(c.out) == 0 {
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// next reads the next frame or RTSP message.
+func (c *srtpConn) next() error {
+	first, err := c.br.Peek(1)
+	if err != nil {
+		return err
+	}
+	if first[0] == '$' {
+		var h [4]byte
+		if _, err := io.ReadFull(c.br, h[:]); err != nil {
+			return err
+		}
+		frame := make([]byte, 4+int(binary.BigEndian.Uint16(h[2:])))
+		if _, err := io.ReadFull(c.br, frame[4:]); err != nil {
+			return err
+		}
+		p, ok := c.d.decrypt(frame[4:])
+		if !ok {
+			return nil
+		}
+		copy(frame, h[:2])
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(p)))
+		c.out = frame[:4+len(p)]
+		return nil
+	}
+
+	// an RTSP message, up to the end of its body
+	var msg []byte
+	length := 0
+	for {
+		line, err := c.br.ReadSlice('\n')
+		msg = append(msg, line...)
+		if err != nil {
+			return err
+		}
+		l := bytes.TrimSpace(line)
+		if len(l) == 0 {
+			break
+		}
+		if k, v, ok := strings.Cut(string(l), ":"); ok && strings.EqualFold(strings.TrimSpace(k), "Content-Length") {
+			length, _ = strconv.Atoi(strings.TrimSpace(v))
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.br, body); err != nil {
+		return err
+	}
+	c.out = append(msg, body...)
+	return nil
+}
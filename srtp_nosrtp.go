@@ -0,0 +1,39 @@
+//go:build nosrtp
+
+package main
+
+import (
+	"net"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+)
+
+// SRTP and MIKEY are left out of a build with the nosrtp tag, -srtp and -mikey-psk are rejected by validate
+// and the encrypted medias are set up as the clear ones.
+
+// srtpStats are the packets decrypted by -srtp.
+type srtpStats struct {
+	RTP          uint64 `json:"rtp"`
+	RTCP         uint64 `json:"rtcp"`
+	AuthFailures uint64 `json:"authFailures"`
+}
+
+type srtpKey struct{}
+
+type srtpDecrypter struct{}
+
+func (d *srtpDecrypter) snapshot() srtpStats { return srtpStats{} }
+
+// parseSRTPKey does not check the key, -srtp is rejected.
+func parseSRTPKey(suite, inline string) (*srtpKey, error) { return nil, nil }
+
+func (s *session) setupSRTP(desc *description.Session, body []byte) (map[*description.Media]bool, error) {
+	return nil, nil
+}
+
+func requestSAVP(req *base.Request) {}
+
+func responseSAVP(res *base.Response) {}
+
+func newSRTPConn(conn net.Conn, d *srtpDecrypter) net.Conn { return conn }
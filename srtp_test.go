@@ -0,0 +1,192 @@
+//go:build !nosrtp
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pion/rtcp"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// TestSRTPKeystream checks the AES-CM key stream of the IV of cryptoIV against RFC 3711 B.2.
+func TestSRTPKeystream(t *testing.T) {
+	block, err := aes.NewCipher(unhex("2B7E151628AED2A6ABF7158809CF4F3C"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := cryptoIV(unhex("F0F1F2F3F4F5F6F7F8F9FAFBFCFD"), 0, 0)
+	stream := make([]byte, 0xFF02*aes.BlockSize)
+	cipher.NewCTR(block, iv[:]).XORKeyStream(stream, stream)
+	for counter, want := range map[int]string{
+		0x0000: "E03EAD0935C95E80E166B16DD92B4EB4",
+		0x0001: "D23513162B02D0F72A43A2FE4A5F97AB",
+		0x0002: "41E95B3BB0A2E8DD477901E4FCA894C0",
+		0xFEFF: "EC8CDF7398607CB0F2D21675EA9EA1E4",
+		0xFF00: "362B7C3C6773516318A077D7FC5073AE",
+		0xFF01: "6A2CC3787889374FBEB4C81B17BA6C44",
+	} {
+		if got := stream[counter*aes.BlockSize : (counter+1)*aes.BlockSize]; !bytes.Equal(got, unhex(want)) {
+			t.Errorf("counter %04X: %X, should be %s", counter, got, want)
+		}
+	}
+}
+
+// TestSRTPKeyDerivation checks the session keys of newSRTPKey against RFC 3711 B.3.
+func TestSRTPKeyDerivation(t *testing.T) {
+	k, err := newSRTPKey(10, unhex("E1F97A0D3E018BE0D64FA32C06DE4139"), unhex("0EC675AD498AFEEBB6960B3AABE6"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := unhex("30CBBC08863D8C85D49DB34A9AE1"); !bytes.Equal(k.rtpSalt, want) {
+		t.Errorf("salt %X, should be %X", k.rtpSalt, want)
+	}
+	block, _ := aes.NewCipher(unhex("C61E7A93744F39EE10734AFE3FF7A087"))
+	var got, want [aes.BlockSize]byte
+	k.rtpBlock.Encrypt(got[:], got[:])
+	block.Encrypt(want[:], want[:])
+	if got != want {
+		t.Errorf("cipher key differs from C61E7A93744F39EE10734AFE3FF7A087")
+	}
+	auth := hmac.New(sha1.New, unhex("CEBE321F6FF7716B6FD4AB49AF256A156D38BAA4"))
+	k.rtpAuth.Reset()
+	k.rtpAuth.Write([]byte("srtp"))
+	auth.Write([]byte("srtp"))
+	if !hmac.Equal(k.rtpAuth.Sum(nil), auth.Sum(nil)) {
+		t.Errorf("auth key differs from CEBE321F6FF7716B6FD4AB49AF256A156D38BAA4")
+	}
+}
+
+// TestSRTPDecryptRTP decrypts the packets of srtpSource, a zero payload, and drops a tampered one.
+func TestSRTPDecryptRTP(t *testing.T) {
+	src := newSRTPSource(100)
+	d := &srtpDecrypter{}
+	d.setKeys([]*srtpKey{src.key}, nil)
+	for i := 0; i < 3; i++ {
+		b, ok := d.decrypt(src.next())
+		if !ok {
+			t.Fatalf("packet %d is not authenticated", i)
+		}
+		if len(b) != 12+100 || !bytes.Equal(b[12:], make([]byte, 100)) {
+			t.Fatalf("packet %d: payload %X, should be 100 zero bytes", i, b[12:])
+		}
+	}
+	b := src.next()
+	b[20] ^= 1
+	if _, ok := d.decrypt(b); ok {
+		t.Errorf("tampered packet is authenticated")
+	}
+	if st := d.snapshot(); st.RTP != 3 || st.AuthFailures != 1 {
+		t.Errorf("stats %+v, should be 3 rtp and 1 authentication failure", st)
+	}
+}
+
+// protectRTCP encrypts an RTCP packet into an SRTCP packet of an index (RFC 3711 3.4).
+func protectRTCP(k *srtpKey, b []byte, index uint32) []byte {
+	out := append([]byte(nil), b...)
+	iv := cryptoIV(k.rtcpSalt, binary.BigEndian.Uint32(out[4:]), uint64(index))
+	cipher.NewCTR(k.rtcpBlock, iv[:]).XORKeyStream(out[8:], out[8:])
+	out = binary.BigEndian.AppendUint32(out, 0x80000000|index)
+	k.rtcpAuth.Reset()
+	k.rtcpAuth.Write(out)
+	return append(out, k.rtcpAuth.Sum(nil)[:srtcpTagLen]...)
+}
+
+// TestSRTCPRoundTrip decrypts the SRTCP packets of a sender report and drops a tampered one.
+func TestSRTCPRoundTrip(t *testing.T) {
+	k, err := newSRTPKey(4, unhex("E1F97A0D3E018BE0D64FA32C06DE4139"), unhex("0EC675AD498AFEEBB6960B3AABE6"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr := &rtcp.SenderReport{SSRC: 0x12345678, NTPTime: 0xE9C1F5A000000000, RTPTime: 90000, PacketCount: 10, OctetCount: 12000}
+	plain, err := sr.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &srtpDecrypter{}
+	d.setKeys([]*srtpKey{k}, nil)
+	for index := uint32(1); index <= 2; index++ {
+		b := protectRTCP(k, plain, index)
+		if bytes.Equal(b[8:len(plain)], plain[8:]) {
+			t.Fatalf("index %d: packet is not encrypted", index)
+		}
+		got, ok := d.decrypt(b)
+		if !ok || !bytes.Equal(got, plain) {
+			t.Fatalf("index %d: %X, %v, should be %X", index, got, ok, plain)
+		}
+	}
+	b := protectRTCP(k, plain, 3)
+	b[len(b)-1] ^= 1
+	if _, ok := d.decrypt(b); ok {
+		t.Errorf("tampered packet is authenticated")
+	}
+	if st := d.snapshot(); st.RTCP != 2 || st.AuthFailures != 1 {
+		t.Errorf("stats %+v, should be 2 rtcp and 1 authentication failure", st)
+	}
+}
+
+// srtpSource generates the SRTP packets of a 90kHz stream of a test key, each decrypted in place
+// from a copy, the packets are protected once.
+type srtpSource struct {
+	key  *srtpKey
+	i    int
+	pkts [][]byte
+	buf  []byte
+}
+
+func newSRTPSource(payloadSize int) *srtpSource {
+	key, err := newSRTPKey(10, make([]byte, srtpKeyLen), make([]byte, srtpSaltLen))
+	if err != nil {
+		panic(err)
+	}
+	src := &srtpSource{key: key, buf: make([]byte, 12+payloadSize+key.tagLen)}
+	for i := 0; i < 1000; i++ {
+		b := make([]byte, 12+payloadSize, 12+payloadSize+key.tagLen)
+		b[0], b[1] = 0x80, 96
+		binary.BigEndian.PutUint16(b[2:], uint16(i))
+		binary.BigEndian.PutUint32(b[4:], uint32(i*90))
+		binary.BigEndian.PutUint32(b[8:], 0x12345678)
+		iv := cryptoIV(key.rtpSalt, 0x12345678, uint64(i))
+		cipher.NewCTR(key.rtpBlock, iv[:]).XORKeyStream(b[12:], b[12:])
+		key.rtpAuth.Reset()
+		key.rtpAuth.Write(b)
+		key.rtpAuth.Write([]byte{0, 0, 0, 0})
+		src.pkts = append(src.pkts, append(b, key.rtpAuth.Sum(nil)[:key.tagLen]...))
+	}
+	return src
+}
+
+func (src *srtpSource) next() []byte {
+	b := src.buf[:copy(src.buf, src.pkts[src.i%len(src.pkts)])]
+	src.i++
+	return b
+}
+
+func init() {
+	optionalHotPaths["SRTPDecrypter"] = func() func() {
+		src := newSRTPSource(1200)
+		d := &srtpDecrypter{}
+		d.setKeys([]*srtpKey{src.key}, nil)
+		return func() {
+			if _, ok := d.decrypt(src.next()); !ok {
+				panic("srtp authentication failed")
+			}
+		}
+	}
+}
+
+func BenchmarkSRTPDecrypter(b *testing.B) { benchmarkHotPath(b, "SRTPDecrypter") }
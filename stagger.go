@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerFeature("stagger")
+}
+
+// -start-jitter distributions
+const (
+	jitterNone        = "none"
+	jitterUniform     = "uniform"
+	jitterExponential = "exponential"
+)
+
+// stagger spaces the starts of the sessions at -start-interval, randomized by -start-jitter,
+// and shuffles their order with -shuffle. A perfectly periodic start of sessions in url order
+// is a load servers handle unrealistically well or badly.
+type stagger struct {
+	interval time.Duration
+	jitter   string
+	shuffled bool
+	seed     int64
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// newStagger returns the stagger of the config, its random source is seeded with -seed, with the time if 0.
+func newStagger(cfg *config) *stagger {
+	seed := cfg.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &stagger{
+		interval: cfg.startInterval,
+		jitter:   cfg.startJitter,
+		shuffled: cfg.shuffle,
+		seed:     seed,
+		rnd:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// random tells if the run uses the random source of the stagger, the seed is logged to repeat the run.
+func (st *stagger) random(cfg *config) bool {
+	return st.jitter != jitterNone || st.shuffled || cfg.injectDrop > 0 || cfg.injectReorder > 0 || cfg.injectDelay > 0 || cfg.zapInterval > 0
+}
+
+// next returns the wait before the start of the next session: -start-interval,
+// uniform in [0, 2*interval) or exponential (Poisson arrivals) of mean interval.
+func (st *stagger) next() time.Duration {
+	if st.jitter == jitterNone || st.interval <= 0 {
+		return st.interval
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	switch st.jitter {
+	case jitterUniform:
+		return time.Duration(st.rnd.Int63n(int64(2 * st.interval)))
+	default:
+		return time.Duration(st.rnd.ExpFloat64() * float64(st.interval))
+	}
+}
+
+// wait waits before the start of the next session.
+func (st *stagger) wait() {
+	<-time.After(st.next())
+}
+
+// derive returns a seed derived from -seed, for the random sources of the sessions.
+func (st *stagger) derive() int64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.rnd.Int63()
+}
+
+// shuffle shuffles the order of n sessions with swap if -shuffle is set.
+func (st *stagger) shuffle(n int, swap func(i, j int)) {
+	if !st.shuffled {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.rnd.Shuffle(n, swap)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	registerFeature("statsd")
+}
+
+// statsdTags are the DogStatsD tags added to all the metrics of -statsd-addr.
+type statsdTags []string
+
+func (t statsdTags) String() string {
+	return strings.Join(t, ",")
+}
+
+// Set implements flag.Value, s is "key:value[,key:value]", it can be repeated.
+func (t *statsdTags) Set(s string) error {
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" || strings.ContainsAny(kv, "|#") {
+			return fmt.Errorf("invalid statsd tag %q, should be key:value", kv)
+		}
+		*t = append(*t, kv)
+	}
+	return nil
+}
+
+// statsdEmitter sends the metrics of a run over StatsD UDP.
+// Events (handshakes, delays, failures) are sent when they happen,
+// the packet counters and the session gauges every -statsd-interval.
+type statsdEmitter struct {
+	prefix string
+	suffix string
+	conn   net.Conn
+
+	packets uint64
+	bytes   uint64
+}
+
+func newStatsdEmitter(cfg *config, runName string) (*statsdEmitter, error) {
+	conn, err := net.Dial("udp", cfg.statsdAddr)
+	if err != nil {
+		return nil, err
+	}
+	tags := append(statsdTags(nil), cfg.statsdTags...)
+	if runName != "" {
+		tags = append(tags, "run:"+runName)
+	}
+	for k, v := range cfg.runLabels() {
+		tags = append(tags, k+":"+v)
+	}
+	sort.Strings(tags)
+	e := &statsdEmitter{prefix: cfg.statsdPrefix, conn: conn}
+	if len(tags) != 0 {
+		e.suffix = "|#" + tags.String()
+	}
+	return e, nil
+}
+
+// send sends a metric, errors are ignored as StatsD is best effort.
+func (e *statsdEmitter) send(name, value, typ string) {
+	e.conn.Write([]byte(e.prefix + name + ":" + value + "|" + typ + e.suffix))
+}
+
+func (e *statsdEmitter) count(name string, v uint64) {
+	e.send(name, strconv.FormatUint(v, 10), "c")
+}
+
+func (e *statsdEmitter) gauge(name string, v uint64) {
+	e.send(name, strconv.FormatUint(v, 10), "g")
+}
+
+func (e *statsdEmitter) timing(name string, d time.Duration) {
+	e.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64), "ms")
+}
+
+func (e *statsdEmitter) addPacket(size int) {
+	atomic.AddUint64(&e.packets, 1)
+	atomic.AddUint64(&e.bytes, uint64(size))
+}
+
+func (e *statsdEmitter) onHandshake(phases map[string]duration, err error) {
+	if err != nil {
+		e.count("handshake_errors", 1)
+		return
+	}
+	var total time.Duration
+	for _, d := range phases {
+		total += time.Duration(d)
+	}
+	e.timing("handshake_ms", total)
+}
+
+func (e *statsdEmitter) onDelay() {
+	e.count("delay_events", 1)
+}
+
+func (e *statsdEmitter) onResult(err error) {
+	if err != nil {
+		e.count("sessions_failed", 1)
+	} else {
+		e.count("sessions_succeeded", 1)
+	}
+}
+
+// flush sends the packet counters since the last flush and the session gauges of r.
+func (e *statsdEmitter) flush(r *run) {
+	e.count("rtp_packets", atomic.SwapUint64(&e.packets, 0))
+	e.count("rtp_bytes", atomic.SwapUint64(&e.bytes, 0))
+	tot := r.totals()
+	e.gauge("sessions_active", uint64(tot.Sessions))
+	e.gauge("sessions_playing", uint64(tot.Playing))
+	e.gauge("bitrate_bps", uint64(tot.Bitrate))
+}
+
+// start flushes the metrics every interval until the returned func is called.
+func (e *statsdEmitter) start(r *run, interval time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				e.flush(r)
+			case <-done:
+				e.flush(r)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		e.conn.Close()
+	}
+}
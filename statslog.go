@@ -0,0 +1,87 @@
+package main
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	registerFeature("stats-log")
+}
+
+// statsLog logs a rollup of the run every -stats-interval, a heartbeat of long runs between the events.
+type statsLog struct {
+	// counters of the window
+	packets uint64
+	errors  int64
+	delays  int64
+	// maximal delay of the window in nanoseconds
+	maxDelay int64
+
+	// CPU time and GC counters of the process at the start of the window, of the logging goroutine only
+	cpu time.Duration
+	gc  gcSnapshot
+}
+
+func (sl *statsLog) addPacket() {
+	atomic.AddUint64(&sl.packets, 1)
+}
+
+func (sl *statsLog) onError() {
+	atomic.AddInt64(&sl.errors, 1)
+}
+
+func (sl *statsLog) onDelay(d time.Duration) {
+	atomic.AddInt64(&sl.delays, 1)
+	for {
+		max := atomic.LoadInt64(&sl.maxDelay)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&sl.maxDelay, max, int64(d)) {
+			return
+		}
+	}
+}
+
+// log logs the sessions of r and the counters of the window of length d, and starts a new window.
+func (sl *statsLog) log(r *run, d time.Duration) {
+	tot := r.totals()
+	packets := atomic.SwapUint64(&sl.packets, 0)
+	h := r.cfg.human()
+	r.logger.Printf(r.cfg.tr("stats: sessions %d, playing %d, %s, packets %s/s, errors %d, delays %d, max delay %s"),
+		tot.Sessions, tot.Playing, h.bitrate(tot.Bitrate), h.float(float64(packets)/d.Seconds()),
+		atomic.SwapInt64(&sl.errors, 0), atomic.SwapInt64(&sl.delays, 0), h.duration(time.Duration(atomic.SwapInt64(&sl.maxDelay, 0))))
+
+	// the usage of the tool itself tells the delays of an overloaded client host from those of the server
+	cpu := processCPU()
+	usage := float64(cpu-sl.cpu) / float64(d) * 100
+	perSessions := "n/a"
+	if tot.Sessions != 0 {
+		perSessions = h.float(usage*1000/float64(tot.Sessions)) + "%"
+	}
+	gc := sl.gc.since()
+	r.logger.Printf(r.cfg.tr("self: cpu %s%% of %d cores, %s per 1000 sessions, heap %s, goroutines %d, gc %d cycles, pause total %s, max %s"),
+		h.float(usage), runtime.NumCPU(), perSessions, h.bytes(gc.HeapSys), runtime.NumGoroutine(),
+		gc.Cycles, h.duration(gc.Total), h.duration(gc.Max))
+	sl.cpu, sl.gc = cpu, takeGCSnapshot()
+}
+
+// start logs every interval until the returned func is called.
+func (sl *statsLog) start(r *run, interval time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		last := time.Now()
+		sl.cpu, sl.gc = processCPU(), takeGCSnapshot()
+		for {
+			select {
+			case now := <-t.C:
+				sl.log(r, now.Sub(last))
+				last = now
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
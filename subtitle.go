@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("subtitles")
+	registerCodec("subtitles", subtitleCodecs...)
+}
+
+// subtitleCodecs are the encoding names of the timed-text formats, the formats of a text media are subtitles too.
+var subtitleCodecs = []string{"t140", "3gpp-tt", "x-srt", "webvtt", "x-webvtt", "ttml+xml", "x-ttml"}
+
+// mediaTypeText is the type of the text medias of the SDP (m=text), renamed by fixTextMedias.
+const mediaTypeText description.MediaType = "application/text"
+
+// fixTextMedias renames the text medias of an SDP to application/text, the client rejects the media type text
+// but accepts the application/ types.
+func fixTextMedias(body []byte) []byte {
+	if !bytes.Contains(body, []byte("m=text ")) {
+		return body
+	}
+	lines := bytes.Split(body, []byte("\n"))
+	for i, l := range lines {
+		if bytes.HasPrefix(l, []byte("m=text ")) {
+			lines[i] = append([]byte("m="+mediaTypeText), l[len("m=text"):]...)
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+func isSubtitle(medi *description.Media, forma format.Format) bool {
+	if medi.Type == mediaTypeText {
+		return true
+	}
+	for _, name := range codecNames(forma) {
+		for _, c := range subtitleCodecs {
+			if strings.EqualFold(name, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subtitleStats are the presence and the cadence of the packets of a subtitle track.
+type subtitleStats struct {
+	Packets     uint64   `json:"packets"`
+	Bytes       uint64   `json:"bytes"`
+	MinInterval duration `json:"minInterval"`
+	AvgInterval duration `json:"avgInterval"`
+	MaxInterval duration `json:"maxInterval"`
+	GapAlarms   int      `json:"gapAlarms"`
+}
+
+// subtitleTrack monitors the presence and the cadence of the sparse packets of a timed-text track,
+// an interval longer than -max-subtitle-gap is an alarm. With -subtitle-dir, the payloads are
+// written one per line with their arrival time and RTP timestamp, quoted.
+type subtitleTrack struct {
+	s    *session
+	name string
+
+	mu    sync.Mutex
+	stats subtitleStats
+	last  time.Time
+	total time.Duration
+	f     *os.File
+	w     *bufio.Writer
+	err   error
+}
+
+// setupSubtitles creates the monitors of the subtitle tracks of the medias, and their files of -subtitle-dir.
+func (s *session) setupSubtitles(medias []*description.Media) error {
+	for _, medi := range medias {
+		for _, forma := range medi.Formats {
+			if !isSubtitle(medi, forma) {
+				continue
+			}
+			st := &subtitleTrack{s: s, name: s.tracks[forma].name}
+			if s.cfg.subtitleDir != "" {
+				if err := os.MkdirAll(s.cfg.subtitleDir, 0o755); err != nil {
+					return err
+				}
+				f, err := os.Create(sessionFileName(s.cfg.subtitleDir, s.id, fmt.Sprintf(".%d.txt", forma.PayloadType())))
+				if err != nil {
+					return err
+				}
+				st.f, st.w = f, bufio.NewWriter(f)
+			}
+			if s.subtitles == nil {
+				s.subtitles = make(map[format.Format]*subtitleTrack)
+			}
+			s.subtitles[forma] = st
+			s.logf("subtitle track %s: %s", st.name, formatString(forma))
+		}
+	}
+	return nil
+}
+
+func (st *subtitleTrack) onPacket(now time.Time, pkt *rtp.Packet) {
+	st.mu.Lock()
+	st.stats.Packets++
+	st.stats.Bytes += uint64(len(pkt.Payload))
+	var interval time.Duration
+	if !st.last.IsZero() {
+		interval = now.Sub(st.last)
+		st.total += interval
+		if st.stats.MinInterval == 0 || duration(interval) < st.stats.MinInterval {
+			st.stats.MinInterval = duration(interval)
+		}
+		if duration(interval) > st.stats.MaxInterval {
+			st.stats.MaxInterval = duration(interval)
+		}
+		st.stats.AvgInterval = duration(st.total / time.Duration(st.stats.Packets-1))
+	}
+	st.last = now
+	alarm := st.s.cfg.maxSubtitleGap > 0 && interval > st.s.cfg.maxSubtitleGap
+	if alarm {
+		st.stats.GapAlarms++
+	}
+	if st.w != nil && st.err == nil {
+		_, st.err = fmt.Fprintf(st.w, "%s\t%d\t%q\n", now.Format(time.RFC3339Nano), pkt.Timestamp, pkt.Payload)
+	}
+	st.mu.Unlock()
+
+	if alarm {
+		st.s.logf("subtitle %s: no packet for %s, over -max-subtitle-gap %s",
+			st.name, st.s.cfg.human().duration(interval), st.s.cfg.human().duration(st.s.cfg.maxSubtitleGap))
+	}
+}
+
+func (st *subtitleTrack) snapshot() subtitleStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.stats
+}
+
+// close flushes the file of -subtitle-dir.
+func (st *subtitleTrack) close() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.f == nil {
+		return nil
+	}
+	if st.err == nil {
+		st.err = st.w.Flush()
+	}
+	if err := st.f.Close(); st.err == nil {
+		st.err = err
+	}
+	return st.err
+}
+
+// closeSubtitles logs the stats of the subtitle tracks and closes their files.
+func (s *session) closeSubtitles() {
+	h := s.cfg.human()
+	for _, st := range s.subtitles {
+		ss := st.snapshot()
+		s.summaryf("subtitles %s: packets %d, bytes %s, interval min/avg/max %s/%s/%s, gap alarms %d",
+			st.name, ss.Packets, h.bytes(ss.Bytes), h.duration(time.Duration(ss.MinInterval)),
+			h.duration(time.Duration(ss.AvgInterval)), h.duration(time.Duration(ss.MaxInterval)), ss.GapAlarms)
+		if err := st.close(); err != nil {
+			s.logf("failed to write subtitles, %v", err)
+		}
+	}
+}
+
+// checkSubtitles fails a session of -expect-subtitles whose subtitle tracks carried no RTP packet.
+func (s *session) checkSubtitles() error {
+	if !s.cfg.expectSubtitles {
+		return nil
+	}
+	for _, st := range s.subtitles {
+		if st.snapshot().Packets == 0 {
+			return s.errorf("no rtp packet on the subtitle track %s", st.name)
+		}
+	}
+	return nil
+}
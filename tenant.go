@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+)
+
+func init() {
+	registerFeature("tenants")
+}
+
+// tenantDef is a test definition in the tenants file.
+// Args are the same flags as the command line.
+// MaxSessions is the concurrent sessions quota of the tenant, it overrides -max-sessions.
+// Headers are the custom headers of the requests by method, added to those of -header.
+//
+// (ex)
+//
+//	{"tenants": [
+//	  {"name": "team-a", "args": ["-url", "rtsp://172.16.11.100:8554", "-count", "100"], "maxSessions": 100},
+//	  {"name": "team-b", "args": ["-url", "rtsp://172.16.11.101:8554/{NUM}.stream", "-start", "1", "-end", "50"],
+//	   "headers": {"DESCRIBE": {"X-Session-Group": "test42"}, "SETUP": {"X-Token": "abc"}}}
+//	]}
+type tenantDef struct {
+	Name        string                       `json:"name"`
+	Args        []string                     `json:"args"`
+	MaxSessions int                          `json:"maxSessions"`
+	Headers     map[string]map[string]string `json:"headers"`
+}
+
+type tenantsFile struct {
+	Tenants []tenantDef `json:"tenants"`
+}
+
+func loadTenants(path string) ([]*run, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file, %v", err)
+	}
+	var tf tenantsFile
+	if err := json.Unmarshal(b, &tf); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants file, %v", err)
+	}
+	if len(tf.Tenants) == 0 {
+		return nil, fmt.Errorf("no tenants in %s", path)
+	}
+
+	var runs []*run
+	names := make(map[string]bool)
+	for _, t := range tf.Tenants {
+		if t.Name == "" || names[t.Name] {
+			return nil, fmt.Errorf("tenant name should be unique and not empty, %q", t.Name)
+		}
+		names[t.Name] = true
+
+		cfg := &config{}
+		fs := newFlagSet(t.Name, cfg, flag.ContinueOnError)
+		if err := parseConfig(fs, t.Args); err != nil {
+			return nil, fmt.Errorf("[%s] invalid args, %v", t.Name, err)
+		}
+		if t.MaxSessions > 0 {
+			cfg.maxSessions = t.MaxSessions
+		}
+		if err := cfg.headers.addMethods(t.Headers); err != nil {
+			return nil, fmt.Errorf("[%s] %v", t.Name, err)
+		}
+		if err := cfg.validate(); err != nil {
+			return nil, fmt.Errorf("[%s] invalid args, %v", t.Name, err)
+		}
+
+		r, err := newRun(t.Name, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %v", t.Name, err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, nil
+}
+
+// runTenants runs the tenants of the file concurrently.
+// The control api of the tenants is served on apiAddr under /tenants/<name>/,
+// and on the -api-addr of each tenant, if set. The gRPC control api of grpcAddr takes the tenant as namespace.
+func runTenants(path string, apiAddr, grpcAddr string) error {
+	runs, err := loadTenants(path)
+	if err != nil {
+		return err
+	}
+
+	routes := make(map[string]*run)
+	for _, r := range runs {
+		routes["/tenants/"+r.name] = r
+	}
+	if apiAddr != "" {
+		serveAPI(apiAddr, routes)
+	}
+	if grpcAddr != "" {
+		serveGRPC(grpcAddr, routes)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(runs))
+	for i, r := range runs {
+		if r.cfg.apiAddr != "" {
+			serveAPI(r.cfg.apiAddr, map[string]*run{"": r})
+		}
+
+		wg.Add(1)
+		go func(i int, r *run) {
+			defer wg.Done()
+			errs[i] = r.start()
+			if errs[i] != nil {
+				r.logger.Printf("tenant finished with errors, %v", errs[i])
+			} else {
+				r.logger.Printf("tenant finished")
+			}
+		}(i, r)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("[%s] %v", runs[i].name, err)
+		}
+	}
+	return nil
+}
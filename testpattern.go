@@ -0,0 +1,231 @@
+package main
+
+import (
+	"math/bits"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+)
+
+// The test pattern of -publish testpattern is an H264 stream made without an encoder:
+// a keyframe of uncompressed (I_PCM) macroblocks of color bars every second,
+// followed by P frames of skipped macroblocks.
+// The bars move every second and the pattern loops every testPatternLoop.
+const (
+	testPatternWidth  = 320
+	testPatternHeight = 240
+	testPatternFPS    = 25
+	testPatternLoop   = 10 * time.Second
+
+	// log2_max_frame_num_minus4 of the SPS, frame_num is 8 bits
+	testPatternFrameNumBits = 8
+)
+
+// testPatternBars are the Y, Cb, Cr of the 75% color bars.
+var testPatternBars = [8][3]byte{
+	{180, 128, 128}, // white
+	{162, 44, 142},  // yellow
+	{131, 156, 44},  // cyan
+	{112, 72, 58},   // green
+	{84, 184, 198},  // magenta
+	{65, 100, 212},  // red
+	{35, 212, 114},  // blue
+	{16, 128, 128},  // black
+}
+
+// bitWriter writes the fields of an H264 RBSP.
+type bitWriter struct {
+	buf []byte
+	n   uint // bits used in the last byte, 0 if aligned
+}
+
+func (w *bitWriter) u(nbits uint, v uint32) {
+	for i := int(nbits) - 1; i >= 0; i-- {
+		if w.n == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v&(1<<uint(i)) != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> w.n
+		}
+		w.n = (w.n + 1) % 8
+	}
+}
+
+// ue writes an unsigned Exp-Golomb code.
+func (w *bitWriter) ue(v uint32) {
+	x := v + 1
+	n := uint(bits.Len32(x))
+	w.u(n-1, 0)
+	w.u(n, x)
+}
+
+// se writes a signed Exp-Golomb code.
+func (w *bitWriter) se(v int32) {
+	if v > 0 {
+		w.ue(uint32(2*v - 1))
+	} else {
+		w.ue(uint32(-2 * v))
+	}
+}
+
+// align writes zero bits up to the next byte.
+func (w *bitWriter) align() {
+	w.n = 0
+}
+
+// trailing writes the rbsp_trailing_bits.
+func (w *bitWriter) trailing() {
+	w.u(1, 1)
+	w.align()
+}
+
+// nalu returns the NAL unit of the RBSP, with the emulation prevention bytes.
+func (w *bitWriter) nalu(header byte) []byte {
+	ret := make([]byte, 1, len(w.buf)+len(w.buf)/64+1)
+	ret[0] = header
+	zeros := 0
+	for _, b := range w.buf {
+		if zeros == 2 && b <= 3 {
+			ret = append(ret, 3)
+			zeros = 0
+		}
+		ret = append(ret, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return ret
+}
+
+func testPatternSPS() []byte {
+	var w bitWriter
+	w.u(8, 66)   // profile_idc, baseline
+	w.u(8, 0xc0) // constraint_set0_flag, constraint_set1_flag
+	w.u(8, 30)   // level_idc
+	w.ue(0)      // seq_parameter_set_id
+	w.ue(testPatternFrameNumBits - 4)
+	w.ue(2) // pic_order_cnt_type, output in decoding order
+	w.ue(1) // max_num_ref_frames
+	w.u(1, 0)
+	w.ue(testPatternWidth/16 - 1)
+	w.ue(testPatternHeight/16 - 1)
+	w.u(1, 1) // frame_mbs_only_flag
+	w.u(1, 1) // direct_8x8_inference_flag
+	w.u(1, 0) // frame_cropping_flag
+	w.u(1, 0) // vui_parameters_present_flag
+	w.trailing()
+	return w.nalu(0x67)
+}
+
+func testPatternPPS() []byte {
+	var w bitWriter
+	w.ue(0)   // pic_parameter_set_id
+	w.ue(0)   // seq_parameter_set_id
+	w.u(1, 0) // entropy_coding_mode_flag, CAVLC
+	w.u(1, 0) // bottom_field_pic_order_in_frame_present_flag
+	w.ue(0)   // num_slice_groups_minus1
+	w.ue(0)   // num_ref_idx_l0_default_active_minus1
+	w.ue(0)   // num_ref_idx_l1_default_active_minus1
+	w.u(1, 0) // weighted_pred_flag
+	w.u(2, 0) // weighted_bipred_idc
+	w.se(0)   // pic_init_qp_minus26
+	w.se(0)   // pic_init_qs_minus26
+	w.se(0)   // chroma_qp_index_offset
+	w.u(1, 1) // deblocking_filter_control_present_flag
+	w.u(1, 0) // constrained_intra_pred_flag
+	w.u(1, 0) // redundant_pic_cnt_present_flag
+	w.trailing()
+	return w.nalu(0x68)
+}
+
+// testPatternIDR returns the keyframe of the bars shifted by shift pixels.
+func testPatternIDR(idrPicID uint32, shift int) []byte {
+	var w bitWriter
+	w.ue(0) // first_mb_in_slice
+	w.ue(7) // slice_type, I
+	w.ue(0) // pic_parameter_set_id
+	w.u(testPatternFrameNumBits, 0)
+	w.ue(idrPicID)
+	w.u(1, 0) // no_output_of_prior_pics_flag
+	w.u(1, 0) // long_term_reference_flag
+	w.se(0)   // slice_qp_delta
+	w.ue(1)   // disable_deblocking_filter_idc
+
+	bar := func(x int) [3]byte {
+		return testPatternBars[(x+shift)%testPatternWidth*len(testPatternBars)/testPatternWidth]
+	}
+	for my := 0; my < testPatternHeight/16; my++ {
+		for mx := 0; mx < testPatternWidth/16; mx++ {
+			// the colors of the columns of the macroblock
+			var cols [16][3]byte
+			for x := range cols {
+				cols[x] = bar(mx*16 + x)
+			}
+			w.ue(25) // mb_type, I_PCM
+			w.align()
+			for y := 0; y < 16; y++ {
+				for x := 0; x < 16; x++ {
+					w.buf = append(w.buf, cols[x][0])
+				}
+			}
+			for c := 1; c <= 2; c++ {
+				for y := 0; y < 8; y++ {
+					for x := 0; x < 8; x++ {
+						w.buf = append(w.buf, cols[x*2][c])
+					}
+				}
+			}
+		}
+	}
+	w.trailing()
+	return w.nalu(0x65)
+}
+
+// testPatternP returns a P frame that repeats the previous frame.
+func testPatternP(frameNum uint32) []byte {
+	var w bitWriter
+	w.ue(0) // first_mb_in_slice
+	w.ue(5) // slice_type, P
+	w.ue(0) // pic_parameter_set_id
+	w.u(testPatternFrameNumBits, frameNum)
+	w.u(1, 0) // num_ref_idx_active_override_flag
+	w.u(1, 0) // ref_pic_list_modification_flag_l0
+	w.u(1, 0) // adaptive_ref_pic_marking_mode_flag
+	w.se(0)   // slice_qp_delta
+	w.ue(1)   // disable_deblocking_filter_idc
+	// mb_skip_run, all the macroblocks
+	w.ue(testPatternWidth / 16 * testPatternHeight / 16)
+	w.trailing()
+	return w.nalu(0x41)
+}
+
+// newTestPattern returns the frames of a testPatternLoop of the test pattern.
+func newTestPattern() *publishMedia {
+	sps, pps := testPatternSPS(), testPatternPPS()
+	pm := &publishMedia{
+		name: "testpattern",
+		tracks: []publishTrack{{
+			newFormat: func() format.Format {
+				return &format.H264{PayloadTyp: 96, SPS: sps, PPS: pps, PacketizationMode: 1}
+			},
+		}},
+		duration: testPatternLoop,
+	}
+	seconds := int(testPatternLoop / time.Second)
+	for sec := 0; sec < seconds; sec++ {
+		shift := sec * testPatternWidth / seconds
+		for i := 0; i < testPatternFPS; i++ {
+			f := publishFrame{dts: time.Duration(sec*testPatternFPS+i) * time.Second / testPatternFPS}
+			f.pts = f.dts
+			if i == 0 {
+				f.au = [][]byte{sps, pps, testPatternIDR(uint32(sec), shift)}
+			} else {
+				f.au = [][]byte{testPatternP(uint32(i))}
+			}
+			pm.frames = append(pm.frames, f)
+		}
+	}
+	return pm
+}
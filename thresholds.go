@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// duration is a time.Duration that is marshaled as "1s", "500ms", ...
+type duration time.Duration
+
+func (d duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// thresholds are the assertion values checked while sessions are playing.
+// They can be changed at runtime through the control API.
+type thresholds struct {
+	DelayTimeout  duration `json:"delayTimeout"`
+	LossThreshold int      `json:"lossThreshold"`
+	MaxGOP        duration `json:"maxGOP"`
+	MinBitrate    bitrate  `json:"minBitrate"`
+	MaxBitrate    bitrate  `json:"maxBitrate"`
+}
+
+func (t thresholds) validate() error {
+	if t.DelayTimeout <= 0 {
+		return fmt.Errorf("delayTimeout should be positive")
+	}
+	if t.LossThreshold < 1 {
+		return fmt.Errorf("lossThreshold should be at least 1")
+	}
+	if t.MaxGOP < 0 {
+		return fmt.Errorf("maxGOP should not be negative")
+	}
+	if t.MinBitrate < 0 || t.MaxBitrate < 0 {
+		return fmt.Errorf("minBitrate and maxBitrate should not be negative")
+	}
+	if t.MaxBitrate > 0 && t.MinBitrate > t.MaxBitrate {
+		return fmt.Errorf("minBitrate should not be greater than maxBitrate")
+	}
+	return nil
+}
+
+func (cfg *config) thresholds() thresholds {
+	return thresholds{
+		DelayTimeout:  duration(cfg.delayTimeout),
+		LossThreshold: cfg.lossThreshold,
+		MaxGOP:        duration(cfg.maxGOP),
+		MinBitrate:    cfg.minBitrate,
+		MaxBitrate:    cfg.maxBitrate,
+	}
+}
+
+func (r *run) getThresholds() thresholds {
+	r.thresholdsMu.RLock()
+	defer r.thresholdsMu.RUnlock()
+	return r.thresholds
+}
+
+func (r *run) setThresholds(t thresholds) {
+	r.thresholdsMu.Lock()
+	defer r.thresholdsMu.Unlock()
+	r.thresholds = t
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// tz is the timezone of the timestamps of all outputs, set by -timezone.
+var tz = time.UTC
+
+// timestampLayout is RFC3339 with milliseconds.
+const timestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// timestamp formats t as RFC3339 in tz.
+func timestamp(t time.Time) string {
+	return t.In(tz).Format(timestampLayout)
+}
+
+// timestampWriter prefixes every write (log line) with the RFC3339 timestamp in tz,
+// it replaces the local time flags of the log package.
+type timestampWriter struct {
+	w io.Writer
+}
+
+func (tw timestampWriter) Write(p []byte) (int, error) {
+	b := make([]byte, 0, len(timestampLayout)+1+len(p))
+	b = append(b, timestamp(time.Now())...)
+	b = append(b, ' ')
+	b = append(b, p...)
+	if _, err := tw.w.Write(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
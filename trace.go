@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+func init() {
+	registerFeature("trace")
+}
+
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization"}
+
+// tracer logs the RTSP messages exchanged by a session.
+type tracer struct {
+	s      *session
+	redact bool
+}
+
+func (t *tracer) header(h base.Header) base.Header {
+	if !t.redact {
+		return h
+	}
+	out := make(base.Header, len(h))
+	for k, v := range h {
+		out[k] = v
+	}
+	for _, k := range redactedHeaders {
+		if _, ok := out[k]; ok {
+			out[k] = base.HeaderValue{"<redacted>"}
+		}
+	}
+	return out
+}
+
+func (t *tracer) request(dir string, req *base.Request) {
+	r := *req
+	r.Header = t.header(req.Header)
+	t.s.logf("%s RTSP request\n%s", dir, strings.TrimRight(r.String(), "\r\n"))
+}
+
+func (t *tracer) response(dir string, res *base.Response) {
+	r := *res
+	r.Header = t.header(res.Header)
+	t.s.logf("%s RTSP response\n%s", dir, strings.TrimRight(r.String(), "\r\n"))
+}
+
+// install sets the trace callbacks of the client.
+// Outgoing messages are traced after the callbacks already set,
+// incoming messages before them, so that the trace shows what is on the wire.
+func (t *tracer) install(c *gortsplib.Client) {
+	onRequest := c.OnRequest
+	c.OnRequest = func(req *base.Request) {
+		if onRequest != nil {
+			onRequest(req)
+		}
+		t.request(">>", req)
+	}
+	onResponse := c.OnResponse
+	c.OnResponse = func(res *base.Response) {
+		t.response("<<", res)
+		if onResponse != nil {
+			onResponse(res)
+		}
+	}
+	onServerRequest := c.OnServerRequest
+	c.OnServerRequest = func(req *base.Request) {
+		t.request("<<", req)
+		if onServerRequest != nil {
+			onServerRequest(req)
+		}
+	}
+	onServerResponse := c.OnServerResponse
+	c.OnServerResponse = func(res *base.Response) {
+		if onServerResponse != nil {
+			onServerResponse(res)
+		}
+		t.response(">>", res)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// rtpStream is the sequence and jitter state of an RTP stream (SSRC),
+// as in RFC 3550 A.1, A.3, A.8.
+type rtpStream struct {
+	started  bool
+	baseSeq  uint16
+	maxSeq   uint16
+	cycles   uint32
+	received uint32
+	transit  int64
+	jitter   float64
+}
+
+func (st *rtpStream) onPacket(now time.Time, pkt *rtp.Packet, clockRate int) {
+	if !st.started {
+		*st = rtpStream{started: true, baseSeq: pkt.SequenceNumber, maxSeq: pkt.SequenceNumber}
+	} else {
+		if pkt.SequenceNumber < st.maxSeq && st.maxSeq-pkt.SequenceNumber > 0x8000 {
+			st.cycles += 1 << 16
+		}
+		if int16(pkt.SequenceNumber-st.maxSeq) > 0 {
+			st.maxSeq = pkt.SequenceNumber
+		}
+	}
+	st.received++
+
+	if clockRate <= 0 {
+		return
+	}
+	arrival := now.UnixNano() * int64(clockRate) / int64(time.Second)
+	transit := arrival - int64(pkt.Timestamp)
+	if st.received > 1 {
+		d := transit - st.transit
+		if d < 0 {
+			d = -d
+		}
+		st.jitter += (float64(d) - st.jitter) / 16
+	}
+	st.transit = transit
+}
+
+func (st *rtpStream) extendedMaxSeq() uint32 {
+	return st.cycles + uint32(st.maxSeq)
+}
+
+func (st *rtpStream) expected() uint32 {
+	return st.extendedMaxSeq() - uint32(st.baseSeq) + 1
+}
+
+func (st *rtpStream) lost() int64 {
+	return int64(st.expected()) - int64(st.received)
+}
+
+// ssrcStats are the statistics of an RTP stream of a format.
+type ssrcStats struct {
+	Packets uint64   `json:"packets"`
+	Bytes   uint64   `json:"bytes"`
+	Lost    int64    `json:"lost"`
+	Jitter  duration `json:"jitter"`
+}
+
+// mediaTrack holds the statistics of a format of a setupped media.
+// They are collected for every format, including the ones without depacketizer.
+type mediaTrack struct {
+	name      string
+	codec     string
+	clockRate int
+
+	mu      sync.Mutex
+	bitrate bitrateMeter
+	packets uint64
+	bytes   uint64
+	ssrcs   map[uint32]*ssrcTrack
+	// arrival of the last packet and the gaps between the arrivals
+	last time.Time
+	gaps gapHistogram
+	// nil without -playout-buffer
+	playout *playoutBuffer
+}
+
+type ssrcTrack struct {
+	stream  rtpStream
+	packets uint64
+	bytes   uint64
+}
+
+type trackStats struct {
+	Codec   string               `json:"codec"`
+	Packets uint64               `json:"packets"`
+	Bytes   uint64               `json:"bytes"`
+	Lost    int64                `json:"lost"`
+	Bitrate bitrateStats         `json:"bitrate"`
+	Gaps    gapStats             `json:"gaps"`
+	SSRCs   map[string]ssrcStats `json:"ssrcs,omitempty"`
+	Playout *playoutStats        `json:"playout,omitempty"`
+}
+
+// onPacket counts a packet, it returns the stall of an underrun of -playout-buffer, 0 if none.
+func (t *mediaTrack) onPacket(now time.Time, pkt *rtp.Packet) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.bitrate.add(now, len(pkt.Payload), nil)
+	t.packets++
+	t.bytes += uint64(len(pkt.Payload))
+	if !t.last.IsZero() {
+		t.gaps.add(now.Sub(t.last))
+	}
+	t.last = now
+
+	if t.ssrcs == nil {
+		t.ssrcs = make(map[uint32]*ssrcTrack)
+	}
+	st := t.ssrcs[pkt.SSRC]
+	if st == nil {
+		st = &ssrcTrack{}
+		t.ssrcs[pkt.SSRC] = st
+	}
+	st.stream.onPacket(now, pkt, t.clockRate)
+	st.packets++
+	st.bytes += uint64(len(pkt.Payload))
+
+	if t.playout == nil {
+		return 0
+	}
+	return t.playout.onPacket(now, pkt.SSRC, pkt.Timestamp)
+}
+
+func (t *mediaTrack) stats() trackStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ts := trackStats{
+		Codec:   t.codec,
+		Packets: t.packets,
+		Bytes:   t.bytes,
+		Bitrate: t.bitrate.stats,
+		Gaps:    t.gaps.stats(),
+	}
+	if t.playout != nil {
+		ps := t.playout.stats
+		ts.Playout = &ps
+	}
+	if len(t.ssrcs) != 0 {
+		ts.SSRCs = make(map[string]ssrcStats)
+	}
+	for ssrc, st := range t.ssrcs {
+		ss := ssrcStats{
+			Packets: st.packets,
+			Bytes:   st.bytes,
+			Lost:    st.stream.lost(),
+		}
+		if t.clockRate > 0 {
+			ss.Jitter = duration(time.Duration(st.stream.jitter * float64(time.Second) / float64(t.clockRate)))
+		}
+		ts.SSRCs[fmt.Sprintf("%08X", ssrc)] = ss
+		ts.Lost += ss.Lost
+	}
+	return ts
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("ts-analysis")
+}
+
+// the limits of ETSI TR 101 290
+const (
+	// PCR_repetition_error
+	tsMaxPCRInterval = 40 * time.Millisecond
+	// PCR_discontinuity_indicator_error
+	tsMaxPCRJump = 100 * time.Millisecond
+	// a PTS/DTS jump, far above any frame interval
+	tsMaxPTSJump = time.Second
+)
+
+const (
+	tsNullPID  = 0x1FFF
+	tsPCRWrap  = (1 << 33) * 300
+	tsPTSWrap  = 1 << 33
+	tsPCRClock = 27000000
+	tsPTSClock = 90000
+)
+
+// tsStats are the MPEG-TS QoS metrics of a MP2T over RTP format, as those of ETSI TR 101 290.
+type tsStats struct {
+	Packets uint64 `json:"packets"`
+	// continuity counter errors
+	CCErrors uint64 `json:"ccErrors"`
+	SyncLoss uint64 `json:"syncLoss"`
+	PCRs     uint64 `json:"pcrs"`
+	// PCRs later than tsMaxPCRInterval after the previous one
+	PCRRepetitionErrors uint64 `json:"pcrRepetitionErrors"`
+	// PCRs going back or jumping by more than tsMaxPCRJump without the discontinuity indicator
+	PCRDiscontinuities uint64   `json:"pcrDiscontinuities"`
+	MaxPCRInterval     duration `json:"maxPcrInterval"`
+	// max and average difference between the intervals of arrival and of value of consecutive PCRs
+	MaxPCRJitter duration `json:"maxPcrJitter"`
+	AvgPCRJitter duration `json:"avgPcrJitter"`
+	// PTS (DTS if any) going back or jumping by more than tsMaxPTSJump without the discontinuity indicator
+	PTSDiscontinuities uint64 `json:"ptsDiscontinuities"`
+}
+
+// tsPID is the state of a PID.
+type tsPID struct {
+	cc    uint8
+	hasCC bool
+
+	pcr     uint64
+	pcrTime time.Time
+	hasPCR  bool
+
+	pts    uint64
+	hasPTS bool
+
+	// PSI or SCTE-35 section being received
+	section []byte
+}
+
+// tsAnalyzer checks the continuity counters, the PCRs and the PTS/DTS of the TS packets of a MP2T over RTP format.
+type tsAnalyzer struct {
+	s    *session
+	name string
+
+	mu   sync.Mutex
+	pids map[uint16]*tsPID
+	// PCR jitter samples and their sum
+	jitters   uint64
+	jitterSum time.Duration
+	stats     tsStats
+
+	// PMT and SCTE-35 PIDs of -scte35
+	pmts        map[uint16]bool
+	scte35      map[uint16]bool
+	scte35Stats scte35Stats
+	// last PTS/DTS of the stream, the reference of the splice times
+	lastPTS uint64
+	hasPTS  bool
+}
+
+func newTSAnalyzer(s *session, name string) *tsAnalyzer {
+	return &tsAnalyzer{
+		s:      s,
+		name:   name,
+		pids:   make(map[uint16]*tsPID),
+		pmts:   make(map[uint16]bool),
+		scte35: make(map[uint16]bool),
+	}
+}
+
+func (ta *tsAnalyzer) onPacketRTP(now time.Time, pkt *rtp.Packet) {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	p := pkt.Payload
+	for len(p) >= tsPacketSize {
+		if p[0] != 0x47 {
+			ta.stats.SyncLoss++
+			return
+		}
+		ta.onPacket(now, p[:tsPacketSize])
+		p = p[tsPacketSize:]
+	}
+}
+
+// onPacket analyzes a TS packet, it is called with ta.mu locked.
+func (ta *tsAnalyzer) onPacket(now time.Time, p []byte) {
+	ta.stats.Packets++
+	pid := uint16(p[1]&0x1F)<<8 | uint16(p[2])
+	if pid == tsNullPID {
+		return
+	}
+	st := ta.pids[pid]
+	if st == nil {
+		st = &tsPID{}
+		ta.pids[pid] = st
+	}
+	start := p[1]&0x40 != 0
+	control := (p[3] >> 4) & 0x03
+	cc := p[3] & 0x0F
+	payload := p[4:]
+
+	discontinuity := false
+	if control&0x02 != 0 {
+		n := int(payload[0])
+		if n > len(payload)-1 {
+			return
+		}
+		af := payload[1 : 1+n]
+		payload = payload[1+n:]
+		if n > 0 {
+			discontinuity = af[0]&0x80 != 0
+			if af[0]&0x10 != 0 && n >= 7 {
+				base := uint64(af[1])<<25 | uint64(af[2])<<17 | uint64(af[3])<<9 | uint64(af[4])<<1 | uint64(af[5])>>7
+				ext := uint64(af[5]&0x01)<<8 | uint64(af[6])
+				ta.onPCR(now, pid, st, base*300+ext, discontinuity)
+			}
+		}
+	}
+
+	if control&0x01 != 0 {
+		// a single duplicate packet is allowed
+		if st.hasCC && !discontinuity && cc != (st.cc+1)&0x0F && cc != st.cc {
+			ta.stats.CCErrors++
+			st.section = st.section[:0]
+		}
+		st.cc, st.hasCC = cc, true
+	} else {
+		payload = nil
+	}
+
+	if ta.s.cfg.scte35 && payload != nil {
+		ta.onSection(pid, st, start, payload)
+	}
+
+	if start && len(payload) >= 14 && payload[0] == 0 && payload[1] == 0 && payload[2] == 1 && payload[7]&0x80 != 0 {
+		// the DTS if any, the PTS of the B frames go back
+		ts := payload[9:14]
+		if payload[7]&0x40 != 0 && len(payload) >= 19 {
+			ts = payload[14:19]
+		}
+		pts := uint64(ts[0]>>1&0x07)<<30 | uint64(ts[1])<<22 | uint64(ts[2]>>1)<<15 | uint64(ts[3])<<7 | uint64(ts[4]>>1)
+		ta.onPTS(pid, st, pts, discontinuity)
+	}
+}
+
+func (ta *tsAnalyzer) onPCR(now time.Time, pid uint16, st *tsPID, pcr uint64, discontinuity bool) {
+	ta.stats.PCRs++
+	last, lastTime, has := st.pcr, st.pcrTime, st.hasPCR
+	st.pcr, st.pcrTime, st.hasPCR = pcr, now, true
+	if !has || discontinuity {
+		return
+	}
+	delta := time.Duration(float64((pcr+tsPCRWrap-last)%tsPCRWrap) * float64(time.Second) / tsPCRClock)
+	if (pcr+tsPCRWrap-last)%tsPCRWrap > tsPCRWrap/2 || delta > tsMaxPCRJump {
+		ta.stats.PCRDiscontinuities++
+		ta.s.logf("mpegts %s pid %d: pcr discontinuity", ta.name, pid)
+		return
+	}
+	if delta > tsMaxPCRInterval {
+		ta.stats.PCRRepetitionErrors++
+	}
+	if duration(delta) > ta.stats.MaxPCRInterval {
+		ta.stats.MaxPCRInterval = duration(delta)
+	}
+	jitter := now.Sub(lastTime) - delta
+	if jitter < 0 {
+		jitter = -jitter
+	}
+	if duration(jitter) > ta.stats.MaxPCRJitter {
+		ta.stats.MaxPCRJitter = duration(jitter)
+	}
+	ta.jitters++
+	ta.jitterSum += jitter
+	ta.stats.AvgPCRJitter = duration(ta.jitterSum / time.Duration(ta.jitters))
+}
+
+func (ta *tsAnalyzer) onPTS(pid uint16, st *tsPID, pts uint64, discontinuity bool) {
+	last, has := st.pts, st.hasPTS
+	st.pts, st.hasPTS = pts, true
+	ta.lastPTS, ta.hasPTS = pts, true
+	if !has || discontinuity {
+		return
+	}
+	d := (pts + tsPTSWrap - last) % tsPTSWrap
+	if d > tsPTSWrap/2 || time.Duration(d)*time.Second/tsPTSClock > tsMaxPTSJump {
+		ta.stats.PTSDiscontinuities++
+		ta.s.logf("mpegts %s pid %d: pts discontinuity", ta.name, pid)
+	}
+}
+
+func (ta *tsAnalyzer) snapshot() tsStats {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	return ta.stats
+}
+
+func (ta *tsAnalyzer) scte35Snapshot() scte35Stats {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	return ta.scte35Stats
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	registerFeature("udp-ports")
+}
+
+// portRange is the range of -udp-ports, the client ports of the SETUP requests over UDP.
+type portRange struct {
+	// first even port and last odd port
+	min, max int
+	next     uint64
+}
+
+// parsePortRange parses -udp-ports, min-max, that holds at least an RTP/RTCP pair.
+func parsePortRange(v string) (*portRange, error) {
+	from, to, ok := strings.Cut(v, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid port range %q", v)
+	}
+	min, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", from)
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", to)
+	}
+	if min < 1024 || max > 65535 {
+		return nil, fmt.Errorf("ports should be between 1024 and 65535")
+	}
+	// the RTP port is even and the RTCP port is the next one
+	min += min % 2
+	if max%2 == 0 {
+		max--
+	}
+	if max <= min {
+		return nil, fmt.Errorf("no RTP/RTCP port pair in %s", v)
+	}
+	return &portRange{min: min, max: max}, nil
+}
+
+// pairs returns the count of the RTP/RTCP port pairs.
+func (pr *portRange) pairs() int {
+	return (pr.max - pr.min + 1) / 2
+}
+
+// rtpPort returns the next RTP port of the range, in turn. The ports in use are skipped
+// by failing to bind them.
+func (pr *portRange) rtpPort() int {
+	n := atomic.AddUint64(&pr.next, 1) - 1
+	return pr.min + int(n%uint64(pr.pairs()))*2
+}
+
+// portListener returns the ListenPacket of a client, that binds on ip, and on the ports of -udp-ports instead of
+// the random ports chosen by the client, to let fixed firewall rules of the test network pass the packets.
+// The client retries another pair when a port fails to bind, it waits a bit for a free pair once all failed.
+func (p *sourcePool) portListener(ip net.IP) func(network, address string) (net.PacketConn, error) {
+	if p.ports == nil {
+		return func(network, address string) (net.PacketConn, error) {
+			return p.listenPacket(ip, network, address)
+		}
+	}
+	var mu sync.Mutex
+	// RTP ports of the range by the RTP port chosen by the client, the RTCP port follows
+	rtpPorts := make(map[int]int)
+	failures := 0
+	return func(network, address string) (net.PacketConn, error) {
+		host, v, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		port, err := strconv.Atoi(v)
+		if err != nil || host != "" {
+			// multicast
+			return p.listenPacket(ip, network, address)
+		}
+
+		mu.Lock()
+		if port%2 == 0 {
+			if failures >= p.ports.pairs() {
+				mu.Unlock()
+				time.Sleep(100 * time.Millisecond)
+				mu.Lock()
+			}
+			rtpPorts[port] = p.ports.rtpPort()
+			port = rtpPorts[port]
+		} else if rtp, ok := rtpPorts[port-1]; ok {
+			delete(rtpPorts, port-1)
+			port = rtp + 1
+		}
+		mu.Unlock()
+
+		pc, err := p.listenPacket(ip, network, net.JoinHostPort("", strconv.Itoa(port)))
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case err != nil:
+			failures++
+		case port%2 == 1:
+			failures = 0
+		}
+		return pc, err
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerFeature("url-template")
+}
+
+// urlPlaceholder matches the placeholders of the url expanded for each session,
+// after {NUM} which is expanded for the session range.
+var urlPlaceholder = regexp.MustCompile(`\{(SEQ|RAND|UUID|TIME|CSV:[^{}]+)\}`)
+
+// anyPlaceholder matches anything that looks like a placeholder, to report the unknown ones.
+var anyPlaceholder = regexp.MustCompile(`\{[A-Za-z]+(:[^{}]*)?\}`)
+
+// urlColumns returns the columns of the {CSV:column} placeholders of the url.
+func urlColumns(rawURL string) []string {
+	var ret []string
+	for _, m := range urlPlaceholder.FindAllStringSubmatch(rawURL, -1) {
+		if strings.HasPrefix(m[1], "CSV:") {
+			ret = append(ret, strings.TrimPrefix(m[1], "CSV:"))
+		}
+	}
+	return ret
+}
+
+// unknownPlaceholders returns the placeholders of the url that are not expanded.
+func unknownPlaceholders(rawURL string) []string {
+	var ret []string
+	for _, p := range anyPlaceholder.FindAllString(rawURL, -1) {
+		if p != "{NUM}" && !urlPlaceholder.MatchString(p) {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// urlValues are the rows of -url-values, by column name.
+type urlValues struct {
+	columns map[string]int
+	rows    [][]string
+}
+
+// loadURLValues loads a CSV file with a header row, each session takes the next row.
+func loadURLValues(path string, columns []string) (*urlValues, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("no rows after the header")
+	}
+	v := &urlValues{columns: make(map[string]int), rows: records[1:]}
+	for i, c := range records[0] {
+		v.columns[strings.TrimSpace(c)] = i
+	}
+	for _, c := range columns {
+		if _, ok := v.columns[c]; !ok {
+			return nil, fmt.Errorf("no column %q, the columns are %s", c, strings.Join(records[0], ", "))
+		}
+	}
+	return v, nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// expandURL returns the url of the seq-th session of the run (from 1), with its placeholders expanded:
+// {SEQ} the sequence, {RAND} a random number, {UUID} a random UUID, {TIME} the unix time in seconds
+// and {CSV:column} the column of the seq-th row of -url-values, the rows are reused in turn.
+func (r *run) expandURL(rawURL string, seq int64) string {
+	if !strings.Contains(rawURL, "{") {
+		return rawURL
+	}
+	return urlPlaceholder.ReplaceAllStringFunc(rawURL, func(p string) string {
+		switch name := p[1 : len(p)-1]; name {
+		case "SEQ":
+			return strconv.FormatInt(seq, 10)
+		case "RAND":
+			n, _ := rand.Int(rand.Reader, big.NewInt(1<<32))
+			return n.String()
+		case "UUID":
+			return newUUID()
+		case "TIME":
+			return strconv.FormatInt(time.Now().Unix(), 10)
+		default:
+			if r.urlValues == nil {
+				return p
+			}
+			row := r.urlValues.rows[(seq-1)%int64(len(r.urlValues.rows))]
+			if i := r.urlValues.columns[strings.TrimPrefix(name, "CSV:")]; i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+	})
+}
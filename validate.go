@@ -0,0 +1,534 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+// configError is a problem of a flag and how to fix it.
+type configError struct {
+	Flag       string
+	Problem    string
+	Suggestion string
+}
+
+func (e configError) String() string {
+	s := "-" + e.Flag + ": " + e.Problem
+	if e.Suggestion != "" {
+		s += ", " + e.Suggestion
+	}
+	return s
+}
+
+// configErrors are all the problems of a config.
+type configErrors []configError
+
+func (errs *configErrors) add(flag, problem, suggestion string) {
+	*errs = append(*errs, configError{Flag: flag, Problem: problem, Suggestion: suggestion})
+}
+
+func (errs configErrors) Error() string {
+	l := make([]string, len(errs))
+	for i, e := range errs {
+		l[i] = "  " + e.String()
+	}
+	return fmt.Sprintf("%d config error(s):\n%s", len(errs), strings.Join(l, "\n"))
+}
+
+// err returns errs as an error, nil if there is no problem.
+func (errs configErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validate checks all the flags and their combinations,
+// and returns all the problems at once.
+func (cfg *config) validate() error {
+	return cfg.problems().err()
+}
+
+func (cfg *config) problems() configErrors {
+	var errs configErrors
+
+	// the optional subsystems left out of the build
+	for _, o := range []struct {
+		flag, feature string
+		set           bool
+	}{
+		{"grpc-addr", "grpc-api", cfg.grpcAddr != ""},
+		{"pcap-dir", "pcap", cfg.pcapDir != ""},
+		{"srtp", "srtp", cfg.srtp},
+		{"mikey-psk", "mikey", cfg.mikeyPSK != ""},
+	} {
+		if ok, tag := builtIn(o.feature); o.set && !ok {
+			errs.add(o.flag, o.feature+" is not built in this binary", "build it without the "+tag+" tag")
+		}
+	}
+
+	sample := urlPlaceholder.ReplaceAllString(strings.ReplaceAll(cfg.url, "{NUM}", "0"), "0")
+	if u, err := url.Parse(sample); err != nil {
+		errs.add("url", fmt.Sprintf("invalid url, %v", err), "ex) rtsp://localhost:554/stream")
+	} else if u.Scheme != "rtsp" && u.Scheme != "rtsps" {
+		errs.add("url", fmt.Sprintf("unsupported scheme %q", u.Scheme), "use rtsp:// or rtsps://")
+	}
+	if unknown := unknownPlaceholders(cfg.url); len(unknown) != 0 {
+		errs.add("url", "unknown placeholder "+strings.Join(unknown, ", "), "use {NUM}, {SEQ}, {RAND}, {UUID}, {TIME} or {CSV:column}")
+	}
+	switch columns := urlColumns(cfg.url); {
+	case len(columns) != 0 && cfg.urlValues == "":
+		errs.add("url", "{CSV:column} needs -url-values", "ex) -url-values tokens.csv")
+	case len(columns) == 0 && cfg.urlValues != "":
+		errs.add("url-values", "has no effect without {CSV:column} in -url", "ex) -url rtsp://host/{NUM}.stream?token={CSV:token}")
+	}
+	if cfg.transport != "UDP" && cfg.transport != "TCP" {
+		if up := strings.ToUpper(cfg.transport); up == "UDP" || up == "TCP" {
+			errs.add("transport", fmt.Sprintf("invalid transport %q", cfg.transport), "use -transport "+up)
+		} else {
+			errs.add("transport", fmt.Sprintf("invalid transport %q", cfg.transport), "should be UDP or TCP")
+		}
+	}
+	if strings.Contains(cfg.url, "{NUM}") {
+		if cfg.nStart > cfg.nEnd {
+			errs.add("start", fmt.Sprintf("start %d is greater than end %d", cfg.nStart, cfg.nEnd),
+				fmt.Sprintf("use -start %d -end %d", cfg.nEnd, cfg.nStart))
+		}
+	} else if cfg.count < 1 {
+		errs.add("count", "should be at least 1", "")
+	}
+	if cfg.readTimeout <= 0 {
+		errs.add("read-timeout", "should be positive", "")
+	}
+	if cfg.writeTimeout <= 0 {
+		errs.add("write-timeout", "should be positive", "")
+	}
+	if cfg.startInterval < 0 {
+		errs.add("start-interval", "should not be negative", "")
+	}
+	switch cfg.startJitter {
+	case jitterNone, jitterUniform, jitterExponential:
+		if cfg.startJitter != jitterNone && cfg.startInterval == 0 {
+			errs.add("start-jitter", "has no effect with -start-interval 0", "ex) -start-interval 100ms")
+		}
+	default:
+		errs.add("start-jitter", fmt.Sprintf("invalid distribution %q", cfg.startJitter), "should be none, uniform or exponential")
+	}
+	switch {
+	case cfg.readRate < 0:
+		errs.add("read-rate", "should not be negative", "")
+	case cfg.readRate > 0 && cfg.transport != "TCP":
+		errs.add("read-rate", "needs -transport TCP, the packets over UDP are not read from the RTSP connection", "use -transport TCP")
+	}
+	for _, f := range []struct {
+		flag string
+		v    float64
+	}{
+		{"inject-drop", cfg.injectDrop},
+		{"inject-reorder", cfg.injectReorder},
+		{"inject-delay", cfg.injectDelay},
+	} {
+		if f.v < 0 || f.v > 100 {
+			errs.add(f.flag, fmt.Sprintf("%v is not a percentage", f.v), "should be between 0 and 100")
+		}
+	}
+	if sum := cfg.injectDrop + cfg.injectReorder + cfg.injectDelay; sum > 100 {
+		errs.add("inject-drop", fmt.Sprintf("-inject-drop, -inject-reorder and -inject-delay sum to %v%%", sum), "should be at most 100")
+	}
+	if cfg.injectDelay > 0 && cfg.injectDelayBy <= 0 {
+		errs.add("inject-delay-by", "should be positive", "")
+	}
+	if cfg.nack && cfg.nackTimeout <= 0 {
+		errs.add("nack-timeout", "should be positive", "")
+	}
+	if cfg.srtp && cfg.transport != "TCP" {
+		errs.add("srtp", "needs -transport TCP, the client (gortsplib) takes only its own UDP sockets, the packets can not be decrypted before it reads them",
+			"use -transport TCP")
+	}
+	if cfg.mikeyPSK != "" {
+		if !cfg.srtp {
+			errs.add("mikey-psk", "has no effect without -srtp", "")
+		} else if psk, err := base64.StdEncoding.DecodeString(cfg.mikeyPSK); err != nil || len(psk) == 0 {
+			errs.add("mikey-psk", "invalid base64 key", "ex) -mikey-psk $(openssl rand -base64 16)")
+		}
+	}
+	if cfg.srtpKey != "" {
+		switch {
+		case !cfg.srtp:
+			errs.add("srtp-key", "has no effect without -srtp", "")
+		default:
+			if _, err := parseSRTPKey(cfg.srtpSuite, cfg.srtpKey); err != nil {
+				errs.add("srtp-key", err.Error(), "base64 of the 16-byte master key followed by the 14-byte master salt")
+			}
+		}
+	}
+	if cfg.statsInterval < 0 {
+		errs.add("stats-interval", "should not be negative", "")
+	}
+	switch {
+	case cfg.soakInterval < 0:
+		errs.add("soak-interval", "should not be negative", "")
+	case cfg.soakInterval == 0 && (cfg.serverSessionsParam != "" || cfg.serverSessionsHeader != ""):
+		errs.add("soak-interval", "is needed by -server-sessions-param and -server-sessions-header", "ex) -soak-interval 5m")
+	case cfg.serverSessionsParam != "" && cfg.serverSessionsHeader != "":
+		errs.add("server-sessions-param", "can not be used with -server-sessions-header", "")
+	}
+	switch {
+	case cfg.describeRate < 0:
+		errs.add("describe-rate", "should not be negative", "")
+	case cfg.describeRate > 0 && cfg.publish != "":
+		errs.add("describe-rate", "can not be used with -publish", "")
+	case cfg.describeRate > 0 && cfg.describeDuration <= 0:
+		errs.add("describe-duration", "should be positive", "")
+	case cfg.describeRate > 0 && cfg.describeConcurrency < 1:
+		errs.add("describe-concurrency", "should be at least 1", "")
+	}
+	if cfg.probe && (cfg.monitor || cfg.describeRate > 0 || cfg.publish != "") {
+		errs.add("probe", "can not be used with -mode monitor, -describe-rate and -publish", "")
+	}
+	if len(cfg.expectParameters) != 0 && cfg.getParameter == "" {
+		errs.add("expect-parameter", "needs -get-parameter", "ex) -get-parameter position -expect-parameter position=^[0-9.]+$")
+	}
+	if cfg.zapInterval > 0 {
+		switch {
+		case len(cfg.urls()) < 2:
+			errs.add("zap-interval", "needs a lineup of urls", "ex) -url rtsp://host/ch{NUM} -start 1 -end 100 -zap-interval 10s")
+		case cfg.zapJitter < 0 || cfg.zapJitter >= cfg.zapInterval:
+			errs.add("zap-jitter", "should be between 0 and -zap-interval", "")
+		case cfg.zaps < 1:
+			errs.add("zaps", "should be positive", "")
+		case cfg.monitor || cfg.describeRate > 0 || cfg.probe || cfg.publish != "":
+			errs.add("zap-interval", "can not be used with -mode monitor, -describe-rate, -probe and -publish", "")
+		}
+	} else if cfg.zapInterval < 0 {
+		errs.add("zap-interval", "should not be negative", "")
+	}
+	if types, err := cfg.mediaTypes(); err != nil {
+		errs.add("media", err.Error(), "use all, video, audio or application, comma separated")
+	} else if types != nil && cfg.audioLang != "" && !strings.Contains(strings.ToLower(cfg.media), "audio") {
+		errs.add("audio-lang", "has no effect without audio in -media", "")
+	} else if cfg.media != mediaAll && (cfg.publish != "" || cfg.describeRate > 0 || cfg.probe) {
+		errs.add("media", "has no effect with -publish, -describe-rate and -probe, the sessions do not play", "")
+	}
+	if cfg.playoutBuffer < 0 {
+		errs.add("playout-buffer", "should not be negative", "")
+	}
+	if cfg.backchannel && (cfg.publish != "" || cfg.describeRate > 0 || cfg.probe || cfg.loopback) {
+		errs.add("backchannel", "has no effect with -publish, -describe-rate, -probe and -loopback, the sessions do not play", "")
+	}
+	if cfg.parameterRequests() && cfg.parameterInterval <= 0 {
+		errs.add("parameter-interval", "should be positive", "")
+	}
+	if cfg.parameterRequests() && (cfg.publish != "" || cfg.describeRate > 0 || cfg.probe) {
+		errs.add("get-parameter", "has no effect with -publish, -describe-rate and -probe, the sessions do not play", "")
+	}
+	switch cfg.resolveMode {
+	case resolveSystem, resolveOnce, resolveSession, resolveRoundRobin:
+	default:
+		errs.add("resolve-mode", fmt.Sprintf("invalid mode %q", cfg.resolveMode), "should be system, once, session or round-robin")
+	}
+	if cfg.proxy != "" {
+		if _, err := parseProxy(cfg.proxy); err != nil {
+			errs.add("proxy", err.Error(), "ex) -proxy socks5://jump:1080 or -proxy http://jump:3128")
+		} else if cfg.transport != "TCP" && cfg.describeRate == 0 {
+			errs.add("proxy", "needs -transport TCP, the packets over UDP do not go through the proxy", "use -transport TCP")
+		}
+	}
+	if cfg.forceIPv4 && cfg.forceIPv6 {
+		errs.add("force-ipv4", "can not be used with -force-ipv6", "")
+	}
+	if cfg.localIP != "" {
+		if ips, err := parseLocalIPs(cfg.localIP); err != nil {
+			errs.add("local-ip", err.Error(), "ex) -local-ip 10.0.1.10,10.0.1.11 or -local-ip 10.0.1.0/26")
+		} else if f := cfg.ipFamily(); f != "" && otherFamily(ips, f) != nil {
+			errs.add("local-ip", fmt.Sprintf("%s is not an IPv%s address", otherFamily(ips, f), f), "remove -force-ipv"+f+" or the address")
+		} else if missing, err := missingLocalIPs(ips); err == nil && len(missing) != 0 {
+			errs.add("local-ip", fmt.Sprintf("%d addresses are not on the host, first %s", len(missing), missing[0]),
+				fmt.Sprintf("add them to an interface, ex) ip addr add %s/24 dev eth0", missing[0]))
+		}
+	}
+	if cfg.udpPorts != "" {
+		if _, err := parsePortRange(cfg.udpPorts); err != nil {
+			errs.add("udp-ports", err.Error(), "ex) -udp-ports 40000-41000")
+		} else if cfg.transport == "TCP" {
+			errs.add("udp-ports", "has no effect with -transport TCP", "")
+		}
+	}
+	if cfg.udpRcvbuf > 0 && cfg.transport == "TCP" {
+		errs.add("udp-rcvbuf", "has no effect with -transport TCP", "")
+	}
+	if cfg.iface != "" {
+		if _, err := net.InterfaceByName(cfg.iface); err != nil {
+			errs.add("interface", err.Error(), "see the interfaces with ip link")
+		}
+	}
+	if cfg.shuffle && !strings.Contains(cfg.url, "{NUM}") {
+		errs.add("shuffle", "has no effect without {NUM} in -url", "")
+	}
+
+	// thresholds, the same rules as thresholds.validate with the flag names
+	if cfg.delayTimeout <= 0 {
+		errs.add("delay-timeout", "should be positive", "")
+	}
+	if cfg.lossThreshold < 1 {
+		errs.add("loss-threshold", "should be at least 1", "")
+	}
+	if cfg.maxGOP < 0 {
+		errs.add("max-gop", "should not be negative", "")
+	}
+	if cfg.maxSilence < 0 {
+		errs.add("max-silence", "should not be negative", "")
+	}
+	if cfg.maxCaptionGap < 0 {
+		errs.add("max-caption-gap", "should not be negative", "")
+	}
+	if cfg.freezeTimeout < 0 {
+		errs.add("freeze-timeout", "should not be negative", "")
+	}
+	if cfg.minBitrate < 0 {
+		errs.add("min-bitrate", "should not be negative", "")
+	}
+	if cfg.maxBitrate < 0 {
+		errs.add("max-bitrate", "should not be negative", "")
+	}
+	if cfg.maxBitrate > 0 && cfg.minBitrate > cfg.maxBitrate {
+		errs.add("min-bitrate", fmt.Sprintf("%v is greater than -max-bitrate %v", cfg.minBitrate, cfg.maxBitrate),
+			"swap them or raise -max-bitrate")
+	}
+
+	if cfg.maxAVSkew < 0 {
+		errs.add("max-av-skew", "should not be negative", "")
+	}
+	if cfg.maxRTCPInterval < 0 {
+		errs.add("max-rtcp-interval", "should not be negative", "")
+	}
+	if cfg.rrInterval < 0 {
+		errs.add("rr-interval", "should not be negative", "")
+	}
+	if cfg.rrFractionLost < 0 || cfg.rrFractionLost > 1 {
+		errs.add("rr-fraction-lost", "should be between 0 and 1", "ex) 0.05 for 5%")
+	}
+	if cfg.rrJitter < 0 {
+		errs.add("rr-jitter", "should not be negative", "")
+	}
+	if cfg.rrInterval == 0 && (cfg.rrFractionLost != 0 || cfg.rrJitter != 0) {
+		errs.add("rr-interval", "-rr-fraction-lost and -rr-jitter only apply to the receiver reports of -rr-interval",
+			"set -rr-interval, ex) -rr-interval 1s")
+	}
+	if cfg.firstPacketTimeout < 0 {
+		errs.add("first-packet-timeout", "should not be negative", "")
+	}
+
+	if cfg.tsDir == "-" && cfg.sessionCount() != 1 {
+		errs.add("ts-dir", fmt.Sprintf("- (stdout) needs a single session, not %d", cfg.sessionCount()),
+			"use -count 1 or a directory")
+	}
+	if cfg.execSessionID != "" && cfg.exec == "" {
+		errs.add("exec-session", "has no effect without -exec", "set -exec, ex) -exec \"ffplay -\"")
+	}
+
+	if cfg.report != "" && cfg.report == cfg.csvOut {
+		errs.add("csv-out", "is the same file as -report", "use another file")
+	}
+	if cfg.sessionSetupDeadline < 0 {
+		errs.add("session-setup-deadline", "should not be negative", "use 0 to disable")
+	}
+	if cfg.reportCheckpoint < 0 {
+		errs.add("report-checkpoint", "should not be negative", "use 0 to disable")
+	}
+	if cfg.csvOut != "" && cfg.csvInterval <= 0 {
+		errs.add("csv-interval", "should be positive", "")
+	}
+	if cfg.influxURL == "" && (cfg.influxToken != "" || len(cfg.influxTags) != 0) {
+		errs.add("influx-url", "-influx-token and -influx-tag have no effect without it", "")
+	}
+	if cfg.influxURL != "" {
+		if u, err := url.Parse(cfg.influxURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs.add("influx-url", "should be a http(s) url", "ex) http://localhost:8086/write?db=rtsp")
+		}
+		if cfg.influxInterval <= 0 {
+			errs.add("influx-interval", "should be positive", "")
+		}
+	}
+	if cfg.statsdAddr == "" && len(cfg.statsdTags) != 0 {
+		errs.add("statsd-addr", "-statsd-tag has no effect without it", "")
+	}
+	if cfg.statsdAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.statsdAddr); err != nil {
+			errs.add("statsd-addr", fmt.Sprintf("invalid address, %v", err), "ex) localhost:8125")
+		}
+		if cfg.statsdInterval <= 0 {
+			errs.add("statsd-interval", "should be positive", "")
+		}
+	}
+	if cfg.warmup < 0 {
+		errs.add("warmup", "should not be negative", "")
+	}
+	if cfg.compare() && cfg.stateFile != "" {
+		errs.add("state-file", "is not supported with several -url", "")
+	}
+	switch {
+	case cfg.resume && cfg.stateFile == "":
+		errs.add("resume", "needs -state-file", "ex) -state-file run.state -resume")
+	case cfg.stateFile != "" && (cfg.monitor || cfg.describeRate > 0):
+		errs.add("state-file", "has no effect with -mode monitor and -describe-rate", "")
+	}
+	if cfg.describeCache && (cfg.monitor || cfg.describeRate > 0 || cfg.publish != "") {
+		errs.add("describe-cache", "has no effect with -mode monitor, -describe-rate and -publish", "")
+	}
+	if strings.ContainsAny(cfg.testID, ",|#\r\n") {
+		errs.add("test-id", fmt.Sprintf("invalid test id %q", cfg.testID), "use letters, digits, - or _")
+	}
+	if cfg.labelHeader != "" {
+		var h requestHeaders
+		if len(cfg.runLabels()) == 0 {
+			errs.add("label-header", "has no effect without -test-id or -label", "ex) -test-id soak1 -label-header X-Test-Labels")
+		} else if err := h.add(base.Describe, cfg.labelHeader, cfg.runLabels().String()); err != nil {
+			errs.add("label-header", err.Error(), "ex) X-Test-Labels")
+		}
+	}
+
+	if cfg.shards < 0 {
+		errs.add("shards", "should not be negative", "use 0 to disable")
+	}
+	if cfg.pinThreads && cfg.shards == 0 {
+		errs.add("pin-threads", "has no effect without -shards", "ex) -shards 4 -pin-threads")
+	}
+
+	switch {
+	case cfg.manifestRecord && cfg.manifest == "":
+		errs.add("manifest-record", "needs -manifest, the file to write", "ex) -manifest-record -manifest assets.json")
+	case cfg.manifest != "" && !cfg.manifestRecord:
+		if _, err := os.Stat(cfg.manifest); err != nil {
+			errs.add("manifest", err.Error(), "write it with -manifest-record from a reference server")
+		}
+	}
+	if cfg.maxSubtitleGap < 0 {
+		errs.add("max-subtitle-gap", "should not be negative", "")
+	}
+	if cfg.audioLang != "" {
+		for _, lang := range strings.Split(cfg.audioLang, ",") {
+			if strings.TrimSpace(lang) == "" {
+				errs.add("audio-lang", fmt.Sprintf("empty language in %q", cfg.audioLang), "ex) -audio-lang ko,en")
+				break
+			}
+		}
+	}
+	if cfg.kernelTimestamps && cfg.transport == "TCP" {
+		errs.add("kernel-timestamps", "needs -transport UDP, the packets of TCP are not timestamped one by one", "use -transport UDP")
+	}
+
+	if cfg.publish != "" {
+		if cfg.publish != publishTestPattern {
+			if _, err := os.Stat(cfg.publish); err != nil {
+				errs.add("publish", err.Error(), "use a .mp4 or .ts file, or testpattern")
+			}
+		}
+		// the flags of the received stream, received by the players of -loopback
+		for _, f := range []struct {
+			flag string
+			set  bool
+		}{
+			{"ts-dir", cfg.tsDir != ""},
+			{"exec", cfg.exec != ""},
+			{"pcap-dir", cfg.pcapDir != ""},
+			{"first-packet-timeout", cfg.firstPacketTimeout > 0},
+			{"rr-interval", cfg.rrInterval > 0},
+			{"kernel-timestamps", cfg.kernelTimestamps},
+			{"udp-rcvbuf", cfg.udpRcvbuf > 0},
+			{"audio-lang", cfg.audioLang != ""},
+			{"subtitle-dir", cfg.subtitleDir != ""},
+			{"max-subtitle-gap", cfg.maxSubtitleGap > 0},
+			{"expect-subtitles", cfg.expectSubtitles},
+			{"manifest", cfg.manifest != ""},
+			{"inject-drop", cfg.injectDrop > 0},
+			{"inject-reorder", cfg.injectReorder > 0},
+			{"inject-delay", cfg.injectDelay > 0},
+			{"nack", cfg.nack},
+			{"srtp", cfg.srtp},
+		} {
+			if f.set && !cfg.loopback {
+				errs.add(f.flag, "has no effect with -publish, the sessions do not receive", "")
+			}
+		}
+	}
+
+	switch cfg.keepalive {
+	case keepaliveAuto, keepaliveOptions, keepaliveGetParameter, keepaliveNone:
+	default:
+		errs.add("keepalive", fmt.Sprintf("invalid method %q", cfg.keepalive), "should be auto, OPTIONS, GET_PARAMETER or none")
+	}
+	switch {
+	case cfg.keepaliveInterval < 0:
+		errs.add("keepalive-interval", "should not be negative", "")
+	case cfg.keepaliveInterval > 0 && cfg.keepalive == keepaliveNone:
+		errs.add("keepalive-interval", "has no effect with -keepalive none", "")
+	}
+	if cfg.keepaliveDivisor < 1 {
+		errs.add("keepalive-divisor", "should be at least 1, the keepalives would come after the session timeout", "ex) -keepalive-divisor 3")
+	}
+	if cfg.publish != "" && !cfg.loopback && (cfg.keepalive != keepaliveAuto || cfg.keepaliveInterval > 0) {
+		errs.add("keepalive", "has no effect with -publish, the client sends no keepalive while recording", "")
+	}
+
+	if cfg.preflight && cfg.preflightTimeout <= 0 {
+		errs.add("preflight-timeout", "should be positive", "")
+	}
+
+	if err := validLanguage(cfg.lang); err != nil {
+		errs.add("lang", err.Error(), "")
+	}
+	if cfg.precision < 0 || cfg.precision > 6 {
+		errs.add("precision", "should be between 0 and 6", "")
+	}
+
+	if cfg.maxSessions < 0 {
+		errs.add("max-sessions", "should not be negative", "use 0 for unlimited")
+	}
+	if cfg.maxConcurrentSetups < 0 {
+		errs.add("max-concurrent-setups", "should not be negative", "use 0 for unlimited")
+	}
+	if cfg.maxRedirects < 0 {
+		errs.add("max-redirects", "should not be negative", "use 0 to fail the redirected sessions")
+	}
+	switch {
+	case cfg.retryAttempts < 0:
+		errs.add("retry-attempts", "should not be negative", "use 0 to disable")
+	case cfg.retryAttempts > 0 && (cfg.monitor || cfg.describeRate > 0):
+		errs.add("retry-attempts", "has no effect with -mode monitor and -describe-rate", "-monitor-retry restarts the sessions of -mode monitor")
+	case cfg.retryBackoff < 0:
+		errs.add("retry-backoff", "should not be negative", "")
+	case cfg.retryMaxBackoff < cfg.retryBackoff:
+		errs.add("retry-max-backoff", "should not be less than -retry-backoff", "")
+	case cfg.retryRate < 0:
+		errs.add("retry-rate", "should not be negative", "use 0 for unlimited")
+	}
+	if cfg.requestRate < 0 {
+		errs.add("request-rate", "should not be negative", "use 0 for unlimited")
+	}
+	if cfg.requestRate > 0 && cfg.requestBurst < 1 {
+		errs.add("request-burst", "should be at least 1", "")
+	}
+	if cfg.maxErrorRate > 1 {
+		errs.add("max-error-rate", "should be between 0 and 1", "ex) -max-error-rate 0.01")
+	}
+	if cfg.maxP95SetupMs < 0 {
+		errs.add("max-p95-setup-ms", "should not be negative", "")
+	}
+	if cfg.breakerErrorRate < 0 || cfg.breakerErrorRate > 1 {
+		errs.add("breaker-error-rate", "should be between 0 and 1", "ex) 0.5 for 50%")
+	}
+	if cfg.breakerWindow < breakerMinResults {
+		errs.add("breaker-window", fmt.Sprintf("should be at least %d", breakerMinResults), "")
+	}
+	if cfg.breakerErrorRate > 0 && cfg.breakerCooldown <= 0 {
+		errs.add("breaker-cooldown", "should be positive", "ex) 30s")
+	}
+	return errs
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// build info, injected at build time, see build.sh
+// (ex) go build -ldflags "-X main.version=1.2.0 -X main.commit=abc1234 -X main.date=2024-05-02T00:00:00Z"
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// features are the subsystems compiled in, registered by registerFeature.
+// The optional ones are left out of a build by their tag, see optionalFeatures,
+// the others are always built in and tell the versions apart.
+var features []string
+
+// registerFeature registers a subsystem, called from the init of its file.
+func registerFeature(name string) {
+	features = append(features, name)
+}
+
+// optionalFeatures are the build tags leaving out the optional subsystems, and their features.
+// (ex) go build -tags nogrpc,nopcap
+var optionalFeatures = map[string][]string{
+	"nogrpc": {"grpc-api"},
+	"nopcap": {"pcap"},
+	"nosrtp": {"srtp", "mikey"},
+}
+
+// builtIn tells if a feature is compiled in, and the tag that left it out if not.
+func builtIn(name string) (bool, string) {
+	for _, f := range features {
+		if f == name {
+			return true, ""
+		}
+	}
+	for tag, l := range optionalFeatures {
+		for _, f := range l {
+			if f == name {
+				return false, tag
+			}
+		}
+	}
+	return false, ""
+}
+
+// codecs are the handlers of each codec of this version, registered by registerCodec.
+var codecs = make(map[string][]string)
+
+// registerCodec registers the handler of a codec, by the gortsplib codec name or the encoding name,
+// called from the init of the file of the handler.
+func registerCodec(handler string, names ...string) {
+	for _, name := range names {
+		codecs[name] = append(codecs[name], handler)
+	}
+}
+
+type buildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	Date      string   `json:"date"`
+	GoVersion string   `json:"goVersion"`
+	Platform  string   `json:"platform"`
+	Features  []string `json:"features"`
+}
+
+// getBuildInfo returns the injected build info,
+// the commit and date fall back to the vcs info of the go build.
+func getBuildInfo() buildInfo {
+	bi := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Features:  append([]string(nil), features...),
+	}
+	sort.Strings(bi.Features)
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && bi.Commit == "":
+				bi.Commit = s.Value
+			case s.Key == "vcs.time" && bi.Date == "":
+				bi.Date = s.Value
+			case s.Key == "vcs.modified" && s.Value == "true" && commit == "":
+				bi.Commit += "-dirty"
+			}
+		}
+	}
+	return bi
+}
+
+func (bi buildInfo) String() string {
+	s := "rtspclient version " + bi.Version
+	if bi.Commit != "" {
+		s += " (" + bi.Commit + ")"
+	}
+	if bi.Date != "" {
+		s += " built " + bi.Date
+	}
+	s += "\n" + bi.GoVersion + " " + bi.Platform
+	s += "\nfeatures: " + strings.Join(bi.Features, ", ")
+	return s
+}
+
+// runVersion is the version subcommand, "version [--json]".
+func runVersion(args []string) error {
+	bi := getBuildInfo()
+	for _, a := range args {
+		switch a {
+		case "-json", "--json":
+			b, err := json.MarshalIndent(bi, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+			return nil
+		default:
+			return fmt.Errorf("unknown version argument %q", a)
+		}
+	}
+	fmt.Println(bi)
+	return nil
+}
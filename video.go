@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	registerFeature("video-analysis")
+	registerCodec("video-analysis", "H264", "H265")
+}
+
+type auDecoder interface {
+	Decode(pkt *rtp.Packet) ([][]byte, error)
+}
+
+// bitstreamStats are the counts of the H264/H265 sanity checks.
+// malformed counts the access units with any problem.
+type bitstreamStats struct {
+	AccessUnits    uint64 `json:"accessUnits"`
+	Malformed      uint64 `json:"malformed"`
+	CorruptedNALUs uint64 `json:"corruptedNalus"`
+	MissingParams  uint64 `json:"missingParams"`
+	Incomplete     uint64 `json:"incomplete"`
+	DecodeErrors   uint64 `json:"decodeErrors"`
+}
+
+// videoTrack depacketizes the H264/H265 RTP packets of a format
+// and analyzes the access units.
+type videoTrack struct {
+	s     *session
+	name  string
+	codec string
+	h265  bool
+	dec   auDecoder
+
+	hasVPS bool
+	hasSPS bool
+	hasPPS bool
+
+	// an access unit is being received
+	pending   bool
+	pendingTS uint32
+	// a decodable keyframe was received, of -first-idr
+	keyframed bool
+
+	mu    sync.Mutex
+	stats bitstreamStats
+	gop   *gopMeter
+	// freezes of -freeze-timeout
+	freeze freezeMeter
+	// captions of -check-captions
+	captions captionMeter
+
+	// nil if the content of the track is not verified by -manifest
+	content *integrityChecker
+}
+
+// newVideoTrack returns nil if the format is not H264/H265.
+func newVideoTrack(s *session, forma format.Format) (*videoTrack, error) {
+	switch f := forma.(type) {
+	case *format.H264:
+		dec, err := newDepacketizer(f)
+		if err != nil {
+			return nil, err
+		}
+		sps, pps := f.SafeParams()
+		return &videoTrack{
+			s:      s,
+			codec:  f.Codec(),
+			dec:    dec,
+			hasSPS: sps != nil,
+			hasPPS: pps != nil,
+			gop:    newGOPMeter(f.ClockRate()),
+		}, nil
+
+	case *format.H265:
+		dec, err := newDepacketizer(f)
+		if err != nil {
+			return nil, err
+		}
+		vps, sps, pps := f.SafeParams()
+		return &videoTrack{
+			s:      s,
+			codec:  f.Codec(),
+			h265:   true,
+			dec:    dec,
+			hasVPS: vps != nil,
+			hasSPS: sps != nil,
+			hasPPS: pps != nil,
+			gop:    newGOPMeter(f.ClockRate()),
+		}, nil
+	}
+	return nil, nil
+}
+
+func (vt *videoTrack) malformed(counter *uint64, format string, v ...interface{}) {
+	vt.mu.Lock()
+	*counter++
+	vt.stats.Malformed++
+	vt.mu.Unlock()
+	if vt.s.cfg.checkBitstream {
+		vt.s.logf("malformed %s access unit, "+format, append([]interface{}{vt.codec}, v...)...)
+	}
+}
+
+func (vt *videoTrack) onPacketRTP(now time.Time, pkt *rtp.Packet) {
+	if vt.pending && pkt.Timestamp != vt.pendingTS {
+		// the marker of the previous access unit has been lost
+		vt.malformed(&vt.stats.Incomplete, "frame never completed, timestamp %d", vt.pendingTS)
+	}
+
+	au, err := vt.dec.Decode(pkt)
+	if err != nil {
+		switch {
+		case errors.Is(err, errMorePacketsNeeded):
+			vt.pending = true
+			vt.pendingTS = pkt.Timestamp
+		case errors.Is(err, errNonStartingPacket):
+			// normal when the stream is joined in the middle of a frame
+		case errors.Is(err, errNonStartingFragment):
+			vt.pending = false
+			vt.malformed(&vt.stats.Incomplete, "frame never completed, %v", err)
+		default:
+			vt.pending = false
+			vt.malformed(&vt.stats.DecodeErrors, "%v", err)
+		}
+		return
+	}
+	vt.pending = false
+
+	vt.mu.Lock()
+	vt.stats.AccessUnits++
+	vt.mu.Unlock()
+
+	keyframe, ok := vt.checkAccessUnit(au)
+	if vt.content != nil {
+		vt.content.writeAU(au, keyframe, vt.h265)
+	}
+	if !ok {
+		return
+	}
+
+	if keyframe && !vt.keyframed && vt.decodable() && vt.s.cfg.measureFirstKeyframe() {
+		vt.keyframed = true
+		vt.s.onDecodableKeyframe(now, vt.name)
+	}
+
+	if vt.s.cfg.captions() {
+		vt.mu.Lock()
+		gap, first := vt.captions.onAccessUnit(now, au, vt.h265)
+		vt.mu.Unlock()
+		if first {
+			vt.s.logf("%s captions detected", vt.codec)
+		}
+		if max := vt.s.cfg.maxCaptionGap; max > 0 && gap > max {
+			vt.s.loseCaptions(gap)
+		}
+	}
+
+	if timeout := vt.s.cfg.freezeTimeout; timeout > 0 {
+		vt.mu.Lock()
+		d, frozen := vt.freeze.onFrame(now, timeout)
+		vt.mu.Unlock()
+		if frozen {
+			vt.s.logf("%s freeze of %v, no complete frame", vt.codec, d)
+		}
+	}
+
+	vt.mu.Lock()
+	interval, closed := vt.gop.onAccessUnit(pkt.Timestamp, keyframe)
+	maxGOP := time.Duration(vt.s.run.getThresholds().MaxGOP)
+	alarm := closed && maxGOP > 0 && interval > maxGOP
+	if alarm {
+		vt.gop.stats.Alarms++
+	}
+	vt.mu.Unlock()
+	if alarm {
+		vt.s.logf("%s keyframe interval %v exceeds max-gop %v", vt.codec, interval, maxGOP)
+	}
+}
+
+// checkAccessUnit validates NALU headers and the presence of parameter sets.
+// It returns whether the access unit is a keyframe, and false if its NALUs are corrupted.
+func (vt *videoTrack) checkAccessUnit(au [][]byte) (bool, bool) {
+	random := false
+	for _, nalu := range au {
+		if vt.h265 {
+			if len(nalu) < 2 || nalu[0]&0x80 != 0 || nalu[1]&0x07 == 0 {
+				vt.malformed(&vt.stats.CorruptedNALUs, "corrupted NALU header")
+				return false, false
+			}
+			switch typ := h265.NALUType((nalu[0] >> 1) & 0x3F); {
+			case typ >= h265.NALUType_AggregationUnit:
+				vt.malformed(&vt.stats.CorruptedNALUs, "invalid NALU type %d", typ)
+				return false, false
+			case typ == h265.NALUType_VPS_NUT:
+				vt.hasVPS = true
+			case typ == h265.NALUType_SPS_NUT:
+				vt.hasSPS = true
+			case typ == h265.NALUType_PPS_NUT:
+				vt.hasPPS = true
+			case typ >= h265.NALUType_BLA_W_LP && typ <= h265.NALUType_CRA_NUT:
+				random = true
+			}
+			continue
+		}
+
+		if len(nalu) < 1 || nalu[0]&0x80 != 0 {
+			vt.malformed(&vt.stats.CorruptedNALUs, "corrupted NALU header")
+			return false, false
+		}
+		switch typ := h264.NALUType(nalu[0] & 0x1F); {
+		case typ == 0 || typ >= h264.NALUTypeSTAPA:
+			vt.malformed(&vt.stats.CorruptedNALUs, "invalid NALU type %d", typ)
+			return false, false
+		case typ == h264.NALUTypeSPS:
+			vt.hasSPS = true
+		case typ == h264.NALUTypePPS:
+			vt.hasPPS = true
+		case typ == h264.NALUTypeIDR:
+			random = true
+		}
+	}
+
+	if random && !vt.decodable() {
+		vt.malformed(&vt.stats.MissingParams, "random access without parameter sets")
+	}
+	return random, true
+}
+
+// decodable tells if the parameter sets needed to decode a keyframe were received.
+func (vt *videoTrack) decodable() bool {
+	return vt.hasSPS && vt.hasPPS && (!vt.h265 || vt.hasVPS)
+}
+
+func (vt *videoTrack) gopStats() gopStats {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	return vt.gop.snapshot()
+}
+
+// endFreeze ends the freeze going on at the end of the session.
+func (vt *videoTrack) endFreeze(now time.Time) {
+	vt.mu.Lock()
+	d, frozen := vt.freeze.end(now, vt.s.cfg.freezeTimeout)
+	vt.mu.Unlock()
+	if frozen {
+		vt.s.logf("%s freeze of %v at the end of the session, no complete frame", vt.codec, d)
+	}
+}
+
+func (vt *videoTrack) captionStats() captionStats {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	return vt.captions.stats
+}
+
+func (vt *videoTrack) freezeStats() freezeStats {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	return vt.freeze.stats
+}
+
+func (vt *videoTrack) bitstreamStats() bitstreamStats {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+	return vt.stats
+}
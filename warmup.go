@@ -0,0 +1,36 @@
+package main
+
+import (
+	"time"
+)
+
+func init() {
+	registerFeature("warmup")
+}
+
+// startWarmup starts the warm-up of -warmup, the metrics until its end are excluded from the final results:
+// the latencies, the sessions ended, the bitrate and resource samples of the report and the GC pauses.
+// The returned func stops it.
+func (r *run) startWarmup() func() {
+	r.warmupEnd = time.Now().Add(r.cfg.warmup)
+	r.latency.excludeUntil(r.warmupEnd)
+	t := time.AfterFunc(r.cfg.warmup, func() {
+		r.gcMu.Lock()
+		r.gcStart = takeGCSnapshot()
+		r.gcMu.Unlock()
+		r.logger.Printf("warm-up of %v ended, measuring from now", r.cfg.warmup)
+	})
+	return func() { t.Stop() }
+}
+
+// warmingUp returns whether t is in the warm-up of -warmup.
+func (r *run) warmingUp(t time.Time) bool {
+	return t.Before(r.warmupEnd)
+}
+
+// gcSince returns the GC pauses since the start of the run, or the end of its warm-up.
+func (r *run) gcSince() gcPauses {
+	r.gcMu.Lock()
+	defer r.gcMu.Unlock()
+	return r.gcStart.since()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerFeature("watchdog")
+}
+
+// watchdog detects stalls of the tool itself (scheduling delays, blocked outputs),
+// so that they can be told apart from server problems.
+// Stalls are logged with the [watchdog] prefix.
+type watchdog struct {
+	threshold time.Duration
+
+	mu     sync.Mutex
+	ops    map[*watchedOp]struct{}
+	stalls uint64
+	maxLag time.Duration
+}
+
+// watchedOp is a possibly blocking operation, like an output write.
+type watchedOp struct {
+	name     string
+	start    time.Time
+	reported bool
+}
+
+type watchdogStats struct {
+	Threshold duration `json:"threshold"`
+	Stalls    uint64   `json:"stalls"`
+	MaxLag    duration `json:"maxLag"`
+}
+
+// wd is nil if the watchdog is disabled.
+var wd *watchdog
+
+func newWatchdog(threshold time.Duration) *watchdog {
+	return &watchdog{
+		threshold: threshold,
+		ops:       make(map[*watchedOp]struct{}),
+	}
+}
+
+// stallLog writes to stderr directly, not through the watched log output,
+// and is used from its own goroutine, so that a stalled output can't block the watchdog.
+var stallLog = log.New(timestampWriter{w: os.Stderr}, "", 0)
+
+func (w *watchdog) report(format string, v ...interface{}) {
+	w.mu.Lock()
+	w.stalls++
+	w.mu.Unlock()
+	go stallLog.Printf("[watchdog] tool stall, "+format, v...)
+}
+
+func (w *watchdog) begin(name string) *watchedOp {
+	if w == nil {
+		return nil
+	}
+	op := &watchedOp{name: name, start: time.Now()}
+	w.mu.Lock()
+	w.ops[op] = struct{}{}
+	w.mu.Unlock()
+	return op
+}
+
+func (w *watchdog) end(op *watchedOp) {
+	if w == nil {
+		return
+	}
+	d := time.Since(op.start)
+	w.mu.Lock()
+	delete(w.ops, op)
+	reported := op.reported
+	w.mu.Unlock()
+	if d > w.threshold && !reported {
+		w.report("%s took %v", op.name, d)
+	}
+}
+
+func (w *watchdog) run() {
+	interval := w.threshold / 2
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	expected := time.Now().Add(interval)
+	for {
+		time.Sleep(time.Until(expected))
+		now := time.Now()
+
+		lag := now.Sub(expected)
+		if lag > w.threshold {
+			w.report("event loop delayed %v", lag)
+		}
+
+		w.mu.Lock()
+		if lag > w.maxLag {
+			w.maxLag = lag
+		}
+		var blocked []*watchedOp
+		for op := range w.ops {
+			if !op.reported && now.Sub(op.start) > w.threshold {
+				op.reported = true
+				blocked = append(blocked, op)
+			}
+		}
+		w.mu.Unlock()
+
+		for _, op := range blocked {
+			w.report("%s blocked for %v", op.name, now.Sub(op.start))
+		}
+		expected = now.Add(interval)
+	}
+}
+
+func (w *watchdog) stats() watchdogStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return watchdogStats{
+		Threshold: duration(w.threshold),
+		Stalls:    w.stalls,
+		MaxLag:    duration(w.maxLag),
+	}
+}
+
+// watchedWriter reports writes blocked longer than the watchdog threshold.
+type watchedWriter struct {
+	name string
+	w    io.Writer
+}
+
+func (ww *watchedWriter) Write(p []byte) (int, error) {
+	op := wd.begin(ww.name)
+	defer wd.end(op)
+	return ww.w.Write(p)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// wizard asks the questions of the init subcommand.
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask returns the answer to the question, def if empty.
+func (w *wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// askChoice asks until the answer is one of choices, case-insensitively.
+func (w *wizard) askChoice(question string, choices []string, def string) (string, error) {
+	for {
+		a, err := w.ask(question+" ("+strings.Join(choices, "/")+")", def)
+		if err != nil {
+			return "", err
+		}
+		for _, c := range choices {
+			if strings.EqualFold(a, c) {
+				return c, nil
+			}
+		}
+		fmt.Fprintf(w.out, "should be one of %s\n", strings.Join(choices, ", "))
+	}
+}
+
+// askInt asks until the answer is an integer not less than least.
+func (w *wizard) askInt(question string, def, least int) (int, error) {
+	for {
+		a, err := w.ask(question, strconv.Itoa(def))
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(a)
+		if err == nil && n >= least {
+			return n, nil
+		}
+		fmt.Fprintf(w.out, "should be an integer of at least %d\n", least)
+	}
+}
+
+func (w *wizard) askYesNo(question string, def bool) (bool, error) {
+	d := "n"
+	if def {
+		d = "y"
+	}
+	a, err := w.askChoice(question, []string{"y", "n"}, d)
+	return a == "y", err
+}
+
+// args asks the test and returns its flags.
+func (w *wizard) args() ([]string, error) {
+	var args []string
+	add := func(flag, value string) {
+		args = append(args, "-"+flag, value)
+	}
+
+	url, err := w.ask("target url, {NUM} is replaced with start~end (ex) rtsp://host:554/{NUM}.stream", "rtsp://localhost:554")
+	if err != nil {
+		return nil, err
+	}
+	add("url", url)
+	if strings.Contains(url, "{NUM}") {
+		start, err := w.askInt("first {NUM}", 1, 0)
+		if err != nil {
+			return nil, err
+		}
+		end, err := w.askInt("last {NUM}", start, start)
+		if err != nil {
+			return nil, err
+		}
+		add("start", strconv.Itoa(start))
+		add("end", strconv.Itoa(end))
+	} else {
+		count, err := w.askInt("number of sessions", 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		add("count", strconv.Itoa(count))
+	}
+
+	interval, err := w.ask("interval between session starts", "10ms")
+	if err != nil {
+		return nil, err
+	}
+	add("start-interval", interval)
+	transport, err := w.askChoice("transport", []string{"UDP", "TCP"}, "UDP")
+	if err != nil {
+		return nil, err
+	}
+	add("transport", transport)
+	cont, err := w.askYesNo("keep running the other sessions when a session fails", true)
+	if err != nil {
+		return nil, err
+	}
+	if cont {
+		args = append(args, "-continue-on-error")
+	}
+
+	outputs := []struct {
+		flag     string
+		question string
+	}{
+		{"log-file", "log file, empty for stderr"},
+		{"report", "html report file (.md for markdown), empty for none"},
+		{"csv-out", "csv file of the session metrics, empty for none"},
+	}
+	for _, o := range outputs {
+		v, err := w.ask(o.question, "")
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			add(o.flag, v)
+		}
+	}
+	return args, nil
+}
+
+// runInit is the init subcommand, "init [file]".
+// It asks a few questions and writes a tenants file of a single tenant,
+// to run with -tenants.
+func runInit(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: rtspclient init [file]")
+	}
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+
+	def := "rtspclient.json"
+	if len(args) == 1 {
+		def = args[0]
+	}
+	path, err := w.ask("config file to write", def)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		ok, err := w.askYesNo(path+" exists, overwrite", false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("canceled")
+		}
+	}
+	name, err := w.ask("test name", "default")
+	if err != nil {
+		return err
+	}
+
+	targs, err := w.args()
+	if err != nil {
+		return err
+	}
+
+	// the same checks as the command line
+	cfg := &config{}
+	fs := newFlagSet(name, cfg, flag.ContinueOnError)
+	if err := parseConfig(fs, targs); err != nil {
+		return err
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(tenantsFile{Tenants: []tenantDef{{Name: name, Args: targs}}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(w.out, "%s written, run with:\n  rtspclient -tenants %s\n", path, path)
+	return nil
+}
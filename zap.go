@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	registerFeature("zap")
+}
+
+// the latency phases of a zap, from the teardown of the channel left to the first RTP packet
+// and to the first decodable keyframe of the channel joined, what the viewer waits for
+const (
+	channelChangePhase         = "channel change"
+	channelChangeKeyframePhase = "channel change idr"
+)
+
+// zapStats are the zaps of the clients of -zap-interval.
+type zapStats struct {
+	mu     sync.Mutex
+	zaps   int
+	failed int
+}
+
+func (z *zapStats) add(ok bool) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.zaps++
+	if !ok {
+		z.failed++
+	}
+}
+
+// zap is the zapping mode of -zap-interval: each of the -count clients plays a random url of the lineup
+// ({NUM} range) for -zap-interval ± -zap-jitter, tears it down and plays another one, -zaps times.
+// The channel change times, to the first packet and to the first decodable keyframe, go to the latency
+// percentiles, a zap without packet before the next one fails.
+func (r *run) zap() error {
+	lineup := r.cfg.urls()
+	r.logger.Printf("zapping: %d clients over %d channels, every %s ± %s, %d zaps each",
+		r.cfg.count, len(lineup), r.cfg.zapInterval, r.cfg.zapJitter, r.cfg.zaps)
+
+	var stats zapStats
+	var wg sync.WaitGroup
+	for i := 0; i < r.cfg.count; i++ {
+		wg.Add(1)
+		rnd := rand.New(rand.NewSource(r.stagger.derive()))
+		go func() {
+			defer wg.Done()
+			r.zapClient(lineup, rnd, &stats)
+		}()
+		r.stagger.wait()
+	}
+	wg.Wait()
+
+	r.logger.Printf(r.cfg.tr("zapping: zaps %d, failed %d"), stats.zaps, stats.failed)
+	return nil
+}
+
+// zapClient plays the channels of a client in turn, the first one is tuned, not zapped.
+func (r *run) zapClient(lineup []string, rnd *rand.Rand, stats *zapStats) {
+	defer exitOnPanic()
+	url := ""
+	var zapped time.Time
+	for n := 0; n <= r.cfg.zaps; n++ {
+		url = nextChannel(lineup, url, rnd)
+		id := url + ":" + strconv.FormatInt(atomic.AddInt64(&r.seq, 1)-1, 10)
+		s := r.newSession(url, id)
+		first := make(chan time.Time, 1)
+		s.onFirstPacket = func(now time.Time) {
+			first <- now
+		}
+		if from := zapped; !from.IsZero() {
+			s.onFirstKeyframe = func(now time.Time) {
+				d := now.Sub(from)
+				s.summaryf("channel change to keyframe: %s", r.cfg.human().duration(d))
+				r.latency.record(map[string]duration{channelChangeKeyframePhase: duration(d)})
+			}
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			r.play(s)
+		}()
+
+		dwell := time.NewTimer(zapDwell(r.cfg.zapInterval, r.cfg.zapJitter, rnd))
+		joined := false
+		select {
+		case now := <-first:
+			joined = true
+			if !zapped.IsZero() {
+				d := now.Sub(zapped)
+				s.summaryf("channel change: %s", r.cfg.human().duration(d))
+				r.latency.record(map[string]duration{channelChangePhase: duration(d)})
+			}
+			select {
+			case <-dwell.C:
+			case <-done:
+			}
+		case <-dwell.C:
+		case <-done:
+		}
+		dwell.Stop()
+		if !zapped.IsZero() {
+			if !joined {
+				s.logf("channel change failed, no rtp packet")
+			}
+			stats.add(joined)
+		}
+		zapped = time.Now()
+		s.teardown()
+		<-done
+	}
+}
+
+// nextChannel returns a random url of the lineup other than the current one.
+func nextChannel(lineup []string, current string, rnd *rand.Rand) string {
+	for {
+		url := lineup[rnd.Intn(len(lineup))]
+		if url != current || len(lineup) == 1 {
+			return url
+		}
+	}
+}
+
+// zapDwell returns the time on a channel, uniform in interval ± jitter.
+func zapDwell(interval, jitter time.Duration, rnd *rand.Rand) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval - jitter + time.Duration(rnd.Int63n(int64(2*jitter)+1))
+}